@@ -0,0 +1,282 @@
+// Package audit ведет журнал всех кадров, переданных контроллерам: одна запись
+// JSON на строку, только дозапись. По журналу восстанавливается ход событий на
+// стрельбище: кто, когда, на какую линию и что отправил и что ответил контроллер
+package audit
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tir/logging"
+)
+
+// DefaultFile файл журнала по умолчанию
+const DefaultFile = "audit.jsonl"
+
+// File текущий файл журнала; пустое имя отключает запись
+var File = DefaultFile
+
+// Source источник отправки
+type Source string
+
+const (
+	SourceMenu     Source = "menu"     // Ручная отправка из меню
+	SourceDebug    Source = "debug"    // Отладочная отправка из меню
+	SourceAuto     Source = "auto"     // Автоматический режим (пульт и дистанция из меню)
+	SourceFirebase Source = "firebase" // Изменение дистанции в Firebase
+	SourceAPI      Source = "api"      // Локальный API (tir serve)
+	SourceEstop    Source = "estop"    // Аварийная остановка
+	SourceReplay   Source = "replay"   // Воспроизведение записи обмена (tir capture replay)
+)
+
+// Outcome итог передачи
+type Outcome string
+
+const (
+	OutcomeConfirmed Outcome = "confirmed" // Кадр отправлен, контроллер ответил
+	OutcomeNoReply   Outcome = "no-reply"  // Кадр отправлен, ответа нет
+	OutcomeError     Outcome = "error"     // Кадр не отправлен: ошибка порта или записи
+)
+
+// Entry запись журнала. Байты хранятся строками HEX
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Lane      int       `json:"lane"`
+	Port      string    `json:"port"`
+	BaudRate  uint32    `json:"baud"`
+	Scenario  string    `json:"scenario"`
+	Source    Source    `json:"source"`
+	Frame     string    `json:"frame"`
+	Handshake string    `json:"handshake,omitempty"` // Байты инициализации, отправленные перед кадром
+	Reply     string    `json:"reply,omitempty"`     // Ответ контроллера
+	Outcome   Outcome   `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// NewEntry заполняет запись по результату передачи
+func NewEntry(source Source, lane int, port string, baudRate uint32, scenario string,
+	frame, handshake, reply []byte, err error) Entry {
+	entry := Entry{
+		Time:      time.Now(),
+		Lane:      lane,
+		Port:      port,
+		BaudRate:  baudRate,
+		Scenario:  scenario,
+		Source:    source,
+		Frame:     hexString(frame),
+		Handshake: hexString(handshake),
+		Reply:     hexString(reply),
+	}
+
+	switch {
+	case err != nil:
+		entry.Outcome = OutcomeError
+		entry.Error = err.Error()
+	case len(reply) > 0:
+		entry.Outcome = OutcomeConfirmed
+	default:
+		entry.Outcome = OutcomeNoReply
+	}
+	return entry
+}
+
+func hexString(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	return strings.ToUpper(hex.EncodeToString(data))
+}
+
+var logger = logging.For("audit")
+
+// Запись в журнал сериализуется, чтобы строки параллельных отправок не смешивались
+var mu sync.Mutex
+
+// Record дописывает запись в журнал. Ошибка записи не прерывает отправку,
+// а только попадает в диагностический журнал
+func Record(entry Entry) {
+	if err := Append(File, entry); err != nil {
+		logger.Error("Не удалось записать журнал аудита", "file", File, "error", err)
+	}
+}
+
+// Append дописывает запись в заданный файл журнала
+func Append(fileName string, entry Entry) error {
+	if fileName == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Filter условия отбора записей; пустые поля не ограничивают отбор
+type Filter struct {
+	Since    time.Time
+	Until    time.Time
+	Lane     int
+	Port     string
+	Scenario string // Подстрока имени сценария
+	Source   Source
+	Outcome  Outcome
+}
+
+// Match проверяет запись на соответствие условиям
+func (f Filter) Match(entry Entry) bool {
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.Time.Before(f.Until) {
+		return false
+	}
+	if f.Lane != 0 && entry.Lane != f.Lane {
+		return false
+	}
+	if f.Port != "" && !strings.EqualFold(entry.Port, f.Port) {
+		return false
+	}
+	if f.Scenario != "" && !strings.Contains(entry.Scenario, f.Scenario) {
+		return false
+	}
+	if f.Source != "" && entry.Source != f.Source {
+		return false
+	}
+	if f.Outcome != "" && entry.Outcome != f.Outcome {
+		return false
+	}
+	return true
+}
+
+// Read читает записи журнала, подходящие под условия. Поврежденные строки
+// (например, оборванные при отключении питания) пропускаются и считаются
+func Read(fileName string, filter Filter) (entries []Entry, skipped int, err error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			skipped++
+			continue
+		}
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, skipped, scanner.Err()
+}
+
+// ParseTime разбирает границу периода: дата и время ("2006-01-02 15:04",
+// "2006-01-02", RFC 3339) в местном времени или давность ("2h", "30m")
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("неверное время '%s' (ожидается 2006-01-02 15:04, RFC 3339 или давность вида 2h)", value)
+}
+
+// WriteTable выводит записи таблицей для оператора
+func WriteTable(w io.Writer, entries []Entry) {
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s  линия %d  %-6s %-8s %-9s %s\n",
+			e.Time.Local().Format("2006-01-02 15:04:05"), e.Lane, e.Port, e.Source, e.Outcome, e.Scenario)
+		fmt.Fprintf(w, "    кадр: %s\n", spaced(e.Frame))
+		if e.Handshake != "" {
+			fmt.Fprintf(w, "    инициализация: %s\n", spaced(e.Handshake))
+		}
+		if e.Reply != "" {
+			fmt.Fprintf(w, "    ответ: %s\n", spaced(e.Reply))
+		}
+		if e.Error != "" {
+			fmt.Fprintf(w, "    ошибка: %s\n", e.Error)
+		}
+	}
+}
+
+// spaced разделяет байты HEX-строки пробелами
+func spaced(hexText string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(hexText); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(hexText[i : i+2])
+	}
+	return b.String()
+}
+
+// WriteJSON выгружает записи в формате журнала (JSON по строке на запись)
+func WriteJSON(w io.Writer, entries []Entry) error {
+	encoder := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCSV выгружает записи в CSV с заголовком
+func WriteCSV(w io.Writer, entries []Entry) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"time", "lane", "port", "baud", "scenario", "source",
+		"frame", "handshake", "reply", "outcome", "error"})
+	for _, e := range entries {
+		writer.Write([]string{
+			e.Time.Format(time.RFC3339Nano),
+			strconv.Itoa(e.Lane),
+			e.Port,
+			strconv.FormatUint(uint64(e.BaudRate), 10),
+			e.Scenario,
+			string(e.Source),
+			e.Frame,
+			e.Handshake,
+			e.Reply,
+			string(e.Outcome),
+			e.Error,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilterMatch(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	entry := Entry{
+		Time:     base,
+		Lane:     2,
+		Port:     "COM4",
+		Scenario: "test5 30m park",
+		Source:   SourceFirebase,
+		Outcome:  OutcomeConfirmed,
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"без условий", Filter{}, true},
+		{"начало периода включается", Filter{Since: base}, true},
+		{"запись раньше периода", Filter{Since: base.Add(time.Second)}, false},
+		{"конец периода не включается", Filter{Until: base}, false},
+		{"запись до конца периода", Filter{Until: base.Add(time.Second)}, true},
+		{"линия", Filter{Lane: 2}, true},
+		{"другая линия", Filter{Lane: 1}, false},
+		{"порт без учета регистра", Filter{Port: "com4"}, true},
+		{"другой порт", Filter{Port: "COM3"}, false},
+		{"подстрока сценария", Filter{Scenario: "30m"}, true},
+		{"другой сценарий", Filter{Scenario: "10m"}, false},
+		{"источник", Filter{Source: SourceFirebase}, true},
+		{"другой источник", Filter{Source: SourceMenu}, false},
+		{"итог", Filter{Outcome: OutcomeConfirmed}, true},
+		{"другой итог", Filter{Outcome: OutcomeError}, false},
+		{"все условия", Filter{Since: base, Lane: 2, Port: "COM4", Source: SourceFirebase}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(entry); got != tt.want {
+				t.Errorf("Match = %v, ожидалось %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEntryOutcome(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply []byte
+		err   error
+		want  Outcome
+	}{
+		{"ответ получен", []byte{0x06}, nil, OutcomeConfirmed},
+		{"без ответа", nil, nil, OutcomeNoReply},
+		{"ошибка", []byte{0x06}, errors.New("порт занят"), OutcomeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := NewEntry(SourceMenu, 1, "COM4", 4800, "тест", []byte{0x7E, 0x00}, nil, tt.reply, tt.err)
+			if entry.Outcome != tt.want {
+				t.Errorf("итог %s, ожидался %s", entry.Outcome, tt.want)
+			}
+			if entry.Frame != "7E00" {
+				t.Errorf("кадр '%s'", entry.Frame)
+			}
+		})
+	}
+}
+
+func TestReadSkipsDamagedLines(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "audit.jsonl")
+	for _, lane := range []int{1, 2, 1} {
+		if err := Append(fileName, NewEntry(SourceAPI, lane, "COM4", 4800, "тест", []byte{0x7E}, nil, nil, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Строка, оборванная при отключении питания, и пустая строка
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("{\"time\": \"2026\n\n")
+	file.Close()
+
+	entries, skipped, err := Read(fileName, Filter{Lane: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || skipped != 1 {
+		t.Errorf("прочитано %d записей, пропущено %d; ожидалось 2 и 1", len(entries), skipped)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2h", now.Add(-2 * time.Hour)},
+		{"30m", now.Add(-30 * time.Minute)},
+		{"2026-02-28", time.Date(2026, 2, 28, 0, 0, 0, 0, time.Local)},
+		{"2026-02-28 08:15", time.Date(2026, 2, 28, 8, 15, 0, 0, time.Local)},
+		{"2026-02-28 08:15:30", time.Date(2026, 2, 28, 8, 15, 30, 0, time.Local)},
+		{"2026-02-28T08:15:00Z", time.Date(2026, 2, 28, 8, 15, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTime(tt.value, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("%v, ожидалось %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseTime("вчера", now); err == nil {
+		t.Error("'вчера': ожидалась ошибка")
+	}
+}
@@ -1,209 +1,94 @@
 package auto
 
 import (
+	"errors"
 	"fmt"
-	"strconv"
-	"strings"
-	"time"
+	"sort"
+	"tir/audit"
 	"tir/comport"
+	"tir/logging"
+	"tir/metrics"
 	"tir/models"
+	"tir/sender"
 )
 
-// Константы для префиксов автоматизированных сценариев
-const (
-	AutoPrefix = "AUTO_P" // Префикс автоматических сценариев
-)
+var logger = logging.For("auto")
 
-// FindScenarioByDistanceAndPulse находит сценарий по дистанции и типу пульта
-func FindScenarioByDistanceAndPulse(scenarios map[string]models.Scenario, distance int, pulseType byte) (string, bool) {
-	// Сначала ищем по специальному формату имени для автоматизации
-	autoName := fmt.Sprintf("%s%d_%dM", AutoPrefix, pulseType, distance)
-	if scenario, exists := scenarios[autoName]; exists && scenario.PulseType == pulseType {
-		return autoName, true
-	}
-
-	// Ищем по стандартным форматам имени
-	formats := []string{
-		fmt.Sprintf("Сценарий %dм пульт %d", distance, pulseType),
-		fmt.Sprintf("Сценарий %dм", distance),
-	}
-
-	for _, format := range formats {
-		for name, scenario := range scenarios {
-			if strings.HasPrefix(name, format) && scenario.PulseType == pulseType {
-				return name, true
-			}
-		}
-	}
+// resolutions выбор сценариев автоматическим режимом по итогам:
+// stored - сохраненный сценарий, synthesized - синтез кадра, failed - сценария нет
+var resolutions = metrics.NewCounter("tir_auto_resolutions_total",
+	"Выбор сценария по пульту и дистанции (stored, synthesized, failed)", "result")
 
-	// Если точное совпадение не найдено, ищем по начальной части имени и типу пульта
-	searchName := fmt.Sprintf("%d", distance)
-	for name, scenario := range scenarios {
-		if strings.Contains(name, searchName) && scenario.PulseType == pulseType {
-			return name, true
-		}
-	}
-
-	return "", false
+// FindScenarioByDistanceAndPulse находит сценарий по дистанции и типу пульта
+// для линии с тем же номером. Выбор идет только по таблице разрешения: при
+// отсутствии или неоднозначности соответствия возвращается ошибка, а не
+// наиболее похожее имя
+func FindScenarioByDistanceAndPulse(scenarios map[string]models.Scenario, distance int, pulseType byte) (string, error) {
+	return BuildResolutionTable(scenarios).Resolve(ResolutionQuery{
+		PulseType: pulseType,
+		Distance:  distance,
+		Lane:      int(pulseType),
+	})
 }
 
-// SendScenarioAuto отправляет сценарий в автоматическом режиме
-func SendScenarioAuto(scenarios map[string]models.Scenario, portName string, baudRate uint32, pulseType byte, distance int) error {
-	fmt.Printf("Поиск сценария для дистанции %d м и пульта типа %d...\n", distance, pulseType)
-
-	// Находим подходящий сценарий
-	scenarioName, found := FindScenarioByDistanceAndPulse(scenarios, distance, pulseType)
-	if !found {
-		return fmt.Errorf("сценарий для дистанции %d м и пульта типа %d не найден", distance, pulseType)
-	}
-
-	fmt.Printf("Найден сценарий: %s\n", scenarioName)
-
-	// Открываем COM порт
-	fmt.Printf("Подключение к %s со скоростью %d бод...\n", portName, baudRate)
-	handle, err := comport.OpenPort(portName)
-	if err != nil {
-		return fmt.Errorf("ошибка открытия порта: %v", err)
+// ResolveScenarioAuto выбирает сценарий для пульта и дистанции по таблице разрешения,
+// а если сохраненного сценария нет - синтезирует кадр (если синтез разрешен)
+func ResolveScenarioAuto(scenarios map[string]models.Scenario, pulseType byte, distance int) (models.Scenario, error) {
+	scenarioName, err := FindScenarioByDistanceAndPulse(scenarios, distance, pulseType)
+	if err == nil {
+		resolutions.Inc("stored")
+		scenario := scenarios[scenarioName]
+		scenario.Name = scenarioName
+		return scenario, nil
 	}
-	defer comport.ClosePort(handle)
 
-	// Установка параметров порта
-	err = comport.SetCommParams(handle, baudRate)
-	if err != nil {
-		return fmt.Errorf("ошибка установки параметров: %v", err)
+	if !errors.Is(err, ErrNoScenario) {
+		// Неоднозначное соответствие не отправляем и не подменяем синтезом
+		resolutions.Inc("failed")
+		return models.Scenario{}, err
 	}
 
-	// Установка таймаутов
-	err = comport.SetCommTimeouts(handle)
-	if err != nil {
-		return fmt.Errorf("ошибка установки таймаутов: %v", err)
-	}
-
-	fmt.Println("Порт успешно открыт")
-
-	// Очищаем буферы
-	comport.PurgeComm(handle)
-
-	// Имитация цикла инициализации
-	buffer := make([]byte, 64)
-	fmt.Println("Выполнение последовательности инициализации...")
-	for i := 0; i < 10; i++ {
-		_, _ = comport.ReadPort(handle, buffer)
-		time.Sleep(time.Millisecond * 16)
+	// Сохраненного сценария нет - пробуем синтезировать кадр, если это разрешено
+	synthesized, synthErr := SynthesizeScenario(SynthesisSettings(), pulseType, distance)
+	if synthErr != nil {
+		resolutions.Inc("failed")
+		return models.Scenario{}, fmt.Errorf("%v (синтез невозможен: %v)", err, synthErr)
 	}
+	resolutions.Inc("synthesized")
+	logger.Info("Сценарий синтезирован", "scenario", synthesized.Name, "pulse", pulseType, "distance", distance)
+	return synthesized, nil
+}
 
-	// Отправляем инициализационный пакет
-	initPacket := []byte{0x7E, 0xAA}
-	fmt.Println("Отправка инициализационного пакета...")
-	_, err = comport.WritePort(handle, initPacket)
+// SendScenarioAuto отправляет сценарий в автоматическом режиме.
+// source указывает источник отправки для журнала аудита
+func SendScenarioAuto(scenarios map[string]models.Scenario, portName string, baudRate uint32, pulseType byte, distance int, source audit.Source) error {
+	scenario, err := ResolveScenarioAuto(scenarios, pulseType, distance)
 	if err != nil {
-		return fmt.Errorf("ошибка отправки инициализационного пакета: %v", err)
+		return err
 	}
+	logger.Debug("Найден сценарий", "scenario", scenario.Name, "pulse", pulseType, "distance", distance)
 
-	// Пауза после инициализации
-	time.Sleep(time.Millisecond * 500)
-	comport.PurgeComm(handle)
-
-	// Получаем данные сценария
-	scenarioObj := scenarios[scenarioName]
-	scenarioData := scenarioObj.RawData
-
-	// Проверяем, есть ли у сценария сырые данные
-	if len(scenarioData) == 0 {
-		return fmt.Errorf("ошибка: у сценария отсутствуют данные для отправки")
-	}
-
-	fmt.Printf("Отправка сценария '%s'...\n", scenarioName)
-	n, err := comport.WritePort(handle, scenarioData)
+	// Отправка через общий отправитель: доступ к порту сериализуется,
+	// поэтому параллельные отправки не смешиваются на одном контроллере.
+	// Сценарии с ошибками анализа в автоматическом режиме не отправляются
+	reply, err := sender.SendScenario(portName, baudRate, scenario, false, source)
 	if err != nil {
-		return fmt.Errorf("ошибка отправки сценария: %v", err)
-	}
-
-	fmt.Printf("Отправлено %d байт\n", n)
-	fmt.Println("Сценарий успешно отправлен")
-
-	// Печатаем отправленные данные для отладки
-	fmt.Print("Отправленные данные: ")
-	for _, b := range scenarioData {
-		fmt.Printf("%02X ", b)
-	}
-	fmt.Println()
-
-	// Ожидаем ответа от устройства
-	fmt.Println("Ожидание ответа...")
-	for i := 0; i < 10; i++ {
-		n, _ := comport.ReadPort(handle, buffer)
-		if n > 0 {
-			fmt.Printf("Получен ответ (%d байт): % X\n", n, buffer[:n])
-			break
-		}
-		time.Sleep(time.Millisecond * 100)
+		return err
 	}
 
-	fmt.Println("Закрытие порта...")
+	logger.Info("Сценарий отправлен", "scenario", scenario.Name, "source", source,
+		"reply", fmt.Sprintf("% X", reply))
 	return nil
 }
 
-// PrepareForAutomation подготавливает сценарии для автоматизации
-func PrepareForAutomation(scenarios map[string]models.Scenario) map[string]models.Scenario {
-	// Создаем специальные AUTO-сценарии из существующих
-	for name, scenario := range scenarios {
-		// Извлекаем информацию о дистанции из имени
-		if strings.Contains(name, "м") && scenario.PulseType > 0 {
-			distStr := ""
-			for _, char := range name {
-				if char >= '0' && char <= '9' {
-					distStr += string(char)
-				} else if len(distStr) > 0 && (char == 'м' || char == 'M') {
-					break
-				}
-			}
-
-			// Если удалось извлечь дистанцию, создаем AUTO-сценарий
-			if distance, err := strconv.Atoi(distStr); err == nil && distance > 0 {
-				autoName := fmt.Sprintf("%s%d_%dM", AutoPrefix, scenario.PulseType, distance)
-
-				// Проверяем, существует ли уже такой сценарий
-				if _, exists := scenarios[autoName]; !exists {
-					// Создаем копию сценария с AUTO-именем
-					autoScenario := models.Scenario{
-						Name:      autoName,
-						PulseType: scenario.PulseType,
-						RawData:   make([]byte, len(scenario.RawData)),
-						Commands:  make([]models.Command, len(scenario.Commands)),
-					}
-
-					// Копируем данные
-					copy(autoScenario.RawData, scenario.RawData)
-					copy(autoScenario.Commands, scenario.Commands)
-
-					// Добавляем AUTO-сценарий в коллекцию
-					scenarios[autoName] = autoScenario
-					fmt.Printf("Создан AUTO-сценарий: %s (на основе %s)\n", autoName, name)
-				}
-			}
-		}
-	}
-
-	return scenarios
-}
-
 // AutoModeMenu выводит меню автоматического режима
 func AutoModeMenu(scenarios map[string]models.Scenario) {
-	// Подготовка сценариев для автоматизации
-	scenarios = PrepareForAutomation(scenarios)
-
 	fmt.Println("\nАвтоматический режим")
 	fmt.Println("===================")
 
 	// Настройки порта
-	portName := "COM4" // По умолчанию COM4
-	fmt.Print("Введите имя порта (по умолчанию COM4): ")
+	portName := comport.PromptPort("COM4")
 	var input string
-	fmt.Scanln(&input)
-	if input != "" {
-		portName = input
-	}
 
 	// Выбор скорости
 	baudRate := uint32(4800) // По умолчанию 4800 бод
@@ -220,7 +105,9 @@ func AutoModeMenu(scenarios map[string]models.Scenario) {
 	for {
 		fmt.Println("\nВыберите действие:")
 		fmt.Println("1. Отправить сценарий по параметрам")
-		fmt.Println("2. Показать доступные AUTO-сценарии")
+		fmt.Println("2. Показать сценарии с заданной дистанцией")
+		fmt.Println("3. Таблица разрешения (пробелы и неоднозначности)")
+		fmt.Println("4. Настройки синтеза сценариев")
 		fmt.Println("0. Вернуться в главное меню")
 
 		var choice string
@@ -249,25 +136,22 @@ func AutoModeMenu(scenarios map[string]models.Scenario) {
 			}
 
 			// Отправляем сценарий
-			err := SendScenarioAuto(scenarios, portName, baudRate, byte(pulseType), distance)
+			err := SendScenarioAuto(scenarios, portName, baudRate, byte(pulseType), distance, audit.SourceAuto)
 			if err != nil {
 				fmt.Printf("Ошибка: %v\n", err)
+			} else {
+				fmt.Println("Сценарий успешно отправлен")
 			}
 
 		case "2":
-			// Показываем AUTO-сценарии
-			fmt.Println("\nДоступные AUTO-сценарии:")
-			count := 0
-			for name, scenario := range scenarios {
-				if strings.HasPrefix(name, AutoPrefix) {
-					fmt.Printf("%s (Пульт: %d)\n", name, scenario.PulseType)
-					count++
-				}
-			}
+			// Показываем сценарии, пригодные для автоматического режима
+			ShowAutoScenarios(scenarios)
 
-			if count == 0 {
-				fmt.Println("AUTO-сценарии не найдены")
-			}
+		case "3":
+			BuildResolutionTable(scenarios).PrintReport(MinReportDistance, MaxReportDistance)
+
+		case "4":
+			SynthesisMenu()
 
 		case "0":
 			return
@@ -277,3 +161,36 @@ func AutoModeMenu(scenarios map[string]models.Scenario) {
 		}
 	}
 }
+
+// ShowAutoScenarios выводит сценарии с заданной дистанцией, сгруппированные по пульту
+func ShowAutoScenarios(scenarios map[string]models.Scenario) {
+	fmt.Println("\nСценарии с заданной дистанцией:")
+
+	var names []string
+	for name, scenario := range scenarios {
+		if scenario.Distance > 0 {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		fmt.Println("Сценарии с заданной дистанцией не найдены")
+		return
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		a, b := scenarios[names[i]], scenarios[names[j]]
+		if a.PulseType != b.PulseType {
+			return a.PulseType < b.PulseType
+		}
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		scenario := scenarios[name]
+		fmt.Printf("Пульт %d, %d м: %s\n", scenario.PulseType, scenario.Distance, name)
+	}
+}
@@ -0,0 +1,325 @@
+package auto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"tir/models"
+	"tir/protocol"
+)
+
+// Пределы дистанций, для которых отчет ищет пробелы в таблице
+const (
+	MinReportDistance = 3  // Минимальная дистанция (м)
+	MaxReportDistance = 65 // Максимальная дистанция (м)
+)
+
+// ErrNoScenario возвращается, если для пары (пульт, дистанция) нет сценария
+var ErrNoScenario = errors.New("сценарий не найден")
+
+// ResolutionKey метаданные, по которым выбирается сценарий: пульт и дистанция,
+// а также линия, тип упражнения и метки
+type ResolutionKey struct {
+	PulseType byte
+	Distance  int
+	Lane      int    // Номер линии, 0 - любая
+	DrillType string // Тип упражнения, пусто - не задан
+	Tags      string // Метки через запятую в алфавитном порядке
+}
+
+// String описывает ключ для отчета
+func (k ResolutionKey) String() string {
+	text := fmt.Sprintf("Пульт %d, %d м", k.PulseType, k.Distance)
+	if k.Lane > 0 {
+		text += fmt.Sprintf(", линия %d", k.Lane)
+	}
+	if k.DrillType != "" {
+		text += ", тип: " + k.DrillType
+	}
+	if k.Tags != "" {
+		text += ", метки: " + k.Tags
+	}
+	return text
+}
+
+// resolutionKey возвращает ключ сценария по его метаданным
+func resolutionKey(scenario models.Scenario) ResolutionKey {
+	tags := append([]string(nil), scenario.Tags...)
+	sort.Strings(tags)
+	return ResolutionKey{
+		PulseType: scenario.PulseType,
+		Distance:  scenario.Distance,
+		Lane:      scenario.Lane,
+		DrillType: scenario.DrillType,
+		Tags:      strings.Join(tags, ","),
+	}
+}
+
+// ResolutionQuery запрос выбора сценария. Lane, DrillType и Tags сужают
+// выбор: сценарий линии 0 подходит любой линии, пустые тип и метки запроса -
+// любым. Из подходящих выбираются точные совпадения (сначала по линии,
+// затем по типу упражнения и меткам), поэтому общий сценарий без типа
+// упражнения выбирается, пока тип не задан в запросе
+type ResolutionQuery struct {
+	PulseType byte
+	Distance  int
+	Lane      int
+	DrillType string
+	Tags      []string
+}
+
+// ResolutionTable таблица однозначного выбора сценария для автоматического режима.
+// Строится по метаданным сценария (дистанция из CMD_SET_RANGE), а не по имени
+type ResolutionTable struct {
+	Entries     map[ResolutionKey]string   // Однозначные соответствия
+	Ambiguities map[ResolutionKey][]string // Несколько разных кадров с одинаковыми метаданными
+	Skipped     map[string]string          // Сценарии, не попавшие в таблицу, и причина
+}
+
+// BuildResolutionTable строит таблицу разрешения по всем сценариям.
+// Сценарии с одинаковыми данными кадра считаются одним (например, копии),
+// разные кадры с одинаковыми метаданными (пульт, дистанция, линия, тип
+// упражнения, метки) попадают в неоднозначности
+func BuildResolutionTable(scenarios map[string]models.Scenario) *ResolutionTable {
+	table := &ResolutionTable{
+		Entries:     make(map[ResolutionKey]string),
+		Ambiguities: make(map[ResolutionKey][]string),
+		Skipped:     make(map[string]string),
+	}
+
+	// Обходим имена в отсортированном порядке, чтобы результат не зависел от порядка карты
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	candidates := make(map[ResolutionKey][]string)
+	for _, name := range names {
+		scenario := scenarios[name]
+
+		if len(scenario.RawData) == 0 {
+			table.Skipped[name] = "нет данных кадра"
+			continue
+		}
+
+		// Дистанция берется из метаданных сценария, заполненных при импорте
+		if scenario.Distance <= 0 {
+			reason := "дистанция не задана"
+			if _, err := protocol.RangeDistance(scenario.Commands); err != nil {
+				reason += ": " + err.Error()
+			}
+			table.Skipped[name] = reason
+			continue
+		}
+
+		key := resolutionKey(scenario)
+		candidates[key] = append(candidates[key], name)
+	}
+
+	for key, names := range candidates {
+		// Оставляем по одному имени на каждый различный кадр
+		var distinct []string
+		for _, name := range names {
+			duplicate := false
+			for _, kept := range distinct {
+				if bytes.Equal(scenarios[kept].RawData, scenarios[name].RawData) {
+					duplicate = true
+					break
+				}
+			}
+			if !duplicate {
+				distinct = append(distinct, name)
+			}
+		}
+
+		if len(distinct) == 1 {
+			table.Entries[key] = distinct[0]
+		} else {
+			table.Ambiguities[key] = distinct
+		}
+	}
+
+	return table
+}
+
+// Resolve возвращает имя сценария по запросу.
+// Ошибка возвращается, если соответствия нет или оно неоднозначно
+func (t *ResolutionTable) Resolve(query ResolutionQuery) (string, error) {
+	var best []ResolutionKey
+	bestRank := -1
+	for _, key := range t.keys() {
+		rank, matches := query.match(key)
+		switch {
+		case !matches || rank < bestRank:
+		case rank > bestRank:
+			best, bestRank = []ResolutionKey{key}, rank
+		default:
+			best = append(best, key)
+		}
+	}
+
+	if len(best) == 0 {
+		return "", fmt.Errorf("%w: дистанция %d м, пульт типа %d", ErrNoScenario, query.Distance, query.PulseType)
+	}
+	if len(best) == 1 {
+		if names, ambiguous := t.Ambiguities[best[0]]; ambiguous {
+			return "", fmt.Errorf("неоднозначный выбор для дистанции %d м и пульта %d: %v",
+				query.Distance, query.PulseType, names)
+		}
+		return t.Entries[best[0]], nil
+	}
+
+	var names []string
+	for _, key := range best {
+		if name, exists := t.Entries[key]; exists {
+			names = append(names, name)
+		} else {
+			names = append(names, t.Ambiguities[key]...)
+		}
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("неоднозначный выбор для дистанции %d м и пульта %d (задайте линию, тип упражнения или метки): %v",
+		query.Distance, query.PulseType, names)
+}
+
+// keys возвращает ключи однозначных и неоднозначных соответствий
+func (t *ResolutionTable) keys() []ResolutionKey {
+	keys := make([]ResolutionKey, 0, len(t.Entries)+len(t.Ambiguities))
+	for key := range t.Entries {
+		keys = append(keys, key)
+	}
+	for key := range t.Ambiguities {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// match проверяет, подходит ли ключ запросу, и возвращает точность совпадения:
+// совпадение линии весит больше совпадения типа упражнения, а оно - меток
+func (q ResolutionQuery) match(key ResolutionKey) (rank int, matches bool) {
+	if key.PulseType != q.PulseType || key.Distance != q.Distance {
+		return 0, false
+	}
+	if key.Lane != 0 && q.Lane != 0 && key.Lane != q.Lane {
+		return 0, false
+	}
+	if q.DrillType != "" && key.DrillType != q.DrillType {
+		return 0, false
+	}
+	var keyTags []string
+	if key.Tags != "" {
+		keyTags = strings.Split(key.Tags, ",")
+	}
+	for _, tag := range q.Tags {
+		if !containsString(keyTags, tag) {
+			return 0, false
+		}
+	}
+
+	if key.Lane == q.Lane {
+		rank += 4
+	}
+	if key.DrillType == q.DrillType {
+		rank += 2
+	}
+	if len(keyTags) == len(q.Tags) {
+		rank++
+	}
+	return rank, true
+}
+
+// containsString проверяет наличие строки в списке
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Gaps возвращает пары (пульт, дистанция) из заданного диапазона, для которых
+// автоматический режим (линия равна номеру пульта, без типа упражнения и меток)
+// не находит ни одного сценария
+func (t *ResolutionTable) Gaps(minDistance, maxDistance int) []ResolutionKey {
+	var gaps []ResolutionKey
+	for pulseType := byte(models.PULSE_1); pulseType <= models.PULSE_6; pulseType++ {
+		for distance := minDistance; distance <= maxDistance; distance++ {
+			query := ResolutionQuery{PulseType: pulseType, Distance: distance, Lane: int(pulseType)}
+			if _, err := t.Resolve(query); errors.Is(err, ErrNoScenario) {
+				gaps = append(gaps, ResolutionKey{PulseType: pulseType, Distance: distance})
+			}
+		}
+	}
+	return gaps
+}
+
+// PrintReport выводит таблицу разрешения, неоднозначности и пробелы
+func (t *ResolutionTable) PrintReport(minDistance, maxDistance int) {
+	fmt.Println("\nТаблица разрешения (пульт, дистанция, линия, тип, метки) -> сценарий")
+	fmt.Println("=================================================")
+
+	keys := make([]ResolutionKey, 0, len(t.Entries))
+	for key := range t.Entries {
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+	for _, key := range keys {
+		fmt.Printf("%s: %s\n", key, t.Entries[key])
+	}
+
+	fmt.Printf("\nНеоднозначности: %d\n", len(t.Ambiguities))
+	keys = keys[:0]
+	for key := range t.Ambiguities {
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+	for _, key := range keys {
+		fmt.Printf("  %s: %v\n", key, t.Ambiguities[key])
+	}
+
+	// Пробелы выводим по пультам одной строкой
+	fmt.Printf("\nПробелы в диапазоне %d-%d м:\n", minDistance, maxDistance)
+	byPulse := make(map[byte][]int)
+	for _, key := range t.Gaps(minDistance, maxDistance) {
+		byPulse[key.PulseType] = append(byPulse[key.PulseType], key.Distance)
+	}
+	for pulseType := byte(models.PULSE_1); pulseType <= models.PULSE_6; pulseType++ {
+		if distances, exists := byPulse[pulseType]; exists {
+			fmt.Printf("  Пульт %d: %v\n", pulseType, distances)
+		}
+	}
+
+	if len(t.Skipped) > 0 {
+		fmt.Printf("\nНе вошли в таблицу: %d сценариев\n", len(t.Skipped))
+		names := make([]string, 0, len(t.Skipped))
+		for name := range t.Skipped {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  %s: %s\n", name, t.Skipped[name])
+		}
+	}
+}
+
+// sortKeys упорядочивает ключи по пульту, дистанции, затем по остальным метаданным
+func sortKeys(keys []ResolutionKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch {
+		case a.PulseType != b.PulseType:
+			return a.PulseType < b.PulseType
+		case a.Distance != b.Distance:
+			return a.Distance < b.Distance
+		case a.Lane != b.Lane:
+			return a.Lane < b.Lane
+		case a.DrillType != b.DrillType:
+			return a.DrillType < b.DrillType
+		}
+		return a.Tags < b.Tags
+	})
+}
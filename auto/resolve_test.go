@@ -0,0 +1,170 @@
+package auto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"tir/models"
+	"tir/protocol"
+)
+
+// resolveScenario создает сценарий с установкой рубежа и заданными метаданными;
+// lightOn отличает кадры с одинаковыми метаданными
+func resolveScenario(t *testing.T, pulseType byte, distance, lane int, drillType string, lightOn bool, tags ...string) models.Scenario {
+	t.Helper()
+	scenario := models.Scenario{
+		PulseType: pulseType,
+		Lane:      lane,
+		DrillType: drillType,
+		Tags:      tags,
+	}
+	codes := []uint16{models.CMD_SET_RANGE, uint16(distance * 100)}
+	if lightOn {
+		codes = append(codes, models.CMD_LIGHT_ON, 0)
+	}
+	for i := 0; i < len(codes); i += 2 {
+		cmd, err := models.NewCommand(codes[i], codes[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		scenario.Commands = append(scenario.Commands, cmd)
+	}
+	scenario.RawData = protocol.GenerateScenarioPacket(scenario)
+	protocol.FillMetadata(&scenario)
+	return scenario
+}
+
+func TestResolveMetadata(t *testing.T) {
+	scenarios := map[string]models.Scenario{
+		"общий":      resolveScenario(t, models.PULSE_1, 10, 0, "", false),
+		"тренировка": resolveScenario(t, models.PULSE_1, 10, 0, "тренировка", true),
+		"зачет":      resolveScenario(t, models.PULSE_1, 10, 0, "зачет", false, "ночь"),
+		"линия 2":    resolveScenario(t, models.PULSE_1, 10, 2, "", true),
+		"тип А":      resolveScenario(t, models.PULSE_2, 15, 0, "А", false),
+		"тип Б":      resolveScenario(t, models.PULSE_2, 15, 0, "Б", true),
+	}
+	table := BuildResolutionTable(scenarios)
+	if len(table.Ambiguities) != 0 {
+		t.Errorf("сценарии, различающиеся метаданными, считаются неоднозначными: %v", table.Ambiguities)
+	}
+
+	tests := []struct {
+		name  string
+		query ResolutionQuery
+		want  string // Имя сценария или часть ошибки
+	}{
+		{"общий сценарий без типа упражнения", ResolutionQuery{PulseType: 1, Distance: 10, Lane: 1}, "общий"},
+		{"сценарий линии точнее общего", ResolutionQuery{PulseType: 1, Distance: 10, Lane: 2}, "линия 2"},
+		{"тип упражнения", ResolutionQuery{PulseType: 1, Distance: 10, Lane: 1, DrillType: "тренировка"}, "тренировка"},
+		{"метка", ResolutionQuery{PulseType: 1, Distance: 10, Lane: 1, Tags: []string{"ночь"}}, "зачет"},
+		{"нет сценария типа", ResolutionQuery{PulseType: 1, Distance: 10, Lane: 1, DrillType: "дуэль"}, "не найден"},
+		{"нет сценария дистанции", ResolutionQuery{PulseType: 1, Distance: 11, Lane: 1}, "не найден"},
+		{"без типа выбор неоднозначен", ResolutionQuery{PulseType: 2, Distance: 15, Lane: 2}, "неоднозначный"},
+		{"тип снимает неоднозначность", ResolutionQuery{PulseType: 2, Distance: 15, Lane: 2, DrillType: "Б"}, "тип Б"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := table.Resolve(tt.query)
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("ошибка '%v', ожидалось '%s'", err, tt.want)
+				}
+				return
+			}
+			if name != tt.want {
+				t.Errorf("выбран '%s', ожидался '%s'", name, tt.want)
+			}
+		})
+	}
+
+	// Пара без общего сценария неоднозначна, но не пробел
+	for _, gap := range table.Gaps(10, 15) {
+		if gap.PulseType == models.PULSE_2 && gap.Distance == 15 {
+			t.Errorf("пульт 2, 15 м отмечены как пробел")
+		}
+	}
+	if _, err := table.Resolve(ResolutionQuery{PulseType: 1, Distance: 11, Lane: 1}); !errors.Is(err, ErrNoScenario) {
+		t.Errorf("нет сценария: %v, ожидалась ErrNoScenario", err)
+	}
+}
+
+func TestBuildResolutionTable(t *testing.T) {
+	light, _ := models.NewCommand(models.CMD_LIGHT_ON, 0)
+	noRange := models.Scenario{PulseType: models.PULSE_3, Commands: []models.Command{light}}
+	noRange.RawData = protocol.GenerateScenarioPacket(noRange)
+
+	noFrame := resolveScenario(t, models.PULSE_3, 12, 0, "", false)
+	noFrame.RawData = nil
+
+	scenarios := map[string]models.Scenario{
+		"10 м":        resolveScenario(t, models.PULSE_1, 10, 0, "", false),
+		"10 м копия":  resolveScenario(t, models.PULSE_1, 10, 0, "", false),
+		"20 м":        resolveScenario(t, models.PULSE_1, 20, 0, "", false),
+		"20 м свет":   resolveScenario(t, models.PULSE_1, 20, 0, "", true),
+		"30 м пульт2": resolveScenario(t, models.PULSE_2, 30, 0, "", false),
+		"без рубежа":  noRange,
+		"без кадра":   noFrame,
+	}
+	table := BuildResolutionTable(scenarios)
+
+	tests := []struct {
+		name     string
+		pulse    byte
+		distance int
+		want     string // Имя сценария или часть ошибки
+	}{
+		{"копии одного кадра не неоднозначны", models.PULSE_1, 10, "10 м"},
+		{"разные кадры с одинаковыми метаданными", models.PULSE_1, 20, "неоднозначный"},
+		{"другой пульт", models.PULSE_2, 30, "30 м пульт2"},
+		{"пульт без сценария дистанции", models.PULSE_2, 10, "не найден"},
+		{"сценарий без кадра не выбирается", models.PULSE_3, 12, "не найден"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := FindScenarioByDistanceAndPulse(scenarios, tt.distance, tt.pulse)
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("ошибка '%v', ожидалось '%s'", err, tt.want)
+				}
+				return
+			}
+			if name != tt.want {
+				t.Errorf("выбран '%s', ожидался '%s'", name, tt.want)
+			}
+		})
+	}
+
+	// Неоднозначность перечисляет различные кадры, копии не повторяются
+	key := ResolutionKey{PulseType: models.PULSE_1, Distance: 20}
+	if names := table.Ambiguities[key]; len(names) != 2 || names[0] != "20 м" || names[1] != "20 м свет" {
+		t.Errorf("неоднозначность %v", names)
+	}
+	if len(table.Ambiguities) != 1 {
+		t.Errorf("неоднозначностей %d, ожидалась 1", len(table.Ambiguities))
+	}
+
+	for name, reason := range map[string]string{"без рубежа": "дистанция не задана", "без кадра": "нет данных кадра"} {
+		if !strings.HasPrefix(table.Skipped[name], reason) {
+			t.Errorf("%s: причина '%s', ожидалась '%s'", name, table.Skipped[name], reason)
+		}
+	}
+
+	// Неоднозначная пара не пробел; пара без сценария - пробел
+	gaps := make(map[ResolutionKey]bool)
+	for _, gap := range table.Gaps(10, 30) {
+		gaps[gap] = true
+	}
+	for _, tt := range []struct {
+		key ResolutionKey
+		gap bool
+	}{
+		{ResolutionKey{PulseType: models.PULSE_1, Distance: 10}, false},
+		{ResolutionKey{PulseType: models.PULSE_1, Distance: 20}, false},
+		{ResolutionKey{PulseType: models.PULSE_1, Distance: 15}, true},
+		{ResolutionKey{PulseType: models.PULSE_6, Distance: 30}, true},
+	} {
+		if gaps[tt.key] != tt.gap {
+			t.Errorf("%s: пробел %v, ожидалось %v", tt.key, gaps[tt.key], tt.gap)
+		}
+	}
+}
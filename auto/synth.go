@@ -0,0 +1,184 @@
+package auto
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"tir/models"
+	"tir/protocol"
+)
+
+// SynthesisConfig настройки синтеза кадра для дистанций без сохраненного сценария
+type SynthesisConfig struct {
+	AllowedPulses map[byte]bool             // Пульты, для которых разрешен синтез
+	MinDistance   int                       // Минимальная дистанция (м)
+	MaxDistance   int                       // Максимальная дистанция (м)
+	BaseCommands  map[byte][]models.Command // Базовый список команд для каждого пульта
+}
+
+// Текущие настройки синтеза (по умолчанию синтез выключен для всех пультов)
+var (
+	synthesisMu     sync.RWMutex
+	synthesisConfig = DefaultSynthesisConfig()
+)
+
+// DefaultSynthesisConfig возвращает настройки синтеза по умолчанию.
+// Базовые команды повторяют сохраненные сценарии "Сценарий Nм" байт в байт:
+// рубеж, скорость 50, безопасная зона 300 см, мишень в ребро и байт 03,
+// которым заканчиваются все проверенные кадры (его назначение не известно)
+func DefaultSynthesisConfig() SynthesisConfig {
+	config := SynthesisConfig{
+		AllowedPulses: make(map[byte]bool),
+		MinDistance:   MinReportDistance,
+		MaxDistance:   MaxReportDistance,
+		BaseCommands:  make(map[byte][]models.Command),
+	}
+
+	for pulseType := byte(models.PULSE_1); pulseType <= models.PULSE_6; pulseType++ {
+		config.BaseCommands[pulseType] = []models.Command{
+			paramCommand(models.CMD_SET_RANGE, 0),
+			paramCommand(models.CMD_SET_SPEED, 50),
+			paramCommand(models.CMD_SAFE_ZONE, 300),
+			paramCommand(models.CMD_EDGE_POSITION, 0),
+			models.NewRawCommand([]byte{0x03}),
+		}
+	}
+
+	return config
+}
+
+// paramCommand создает команду по реестру команд
+func paramCommand(code uint16, value uint16) models.Command {
+	command, _ := models.NewCommand(code, value)
+	return command
+}
+
+// SynthesisSettings возвращает копию текущих настроек синтеза
+func SynthesisSettings() SynthesisConfig {
+	synthesisMu.RLock()
+	defer synthesisMu.RUnlock()
+
+	config := SynthesisConfig{
+		AllowedPulses: make(map[byte]bool),
+		MinDistance:   synthesisConfig.MinDistance,
+		MaxDistance:   synthesisConfig.MaxDistance,
+		BaseCommands:  make(map[byte][]models.Command),
+	}
+	for pulseType, allowed := range synthesisConfig.AllowedPulses {
+		config.AllowedPulses[pulseType] = allowed
+	}
+	for pulseType, commands := range synthesisConfig.BaseCommands {
+		config.BaseCommands[pulseType] = append([]models.Command(nil), commands...)
+	}
+
+	return config
+}
+
+// SetSynthesisConfig заменяет настройки синтеза
+func SetSynthesisConfig(config SynthesisConfig) {
+	synthesisMu.Lock()
+	defer synthesisMu.Unlock()
+
+	synthesisConfig = config
+}
+
+// SynthesizeScenario создает сценарий для пульта и дистанции из базового списка команд,
+// устанавливая рубеж (CMD_SET_RANGE) в дистанцию×100 см
+func SynthesizeScenario(config SynthesisConfig, pulseType byte, distance int) (models.Scenario, error) {
+	if !config.AllowedPulses[pulseType] {
+		return models.Scenario{}, fmt.Errorf("синтез сценариев для пульта %d не разрешен", pulseType)
+	}
+
+	// Заголовок кадра берется из проверенного на контроллере кадра того же пульта
+	if !protocol.HasVerifiedHeader(pulseType) {
+		return models.Scenario{}, fmt.Errorf("для пульта %d нет проверенного заголовка кадра, синтез невозможен", pulseType)
+	}
+
+	if distance < config.MinDistance || distance > config.MaxDistance {
+		return models.Scenario{}, fmt.Errorf("дистанция %d м вне допустимых пределов синтеза (%d-%d м)",
+			distance, config.MinDistance, config.MaxDistance)
+	}
+
+	rangeCM := distance * 100
+	if rangeCM > 0xFFFF {
+		return models.Scenario{}, fmt.Errorf("рубеж %d см не помещается в параметр команды", rangeCM)
+	}
+
+	base, exists := config.BaseCommands[pulseType]
+	if !exists || len(base) == 0 {
+		return models.Scenario{}, fmt.Errorf("для пульта %d не задан базовый список команд", pulseType)
+	}
+
+	scenario := models.Scenario{
+		Name:      fmt.Sprintf("auto %dm", distance),
+		PulseType: pulseType,
+		Commands:  make([]models.Command, len(base)),
+	}
+	copy(scenario.Commands, base)
+
+	// Подставляем рубеж; если в базовом списке его нет, добавляем первой командой
+	rangeSet := false
+	for i := range scenario.Commands {
+		if !scenario.Commands[i].IsRaw() && scenario.Commands[i].Code == models.CMD_SET_RANGE {
+			scenario.Commands[i].ParamValue = uint16(rangeCM)
+			rangeSet = true
+		}
+	}
+	if !rangeSet {
+		scenario.Commands = append([]models.Command{paramCommand(models.CMD_SET_RANGE, uint16(rangeCM))},
+			scenario.Commands...)
+	}
+
+	// Кадр с недопустимыми параметрами (например, рубеж за пределами трассы) не создаем
+	if errs := models.ValidateScenario(scenario); len(errs) > 0 {
+		return models.Scenario{}, fmt.Errorf("синтезированный сценарий не прошел проверку: %v", errs[0])
+	}
+
+	scenario.RawData = protocol.GenerateScenarioPacket(scenario)
+	scenario.Distance = distance
+
+	return scenario, nil
+}
+
+// SynthesisMenu позволяет включить синтез для пультов и задать пределы дистанций
+func SynthesisMenu() {
+	config := SynthesisSettings()
+
+	fmt.Println("\nСинтез сценариев для дистанций без сохраненного сценария")
+	var allowed []int
+	for pulseType, enabled := range config.AllowedPulses {
+		if enabled {
+			allowed = append(allowed, int(pulseType))
+		}
+	}
+	sort.Ints(allowed)
+	fmt.Printf("Разрешен для пультов: %v\n", allowed)
+	fmt.Printf("Пределы дистанций: %d-%d м\n", config.MinDistance, config.MaxDistance)
+
+	fmt.Print("Введите пульты через запятую без пробелов (например, 1,2; 0 - выключить; Enter - без изменений): ")
+	var input string
+	fmt.Scanln(&input)
+	if input != "" {
+		config.AllowedPulses = make(map[byte]bool)
+		var pulseType int
+		for _, part := range strings.Split(input, ",") {
+			if _, err := fmt.Sscanf(part, "%d", &pulseType); err == nil && pulseType >= 1 && pulseType <= 6 {
+				config.AllowedPulses[byte(pulseType)] = true
+			}
+		}
+	}
+
+	var minDistance, maxDistance int
+	fmt.Print("Введите минимальную дистанцию (Enter - без изменений): ")
+	if _, err := fmt.Scanln(&minDistance); err == nil && minDistance > 0 {
+		config.MinDistance = minDistance
+	}
+	fmt.Print("Введите максимальную дистанцию (Enter - без изменений): ")
+	if _, err := fmt.Scanln(&maxDistance); err == nil && maxDistance >= config.MinDistance {
+		config.MaxDistance = maxDistance
+	}
+
+	SetSynthesisConfig(config)
+	fmt.Println("Настройки синтеза сохранены")
+}
@@ -0,0 +1,54 @@
+package auto
+
+import (
+	"bytes"
+	"testing"
+	"tir/models"
+	"tir/protocol"
+)
+
+func TestSynthesizeScenarioMatchesVerifiedFrames(t *testing.T) {
+	builtin := make(map[string]models.Scenario)
+	protocol.ImportDefaultScenarios(builtin)
+
+	config := DefaultSynthesisConfig()
+	for pulseType := byte(models.PULSE_1); pulseType <= models.PULSE_6; pulseType++ {
+		config.AllowedPulses[pulseType] = true
+	}
+
+	tests := []struct {
+		verified string // Проверенный кадр с тем же набором команд
+		pulse    byte
+		distance int
+	}{
+		{"range_3m_pulse1", models.PULSE_1, 3},
+		{"range_3m_pulse5", models.PULSE_5, 3},
+		{"test5_30m_park", models.PULSE_5, 30},
+		{"Сценарий 5м", models.PULSE_1, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.verified, func(t *testing.T) {
+			scenario, err := SynthesizeScenario(config, tt.pulse, tt.distance)
+			if err != nil {
+				t.Fatalf("SynthesizeScenario: %v", err)
+			}
+			verified := builtin[tt.verified]
+
+			// Заголовок - проверенный для пульта, команды совпадают байт в байт
+			header := protocol.RebuildHeader(nil, scenario.Name, tt.pulse)
+			if !bytes.HasPrefix(scenario.RawData, header) {
+				t.Fatalf("заголовок кадра % X не проверенный", scenario.RawData)
+			}
+			got := scenario.RawData[len(header) : len(scenario.RawData)-1]
+			want := verified.RawData[len(verified.Header) : len(verified.RawData)-1]
+			if !bytes.Equal(got, want) {
+				t.Errorf("команды % X, в проверенном кадре % X", got, want)
+			}
+		})
+	}
+
+	if _, err := SynthesizeScenario(config, models.PULSE_6, 5); err == nil {
+		t.Error("синтез для пульта 6 без проверенного заголовка должен завершаться ошибкой")
+	}
+}
@@ -0,0 +1,132 @@
+// Package capture записывает обмен с последовательными портами в файл
+// (каждая запись и чтение с направлением и временем в микросекундах),
+// показывает записанный обмен с разбором кадров и воспроизводит его
+// на симуляторе или на порту
+package capture
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"tir/comport"
+	"tir/logging"
+)
+
+var logger = logging.For("capture")
+
+// Record событие обмена в файле записи (одна строка JSON). Байты хранятся
+// строкой HEX, как в журнале аудита; у события config - параметры порта в Note
+type Record struct {
+	Time      int64             `json:"t_us"` // Время, микросекунды Unix
+	Port      string            `json:"port"`
+	Direction comport.Direction `json:"dir"`
+	Data      string            `json:"data,omitempty"`
+	Note      string            `json:"note,omitempty"`
+}
+
+// At возвращает время события
+func (r Record) At() time.Time {
+	return time.UnixMicro(r.Time)
+}
+
+// Bytes возвращает байты события
+func (r Record) Bytes() ([]byte, error) {
+	return hex.DecodeString(r.Data)
+}
+
+// Recorder записывает обмен со всеми портами в файл
+type Recorder struct {
+	fileName string
+
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	records int
+	failed  bool
+}
+
+// Start начинает запись обмена в файл (дописывает в конец) и подключает
+// отвод к comport. Одновременно работает одна запись: новая заменяет прежнюю
+func Start(fileName string) (*Recorder, error) {
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := &Recorder{fileName: fileName, file: file, encoder: json.NewEncoder(file)}
+	comport.SetTap(recorder.record)
+	logger.Info("Запись обмена с портами", "file", fileName)
+	return recorder, nil
+}
+
+// Stop отключает отвод и закрывает файл
+func (r *Recorder) Stop() error {
+	comport.SetTap(nil)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	logger.Info("Запись обмена остановлена", "file", r.fileName, "records", r.records)
+	return err
+}
+
+// record записывает событие порта; ошибка записи сообщается один раз
+func (r *Recorder) record(portName string, direction comport.Direction, data []byte, at time.Time) {
+	record := Record{Time: at.UnixMicro(), Port: portName, Direction: direction}
+	if direction == comport.DirectionConfig {
+		record.Note = string(data)
+	} else {
+		record.Data = strings.ToUpper(hex.EncodeToString(data))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	if err := r.encoder.Encode(record); err != nil {
+		if !r.failed {
+			logger.Error("Ошибка записи обмена", "file", r.fileName, "error", err)
+			r.failed = true
+		}
+		return
+	}
+	r.records++
+}
+
+// Read читает файл записи
+func Read(fileName string) ([]Record, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return records, fmt.Errorf("%s, строка %d: %v", fileName, line, err)
+		}
+		if _, err := record.Bytes(); err != nil {
+			return records, fmt.Errorf("%s, строка %d: неверные байты: %v", fileName, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,119 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"tir/comport"
+)
+
+func TestMessages(t *testing.T) {
+	start := time.UnixMicro(1_700_000_000_000_000)
+	at := func(ms int) int64 {
+		return start.Add(time.Duration(ms) * time.Millisecond).UnixMicro()
+	}
+	records := []Record{
+		{Time: at(0), Port: "ttyS0", Direction: comport.DirectionOpen},
+		{Time: at(1), Port: "ttyS0", Direction: comport.DirectionConfig, Note: "4800 8N1"},
+		{Time: at(2), Port: "ttyS0", Direction: comport.DirectionTX, Data: "7E00"},
+		{Time: at(4), Port: "ttyS0", Direction: comport.DirectionTX, Data: "01"},
+		{Time: at(5), Port: "ttyS1", Direction: comport.DirectionTX, Data: "AA"},
+		{Time: at(6), Port: "ttyS0", Direction: comport.DirectionRX, Data: "02"},
+		{Time: at(7), Port: "ttyS0", Direction: comport.DirectionRX, Data: "03"},
+		{Time: at(30), Port: "ttyS0", Direction: comport.DirectionRX, Data: "04"},
+		{Time: at(31), Port: "ttyS0", Direction: comport.DirectionClose},
+		{Time: at(32), Port: "ttyS0", Direction: comport.DirectionRX, Data: "05"},
+	}
+
+	tests := []struct {
+		port string
+		dir  comport.Direction
+		data []byte
+		note string
+	}{
+		{"ttyS0", comport.DirectionOpen, nil, ""},
+		{"ttyS0", comport.DirectionConfig, nil, "4800 8N1"},
+		{"ttyS0", comport.DirectionTX, []byte{0x7E, 0x00, 0x01}, ""}, // Пауза 2 мс не больше gap
+		{"ttyS1", comport.DirectionTX, []byte{0xAA}, ""},
+		{"ttyS0", comport.DirectionRX, []byte{0x02, 0x03}, ""}, // Другой порт между частями не мешает
+		{"ttyS0", comport.DirectionRX, []byte{0x04}, ""},       // Пауза больше gap
+		{"ttyS0", comport.DirectionClose, nil, ""},
+		{"ttyS0", comport.DirectionRX, []byte{0x05}, ""}, // После события порта - новое сообщение
+	}
+
+	messages := Messages(records, 5*time.Millisecond)
+	if len(messages) != len(tests) {
+		t.Fatalf("сообщений %d, ожидалось %d", len(messages), len(tests))
+	}
+	for i, tt := range tests {
+		m := messages[i]
+		if m.Port != tt.port || m.Direction != tt.dir || !bytes.Equal(m.Data, tt.data) || m.Note != tt.note {
+			t.Errorf("сообщение %d: %s %s % X '%s', ожидалось %s %s % X '%s'",
+				i, m.Port, m.Direction, m.Data, m.Note, tt.port, tt.dir, tt.data, tt.note)
+		}
+	}
+	if got, want := messages[2].End.Sub(messages[2].Start), 2*time.Millisecond; got != want {
+		t.Errorf("длительность объединенного сообщения %v, ожидалось %v", got, want)
+	}
+	if ports := Ports(messages); strings.Join(ports, ",") != "ttyS0,ttyS1" {
+		t.Errorf("порты %v, ожидалось [ttyS0 ttyS1]", ports)
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		records int
+		err     string // Часть ошибки
+	}{
+		{"пустой", "", 0, ""},
+		{"пустые строки", "\n{\"t_us\":1,\"port\":\"ttyS0\",\"dir\":\"tx\",\"data\":\"7E00\"}\n\n", 1, ""},
+		{"не JSON", "{\"t_us\":1,\"port\":\"ttyS0\",\"dir\":\"tx\"}\nмусор\n", 1, "строка 2"},
+		{"неверные байты", "{\"t_us\":1,\"port\":\"ttyS0\",\"dir\":\"tx\",\"data\":\"7G\"}\n", 0, "неверные байты"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "capture.jsonl")
+			if err := os.WriteFile(fileName, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			records, err := Read(fileName)
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("ошибка '%v', ожидалась '%s'", err, tt.err)
+			}
+			if len(records) != tt.records {
+				t.Errorf("записей %d, ожидалось %d", len(records), tt.records)
+			}
+		})
+	}
+}
+
+func TestExchangeVerdict(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange Exchange
+		want     string // Начало итога
+	}{
+		{"совпадает", Exchange{Sent: []byte{1}, Recorded: []byte{2}, Received: []byte{2}}, "ответ совпадает"},
+		{"нет ответа, как в записи", Exchange{Sent: []byte{1}}, "ответа нет, как в записи"},
+		{"эхо", Exchange{Sent: []byte{1}, Recorded: []byte{2}, Received: []byte{1}}, "эхо"},
+		{"нет ответа", Exchange{Sent: []byte{1}, Recorded: []byte{2}}, "ответа нет, в записи 02"},
+		{"отличается", Exchange{Sent: []byte{1}, Recorded: []byte{2}, Received: []byte{3}}, "ответ отличается"},
+		{"пропущен", Exchange{Sent: []byte{1}, Skipped: errors.New("линия занята")}, "не отправлено: линия занята"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.exchange.Verdict(); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("'%s', ожидалось '%s'", got, tt.want)
+			}
+		})
+	}
+}
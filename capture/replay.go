@@ -0,0 +1,388 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"tir/audit"
+	"tir/comport"
+	"tir/interlock"
+	"tir/lint"
+	"tir/sender"
+	"tir/sim"
+)
+
+// DefaultBaudRate скорость воспроизведения, если в записи нет параметров порта
+const DefaultBaudRate = 4800
+
+// replayTail сколько ждать ответа после последней записи в порт
+var replayTail = time.Second
+
+// Simulate воспроизводит записанные кадры на симуляторе: для каждого кадра
+// выводит длительность сценария и положение мишени в конце и отмечает кадры,
+// пришедшие на линию раньше, чем закончился предыдущий сценарий
+func Simulate(w io.Writer, messages []Message, cal sim.Calibration) int {
+	type running struct {
+		name string
+		end  time.Time
+	}
+	lanes := make(map[byte]running)
+
+	frames := 0
+	for _, m := range messages {
+		scenario, isFrame, err := m.Frame()
+		if !isFrame {
+			continue
+		}
+		frames++
+		prefix := linePrefix(m.Start.Sub(messages[0].Start), m.Port)
+		indent := strings.Repeat(" ", len(prefix))
+		if err != nil {
+			fmt.Fprintf(w, "%sкадр не разобран: %v\n", prefix, err)
+			continue
+		}
+
+		timeline, err := sim.Simulate(scenario, cal)
+		if err != nil {
+			fmt.Fprintf(w, "%s'%s': %v\n", prefix, scenario.Name, err)
+			continue
+		}
+		final := timeline.Points[len(timeline.Points)-1]
+		fmt.Fprintf(w, "%s'%s', пульт %d: длительность %s, мишень %.0f см, %s, подсветка %s\n",
+			prefix, scenario.Name, scenario.PulseType, sim.FormatDuration(timeline.Duration),
+			final.PositionCM, final.Facing, onOff(final.Light))
+
+		if previous, exists := lanes[scenario.PulseType]; exists && m.Start.Before(previous.end) {
+			fmt.Fprintf(w, "%sпрерывает '%s': до конца оставалось %s\n", indent,
+				previous.name, sim.FormatDuration(previous.end.Sub(m.Start).Seconds()))
+		}
+		for _, warning := range timeline.Warnings {
+			fmt.Fprintf(w, "%sпредупреждение: %s\n", indent, warning)
+		}
+		lanes[scenario.PulseType] = running{
+			name: scenario.Name,
+			end:  m.Start.Add(time.Duration(timeline.Duration * float64(time.Second))),
+		}
+	}
+	return frames
+}
+
+// onOff форматирует состояние подсветки
+func onOff(on bool) string {
+	if on {
+		return "вкл"
+	}
+	return "выкл"
+}
+
+// ReplayOptions параметры воспроизведения записи на порту
+type ReplayOptions struct {
+	PortName string  // Порт воспроизведения: контроллер или петля (TX соединен с RX)
+	BaudRate uint32  // 0 - скорость из записи
+	Source   string  // Записанный порт; пусто - единственный порт записи
+	Speed    float64 // Ускорение; 0 - в реальном времени
+}
+
+// Exchange итог воспроизведения одной записи в порт
+type Exchange struct {
+	Offset   time.Duration // Время от первой записи в порт
+	Sent     []byte
+	Recorded []byte // Ответ в записи
+	Received []byte // Ответ при воспроизведении
+	Skipped  error  // Кадр не отправлен: блокировка линии
+}
+
+// Verdict сравнивает полученный ответ с записанным
+func (e Exchange) Verdict() string {
+	switch {
+	case e.Skipped != nil:
+		return fmt.Sprintf("не отправлено: %v", e.Skipped)
+	case bytes.Equal(e.Received, e.Recorded):
+		if len(e.Received) == 0 {
+			return "ответа нет, как в записи"
+		}
+		return "ответ совпадает с записью"
+	case bytes.Equal(e.Received, e.Sent):
+		return "эхо (петля)"
+	case len(e.Received) == 0:
+		return fmt.Sprintf("ответа нет, в записи % X", e.Recorded)
+	default:
+		return fmt.Sprintf("ответ отличается, в записи % X", e.Recorded)
+	}
+}
+
+// Replay воспроизводит записанные в порт байты на другом порту с исходными
+// паузами и собирает ответы. Кадры сценариев проверяются блокировками линий
+// и анализатором (кадр с ошибками не отправляется) и записываются в журнал
+// аудита. Перед каждой записью и во время ожидания проверяется аварийная
+// блокировка: при остановке воспроизведение прерывается с ErrEmergencyStop.
+// Порт занимается только на время записи и сбора ответа, паузы между записями
+// порт свободен. progress (может быть nil) вызывается после каждой записи,
+// когда собран ответ на нее
+func Replay(messages []Message, options ReplayOptions, progress func(Exchange)) ([]Exchange, error) {
+	source, err := sourcePort(messages, options.Source)
+	if err != nil {
+		return nil, err
+	}
+	baudRate := options.BaudRate
+	if baudRate == 0 {
+		baudRate = recordedBaudRate(messages, source)
+	}
+	speed := options.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+
+	// Записи в порт и записанные ответы на них
+	var exchanges []Exchange
+	var first time.Time
+	for _, m := range messages {
+		switch {
+		case m.Port != source:
+		case m.Direction == comport.DirectionTX:
+			if len(exchanges) == 0 {
+				first = m.Start
+			}
+			exchanges = append(exchanges, Exchange{Offset: m.Start.Sub(first), Sent: m.Data})
+		case m.Direction == comport.DirectionRX && len(exchanges) > 0:
+			last := &exchanges[len(exchanges)-1]
+			last.Recorded = append(last.Recorded, m.Data...)
+		}
+	}
+	if len(exchanges) == 0 {
+		return nil, fmt.Errorf("в записи нет данных, отправленных в порт %s", source)
+	}
+
+	if sender.EmergencyActive() {
+		return nil, sender.ErrEmergencyStop
+	}
+
+	logger.Info("Воспроизведение записи", "source", source, "port", options.PortName,
+		"baud", baudRate, "writes", len(exchanges), "speed", speed)
+
+	port := &replayPort{name: options.PortName, baudRate: baudRate}
+	defer port.release()
+
+	started := time.Now()
+	var written time.Time // Время последней записи в порт
+	buffer := make([]byte, 256)
+	for i := range exchanges {
+		exchange := &exchanges[i]
+
+		// Исходная пауза; ответ на предыдущую запись собирается до следующей,
+		// но не дольше replayTail - дальше порт освобождается до следующей записи
+		due := started.Add(time.Duration(float64(exchange.Offset) / speed))
+		if port.open() {
+			until := due
+			if tail := written.Add(replayTail); tail.Before(until) {
+				until = tail
+			}
+			if err := collect(port.handle, buffer, until, previous(exchanges, i)); err != nil {
+				return exchanges[:i], err
+			}
+			if until.Before(due) {
+				port.release()
+			}
+		}
+		if i > 0 {
+			finish(exchanges[i-1], options.PortName, baudRate, progress)
+		}
+		if err := wait(due); err != nil {
+			return exchanges[:i], err
+		}
+
+		scenario, isFrame, _ := Message{Direction: comport.DirectionTX, Data: exchange.Sent}.Frame()
+		var reservation *interlock.Reservation
+		if isFrame {
+			// Неразобранный кадр блокировки тоже не пропускают
+			reservation, err = interlock.Reserve(int(scenario.PulseType), scenario)
+			if err != nil {
+				exchange.Skipped = err
+				continue
+			}
+			if findings := lint.Check(scenario); lint.HasErrors(findings) {
+				reservation.Done(false)
+				exchange.Skipped = &sender.LintError{Scenario: scenario.Name, Findings: findings}
+				continue
+			}
+		}
+
+		if err := port.acquire(); err != nil {
+			reservation.Done(false)
+			return exchanges[:i], err
+		}
+		// Остановка могла сработать, пока порт был занят
+		if sender.EmergencyActive() {
+			reservation.Done(false)
+			return exchanges[:i], sender.ErrEmergencyStop
+		}
+		_, err := comport.WritePort(port.handle, exchange.Sent)
+		reservation.Done(true)
+		if err != nil {
+			return exchanges[:i+1], fmt.Errorf("ошибка записи в порт: %v", err)
+		}
+		written = time.Now()
+	}
+
+	last := len(exchanges) - 1
+	if port.open() {
+		if err := collect(port.handle, buffer, time.Now().Add(replayTail), &exchanges[last]); err != nil {
+			return exchanges, err
+		}
+		port.release()
+	}
+	finish(exchanges[last], options.PortName, baudRate, progress)
+	return exchanges, nil
+}
+
+// replayPort порт воспроизведения: открыт и занят только на время записи
+// и сбора ответа
+type replayPort struct {
+	name     string
+	baudRate uint32
+	handle   comport.Handle
+	opened   bool
+	unlock   func()
+}
+
+// open сообщает, занят ли порт воспроизведением
+func (p *replayPort) open() bool {
+	return p.unlock != nil
+}
+
+// acquire занимает и открывает порт, если он еще не открыт
+func (p *replayPort) acquire() error {
+	if p.open() {
+		return nil
+	}
+	p.unlock = sender.LockPort(p.name)
+	handle, err := comport.OpenPort(p.name)
+	if err != nil {
+		p.release()
+		return fmt.Errorf("ошибка открытия порта: %v", err)
+	}
+	p.handle, p.opened = handle, true
+	if err := comport.Configure(handle, sender.LineSettings(p.name, p.baudRate)); err != nil {
+		p.release()
+		return fmt.Errorf("ошибка установки параметров: %v", err)
+	}
+	if err := comport.SetCommTimeouts(handle); err != nil {
+		p.release()
+		return fmt.Errorf("ошибка установки таймаутов: %v", err)
+	}
+	comport.PurgeComm(handle)
+	return nil
+}
+
+// release закрывает и освобождает порт
+func (p *replayPort) release() {
+	if !p.open() {
+		return
+	}
+	if p.opened {
+		comport.ClosePort(p.handle)
+		p.opened = false
+	}
+	p.unlock()
+	p.unlock = nil
+}
+
+// stopCheckInterval как часто проверять аварийную блокировку во время ожидания
+const stopCheckInterval = 50 * time.Millisecond
+
+// wait ждет момента due, прерываясь при аварийной остановке
+func wait(due time.Time) error {
+	for {
+		if sender.EmergencyActive() {
+			return sender.ErrEmergencyStop
+		}
+		left := time.Until(due)
+		if left <= 0 {
+			return nil
+		}
+		time.Sleep(min(stopCheckInterval, left))
+	}
+}
+
+// previous возвращает запись, ответ на которую собирается перед i-й
+func previous(exchanges []Exchange, i int) *Exchange {
+	if i == 0 {
+		return nil
+	}
+	return &exchanges[i-1]
+}
+
+// collect читает порт до момента due; прочитанное добавляется к ответу exchange.
+// При аварийной остановке чтение прерывается с ErrEmergencyStop
+func collect(handle comport.Handle, buffer []byte, due time.Time, exchange *Exchange) error {
+	checked := time.Now()
+	for {
+		n, err := comport.ReadPort(handle, buffer)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения порта: %v", err)
+		}
+		if n > 0 && exchange != nil {
+			exchange.Received = append(exchange.Received, buffer[:n]...)
+		}
+		if !time.Now().Before(due) {
+			return nil
+		}
+		if time.Since(checked) >= stopCheckInterval {
+			if sender.EmergencyActive() {
+				return sender.ErrEmergencyStop
+			}
+			checked = time.Now()
+		}
+		if n == 0 {
+			time.Sleep(min(2*time.Millisecond, time.Until(due)))
+		}
+	}
+}
+
+// finish записывает отправленный кадр в журнал аудита и сообщает итог записи
+func finish(exchange Exchange, portName string, baudRate uint32, progress func(Exchange)) {
+	scenario, isFrame, _ := Message{Direction: comport.DirectionTX, Data: exchange.Sent}.Frame()
+	if isFrame && exchange.Skipped == nil {
+		audit.Record(audit.NewEntry(audit.SourceReplay, int(scenario.PulseType), portName, baudRate,
+			scenario.Name, exchange.Sent, nil, exchange.Received, nil))
+	}
+	if progress != nil {
+		progress(exchange)
+	}
+}
+
+// sourcePort выбирает записанный порт для воспроизведения
+func sourcePort(messages []Message, source string) (string, error) {
+	ports := Ports(messages)
+	if source != "" {
+		for _, port := range ports {
+			if port == source {
+				return source, nil
+			}
+		}
+		return "", fmt.Errorf("в записи нет порта %s (есть: %v)", source, ports)
+	}
+	switch len(ports) {
+	case 0:
+		return "", fmt.Errorf("запись пуста")
+	case 1:
+		return ports[0], nil
+	default:
+		return "", fmt.Errorf("в записи несколько портов %v, выберите один", ports)
+	}
+}
+
+// recordedBaudRate возвращает скорость из записанных параметров порта
+func recordedBaudRate(messages []Message, port string) uint32 {
+	for _, m := range messages {
+		if m.Port == port && m.Direction == comport.DirectionConfig {
+			var baudRate uint32
+			if _, err := fmt.Sscanf(m.Note, "%d", &baudRate); err == nil && baudRate > 0 {
+				return baudRate
+			}
+		}
+	}
+	return DefaultBaudRate
+}
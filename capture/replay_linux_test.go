@@ -0,0 +1,218 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+	"tir/audit"
+	"tir/comport"
+	"tir/interlock"
+	"tir/models"
+	"tir/protocol"
+	"tir/sender"
+	"unsafe"
+)
+
+// openPTY открывает псевдотерминал: ведущая сторона отвечает вместо
+// контроллера, ведомая открывается как последовательный порт
+func openPTY(t *testing.T) (*os.File, string) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("псевдотерминал недоступен: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	unlock := 0
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK,
+		uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		t.Fatalf("TIOCSPTLCK: %v", errno)
+	}
+	var number uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN,
+		uintptr(unsafe.Pointer(&number))); errno != 0 {
+		t.Fatalf("TIOCGPTN: %v", errno)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", number)
+}
+
+// answer отвечает reply на каждое чтение ведущей стороны, пока она открыта
+func answer(master *os.File, reply []byte) {
+	buffer := make([]byte, 256)
+	for {
+		if _, err := master.Read(buffer); err != nil {
+			return
+		}
+		if _, err := master.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+// Запись обмена с портом: открытие, параметры, запись, ответ и закрытие
+func TestRecord(t *testing.T) {
+	master, portName := openPTY(t)
+	go answer(master, []byte{0xAA, 0xBB})
+
+	fileName := filepath.Join(t.TempDir(), "capture.jsonl")
+	recorder, err := Start(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Stop()
+
+	handle, err := comport.OpenPort(portName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := comport.Configure(handle, comport.DefaultSettings(9600)); err != nil {
+		comport.ClosePort(handle)
+		t.Fatal(err)
+	}
+	if err := comport.SetCommTimeouts(handle); err != nil {
+		comport.ClosePort(handle)
+		t.Fatal(err)
+	}
+	if _, err := comport.WritePort(handle, []byte{0x01, 0x02, 0x03}); err != nil {
+		comport.ClosePort(handle)
+		t.Fatal(err)
+	}
+	var received []byte
+	buffer := make([]byte, 16)
+	for deadline := time.Now().Add(2 * time.Second); len(received) < 2 && time.Now().Before(deadline); {
+		n, err := comport.ReadPort(handle, buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, buffer[:n]...)
+		time.Sleep(time.Millisecond)
+	}
+	comport.ClosePort(handle)
+	if err := recorder.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// После остановки обмен не записывается
+	if handle, err := comport.OpenPort(portName); err == nil {
+		comport.ClosePort(handle)
+	}
+
+	records, err := Read(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := Messages(records, time.Second)
+	tests := []struct {
+		dir  comport.Direction
+		data []byte
+		note string
+	}{
+		{comport.DirectionOpen, nil, ""},
+		{comport.DirectionConfig, nil, "9600 8N1"},
+		{comport.DirectionTX, []byte{0x01, 0x02, 0x03}, ""},
+		{comport.DirectionRX, []byte{0xAA, 0xBB}, ""},
+		{comport.DirectionClose, nil, ""},
+	}
+	if len(messages) != len(tests) {
+		t.Fatalf("сообщений %d, ожидалось %d: %+v", len(messages), len(tests), messages)
+	}
+	for i, tt := range tests {
+		m := messages[i]
+		if m.Port != portName || m.Direction != tt.dir || !bytes.Equal(m.Data, tt.data) || m.Note != tt.note {
+			t.Errorf("сообщение %d: %s %s % X '%s', ожидалось %s %s % X '%s'",
+				i, m.Port, m.Direction, m.Data, m.Note, portName, tt.dir, tt.data, tt.note)
+		}
+	}
+}
+
+// Воспроизведение записи на порту: ответы сравниваются с записанными,
+// кадр движения на невзведенной линии не отправляется
+func TestReplay(t *testing.T) {
+	previousAudit := audit.File
+	previousInterlock := interlock.Settings()
+	previousEmergency := sender.EmergencyFile()
+	previousTail := replayTail
+	defer func() {
+		audit.File = previousAudit
+		interlock.Configure(previousInterlock)
+		sender.SetEmergencyFile(previousEmergency)
+		replayTail = previousTail
+	}()
+
+	dir := t.TempDir()
+	audit.File = filepath.Join(dir, "audit.jsonl")
+	config := interlock.DefaultConfig()
+	config.StateFile = filepath.Join(dir, "interlock.json")
+	config.RangeHotFile = filepath.Join(dir, "range_hot.txt")
+	config.RangeHotDisabled = false
+	config.LogFile = ""
+	interlock.Configure(config)
+	if err := sender.SetEmergencyFile(filepath.Join(dir, "estop.lock")); err != nil {
+		t.Fatal(err)
+	}
+	replayTail = 200 * time.Millisecond
+
+	scenario := models.Scenario{Name: "движение", PulseType: models.PULSE_1}
+	for _, pair := range [][2]uint16{
+		{models.CMD_SET_RANGE, 1000},
+		{models.CMD_MOVE_TO_RANGE, 0},
+	} {
+		cmd, err := models.NewCommand(pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		scenario.Commands = append(scenario.Commands, cmd)
+	}
+	frame := protocol.GenerateScenarioPacket(scenario)
+
+	start := time.Now()
+	messages := []Message{
+		{Start: start, Port: "ttyS0", Direction: comport.DirectionConfig, Note: "9600 8N1"},
+		{Start: start, Port: "ttyS0", Direction: comport.DirectionTX, Data: []byte{0x01, 0x02, 0x03}},
+		{Start: start.Add(10 * time.Millisecond), Port: "ttyS0", Direction: comport.DirectionRX, Data: []byte{0xAA, 0xBB}},
+		{Start: start.Add(time.Second), Port: "ttyS0", Direction: comport.DirectionTX, Data: []byte{0x04}},
+		{Start: start.Add(time.Second), Port: "ttyS0", Direction: comport.DirectionRX, Data: []byte{0xCC}},
+		{Start: start.Add(2 * time.Second), Port: "ttyS0", Direction: comport.DirectionTX, Data: frame},
+	}
+
+	master, portName := openPTY(t)
+	go answer(master, []byte{0xAA, 0xBB})
+
+	var reported int
+	exchanges, err := Replay(messages, ReplayOptions{PortName: portName, Speed: 10}, func(Exchange) {
+		reported++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exchanges) != 3 || reported != 3 {
+		t.Fatalf("записей %d, сообщено %d, ожидалось 3", len(exchanges), reported)
+	}
+	if !bytes.Equal(exchanges[0].Received, []byte{0xAA, 0xBB}) {
+		t.Errorf("ответ % X, ожидалось AA BB: %s", exchanges[0].Received, exchanges[0].Verdict())
+	}
+	if !bytes.Equal(exchanges[1].Received, []byte{0xAA, 0xBB}) || bytes.Equal(exchanges[1].Received, exchanges[1].Recorded) {
+		t.Errorf("ответ % X, ожидалось отличие от записи: %s", exchanges[1].Received, exchanges[1].Verdict())
+	}
+	if offset := exchanges[1].Offset; offset != time.Second {
+		t.Errorf("смещение %v, ожидалось 1s", offset)
+	}
+	var blocked *interlock.BlockedError
+	if !errors.As(exchanges[2].Skipped, &blocked) {
+		t.Errorf("кадр движения: %v, ожидалась блокировка линии", exchanges[2].Skipped)
+	}
+
+	// Аварийная остановка не дает начать воспроизведение
+	if _, err := sender.EmergencyStop(nil, "проверка"); err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Rearm()
+	if _, err := Replay(messages, ReplayOptions{PortName: portName}, nil); !errors.Is(err, sender.ErrEmergencyStop) {
+		t.Errorf("воспроизведение при остановке: %v, ожидалась ErrEmergencyStop", err)
+	}
+}
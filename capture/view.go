@@ -0,0 +1,176 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"tir/comport"
+	"tir/models"
+	"tir/protocol"
+)
+
+// DefaultGap наибольшая пауза между частями одного сообщения: чтения
+// и записи одного порта в одном направлении с меньшей паузой объединяются
+const DefaultGap = 50 * time.Millisecond
+
+// Байты инициализации перед кадром
+var handshake = []byte{0x7E, 0xAA}
+
+// Message подряд идущие байты одного порта в одном направлении
+// или событие порта (открытие, параметры, закрытие)
+type Message struct {
+	Start     time.Time
+	End       time.Time
+	Port      string
+	Direction comport.Direction
+	Data      []byte
+	Note      string
+}
+
+// Messages объединяет события в сообщения. Части одного направления
+// объединяются, если пауза между ними не больше gap
+func Messages(records []Record, gap time.Duration) []Message {
+	var messages []Message
+	last := make(map[string]int) // Порт -> индекс последнего сообщения с байтами
+	for _, record := range records {
+		data, _ := record.Bytes()
+		at := record.At()
+		streamed := record.Direction == comport.DirectionTX || record.Direction == comport.DirectionRX
+
+		if i, exists := last[record.Port]; exists && streamed {
+			previous := &messages[i]
+			if previous.Direction == record.Direction && at.Sub(previous.End) <= gap {
+				previous.Data = append(previous.Data, data...)
+				previous.End = at
+				continue
+			}
+		}
+
+		messages = append(messages, Message{
+			Start:     at,
+			End:       at,
+			Port:      record.Port,
+			Direction: record.Direction,
+			Data:      data,
+			Note:      record.Note,
+		})
+		if streamed {
+			last[record.Port] = len(messages) - 1
+		} else {
+			delete(last, record.Port)
+		}
+	}
+	return messages
+}
+
+// Frame разбирает записанный кадр сценария; false, если байты не начинаются с 7E 00
+func (m Message) Frame() (models.Scenario, bool, error) {
+	if m.Direction != comport.DirectionTX || len(m.Data) < 2 || m.Data[0] != 0x7E || m.Data[1] != 0x00 {
+		return models.Scenario{}, false, nil
+	}
+	scenario, err := protocol.ParseScenarioData(m.Data)
+	if err != nil {
+		return scenario, true, err
+	}
+	// Длина имени в кадре с пульта может захватывать нулевой байт и заполнение
+	scenario.Name, _, _ = strings.Cut(scenario.Name, "\x00")
+	scenario.RawData = m.Data
+	return scenario, true, nil
+}
+
+// Describe возвращает расшифровку сообщения: первая строка - краткое описание,
+// остальные - команды кадра
+func (m Message) Describe() []string {
+	switch m.Direction {
+	case comport.DirectionOpen:
+		return []string{"порт открыт"}
+	case comport.DirectionClose:
+		return []string{"порт закрыт"}
+	case comport.DirectionConfig:
+		return []string{"параметры " + m.Note}
+	case comport.DirectionRX:
+		return []string{"ответ"}
+	}
+
+	if bytes.Equal(m.Data, handshake) {
+		return []string{"инициализация"}
+	}
+	scenario, isFrame, err := m.Frame()
+	switch {
+	case !isFrame:
+		return []string{"данные"}
+	case err != nil:
+		return []string{fmt.Sprintf("кадр не разобран: %v", err)}
+	}
+
+	lines := []string{fmt.Sprintf("кадр '%s', пульт %d, команд %d, контрольная сумма %02X",
+		scenario.Name, scenario.PulseType, len(scenario.Commands), m.Data[len(m.Data)-1])}
+	if len(m.Data) > protocol.MaxFrameSize {
+		lines[0] += fmt.Sprintf(" (длина %d больше допустимой %d)", len(m.Data), protocol.MaxFrameSize)
+	}
+	for _, cmd := range scenario.Commands {
+		if cmd.HasParam {
+			lines = append(lines, fmt.Sprintf("%s: %s = %d", cmd.Name, cmd.ParamName, cmd.ParamValue))
+		} else {
+			lines = append(lines, cmd.Name)
+		}
+	}
+	return lines
+}
+
+// Print выводит сообщения: время от начала записи (с точностью до микросекунды),
+// порт, направление, байты и расшифровку. Для ответа указывается задержка
+// после последней записи в порт
+func Print(w io.Writer, messages []Message) {
+	if len(messages) == 0 {
+		fmt.Fprintln(w, "Записей нет")
+		return
+	}
+
+	start := messages[0].Start
+	lastTX := make(map[string]time.Time)
+	for _, m := range messages {
+		prefix := linePrefix(m.Start.Sub(start), m.Port)
+		lines := m.Describe()
+
+		switch m.Direction {
+		case comport.DirectionTX:
+			lastTX[m.Port] = m.End
+			fmt.Fprintf(w, "%s>> % X\n", prefix, m.Data)
+		case comport.DirectionRX:
+			if sent, exists := lastTX[m.Port]; exists {
+				lines[0] += fmt.Sprintf(" через %.1f мс", float64(m.Start.Sub(sent).Microseconds())/1000)
+			}
+			fmt.Fprintf(w, "%s<< % X\n", prefix, m.Data)
+		default:
+			fmt.Fprintf(w, "%s%s\n", prefix, lines[0])
+			continue
+		}
+
+		indent := strings.Repeat(" ", len(prefix)+3)
+		fmt.Fprintf(w, "%s%s\n", indent, lines[0])
+		for _, line := range lines[1:] {
+			fmt.Fprintf(w, "%s  %s\n", indent, line)
+		}
+	}
+}
+
+// linePrefix начало строки вывода: время от начала записи и порт
+func linePrefix(offset time.Duration, port string) string {
+	return fmt.Sprintf("%-12s %-10s ", fmt.Sprintf("+%.6f", offset.Seconds()), port)
+}
+
+// Ports возвращает порты, обмен с которыми записан, в порядке появления
+func Ports(messages []Message) []string {
+	var ports []string
+	seen := make(map[string]bool)
+	for _, m := range messages {
+		if !seen[m.Port] {
+			seen[m.Port] = true
+			ports = append(ports, m.Port)
+		}
+	}
+	return ports
+}
@@ -0,0 +1,826 @@
+// cli.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"tir/audit"
+	"tir/capture"
+	"tir/comport"
+	"tir/daemon"
+	"tir/doctor"
+	"tir/drill"
+	"tir/dsl"
+	"tir/firebase"
+	"tir/interlock"
+	"tir/lint"
+	"tir/metrics"
+	"tir/models"
+	"tir/protocol"
+	"tir/sender"
+	"tir/server"
+	"tir/sim"
+	"tir/storage"
+	"tir/ui"
+)
+
+// runCommand выполняет команду командной строки и возвращает код завершения
+func runCommand(command string, args []string) int {
+	switch command {
+	case "lint":
+		return runLint(args)
+	case "sim":
+		return runSim(args)
+	case "drill":
+		return runDrill(args)
+	case "dsl":
+		return runDSL(args)
+	case "serve":
+		return runServe(args)
+	case "estop":
+		return runEstop(args)
+	case "interlock":
+		return runInterlock(args)
+	case "audit":
+		return runAudit(args)
+	case "daemon":
+		return runDaemon(args)
+	case "doctor":
+		return runDoctor(args)
+	case "ports":
+		return runPorts(args)
+	case "capture":
+		return runCapture(args)
+	default:
+		fmt.Printf("Неизвестная команда: %s\n", command)
+		fmt.Println("Доступные команды: lint, sim, drill, dsl, serve, estop, interlock, audit, daemon, doctor, ports, capture")
+		return 2
+	}
+}
+
+// loadLibrary загружает встроенные сценарии и сценарии из файла
+func loadLibrary(fileName string) map[string]models.Scenario {
+	library := map[string]models.Scenario{}
+	protocol.ImportDefaultScenarios(library)
+	storage.LoadScenariosFrom(fileName, library)
+	return library
+}
+
+// runLint проверяет сценарии анализатором: tir lint [-file файл] [-q|-v] [имя...]
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fileName := flags.String("file", storage.DefaultFileName, "файл сценариев")
+	quiet := flags.Bool("q", false, "выводить только ошибки")
+	verbose := flags.Bool("v", false, "выводить также информационные замечания")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	library := loadLibrary(*fileName)
+
+	minSeverity := lint.Warning
+	if *quiet {
+		minSeverity = lint.Error
+	} else if *verbose {
+		minSeverity = lint.Info
+	}
+
+	names := flags.Args()
+	if len(names) == 0 {
+		for name := range library {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	errorCount, warningCount := 0, 0
+	for _, name := range names {
+		scenario, exists := library[name]
+		if !exists {
+			fmt.Printf("%s: сценарий не найден\n", name)
+			errorCount++
+			continue
+		}
+
+		var shown []lint.Finding
+		for _, f := range lint.Check(scenario) {
+			switch f.Severity {
+			case lint.Error:
+				errorCount++
+			case lint.Warning:
+				warningCount++
+			}
+			if f.Severity >= minSeverity {
+				shown = append(shown, f)
+			}
+		}
+
+		if len(shown) > 0 {
+			fmt.Printf("%s:\n", name)
+			lint.Print(shown)
+		}
+	}
+
+	fmt.Printf("\nПроверено сценариев: %d, ошибок: %d, предупреждений: %d\n",
+		len(names), errorCount, warningCount)
+
+	if errorCount > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runSim выводит временную шкалу сценария:
+// tir sim [-file файл] [-cal см/с] [-chart] [-csv файл] имя
+func runSim(args []string) int {
+	flags := flag.NewFlagSet("sim", flag.ContinueOnError)
+	fileName := flags.String("file", storage.DefaultFileName, "файл сценариев")
+	calibration := flags.Float64("cal", sim.DefaultCalibration.CMPerSecondPerUnit,
+		"скорость мишени (см/с) на единицу параметра скорости")
+	chart := flags.Bool("chart", false, "вывести график вместо таблицы")
+	csvFile := flags.String("csv", "", "выгрузить временную шкалу в CSV-файл")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Println("Использование: tir sim [-file файл] [-cal см/с] [-chart] [-csv файл] имя")
+		return 2
+	}
+
+	library := loadLibrary(*fileName)
+	scenario, exists := library[flags.Arg(0)]
+	if !exists {
+		fmt.Printf("%s: сценарий не найден\n", flags.Arg(0))
+		return 1
+	}
+
+	cal := sim.DefaultCalibration
+	cal.CMPerSecondPerUnit = *calibration
+	timeline, err := sim.Simulate(scenario, cal)
+	if err != nil {
+		fmt.Printf("Ошибка симуляции: %v\n", err)
+		return 1
+	}
+
+	if *chart {
+		sim.PrintChart(os.Stdout, timeline, 50)
+		fmt.Printf("Общая длительность: %s\n", sim.FormatDuration(timeline.Duration))
+	} else {
+		sim.PrintTable(os.Stdout, timeline)
+	}
+	for _, warning := range timeline.Warnings {
+		fmt.Printf("Предупреждение: %s\n", warning)
+	}
+
+	if *csvFile != "" {
+		file, err := os.Create(*csvFile)
+		if err != nil {
+			fmt.Printf("Ошибка создания файла: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		if err := sim.WriteCSV(file, timeline); err != nil {
+			fmt.Printf("Ошибка записи CSV: %v\n", err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// runDrill разворачивает упражнение в кадры и выводит их: tir drill файл.json
+func runDrill(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("Использование: tir drill файл.json")
+		return 2
+	}
+
+	d, err := drill.Load(args[0])
+	if err != nil {
+		fmt.Printf("Ошибка загрузки упражнения: %v\n", err)
+		return 1
+	}
+
+	frames, err := drill.Expand(d)
+	if err != nil {
+		fmt.Printf("Ошибка развертывания: %v\n", err)
+		return 1
+	}
+
+	ui.PrintDrillFrames(frames)
+	return 0
+}
+
+// runDSL работает с текстовым форматом сценариев:
+//
+//	tir dsl print [-file файл] имя...    - вывести сценарии в текстовом формате
+//	tir dsl export [-file файл] [-dir каталог] [имя...] - выгрузить сценарии в файлы .tir
+//	tir dsl check файл.tir...            - проверить файлы
+//	tir dsl import [-file файл] файл.tir... - добавить сценарии из файлов в файл сценариев
+func runDSL(args []string) int {
+	usage := "Использование: tir dsl print|export|check|import [флаги] ..."
+	if len(args) == 0 {
+		fmt.Println(usage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("dsl "+args[0], flag.ContinueOnError)
+	fileName := flags.String("file", storage.DefaultFileName, "файл сценариев")
+	dir := flags.String("dir", ".", "каталог для файлов .tir")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	switch args[0] {
+	case "print", "export":
+		library := loadLibrary(*fileName)
+		names := flags.Args()
+		if len(names) == 0 && args[0] == "export" {
+			for name := range library {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		failed := 0
+		for _, name := range names {
+			scenario, exists := library[name]
+			if !exists {
+				fmt.Printf("%s: сценарий не найден\n", name)
+				failed++
+				continue
+			}
+			scenario.Name = name
+
+			if args[0] == "print" {
+				text, err := dsl.Format(scenario)
+				if err != nil {
+					fmt.Printf("%s: %v\n", name, err)
+					failed++
+					continue
+				}
+				fmt.Println(text)
+				continue
+			}
+
+			target := filepath.Join(*dir, dsl.FileNameFor(name))
+			if err := dsl.WriteFile(target, scenario); err != nil {
+				fmt.Printf("%s: %v\n", name, err)
+				failed++
+			}
+		}
+		if args[0] == "export" {
+			fmt.Printf("Выгружено сценариев: %d\n", len(names)-failed)
+		}
+		if failed > 0 {
+			return 1
+		}
+		return 0
+
+	case "check", "import":
+		imported := map[string]models.Scenario{}
+		failed := 0
+		for _, path := range flags.Args() {
+			scenario, err := dsl.ParseFile(path)
+			if err != nil {
+				fmt.Println(err)
+				failed++
+				continue
+			}
+			imported[scenario.Name] = scenario
+		}
+
+		// В файле заменяются только строки загруженных сценариев, остальные
+		// строки (в том числе неразобранные) остаются как были
+		if args[0] == "import" && failed == 0 {
+			if err := storage.UpdateScenariosFile(*fileName, imported, nil); err != nil {
+				fmt.Printf("Ошибка сохранения файла: %v\n", err)
+				return 1
+			}
+			fmt.Printf("Загружено файлов: %d, сценарии сохранены в %s\n", len(flags.Args()), *fileName)
+		}
+		if failed > 0 {
+			return 1
+		}
+		return 0
+
+	default:
+		fmt.Println(usage)
+		return 2
+	}
+}
+
+// runServe запускает локальный HTTP/JSON API:
+// tir serve [-addr адрес] [-token токен] [-file файл] [-port порт] [-baud скорость] [-lanes 1=COM4,2=COM5]
+// [-line 8N1] [-metrics адрес]
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", server.DefaultAddr, "адрес прослушивания")
+	token := flags.String("token", os.Getenv("TIR_TOKEN"), "токен доступа (по умолчанию - переменная TIR_TOKEN или случайный)")
+	fileName := flags.String("file", storage.DefaultFileName, "файл сценариев")
+	portName := flags.String("port", "COM4", "порт по умолчанию")
+	baudRate := flags.Uint("baud", 4800, "скорость порта")
+	lanes := flags.String("lanes", "", "порты для отдельных линий, например 1=COM4,2=serial:A10K5QZ3,3=path:1-1.2")
+	line := flags.String("line", "", "формат линии портов, например 8E1 или 8N1,rs485 (по умолчанию 8N1)")
+	queueSize := flags.Int("queue", 0, "размер очереди отправки на порт")
+	metricsAddr := flags.String("metrics", "", "адрес метрик Prometheus, например 127.0.0.1:9101 (по умолчанию выключены)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := setLineFormat(*line); err != nil {
+		fmt.Printf("Ошибка формата линии: %v\n", err)
+		return 2
+	}
+
+	library := loadLibrary(*fileName)
+	srv, err := server.New(server.Config{
+		Addr:      *addr,
+		Token:     *token,
+		FileName:  *fileName,
+		PortName:  *portName,
+		BaudRate:  uint32(*baudRate),
+		LinePorts: parseLinePorts(*lanes),
+		QueueSize: *queueSize,
+	}, library)
+	if err != nil {
+		fmt.Printf("Ошибка запуска сервера: %v\n", err)
+		return 1
+	}
+
+	warnIfExposed(srv.Addr(), "API")
+	fmt.Printf("API запущен: http://%s/api\n", srv.Addr())
+	fmt.Printf("Пульт инструктора: http://%s/?token=%s\n", srv.Addr(), srv.Token())
+	fmt.Printf("Токен доступа: %s\n", srv.Token())
+
+	var metricsServer *http.Server
+	if *metricsAddr != "" {
+		warnIfExposed(*metricsAddr, "метрики")
+		metricsServer = metrics.NewServer(*metricsAddr)
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Printf("Ошибка сервера метрик: %v\n", err)
+			}
+		}()
+		fmt.Printf("Метрики: http://%s/metrics\n", *metricsAddr)
+	}
+
+	// Завершение по Ctrl+C или SIGTERM: текущие отправки дожидаемся
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		fmt.Println("Остановка сервера...")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if metricsServer != nil {
+			metricsServer.Shutdown(ctx)
+		}
+		srv.Shutdown(ctx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil {
+		fmt.Printf("Ошибка сервера: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// warnIfExposed предупреждает, если адрес прослушивания доступен не только локально
+func warnIfExposed(addr, what string) {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			fmt.Printf("ВНИМАНИЕ: %s: доступ не только с этого компьютера (%s)\n", what, addr)
+		}
+	}
+}
+
+// runEstop выполняет аварийную остановку или снимает блокировку:
+// tir estop [-port порт] [-baud скорость] [-lanes 1=COM4,2=COM5] [-line 8N1] [-reason текст] [-file файл]
+// tir estop -status | -rearm [-file файл]
+func runEstop(args []string) int {
+	flags := flag.NewFlagSet("estop", flag.ContinueOnError)
+	portName := flags.String("port", "COM4", "порт по умолчанию")
+	baudRate := flags.Uint("baud", 4800, "скорость порта")
+	lanes := flags.String("lanes", "", "порты для отдельных линий, например 1=COM4,2=serial:A10K5QZ3,3=path:1-1.2")
+	line := flags.String("line", "", "формат линии портов, например 8E1 или 8N1,rs485 (по умолчанию 8N1)")
+	reason := flags.String("reason", "командная строка", "причина остановки")
+	file := flags.String("file", "", "файл блокировки (по умолчанию TIR_ESTOP_FILE или estop.lock)")
+	status := flags.Bool("status", false, "показать состояние блокировки")
+	rearm := flags.Bool("rearm", false, "снять блокировку (повторное взведение)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *file != "" {
+		if err := sender.SetEmergencyFile(*file); err != nil {
+			fmt.Println(err)
+			return 2
+		}
+	}
+
+	switch {
+	case *status:
+		state := sender.Emergency()
+		if !state.Active {
+			fmt.Println("Аварийная блокировка не действует")
+			return 0
+		}
+		fmt.Printf("Аварийная блокировка с %s: %s\n", state.Since.Format("2006-01-02 15:04:05"), state.Reason)
+		return 1
+	case *rearm:
+		if err := sender.Rearm(); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := setLineFormat(*line); err != nil {
+		fmt.Printf("Ошибка формата линии: %v\n", err)
+		return 2
+	}
+
+	linePorts := parseLinePorts(*lanes)
+	var targets []sender.Target
+	for lane := models.PULSE_1; lane <= models.PULSE_6; lane++ {
+		port := *portName
+		if linePort, exists := linePorts[lane]; exists {
+			port = linePort
+		}
+		targets = append(targets, sender.Target{Lane: lane, PortName: port, BaudRate: uint32(*baudRate)})
+	}
+
+	results, err := sender.EmergencyStop(targets, *reason)
+	sender.PrintStopResults(results)
+	if err != nil {
+		fmt.Printf("ОШИБКА БЛОКИРОВКИ: %v\n", err)
+		return 1
+	}
+	fmt.Println("Отправка сценариев заблокирована до повторного взведения: tir estop -rearm")
+
+	// Успех - только если каждая линия подтвердила прием парковки
+	for _, r := range results {
+		if !r.Confirmed() {
+			return 1
+		}
+	}
+	return 0
+}
+
+// runInterlock взводит линии, снимает их со взвода и показывает состояние блокировок:
+// tir interlock [-arm 1,2] [-disarm 3]
+func runInterlock(args []string) int {
+	flags := flag.NewFlagSet("interlock", flag.ContinueOnError)
+	arm := flags.String("arm", "", "взвести линии (через запятую)")
+	disarm := flags.String("disarm", "", "снять линии со взвода (через запятую)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	code := 0
+	apply := func(list string, action func(int) error) {
+		if list == "" {
+			return
+		}
+		for _, part := range strings.Split(list, ",") {
+			lane, err := strconv.Atoi(strings.TrimSpace(part))
+			if err == nil {
+				err = action(lane)
+			}
+			if err != nil {
+				fmt.Printf("Линия %s: %v\n", part, err)
+				code = 1
+			}
+		}
+	}
+	apply(*disarm, interlock.Disarm)
+	apply(*arm, interlock.Arm)
+
+	ui.PrintInterlockStatus()
+	return code
+}
+
+// runAudit выбирает записи журнала аудита и выводит или выгружает их:
+// tir audit [-log файл] [-since время] [-until время] [-lane N] [-port порт]
+// [-scenario текст] [-source источник] [-outcome итог] [-format text|json|csv] [-o файл]
+func runAudit(args []string) int {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	logFile := flags.String("log", audit.DefaultFile, "файл журнала аудита")
+	since := flags.String("since", "", "начало периода: 2006-01-02 15:04 или давность (например, 2h)")
+	until := flags.String("until", "", "конец периода (не включая)")
+	lane := flags.Int("lane", 0, "линия")
+	portName := flags.String("port", "", "порт")
+	scenario := flags.String("scenario", "", "часть имени сценария")
+	source := flags.String("source", "", "источник: menu, debug, auto, firebase, api, estop, replay")
+	outcome := flags.String("outcome", "", "итог: confirmed, no-reply, error")
+	format := flags.String("format", "text", "формат вывода: text, json, csv")
+	output := flags.String("o", "", "выгрузить в файл вместо вывода на экран")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	filter := audit.Filter{
+		Lane:     *lane,
+		Port:     *portName,
+		Scenario: *scenario,
+		Source:   audit.Source(*source),
+		Outcome:  audit.Outcome(*outcome),
+	}
+	now := time.Now()
+	for _, bound := range []struct {
+		value  string
+		target *time.Time
+	}{{*since, &filter.Since}, {*until, &filter.Until}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := audit.ParseTime(bound.value, now)
+		if err != nil {
+			fmt.Println(err)
+			return 2
+		}
+		*bound.target = t
+	}
+
+	entries, skipped, err := audit.Read(*logFile, filter)
+	if err != nil {
+		fmt.Printf("Ошибка чтения журнала %s: %v\n", *logFile, err)
+		return 1
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Printf("Ошибка создания файла: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	switch *format {
+	case "text":
+		audit.WriteTable(out, entries)
+	case "json":
+		err = audit.WriteJSON(out, entries)
+	case "csv":
+		err = audit.WriteCSV(out, entries)
+	default:
+		fmt.Printf("Неизвестный формат: %s\n", *format)
+		return 2
+	}
+	if err != nil {
+		fmt.Printf("Ошибка выгрузки: %v\n", err)
+		return 1
+	}
+
+	if *output != "" {
+		fmt.Printf("Выгружено записей: %d в %s\n", len(entries), *output)
+	} else if *format == "text" {
+		fmt.Printf("\nЗаписей: %d\n", len(entries))
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Пропущено поврежденных строк: %d\n", skipped)
+	}
+	return 0
+}
+
+// runDaemon запускает программу службой без терминала:
+// tir daemon [-config tir.json] [-pid файл] [-check]
+func runDaemon(args []string) int {
+	flags := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	configFile := flags.String("config", daemon.DefaultConfigFile, "файл настроек службы")
+	pidFile := flags.String("pid", "", "PID-файл (заменяет pid_file из настроек)")
+	check := flags.Bool("check", false, "только проверить настройки")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	base := daemon.DefaultConfig()
+	base.Firebase.ProjectID, base.Firebase.APIKey = getFirebaseCredentials()
+
+	if *check {
+		if _, err := daemon.LoadConfig(*configFile, base); err != nil {
+			fmt.Printf("Ошибка настроек: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Настройки %s в порядке\n", *configFile)
+		return 0
+	}
+
+	service := daemon.New(*configFile, base)
+	service.PIDFile = *pidFile
+	if err := service.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка службы: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runDoctor проверяет готовность к работе:
+// tir doctor [-config tir.json] [-port COM4] [-baud 4800] [-lanes 1=COM4,...] [-line 8N1] [-file файл]
+// [-no-probe] [-no-firebase]
+func runDoctor(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	configFile := flags.String("config", daemon.DefaultConfigFile, "файл настроек службы (если есть)")
+	portName := flags.String("port", "", "порт по умолчанию (заменяет настройки)")
+	baudRate := flags.Uint("baud", 0, "скорость порта (заменяет настройки)")
+	lanes := flags.String("lanes", "", "порты для отдельных линий, например 1=COM4,2=serial:A10K5QZ3,3=path:1-1.2")
+	line := flags.String("line", "", "формат линии портов, например 8E1 или 8N1,rs485 (заменяет настройки)")
+	fileName := flags.String("file", "", "файл сценариев (заменяет настройки)")
+	noProbe := flags.Bool("no-probe", false, "не обращаться к контроллерам")
+	noFirebase := flags.Bool("no-firebase", false, "не проверять Firebase")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Настройки службы, если файл есть; флаги заменяют их
+	base := daemon.DefaultConfig()
+	base.Firebase.ProjectID, base.Firebase.APIKey = getFirebaseCredentials()
+	config, err := daemon.LoadConfig(*configFile, base)
+	if err != nil {
+		fmt.Printf("Ошибка настроек %s: %v\n", *configFile, err)
+		return 2
+	}
+	if *portName != "" {
+		config.PortName = *portName
+	}
+	if *baudRate != 0 {
+		config.BaudRate = uint32(*baudRate)
+	}
+	if *lanes != "" {
+		config.LinePorts = parseLinePorts(*lanes)
+	}
+	if *fileName != "" {
+		config.ScenariosFile = *fileName
+	}
+	if *line != "" {
+		config.Line, config.PortLines = *line, nil
+	}
+	lines, err := config.LineSettings()
+	if err != nil {
+		fmt.Printf("Ошибка настроек %s: %v\n", *configFile, err)
+		return 2
+	}
+	sender.SetLineSettings(lines)
+
+	options := doctor.Options{
+		ScenariosFile: config.ScenariosFile,
+		PortName:      config.PortName,
+		BaudRate:      config.BaudRate,
+		LinePorts:     config.LinePorts,
+		SkipProbe:     *noProbe,
+	}
+	if config.Firebase.Enabled && !*noFirebase {
+		options.Firebase = firebase.NewRestClient(config.Firebase.ProjectID, config.Firebase.APIKey, nil)
+	}
+
+	report := doctor.Run(options)
+	fmt.Println()
+	report.Print(os.Stdout)
+	if report.Failed() {
+		return 1
+	}
+	return 0
+}
+
+// runPorts выводит последовательные порты с данными USB и постоянными именами
+// для настройки линий: tir ports [-json]
+func runPorts(args []string) int {
+	flags := flag.NewFlagSet("ports", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "вывести в формате JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ports, err := comport.ListPorts()
+	if err != nil {
+		fmt.Printf("Не удалось перечислить порты: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(ports); err != nil {
+			fmt.Printf("Ошибка вывода: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if len(ports) == 0 {
+		fmt.Println("Последовательные порты не найдены")
+		return 0
+	}
+	for _, port := range ports {
+		fmt.Println(port)
+		if stable := port.StableName(); stable != port.Name {
+			fmt.Printf("    для настроек линий: %s\n", stable)
+		}
+	}
+	return 0
+}
+
+// runCapture показывает и воспроизводит запись обмена с портами
+// (запись включается переменной TIR_CAPTURE=файл или capture_file в настройках службы):
+//
+//	tir capture view [-gap 50ms] файл               - обмен с разбором кадров
+//	tir capture replay [-cal 2] файл                - кадры на симуляторе
+//	tir capture replay -port COM5 [-baud скорость] [-source порт] [-speed 1] [-line 8N1] файл
+//	                                                - записанные байты в порт (контроллер или петля)
+func runCapture(args []string) int {
+	usage := "Использование: tir capture view|replay [флаги] файл"
+	if len(args) == 0 {
+		fmt.Println(usage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("capture "+args[0], flag.ContinueOnError)
+	gap := flags.Duration("gap", capture.DefaultGap, "наибольшая пауза внутри одного сообщения")
+	portName := flags.String("port", "", "порт воспроизведения (по умолчанию - симулятор)")
+	baudRate := flags.Uint("baud", 0, "скорость порта (по умолчанию из записи)")
+	source := flags.String("source", "", "записанный порт, если в записи их несколько")
+	speed := flags.Float64("speed", 1, "ускорение воспроизведения")
+	line := flags.String("line", "", "формат линии порта, например 8E1 или 8N1,rs485 (по умолчанию 8N1)")
+	calibration := flags.Float64("cal", sim.DefaultCalibration.CMPerSecondPerUnit,
+		"скорость (см/с) на единицу параметра скорости")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Println(usage)
+		return 2
+	}
+
+	records, err := capture.Read(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("Ошибка чтения записи: %v\n", err)
+		return 1
+	}
+	messages := capture.Messages(records, *gap)
+
+	switch {
+	case args[0] == "view":
+		capture.Print(os.Stdout, messages)
+		return 0
+
+	case args[0] == "replay" && *portName == "":
+		cal := sim.DefaultCalibration
+		cal.CMPerSecondPerUnit = *calibration
+		if capture.Simulate(os.Stdout, messages, cal) == 0 {
+			fmt.Println("В записи нет кадров сценариев")
+		}
+		return 0
+
+	case args[0] == "replay":
+		if err := setLineFormat(*line); err != nil {
+			fmt.Printf("Ошибка формата линии: %v\n", err)
+			return 2
+		}
+		options := capture.ReplayOptions{
+			PortName: *portName,
+			BaudRate: uint32(*baudRate),
+			Source:   *source,
+			Speed:    *speed,
+		}
+		failed := 0
+		exchanges, err := capture.Replay(messages, options, func(e capture.Exchange) {
+			fmt.Printf("%-12s >> % X\n", fmt.Sprintf("+%.6f", e.Offset.Seconds()), e.Sent)
+			if len(e.Received) > 0 {
+				fmt.Printf("%12s << % X\n", "", e.Received)
+			}
+			fmt.Printf("%12s    %s\n", "", e.Verdict())
+			if e.Skipped != nil || !bytes.Equal(e.Received, e.Recorded) && !bytes.Equal(e.Received, e.Sent) {
+				failed++
+			}
+		})
+		if err != nil {
+			fmt.Printf("Ошибка воспроизведения: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Воспроизведено записей: %d, расхождений: %d\n", len(exchanges), failed)
+		if failed > 0 {
+			return 1
+		}
+		return 0
+
+	default:
+		fmt.Println(usage)
+		return 2
+	}
+}
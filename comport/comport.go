@@ -0,0 +1,7 @@
+// Package comport работает с последовательным портом контроллера:
+// Windows (COM-порты, WinAPI) и Linux (/dev/tty*, termios)
+package comport
+
+import "tir/logging"
+
+var logger = logging.For("comport")
@@ -0,0 +1,161 @@
+package comport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PortInfo последовательный порт системы
+type PortInfo struct {
+	Name         string `json:"name"`                    // Имя для OpenPort: COM4, ttyUSB0
+	Path         string `json:"path"`                    // Путь устройства: \\.\COM4, /dev/ttyUSB0
+	USB          bool   `json:"usb"`                     // Порт USB-преобразователя
+	VID          uint16 `json:"vid,omitempty"`           // Идентификатор производителя USB
+	PID          uint16 `json:"pid,omitempty"`           // Идентификатор изделия USB
+	Manufacturer string `json:"manufacturer,omitempty"`  // Производитель по данным устройства USB
+	Product      string `json:"product,omitempty"`       // Изделие по данным устройства USB
+	SerialNumber string `json:"serial_number,omitempty"` // Серийный номер устройства USB (есть не у всех преобразователей)
+	Location     string `json:"location,omitempty"`      // Физическое подключение: цепочка портов USB (1-1.2:1.0) или место в Windows
+	Description  string `json:"description,omitempty"`   // Описание устройства или известная микросхема
+}
+
+// Префиксы постоянных имен порта: устройство ищется по серийному номеру
+// или месту подключения и не зависит от имени, выданного системой
+const (
+	SerialPrefix   = "serial:"
+	LocationPrefix = "path:"
+)
+
+// Известные USB-преобразователи, которыми подключают контроллеры
+var knownChips = map[[2]uint16]string{
+	{0x1A86, 0x7523}: "CH340",
+	{0x1A86, 0x5523}: "CH341",
+	{0x1A86, 0x55D4}: "CH9102",
+	{0x0403, 0x6001}: "FTDI FT232R",
+	{0x0403, 0x6015}: "FTDI FT231X",
+	{0x067B, 0x2303}: "Prolific PL2303",
+	{0x10C4, 0xEA60}: "Silicon Labs CP210x",
+}
+
+// USBID возвращает идентификатор USB вида 1A86:7523 (пусто для порта не на USB)
+func (p PortInfo) USBID() string {
+	if !p.USB {
+		return ""
+	}
+	return fmt.Sprintf("%04X:%04X", p.VID, p.PID)
+}
+
+// Chip возвращает название известной микросхемы преобразователя
+func (p PortInfo) Chip() string {
+	if !p.USB {
+		return ""
+	}
+	return knownChips[[2]uint16{p.VID, p.PID}]
+}
+
+// StableName возвращает имя, которое не меняется при переподключении
+// преобразователя: по серийному номеру, иначе по месту подключения, иначе
+// имя порта
+func (p PortInfo) StableName() string {
+	switch {
+	case p.SerialNumber != "":
+		return SerialPrefix + p.SerialNumber
+	case p.USB && p.Location != "":
+		return LocationPrefix + p.Location
+	default:
+		return p.Name
+	}
+}
+
+// String форматирует порт для вывода:
+// "ttyUSB0 USB 1A86:7523 CH340 (QinHeng USB Serial), серийный номер 5A7B, путь 1-1.2:1.0"
+func (p PortInfo) String() string {
+	text := p.Name
+	if p.USB {
+		text += " USB " + p.USBID()
+		if chip := p.Chip(); chip != "" {
+			text += " " + chip
+		}
+	}
+	description := strings.TrimSpace(p.Manufacturer + " " + p.Product)
+	if description == "" {
+		description = p.Description
+	}
+	if description != "" && description != p.Chip() {
+		text += " (" + description + ")"
+	}
+	if p.SerialNumber != "" {
+		text += ", серийный номер " + p.SerialNumber
+	}
+	if p.USB && p.Location != "" {
+		text += ", путь " + p.Location
+	}
+	return text
+}
+
+// sortPorts упорядочивает порты по имени
+func sortPorts(ports []PortInfo) {
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Name < ports[j].Name })
+}
+
+// IsStableName проверяет, задан ли порт постоянным именем (serial: или path:)
+func IsStableName(portName string) bool {
+	return strings.HasPrefix(portName, SerialPrefix) || strings.HasPrefix(portName, LocationPrefix)
+}
+
+// Resolve возвращает текущее имя порта. Постоянное имя (serial:5A7B,
+// path:1-1.2) ищется среди подключенных устройств; обычное имя возвращается
+// без изменений
+func Resolve(portName string) (string, error) {
+	if !IsStableName(portName) {
+		return portName, nil
+	}
+
+	ports, err := ListPorts()
+	if err != nil {
+		return "", fmt.Errorf("не удалось перечислить порты: %v", err)
+	}
+	port, err := findPort(ports, portName)
+	if err != nil {
+		return "", err
+	}
+	logger.Debug("Постоянное имя порта", "port", portName, "device", port.Name)
+	return port.Name, nil
+}
+
+// findPort находит порт по постоянному имени
+func findPort(ports []PortInfo, portName string) (PortInfo, error) {
+	var matches []PortInfo
+	switch {
+	case strings.HasPrefix(portName, SerialPrefix):
+		serial := strings.TrimPrefix(portName, SerialPrefix)
+		for _, port := range ports {
+			if port.SerialNumber != "" && strings.EqualFold(port.SerialNumber, serial) {
+				matches = append(matches, port)
+			}
+		}
+	case strings.HasPrefix(portName, LocationPrefix):
+		// Место можно указать без номера интерфейса: path:1-1.2 вместо path:1-1.2:1.0
+		location := strings.TrimPrefix(portName, LocationPrefix)
+		for _, port := range ports {
+			if port.Location == location || strings.HasPrefix(port.Location, location+":") {
+				matches = append(matches, port)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return PortInfo{}, fmt.Errorf("устройство %s не подключено", portName)
+	case 1:
+		return matches[0], nil
+	default:
+		var names []string
+		for _, port := range matches {
+			names = append(names, port.Name)
+		}
+		return PortInfo{}, fmt.Errorf("устройству %s соответствует несколько портов: %s",
+			portName, strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,99 @@
+package comport
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysClassTTY каталог sysfs с устройствами терминалов
+var sysClassTTY = "/sys/class/tty"
+
+// ListPorts перечисляет последовательные порты по sysfs. Встроенные порты
+// ttyS* без устройства (type 0) пропускаются
+func ListPorts() ([]PortInfo, error) {
+	entries, err := os.ReadDir(sysClassTTY)
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []PortInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		ttyDir := filepath.Join(sysClassTTY, name)
+
+		// Виртуальные терминалы и псевдотерминалы не связаны с устройством
+		device, err := filepath.EvalSymlinks(filepath.Join(ttyDir, "device"))
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(name, "ttyS") && readSysfs(filepath.Join(ttyDir, "type")) == "0" {
+			continue
+		}
+
+		port := PortInfo{Name: name, Path: devicePath(name)}
+		if usbDir := findUSBDevice(device); usbDir != "" {
+			port.USB = true
+			port.VID = readSysfsHex(filepath.Join(usbDir, "idVendor"))
+			port.PID = readSysfsHex(filepath.Join(usbDir, "idProduct"))
+			port.Manufacturer = readSysfs(filepath.Join(usbDir, "manufacturer"))
+			port.Product = readSysfs(filepath.Join(usbDir, "product"))
+			port.SerialNumber = readSysfs(filepath.Join(usbDir, "serial"))
+			port.Location = usbLocation(usbDir, device)
+		}
+		port.Description = port.Chip()
+		ports = append(ports, port)
+	}
+
+	sortPorts(ports)
+	return ports, nil
+}
+
+// findUSBDevice поднимается от устройства порта к устройству USB
+// (каталогу с idVendor); пусто, если порт не на USB
+func findUSBDevice(dir string) string {
+	for dir != "/" && dir != "." {
+		if _, err := os.Stat(filepath.Join(dir, "idVendor")); err == nil {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+	return ""
+}
+
+// usbLocation возвращает место подключения: интерфейс устройства USB с портом,
+// например 1-1.2:1.0 (шина 1, порт 1 корневого концентратора, порт 2 следующего,
+// конфигурация 1, интерфейс 0). Не меняется, пока преобразователь включен в то же гнездо
+func usbLocation(usbDir, device string) string {
+	rel, err := filepath.Rel(usbDir, device)
+	if err != nil || rel == "." {
+		return filepath.Base(usbDir)
+	}
+	return strings.Split(rel, string(filepath.Separator))[0]
+}
+
+// readSysfs читает атрибут sysfs без перевода строки
+func readSysfs(file string) string {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readSysfsHex читает шестнадцатеричный атрибут sysfs (idVendor, idProduct)
+func readSysfsHex(file string) uint16 {
+	value, _ := strconv.ParseUint(readSysfs(file), 16, 16)
+	return uint16(value)
+}
+
+// Present проверяет, подключено ли устройство порта (узел устройства существует)
+func Present(portName string) bool {
+	name, err := Resolve(portName)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(devicePath(name))
+	return err == nil
+}
@@ -0,0 +1,135 @@
+package comport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSysfs создает дерево sysfs с портами и подменяет им /sys/class/tty
+func fakeSysfs(t *testing.T) {
+	t.Helper()
+	root := t.TempDir()
+	previous := sysClassTTY
+	sysClassTTY = filepath.Join(root, "class", "tty")
+	t.Cleanup(func() { sysClassTTY = previous })
+
+	write := func(path, value string) {
+		t.Helper()
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// tty - класс устройства; device - путь устройства относительно root
+	tty := func(name, device string, attrs map[string]string) {
+		t.Helper()
+		dir := filepath.Join(root, "class", "tty", name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if device != "" {
+			if err := os.MkdirAll(filepath.Join(root, device), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink(filepath.Join(root, device), filepath.Join(dir, "device")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for attr, value := range attrs {
+			write(filepath.Join("class", "tty", name, attr), value)
+		}
+	}
+
+	// CH340 с серийным номером: концентратор 1-1, порт 2
+	usb := "devices/pci0000:00/usb1/1-1/1-1.2"
+	write(usb+"/idVendor", "1a86")
+	write(usb+"/idProduct", "7523")
+	write(usb+"/manufacturer", "QinHeng")
+	write(usb+"/product", "USB Serial")
+	write(usb+"/serial", "5A7B")
+	tty("ttyUSB0", usb+"/1-1.2:1.0/ttyUSB0", nil)
+
+	// Преобразователь без серийного номера
+	acm := "devices/pci0000:00/usb1/1-3"
+	write(acm+"/idVendor", "2341")
+	write(acm+"/idProduct", "0043")
+	tty("ttyACM0", acm+"/1-3:1.0/tty/ttyACM0", nil)
+
+	// Встроенные порты: без устройства (type 0) и с устройством
+	tty("ttyS0", "devices/platform/serial8250/tty/ttyS0", map[string]string{"type": "0"})
+	tty("ttyS1", "devices/pnp0/00:05/tty/ttyS1", map[string]string{"type": "4"})
+
+	// Виртуальный терминал без устройства
+	tty("tty1", "", nil)
+}
+
+func TestListPorts(t *testing.T) {
+	fakeSysfs(t)
+
+	ports, err := ListPorts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		usbID    string
+		location string
+		stable   string
+		text     string // Часть описания порта
+	}{
+		{"ttyACM0", "2341:0043", "1-3:1.0", "path:1-3:1.0", "путь 1-3:1.0"},
+		{"ttyS1", "", "", "ttyS1", "ttyS1"},
+		{"ttyUSB0", "1A86:7523", "1-1.2:1.0", "serial:5A7B", "CH340 (QinHeng USB Serial), серийный номер 5A7B"},
+	}
+	if len(ports) != len(tests) {
+		t.Fatalf("порты %v, ожидалось %d", ports, len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := ports[i]
+			if port.Name != tt.name || port.Path != "/dev/"+tt.name {
+				t.Fatalf("порт %s (%s), ожидался %s", port.Name, port.Path, tt.name)
+			}
+			if port.USBID() != tt.usbID || port.Location != tt.location || port.StableName() != tt.stable {
+				t.Errorf("USB %s, место %s, имя %s; ожидалось %s, %s, %s",
+					port.USBID(), port.Location, port.StableName(), tt.usbID, tt.location, tt.stable)
+			}
+			if !strings.Contains(port.String(), tt.text) {
+				t.Errorf("описание '%s', ожидалось '%s'", port.String(), tt.text)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	fakeSysfs(t)
+
+	tests := []struct {
+		port string
+		want string // Имя порта или часть ошибки
+	}{
+		{"ttyUSB1", "ttyUSB1"},
+		{"serial:5a7b", "ttyUSB0"},
+		{"path:1-1.2", "ttyUSB0"},
+		{"path:1-3:1.0", "ttyACM0"},
+		{"path:1-1", "не подключено"},
+		{"serial:0000", "не подключено"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.port, func(t *testing.T) {
+			name, err := Resolve(tt.port)
+			if err != nil {
+				name = err.Error()
+			}
+			if !strings.Contains(name, tt.want) {
+				t.Errorf("'%s', ожидалось '%s'", name, tt.want)
+			}
+		})
+	}
+}
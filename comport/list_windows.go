@@ -0,0 +1,217 @@
+package comport
+
+import (
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32         = syscall.NewLazyDLL("advapi32.dll")
+	procRegEnumValue = advapi32.NewProc("RegEnumValueW")
+)
+
+// ListPorts перечисляет COM-порты по реестру: имена из HARDWARE\DEVICEMAP\SERIALCOMM,
+// идентификаторы USB из веток устройств USB и FTDIBUS
+func ListPorts() ([]PortInfo, error) {
+	names, err := serialCommPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	usbPorts := make(map[string]PortInfo)
+	for _, enumKey := range []string{`SYSTEM\CurrentControlSet\Enum\USB`, `SYSTEM\CurrentControlSet\Enum\FTDIBUS`} {
+		collectUSBPorts(enumKey, usbPorts)
+	}
+
+	var ports []PortInfo
+	for _, name := range names {
+		port := PortInfo{Name: name, Path: `\\.\` + name}
+		if usb, exists := usbPorts[strings.ToUpper(name)]; exists {
+			usb.Name, usb.Path = port.Name, port.Path
+			port = usb
+		}
+		if port.Description == "" {
+			port.Description = port.Chip()
+		}
+		ports = append(ports, port)
+	}
+
+	sortPorts(ports)
+	return ports, nil
+}
+
+// serialCommPorts возвращает имена портов из HARDWARE\DEVICEMAP\SERIALCOMM
+func serialCommPorts() ([]string, error) {
+	key, err := openKey(syscall.HKEY_LOCAL_MACHINE, `HARDWARE\DEVICEMAP\SERIALCOMM`)
+	if err != nil {
+		if err == syscall.ERROR_FILE_NOT_FOUND {
+			return nil, nil // Ключа нет, если в системе нет ни одного порта
+		}
+		return nil, err
+	}
+	defer syscall.RegCloseKey(key)
+
+	var names []string
+	for i := uint32(0); ; i++ {
+		var valueName [256]uint16
+		var data [256]uint16
+		nameLen := uint32(len(valueName))
+		dataLen := uint32(len(data) * 2)
+		var valueType uint32
+		r, _, _ := procRegEnumValue.Call(uintptr(key), uintptr(i),
+			uintptr(unsafe.Pointer(&valueName[0])), uintptr(unsafe.Pointer(&nameLen)), 0,
+			uintptr(unsafe.Pointer(&valueType)), uintptr(unsafe.Pointer(&data[0])), uintptr(unsafe.Pointer(&dataLen)))
+		if r != 0 {
+			break // ERROR_NO_MORE_ITEMS
+		}
+		if valueType == syscall.REG_SZ {
+			names = append(names, syscall.UTF16ToString(data[:]))
+		}
+	}
+	return names, nil
+}
+
+// collectUSBPorts обходит ветку Enum\USB или Enum\FTDIBUS и собирает порты
+// с идентификаторами устройств: ...\VID_1A86&PID_7523\<экземпляр>\Device Parameters\PortName
+func collectUSBPorts(enumKey string, ports map[string]PortInfo) {
+	for _, deviceID := range subKeys(enumKey) {
+		vid, pid, ok := parseDeviceID(deviceID)
+		if !ok {
+			continue
+		}
+		deviceKey := enumKey + `\` + deviceID
+		for _, instance := range subKeys(deviceKey) {
+			instanceKey := deviceKey + `\` + instance
+			portName := stringValue(instanceKey+`\Device Parameters`, "PortName")
+			if portName == "" {
+				// У FTDI параметры порта на уровень ниже: ...\0000\Device Parameters
+				for _, sub := range subKeys(instanceKey) {
+					if portName = stringValue(instanceKey+`\`+sub+`\Device Parameters`, "PortName"); portName != "" {
+						break
+					}
+				}
+			}
+			if portName == "" {
+				continue
+			}
+			ports[strings.ToUpper(portName)] = PortInfo{
+				USB:          true,
+				VID:          vid,
+				PID:          pid,
+				Manufacturer: infString(stringValue(instanceKey, "Mfg")),
+				Product:      infString(stringValue(instanceKey, "DeviceDesc")),
+				SerialNumber: serialNumber(deviceID, instance),
+				Location:     stringValue(instanceKey, "LocationInformation"),
+				Description:  friendlyDescription(stringValue(instanceKey, "FriendlyName"), portName),
+			}
+		}
+	}
+}
+
+// parseDeviceID извлекает VID и PID из имени "VID_1A86&PID_7523" или "VID_0403+PID_6001+A1B2C3"
+func parseDeviceID(deviceID string) (vid, pid uint16, ok bool) {
+	upper := strings.ToUpper(deviceID)
+	vidAt := strings.Index(upper, "VID_")
+	pidAt := strings.Index(upper, "PID_")
+	if vidAt < 0 || pidAt < 0 || vidAt+8 > len(upper) || pidAt+8 > len(upper) {
+		return 0, 0, false
+	}
+	v, err1 := strconv.ParseUint(upper[vidAt+4:vidAt+8], 16, 16)
+	p, err2 := strconv.ParseUint(upper[pidAt+4:pidAt+8], 16, 16)
+	if err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+	return uint16(v), uint16(p), true
+}
+
+// serialNumber возвращает серийный номер устройства. Для USB это имя экземпляра,
+// если Windows не сгенерировала его сама (в сгенерированном есть '&');
+// для FTDIBUS номер записан в имени устройства: VID_0403+PID_6001+A10K5QZ3A
+func serialNumber(deviceID, instance string) string {
+	if parts := strings.Split(deviceID, "+"); len(parts) == 3 {
+		return parts[2]
+	}
+	if strings.Contains(instance, "&") {
+		return ""
+	}
+	return instance
+}
+
+// infString убирает ссылку на INF-файл из строки реестра: "@oem12.inf,%desc%;USB-SERIAL CH340"
+func infString(value string) string {
+	if i := strings.LastIndex(value, ";"); i >= 0 && strings.HasPrefix(value, "@") {
+		return value[i+1:]
+	}
+	return value
+}
+
+// friendlyDescription убирает имя порта из описания "USB-SERIAL CH340 (COM4)"
+func friendlyDescription(name, portName string) string {
+	return strings.TrimSpace(strings.TrimSuffix(name, "("+portName+")"))
+}
+
+// openKey открывает ключ реестра для чтения
+func openKey(root syscall.Handle, path string) (syscall.Handle, error) {
+	var key syscall.Handle
+	err := syscall.RegOpenKeyEx(root, syscall.StringToUTF16Ptr(path), 0, syscall.KEY_READ, &key)
+	return key, err
+}
+
+// subKeys возвращает имена вложенных ключей HKLM\path
+func subKeys(path string) []string {
+	key, err := openKey(syscall.HKEY_LOCAL_MACHINE, path)
+	if err != nil {
+		return nil
+	}
+	defer syscall.RegCloseKey(key)
+
+	var names []string
+	for i := uint32(0); ; i++ {
+		var name [256]uint16
+		nameLen := uint32(len(name))
+		if err := syscall.RegEnumKeyEx(key, i, &name[0], &nameLen, nil, nil, nil, nil); err != nil {
+			break
+		}
+		names = append(names, syscall.UTF16ToString(name[:nameLen]))
+	}
+	return names
+}
+
+// stringValue читает строковое значение HKLM\path\value; пусто, если его нет
+func stringValue(path, value string) string {
+	key, err := openKey(syscall.HKEY_LOCAL_MACHINE, path)
+	if err != nil {
+		return ""
+	}
+	defer syscall.RegCloseKey(key)
+
+	var data [512]uint16
+	dataLen := uint32(len(data) * 2)
+	var valueType uint32
+	err = syscall.RegQueryValueEx(key, syscall.StringToUTF16Ptr(value), nil, &valueType,
+		(*byte)(unsafe.Pointer(&data[0])), &dataLen)
+	if err != nil || valueType != syscall.REG_SZ {
+		return ""
+	}
+	return syscall.UTF16ToString(data[:])
+}
+
+// Present проверяет, подключено ли устройство порта (порт есть в SERIALCOMM)
+func Present(portName string) bool {
+	name, err := Resolve(portName)
+	if err != nil {
+		return false
+	}
+	names, err := serialCommPorts()
+	if err != nil {
+		return false
+	}
+	for _, present := range names {
+		if strings.EqualFold(present, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package comport
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// PromptPort выводит найденные порты и запрашивает порт у оператора. Можно
+// ввести номер из списка, имя порта или постоянное имя (serial:..., path:...).
+// Порт из списка выбирается по постоянному имени, чтобы переподключение
+// преобразователя не меняло назначение. Пустой ввод - defaultName
+func PromptPort(defaultName string) string {
+	ports, err := ListPorts()
+	if err == nil && len(ports) > 0 {
+		fmt.Println("Найденные порты:")
+		for i, port := range ports {
+			fmt.Printf("  %d. %s\n", i+1, port)
+		}
+	}
+
+	fmt.Printf("Введите имя или номер порта (по умолчанию %s): ", defaultName)
+	var input string
+	fmt.Scanln(&input)
+	if input == "" {
+		return defaultName
+	}
+	if number, err := strconv.Atoi(input); err == nil && number >= 1 && number <= len(ports) {
+		return ports[number-1].StableName()
+	}
+	return input
+}
@@ -0,0 +1,68 @@
+package comport
+
+import (
+	"sync"
+	"time"
+)
+
+// Порты, на которых направление RS-485 переключается программно: драйвер
+// не умеет сам управлять RTS на время передачи (большинство USB-преобразователей)
+var (
+	softRS485Mu sync.Mutex
+	softRS485   = make(map[Handle]RS485)
+)
+
+// setSoftRS485 включает или выключает программное переключение направления
+// и переводит преобразователь на прием
+func setSoftRS485(handle Handle, rs485 RS485) error {
+	if rs485.Enabled {
+		if err := setRTS(handle, rs485.InvertRTS); err != nil {
+			forgetSoftRS485(handle)
+			return err
+		}
+	}
+
+	softRS485Mu.Lock()
+	defer softRS485Mu.Unlock()
+	if rs485.Enabled {
+		softRS485[handle] = rs485
+	} else {
+		delete(softRS485, handle)
+	}
+	return nil
+}
+
+// forgetSoftRS485 убирает закрытый порт из программного режима
+func forgetSoftRS485(handle Handle) {
+	softRS485Mu.Lock()
+	delete(softRS485, handle)
+	softRS485Mu.Unlock()
+}
+
+// writeDirected записывает данные, переключая преобразователь RS-485 на передачу,
+// если порт в программном режиме. Прием включается после того, как драйвер
+// передал все байты
+func writeDirected(handle Handle, buf []byte, write func([]byte) (uint32, error)) (uint32, error) {
+	softRS485Mu.Lock()
+	rs485, soft := softRS485[handle]
+	softRS485Mu.Unlock()
+	if !soft {
+		return write(buf)
+	}
+
+	if err := setRTS(handle, !rs485.InvertRTS); err != nil {
+		return 0, err
+	}
+	time.Sleep(rs485.DelayBefore)
+
+	written, err := write(buf)
+	if err == nil {
+		err = drain(handle)
+	}
+	time.Sleep(rs485.DelayAfter)
+
+	if rtsErr := setRTS(handle, rs485.InvertRTS); err == nil {
+		err = rtsErr
+	}
+	return written, err
+}
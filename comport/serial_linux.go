@@ -0,0 +1,294 @@
+package comport
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Handle дескриптор открытого порта
+type Handle = int
+
+// Константы termios, отсутствующие в пакете syscall (значения x86 и ARM)
+const (
+	cbaud   = 0x100f
+	crtscts = 0x80000000
+	cmspar  = 0x40000000
+	tcflsh  = 0x540B
+	tcsbrk  = 0x5409
+)
+
+// Биты данных termios
+var dataBits = map[int]uint32{
+	5: syscall.CS5,
+	6: syscall.CS6,
+	7: syscall.CS7,
+	8: syscall.CS8,
+}
+
+// serialRS485 структура serial_rs485 ядра для TIOCSRS485
+type serialRS485 struct {
+	Flags              uint32
+	DelayRTSBeforeSend uint32 // мс
+	DelayRTSAfterSend  uint32 // мс
+	padding            [5]uint32
+}
+
+// Флаги serial_rs485
+const (
+	serRS485Enabled      = 1 << 0
+	serRS485RTSOnSend    = 1 << 1
+	serRS485RTSAfterSend = 1 << 2
+)
+
+// Скорости termios
+var baudRates = map[uint32]uint32{
+	1200:   syscall.B1200,
+	2400:   syscall.B2400,
+	4800:   syscall.B4800,
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+}
+
+// ioctl вызывает ioctl для дескриптора порта
+func ioctl(fd Handle, request uintptr, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// devicePath возвращает путь устройства: имя без каталога ищется в /dev
+func devicePath(portName string) string {
+	if strings.HasPrefix(portName, "/") {
+		return portName
+	}
+	return "/dev/" + portName
+}
+
+// OpenPort открывает последовательный порт (например, ttyUSB0, /dev/ttyS0
+// или постоянное имя serial:5A7B, path:1-1.2)
+func OpenPort(portName string) (Handle, error) {
+	name, err := Resolve(portName)
+	if err != nil {
+		return -1, err
+	}
+	path := devicePath(name)
+	// O_NONBLOCK не дает зависнуть на открытии, пока нет сигнала DCD
+	fd, err := syscall.Open(path, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		logger.Debug("Порт не открыт", "port", path, "error", err)
+		return -1, os.NewSyscallError("open", err)
+	}
+	if err := syscall.SetNonblock(fd, false); err != nil {
+		syscall.Close(fd)
+		return -1, os.NewSyscallError("fcntl", err)
+	}
+
+	logger.Debug("Порт открыт", "port", path, "handle", fd)
+	tapOpened(fd, name)
+	return fd, nil
+}
+
+// ClosePort закрывает порт
+func ClosePort(handle Handle) {
+	tapClosed(handle)
+	forgetSoftRS485(handle)
+	syscall.Close(handle)
+	logger.Debug("Порт закрыт", "handle", handle)
+}
+
+// Configure устанавливает скорость, формат, управление потоком, состояние
+// линий RTS и DTR и режим RS-485. RS-485 включается в драйвере (TIOCSRS485),
+// а если драйвер его не поддерживает - направление переключается программно
+func Configure(handle Handle, settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	speed, exists := baudRates[settings.BaudRate]
+	if !exists {
+		return fmt.Errorf("скорость %d бод не поддерживается", settings.BaudRate)
+	}
+	if settings.StopBits == StopBits1_5 {
+		return fmt.Errorf("1,5 стоповых бита в Linux не поддерживаются")
+	}
+
+	var tio syscall.Termios
+	if err := ioctl(handle, syscall.TCGETS, uintptr(unsafe.Pointer(&tio))); err != nil {
+		return os.NewSyscallError("TCGETS", err)
+	}
+
+	tio.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON | syscall.IXOFF | syscall.IXANY |
+		syscall.INPCK | syscall.IGNPAR
+	tio.Oflag &^= syscall.OPOST
+	tio.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	tio.Cflag &^= syscall.CSIZE | syscall.PARENB | syscall.PARODD | cmspar | syscall.CSTOPB | cbaud | crtscts
+	tio.Cflag |= dataBits[settings.DataBits] | syscall.CREAD | syscall.CLOCAL | speed
+
+	switch settings.Parity {
+	case ParityOdd:
+		tio.Cflag |= syscall.PARENB | syscall.PARODD
+	case ParityEven:
+		tio.Cflag |= syscall.PARENB
+	case ParityMark:
+		tio.Cflag |= syscall.PARENB | cmspar | syscall.PARODD
+	case ParitySpace:
+		tio.Cflag |= syscall.PARENB | cmspar
+	}
+	if settings.Parity != ParityNone {
+		tio.Iflag |= syscall.INPCK
+	}
+	if settings.StopBits == StopBits2 {
+		tio.Cflag |= syscall.CSTOPB
+	}
+
+	switch settings.FlowControl {
+	case FlowHardware:
+		tio.Cflag |= crtscts
+	case FlowSoftware:
+		tio.Iflag |= syscall.IXON | syscall.IXOFF
+		tio.Cc[syscall.VSTART] = xonChar
+		tio.Cc[syscall.VSTOP] = xoffChar
+	}
+	tio.Ispeed = speed
+	tio.Ospeed = speed
+
+	if err := ioctl(handle, syscall.TCSETS, uintptr(unsafe.Pointer(&tio))); err != nil {
+		return os.NewSyscallError("TCSETS", err)
+	}
+
+	if err := setSignal(handle, syscall.TIOCM_DTR, settings.DTR); err != nil {
+		return err
+	}
+	if err := setSignal(handle, syscall.TIOCM_RTS, settings.RTS); err != nil {
+		return err
+	}
+	if err := setRS485(handle, settings.RS485); err != nil {
+		return err
+	}
+	logger.Debug("Параметры порта установлены", "handle", handle, "baud", settings.BaudRate, "line", settings.String())
+	tapConfigured(handle, settings)
+	return nil
+}
+
+// setRS485 включает режим RS-485 в драйвере; если драйвер его не поддерживает
+// (ENOTTY, EINVAL), направление переключается программно при записи
+func setRS485(handle Handle, rs485 RS485) error {
+	if !rs485.Enabled {
+		return setSoftRS485(handle, rs485)
+	}
+
+	config := serialRS485{
+		Flags:              serRS485Enabled | serRS485RTSOnSend,
+		DelayRTSBeforeSend: uint32(rs485.DelayBefore.Milliseconds()),
+		DelayRTSAfterSend:  uint32(rs485.DelayAfter.Milliseconds()),
+	}
+	if rs485.InvertRTS {
+		config.Flags = serRS485Enabled | serRS485RTSAfterSend
+	}
+	err := ioctl(handle, syscall.TIOCSRS485, uintptr(unsafe.Pointer(&config)))
+	switch err {
+	case nil:
+		logger.Debug("RS-485 включен в драйвере", "handle", handle)
+		return setSoftRS485(handle, RS485{})
+	case syscall.ENOTTY, syscall.EINVAL, syscall.EOPNOTSUPP:
+		logger.Debug("Драйвер не поддерживает RS-485, направление переключается программно", "handle", handle)
+		return setSoftRS485(handle, rs485)
+	default:
+		return os.NewSyscallError("TIOCSRS485", err)
+	}
+}
+
+// setSignal устанавливает или сбрасывает линию модема (TIOCM_RTS, TIOCM_DTR)
+func setSignal(handle Handle, line int, signal Signal) error {
+	switch signal {
+	case SignalOn:
+		if err := ioctl(handle, syscall.TIOCMBIS, uintptr(unsafe.Pointer(&line))); err != nil {
+			return os.NewSyscallError("TIOCMBIS", err)
+		}
+	case SignalOff:
+		if err := ioctl(handle, syscall.TIOCMBIC, uintptr(unsafe.Pointer(&line))); err != nil {
+			return os.NewSyscallError("TIOCMBIC", err)
+		}
+	}
+	return nil
+}
+
+// setRTS устанавливает (on) или сбрасывает линию RTS
+func setRTS(handle Handle, on bool) error {
+	if on {
+		return setSignal(handle, syscall.TIOCM_RTS, SignalOn)
+	}
+	return setSignal(handle, syscall.TIOCM_RTS, SignalOff)
+}
+
+// drain ждет, пока драйвер передаст все записанные байты (tcdrain)
+func drain(handle Handle) error {
+	if err := ioctl(handle, tcsbrk, 1); err != nil {
+		return os.NewSyscallError("TCSBRK", err)
+	}
+	return nil
+}
+
+// SetCommTimeouts настраивает чтение без ожидания: как и в Windows, чтение
+// возвращает доступные байты сразу, а ожидание ответа ведет вызывающий код
+func SetCommTimeouts(handle Handle) error {
+	var tio syscall.Termios
+	if err := ioctl(handle, syscall.TCGETS, uintptr(unsafe.Pointer(&tio))); err != nil {
+		return os.NewSyscallError("TCGETS", err)
+	}
+
+	tio.Cc[syscall.VMIN] = 0
+	tio.Cc[syscall.VTIME] = 0
+
+	if err := ioctl(handle, syscall.TCSETS, uintptr(unsafe.Pointer(&tio))); err != nil {
+		return os.NewSyscallError("TCSETS", err)
+	}
+	return nil
+}
+
+// PurgeComm очищает буферы приема и передачи
+func PurgeComm(handle Handle) error {
+	if err := ioctl(handle, tcflsh, syscall.TCIOFLUSH); err != nil {
+		return os.NewSyscallError("TCFLSH", err)
+	}
+	return nil
+}
+
+// WritePort записывает данные в порт
+func WritePort(handle Handle, buf []byte) (uint32, error) {
+	started := time.Now()
+	written, err := writeDirected(handle, buf, func(buf []byte) (uint32, error) {
+		written, err := syscall.Write(handle, buf)
+		if err != nil {
+			return 0, os.NewSyscallError("write", err)
+		}
+		return uint32(written), nil
+	})
+	tapped(handle, DirectionTX, buf[:written], started)
+	if err != nil {
+		return written, err
+	}
+
+	logger.Debug("Запись в порт", "handle", handle, "bytes", written)
+	return written, nil
+}
+
+// ReadPort читает доступные данные из порта
+func ReadPort(handle Handle, buf []byte) (uint32, error) {
+	read, err := syscall.Read(handle, buf)
+	if err != nil {
+		return 0, os.NewSyscallError("read", err)
+	}
+	if read > 0 {
+		tapped(handle, DirectionRX, buf[:read], time.Now())
+	}
+	return uint32(read), nil
+}
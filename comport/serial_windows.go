@@ -0,0 +1,328 @@
+package comport
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Handle дескриптор открытого порта
+type Handle = syscall.Handle
+
+var (
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procCreateFile      = kernel32.NewProc("CreateFileW")
+	procCloseHandle     = kernel32.NewProc("CloseHandle")
+	procWriteFile       = kernel32.NewProc("WriteFile")
+	procReadFile        = kernel32.NewProc("ReadFile")
+	procGetCommState    = kernel32.NewProc("GetCommState")
+	procSetCommState    = kernel32.NewProc("SetCommState")
+	procSetCommTimeouts = kernel32.NewProc("SetCommTimeouts")
+	procPurgeComm       = kernel32.NewProc("PurgeComm")
+	procEscapeComm      = kernel32.NewProc("EscapeCommFunction")
+	procFlushBuffers    = kernel32.NewProc("FlushFileBuffers")
+)
+
+type DCB struct {
+	DCBlength, BaudRate                            uint32
+	flags                                          uint32
+	wReserved, XonLim, XoffLim                     uint16
+	ByteSize, Parity, StopBits                     byte
+	XonChar, XoffChar, ErrorChar, EofChar, EvtChar byte
+	wReserved1                                     uint16
+}
+
+type COMMTIMEOUTS struct {
+	ReadIntervalTimeout         uint32
+	ReadTotalTimeoutMultiplier  uint32
+	ReadTotalTimeoutConstant    uint32
+	WriteTotalTimeoutMultiplier uint32
+	WriteTotalTimeoutConstant   uint32
+}
+
+const (
+	PURGE_TXABORT        = 0x0001
+	PURGE_RXABORT        = 0x0002
+	PURGE_TXCLEAR        = 0x0004
+	PURGE_RXCLEAR        = 0x0008
+	INVALID_HANDLE_VALUE = ^uintptr(0)
+)
+
+// Битовые поля DCB.flags
+const (
+	dcbBinary          = 1 << 0
+	dcbParity          = 1 << 1
+	dcbOutxCtsFlow     = 1 << 2
+	dcbOutxDsrFlow     = 1 << 3
+	dcbDtrControlShift = 4 // 2 бита: DTR_CONTROL_*
+	dcbDsrSensitivity  = 1 << 6
+	dcbOutX            = 1 << 8
+	dcbInX             = 1 << 9
+	dcbRtsControlShift = 12 // 2 бита: RTS_CONTROL_*
+	dcbAbortOnError    = 1 << 14
+	dcbControlMask     = 3
+)
+
+// Режимы линий DTR и RTS в DCB
+const (
+	controlDisable   = 0
+	controlEnable    = 1
+	controlHandshake = 2
+	rtsControlToggle = 3 // RTS установлена только на время передачи
+)
+
+// errorInvalidFunction ERROR_INVALID_FUNCTION: драйвер не поддерживает операцию
+const errorInvalidFunction = syscall.Errno(1)
+
+// Функции EscapeCommFunction
+const (
+	escSetRTS = 3
+	escClrRTS = 4
+)
+
+// OpenPort открывает COM-порт (например, COM4 или постоянное имя serial:5A7B)
+func OpenPort(portName string) (syscall.Handle, error) {
+	portName, err := Resolve(portName)
+	if err != nil {
+		return 0, err
+	}
+	path := syscall.StringToUTF16Ptr("\\\\.\\" + portName)
+	handle, _, err := procCreateFile.Call(
+		uintptr(unsafe.Pointer(path)),
+		syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+		0,
+		0,
+		syscall.OPEN_EXISTING,
+		0,
+		0)
+
+	if handle == INVALID_HANDLE_VALUE {
+		logger.Debug("Порт не открыт", "port", portName, "error", err)
+		return 0, os.NewSyscallError("CreateFile", err)
+	}
+
+	logger.Debug("Порт открыт", "port", portName, "handle", handle)
+	tapOpened(syscall.Handle(handle), portName)
+	return syscall.Handle(handle), nil
+}
+
+// ClosePort закрывает COM-порт
+func ClosePort(handle syscall.Handle) {
+	tapClosed(handle)
+	forgetSoftRS485(handle)
+	procCloseHandle.Call(uintptr(handle))
+	logger.Debug("Порт закрыт", "handle", uintptr(handle))
+}
+
+// Configure устанавливает скорость, формат, управление потоком, состояние
+// линий RTS и DTR и режим RS-485. Незаданные линии остаются в режиме драйвера.
+// RS-485 без инверсии и пауз включается в драйвере (RTS_CONTROL_TOGGLE),
+// иначе или если драйвер его не принимает - направление переключается программно
+func Configure(handle syscall.Handle, settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	var dcb DCB
+	dcb.DCBlength = uint32(unsafe.Sizeof(dcb))
+	if r, _, err := procGetCommState.Call(uintptr(handle), uintptr(unsafe.Pointer(&dcb))); r == 0 {
+		return os.NewSyscallError("GetCommState", err)
+	}
+
+	dcb.BaudRate = settings.BaudRate
+	dcb.ByteSize = byte(settings.DataBits)
+	dcb.Parity = byte(settings.Parity)
+	dcb.StopBits = byte(settings.StopBits)
+
+	dcb.flags &^= dcbParity | dcbOutxCtsFlow | dcbOutxDsrFlow | dcbDsrSensitivity | dcbOutX | dcbInX | dcbAbortOnError
+	dcb.flags |= dcbBinary
+	if settings.Parity != ParityNone {
+		dcb.flags |= dcbParity
+	}
+
+	dtr := control(dcb.flags, dcbDtrControlShift)
+	if dtr == controlHandshake {
+		dtr = controlEnable
+	}
+	switch settings.DTR {
+	case SignalOn:
+		dtr = controlEnable
+	case SignalOff:
+		dtr = controlDisable
+	}
+
+	rts := control(dcb.flags, dcbRtsControlShift)
+	if rts == controlHandshake || rts == rtsControlToggle {
+		rts = controlEnable
+	}
+	switch settings.RTS {
+	case SignalOn:
+		rts = controlEnable
+	case SignalOff:
+		rts = controlDisable
+	}
+
+	switch settings.FlowControl {
+	case FlowHardware:
+		dcb.flags |= dcbOutxCtsFlow
+		rts = controlHandshake
+	case FlowSoftware:
+		dcb.flags |= dcbOutX | dcbInX
+		dcb.XonChar, dcb.XoffChar = xonChar, xoffChar
+		dcb.XonLim, dcb.XoffLim = 2048, 512
+	}
+
+	rs485 := settings.RS485
+	driverRS485 := rs485.Enabled && !rs485.InvertRTS && rs485.DelayBefore == 0 && rs485.DelayAfter == 0
+	if driverRS485 {
+		err := setCommState(handle, &dcb, dtr, rtsControlToggle)
+		if err == nil {
+			logger.Debug("RS-485 включен в драйвере", "handle", uintptr(handle))
+			rs485 = RS485{}
+		} else {
+			logger.Debug("Драйвер не поддерживает RS-485, направление переключается программно",
+				"handle", uintptr(handle), "error", err)
+			driverRS485 = false
+		}
+	}
+	if !driverRS485 {
+		if rs485.Enabled {
+			rts = controlDisable // Линией управляет программа
+		}
+		if err := setCommState(handle, &dcb, dtr, rts); err != nil {
+			return err
+		}
+	}
+	if err := setSoftRS485(handle, rs485); err != nil {
+		return err
+	}
+	logger.Debug("Параметры порта установлены", "handle", uintptr(handle), "baud", settings.BaudRate,
+		"line", settings.String())
+	tapConfigured(handle, settings)
+	return nil
+}
+
+// control возвращает режим линии из поля flags
+func control(flags uint32, shift uint) uint32 {
+	return flags >> shift & dcbControlMask
+}
+
+// setCommState записывает DCB с режимами линий DTR и RTS
+func setCommState(handle syscall.Handle, dcb *DCB, dtr, rts uint32) error {
+	dcb.flags &^= dcbControlMask<<dcbDtrControlShift | dcbControlMask<<dcbRtsControlShift
+	dcb.flags |= dtr<<dcbDtrControlShift | rts<<dcbRtsControlShift
+
+	r, _, err := procSetCommState.Call(
+		uintptr(handle),
+		uintptr(unsafe.Pointer(dcb)))
+
+	if r == 0 {
+		return os.NewSyscallError("SetCommState", err)
+	}
+	return nil
+}
+
+// setRTS устанавливает (on) или сбрасывает линию RTS
+func setRTS(handle syscall.Handle, on bool) error {
+	function := uintptr(escClrRTS)
+	if on {
+		function = escSetRTS
+	}
+	if r, _, err := procEscapeComm.Call(uintptr(handle), function); r == 0 {
+		return os.NewSyscallError("EscapeCommFunction", err)
+	}
+	return nil
+}
+
+// drain ждет, пока драйвер передаст все записанные байты
+func drain(handle syscall.Handle) error {
+	if r, _, err := procFlushBuffers.Call(uintptr(handle)); r == 0 {
+		if errors.Is(err, errorInvalidFunction) {
+			return nil // Драйвер не поддерживает ожидание передачи
+		}
+		return os.NewSyscallError("FlushFileBuffers", err)
+	}
+	return nil
+}
+
+// SetCommTimeouts устанавливает таймауты для COM-порта
+func SetCommTimeouts(handle syscall.Handle) error {
+	var timeouts COMMTIMEOUTS
+	timeouts.ReadIntervalTimeout = 0
+	timeouts.ReadTotalTimeoutMultiplier = 1
+	timeouts.ReadTotalTimeoutConstant = 2
+	timeouts.WriteTotalTimeoutMultiplier = 0
+	timeouts.WriteTotalTimeoutConstant = 0
+
+	r, _, err := procSetCommTimeouts.Call(
+		uintptr(handle),
+		uintptr(unsafe.Pointer(&timeouts)))
+
+	if r == 0 {
+		return os.NewSyscallError("SetCommTimeouts", err)
+	}
+
+	return nil
+}
+
+// PurgeComm очищает буферы COM-порта
+func PurgeComm(handle syscall.Handle) error {
+	r, _, err := procPurgeComm.Call(
+		uintptr(handle),
+		uintptr(PURGE_RXCLEAR|PURGE_TXCLEAR))
+
+	if r == 0 {
+		return os.NewSyscallError("PurgeComm", err)
+	}
+
+	return nil
+}
+
+// WritePort записывает данные в COM-порт
+func WritePort(handle syscall.Handle, buf []byte) (uint32, error) {
+	started := time.Now()
+	written, err := writeDirected(handle, buf, func(buf []byte) (uint32, error) {
+		var written uint32
+		r, _, err := procWriteFile.Call(
+			uintptr(handle),
+			uintptr(unsafe.Pointer(&buf[0])),
+			uintptr(len(buf)),
+			uintptr(unsafe.Pointer(&written)),
+			0)
+
+		if r == 0 {
+			return 0, os.NewSyscallError("WriteFile", err)
+		}
+		return written, nil
+	})
+	tapped(handle, DirectionTX, buf[:written], started)
+	if err != nil {
+		return written, err
+	}
+	logger.Debug("Запись в порт", "handle", uintptr(handle), "bytes", written)
+
+	return written, nil
+}
+
+// ReadPort читает данные из COM-порта
+func ReadPort(handle syscall.Handle, buf []byte) (uint32, error) {
+	var read uint32
+	r, _, err := procReadFile.Call(
+		uintptr(handle),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+		uintptr(unsafe.Pointer(&read)),
+		0)
+
+	if r == 0 {
+		return 0, os.NewSyscallError("ReadFile", err)
+	}
+	if read > 0 {
+		tapped(handle, DirectionRX, buf[:read], time.Now())
+	}
+
+	return read, nil
+}
@@ -0,0 +1,247 @@
+package comport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parity контроль четности; значения совпадают с полем Parity структуры DCB
+type Parity byte
+
+const (
+	ParityNone  Parity = iota // N
+	ParityOdd                 // O
+	ParityEven                // E
+	ParityMark                // M: бит четности всегда 1
+	ParitySpace               // S: бит четности всегда 0
+)
+
+// parityLetters обозначения четности в формате 8N1
+const parityLetters = "NOEMS"
+
+// StopBits число стоповых битов; значения совпадают с полем StopBits структуры DCB
+type StopBits byte
+
+const (
+	StopBits1   StopBits = iota // 1
+	StopBits1_5                 // 1,5 (только Windows, 5 битов данных)
+	StopBits2                   // 2
+)
+
+// FlowControl управление потоком
+type FlowControl byte
+
+const (
+	FlowNone     FlowControl = iota // Без управления потоком
+	FlowHardware                    // Аппаратное: RTS/CTS
+	FlowSoftware                    // Программное: XON/XOFF
+)
+
+// Signal состояние линии RTS или DTR после открытия порта
+type Signal byte
+
+const (
+	SignalDefault Signal = iota // Как выставит драйвер
+	SignalOn                    // Установлена
+	SignalOff                   // Сброшена
+)
+
+// Символы программного управления потоком
+const (
+	xonChar  = 0x11
+	xoffChar = 0x13
+)
+
+// RS485 полудуплексный режим преобразователя RS-485: направление передачи
+// переключается линией RTS на время отправки
+type RS485 struct {
+	Enabled     bool
+	InvertRTS   bool          // Во время передачи RTS сброшена, в покое установлена
+	DelayBefore time.Duration // Пауза после переключения на передачу
+	DelayAfter  time.Duration // Пауза перед возвратом на прием
+}
+
+// Settings параметры линии порта
+type Settings struct {
+	BaudRate    uint32
+	DataBits    int // 5-8
+	Parity      Parity
+	StopBits    StopBits
+	FlowControl FlowControl
+	RTS         Signal // Не задается при аппаратном управлении потоком и RS-485
+	DTR         Signal
+	RS485       RS485
+}
+
+// DefaultSettings возвращает формат 8N1 без управления потоком
+func DefaultSettings(baudRate uint32) Settings {
+	return Settings{BaudRate: baudRate, DataBits: 8}
+}
+
+// ParseSettings разбирает формат линии: части через запятую в любом порядке.
+// Пустая строка - 8N1:
+//
+//	8N1, 7E2, 8O1.5    биты данных, четность (N, O, E, M, S), стоповые биты
+//	rtscts, xonxoff    аппаратное или программное управление потоком
+//	rts=on, dtr=off    состояние линий RTS и DTR
+//	rs485              переключение направления линией RTS
+//	rs485-invert       RTS сброшена во время передачи
+//	rs485-before=1ms   пауза после переключения на передачу
+//	rs485-after=1ms    пауза перед возвратом на прием
+func ParseSettings(baudRate uint32, text string) (Settings, error) {
+	settings := DefaultSettings(baudRate)
+	for _, part := range strings.Split(text, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		key, value, hasValue := strings.Cut(part, "=")
+		switch {
+		case part == "":
+		case !hasValue && len(part) >= 3 && part[0] >= '5' && part[0] <= '8':
+			if err := settings.parseFraming(part); err != nil {
+				return settings, err
+			}
+		case part == "rtscts":
+			settings.FlowControl = FlowHardware
+		case part == "xonxoff":
+			settings.FlowControl = FlowSoftware
+		case key == "rts" || key == "dtr":
+			signal, err := parseSignal(value)
+			if err != nil {
+				return settings, fmt.Errorf("%s: %v", key, err)
+			}
+			if key == "rts" {
+				settings.RTS = signal
+			} else {
+				settings.DTR = signal
+			}
+		case part == "rs485":
+			settings.RS485.Enabled = true
+		case part == "rs485-invert":
+			settings.RS485.Enabled, settings.RS485.InvertRTS = true, true
+		case key == "rs485-before" || key == "rs485-after":
+			delay, err := time.ParseDuration(value)
+			if err != nil || delay < 0 {
+				return settings, fmt.Errorf("неверная пауза %s: '%s'", key, value)
+			}
+			settings.RS485.Enabled = true
+			if key == "rs485-before" {
+				settings.RS485.DelayBefore = delay
+			} else {
+				settings.RS485.DelayAfter = delay
+			}
+		default:
+			return settings, fmt.Errorf("неизвестный параметр линии '%s'", part)
+		}
+	}
+	return settings, settings.Validate()
+}
+
+// parseFraming разбирает биты данных, четность и стоповые биты: 8N1, 7E2, 5N1.5
+func (s *Settings) parseFraming(text string) error {
+	parity := strings.IndexByte(parityLetters, strings.ToUpper(text[1:2])[0])
+	if parity < 0 {
+		return fmt.Errorf("неизвестная четность в '%s' (N, O, E, M, S)", text)
+	}
+	s.DataBits = int(text[0] - '0')
+	s.Parity = Parity(parity)
+	switch text[2:] {
+	case "1":
+		s.StopBits = StopBits1
+	case "1.5":
+		s.StopBits = StopBits1_5
+	case "2":
+		s.StopBits = StopBits2
+	default:
+		return fmt.Errorf("неверное число стоповых битов в '%s' (1, 1.5, 2)", text)
+	}
+	return nil
+}
+
+// parseSignal разбирает состояние линии: on или off
+func parseSignal(text string) (Signal, error) {
+	switch text {
+	case "on", "1":
+		return SignalOn, nil
+	case "off", "0":
+		return SignalOff, nil
+	}
+	return SignalDefault, fmt.Errorf("неверное состояние линии '%s' (on, off)", text)
+}
+
+// Validate проверяет, что параметры совместимы друг с другом
+func (s Settings) Validate() error {
+	if s.DataBits < 5 || s.DataBits > 8 {
+		return fmt.Errorf("неверное число битов данных: %d (5-8)", s.DataBits)
+	}
+	if s.Parity > ParitySpace {
+		return fmt.Errorf("неверная четность: %d", s.Parity)
+	}
+	if s.StopBits > StopBits2 {
+		return fmt.Errorf("неверное число стоповых битов: %d", s.StopBits)
+	}
+	if s.StopBits == StopBits1_5 && s.DataBits != 5 {
+		return fmt.Errorf("1,5 стоповых бита допустимы только при 5 битах данных")
+	}
+	if s.FlowControl > FlowSoftware {
+		return fmt.Errorf("неверное управление потоком: %d", s.FlowControl)
+	}
+	if s.RS485.Enabled && s.FlowControl == FlowHardware {
+		return fmt.Errorf("RS-485 и аппаратное управление потоком используют одну линию RTS")
+	}
+	if s.RTS != SignalDefault && (s.RS485.Enabled || s.FlowControl == FlowHardware) {
+		return fmt.Errorf("линией RTS управляет %s, ее состояние задать нельзя", s.rtsOwner())
+	}
+	return nil
+}
+
+// rtsOwner описывает, чем занята линия RTS
+func (s Settings) rtsOwner() string {
+	if s.RS485.Enabled {
+		return "RS-485"
+	}
+	return "управление потоком"
+}
+
+// String форматирует параметры в виде, который принимает ParseSettings:
+// "8N1", "8E1,rtscts", "8N1,rs485,rs485-after=2ms"
+func (s Settings) String() string {
+	stopBits := map[StopBits]string{StopBits1: "1", StopBits1_5: "1.5", StopBits2: "2"}[s.StopBits]
+	parts := []string{strconv.Itoa(s.DataBits) + parityLetters[s.Parity:s.Parity+1] + stopBits}
+	switch s.FlowControl {
+	case FlowHardware:
+		parts = append(parts, "rtscts")
+	case FlowSoftware:
+		parts = append(parts, "xonxoff")
+	}
+	for _, line := range []struct {
+		name   string
+		signal Signal
+	}{{"rts", s.RTS}, {"dtr", s.DTR}} {
+		switch line.signal {
+		case SignalOn:
+			parts = append(parts, line.name+"=on")
+		case SignalOff:
+			parts = append(parts, line.name+"=off")
+		}
+	}
+	if s.RS485.Enabled {
+		if s.RS485.InvertRTS {
+			parts = append(parts, "rs485-invert")
+		} else {
+			parts = append(parts, "rs485")
+		}
+		if s.RS485.DelayBefore > 0 {
+			parts = append(parts, "rs485-before="+s.RS485.DelayBefore.String())
+		}
+		if s.RS485.DelayAfter > 0 {
+			parts = append(parts, "rs485-after="+s.RS485.DelayAfter.String())
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// SetCommParams устанавливает скорость и формат 8N1 без управления потоком
+func SetCommParams(handle Handle, baudRate uint32) error {
+	return Configure(handle, DefaultSettings(baudRate))
+}
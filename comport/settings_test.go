@@ -0,0 +1,93 @@
+package comport
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSettings(t *testing.T) {
+	tests := []struct {
+		text string
+		want Settings // Без скорости; пусто при ошибке
+		err  string   // Часть ошибки
+	}{
+		{"", Settings{DataBits: 8}, ""},
+		{"8N1", Settings{DataBits: 8}, ""},
+		{"7e2", Settings{DataBits: 7, Parity: ParityEven, StopBits: StopBits2}, ""},
+		{"5S1.5", Settings{DataBits: 5, Parity: ParitySpace, StopBits: StopBits1_5}, ""},
+		{"8O1, rtscts", Settings{DataBits: 8, Parity: ParityOdd, FlowControl: FlowHardware}, ""},
+		{"xonxoff,dtr=off,rts=on", Settings{DataBits: 8, FlowControl: FlowSoftware, RTS: SignalOn, DTR: SignalOff}, ""},
+		{"8M1,rs485-invert,rs485-before=1ms,rs485-after=2ms", Settings{DataBits: 8, Parity: ParityMark,
+			RS485: RS485{Enabled: true, InvertRTS: true, DelayBefore: time.Millisecond, DelayAfter: 2 * time.Millisecond}}, ""},
+		{"rs485-after=500us", Settings{DataBits: 8, RS485: RS485{Enabled: true, DelayAfter: 500 * time.Microsecond}}, ""},
+		{"8X1", Settings{}, "четность"},
+		{"8N3", Settings{}, "стоповых битов"},
+		{"8N1.5", Settings{}, "1,5 стоповых"},
+		{"9N1", Settings{}, "неизвестный параметр"},
+		{"rts=maybe", Settings{}, "rts"},
+		{"rs485-before=-1ms", Settings{}, "неверная пауза"},
+		{"rs485,rtscts", Settings{}, "одну линию RTS"},
+		{"rtscts,rts=on", Settings{}, "RTS управляет"},
+		{"parity=even", Settings{}, "неизвестный параметр"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			settings, err := ParseSettings(9600, tt.text)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("ошибка '%v', ожидалась '%s'", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.BaudRate = 9600
+			if settings != tt.want {
+				t.Errorf("%+v, ожидалось %+v", settings, tt.want)
+			}
+		})
+	}
+}
+
+// String выдает формат, который ParseSettings разбирает в те же параметры
+func TestSettingsStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // Вид String(); пусто - совпадает с text
+	}{
+		{"", "8N1"},
+		{"8N1", ""},
+		{"7E2,xonxoff", ""},
+		{"5O1.5,rts=off,dtr=on", ""},
+		{"8E1,rtscts,dtr=off", ""},
+		{"8N1,rs485", ""},
+		{"8N1,rs485-invert,rs485-before=1ms,rs485-after=2.5ms", ""},
+		{"rs485-after=2ms, 8s2", "8S2,rs485,rs485-after=2ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			settings, err := ParseSettings(4800, tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if want == "" {
+				want = tt.text
+			}
+			text := settings.String()
+			if text != want {
+				t.Errorf("'%s', ожидалось '%s'", text, want)
+			}
+
+			again, err := ParseSettings(4800, text)
+			if err != nil {
+				t.Fatalf("'%s' не разбирается: %v", text, err)
+			}
+			if again != settings {
+				t.Errorf("после разбора '%s': %+v, ожидалось %+v", text, again, settings)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package comport
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Direction вид события обмена с портом
+type Direction string
+
+const (
+	DirectionOpen   Direction = "open"   // Порт открыт
+	DirectionConfig Direction = "config" // Установлены параметры: данные - "4800 8N1"
+	DirectionTX     Direction = "tx"     // Запись в порт
+	DirectionRX     Direction = "rx"     // Чтение из порта
+	DirectionClose  Direction = "close"  // Порт закрыт
+)
+
+// Tap получает события обмена со всеми открытыми портами: записанные
+// и прочитанные байты (пустые чтения не передаются). Вызывается из потока,
+// ведущего обмен; data действительны только во время вызова
+type Tap func(portName string, direction Direction, data []byte, at time.Time)
+
+// Подключенный отвод и имена открытых портов по дескрипторам
+var (
+	tapMu     sync.Mutex
+	tap       Tap
+	tapHandle = make(map[Handle]string)
+)
+
+// SetTap подключает отвод для записи обмена; nil отключает запись
+func SetTap(t Tap) {
+	tapMu.Lock()
+	tap = t
+	tapMu.Unlock()
+}
+
+// tapOpened запоминает имя открытого порта и передает событие открытия
+func tapOpened(handle Handle, portName string) {
+	tapMu.Lock()
+	tapHandle[handle] = portName
+	tapMu.Unlock()
+	tapped(handle, DirectionOpen, nil, time.Now())
+}
+
+// tapClosed передает событие закрытия и забывает порт
+func tapClosed(handle Handle) {
+	tapped(handle, DirectionClose, nil, time.Now())
+	tapMu.Lock()
+	delete(tapHandle, handle)
+	tapMu.Unlock()
+}
+
+// tapConfigured передает установленные параметры порта
+func tapConfigured(handle Handle, settings Settings) {
+	tapped(handle, DirectionConfig, []byte(fmt.Sprintf("%d %s", settings.BaudRate, settings)), time.Now())
+}
+
+// tapped передает событие порта отводу, если он подключен
+func tapped(handle Handle, direction Direction, data []byte, at time.Time) {
+	tapMu.Lock()
+	t, portName := tap, tapHandle[handle]
+	tapMu.Unlock()
+	if t != nil {
+		t(portName, direction, data, at)
+	}
+}
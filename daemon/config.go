@@ -0,0 +1,174 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+	"tir/comport"
+	"tir/logging"
+	"tir/server"
+	"tir/storage"
+)
+
+// DefaultConfigFile файл настроек службы по умолчанию
+const DefaultConfigFile = "tir.json"
+
+// Config настройки службы
+type Config struct {
+	ScenariosFile string            `json:"scenarios_file"`
+	PortName      string            `json:"port"`       // Порт по умолчанию
+	BaudRate      uint32            `json:"baud"`       // Скорость порта
+	LinePorts     map[int]string    `json:"lanes"`      // Порты отдельных линий: {"1": "COM4", "2": "serial:A10K5QZ3"}
+	Line          string            `json:"line"`       // Формат линии портов: "8N1", "8E1,rs485" (по умолчанию 8N1)
+	PortLines     map[string]string `json:"port_lines"` // Формат линии отдельных портов: {"serial:A10K5QZ3": "7E1,rtscts"}
+	QueueSize     int               `json:"queue_size"` // Размер очереди отправки на порт
+	DrainSeconds  int               `json:"drain_seconds"`
+	PIDFile       string            `json:"pid_file"`
+	MetricsAddr   string            `json:"metrics_addr"`   // Адрес метрик Prometheus (GET /metrics); пусто - выключены
+	CaptureFile   string            `json:"capture_file"`   // Запись обмена с портами (просмотр: tir capture view); пусто - выключена
+	EstopFile     string            `json:"estop_file"`     // Файл аварийной блокировки; пусто - TIR_ESTOP_FILE или estop.lock
+	RangeHotFile  string            `json:"range_hot_file"` // Файл признаков "стрельбище горячее"; "off" - правило отключено
+
+	Firebase FirebaseConfig `json:"firebase"`
+	Serve    ServeConfig    `json:"serve"`
+	Log      LogConfig      `json:"log"`
+}
+
+// FirebaseConfig источник дистанций линий - Firestore
+type FirebaseConfig struct {
+	Enabled   bool   `json:"enabled"`
+	ProjectID string `json:"project_id"`
+	APIKey    string `json:"api_key"`
+}
+
+// ServeConfig локальный API и пульт инструктора (tir serve)
+type ServeConfig struct {
+	Enabled bool   `json:"enabled"`
+	Addr    string `json:"addr"`
+	Token   string `json:"token"`
+}
+
+// LogConfig настройки журнала; пустые поля оставляют настройки из окружения
+type LogConfig struct {
+	Level  string `json:"level"` // Например, "info" или "warn,sender=debug"
+	Format string `json:"format"`
+	File   string `json:"file"`
+}
+
+// DefaultConfig настройки по умолчанию: автоотправка из Firebase на COM4 4800 бод
+func DefaultConfig() Config {
+	return Config{
+		ScenariosFile: storage.DefaultFileName,
+		PortName:      "COM4",
+		BaudRate:      4800,
+		LinePorts:     map[int]string{},
+		DrainSeconds:  30,
+		Firebase:      FirebaseConfig{Enabled: true},
+		Serve:         ServeConfig{Addr: server.DefaultAddr},
+	}
+}
+
+// LoadConfig читает настройки из файла поверх base. Отсутствующий файл
+// не ошибка: используются base
+func LoadConfig(fileName string, base Config) (Config, error) {
+	config := base
+	config.LinePorts = make(map[int]string)
+	for lane, port := range base.LinePorts {
+		config.LinePorts[lane] = port
+	}
+
+	data, err := os.ReadFile(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return config, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return config, fmt.Errorf("%s: %v", fileName, err)
+		}
+	}
+
+	return config, config.Validate()
+}
+
+// Validate проверяет настройки
+func (c Config) Validate() error {
+	if c.PortName == "" {
+		return fmt.Errorf("не задан порт")
+	}
+	if c.BaudRate == 0 {
+		return fmt.Errorf("не задана скорость порта")
+	}
+	for lane, port := range c.LinePorts {
+		if lane < 1 || lane > 6 || port == "" {
+			return fmt.Errorf("неверное назначение порта линии %d: '%s'", lane, port)
+		}
+	}
+	if _, err := c.LineSettings(); err != nil {
+		return err
+	}
+	if c.DrainSeconds < 0 {
+		return fmt.Errorf("отрицательное время завершения очереди")
+	}
+	if !c.Firebase.Enabled && !c.Serve.Enabled {
+		return fmt.Errorf("не включен ни один источник заданий (firebase, serve)")
+	}
+	if c.Firebase.Enabled && (c.Firebase.ProjectID == "" || c.Firebase.APIKey == "") {
+		return fmt.Errorf("для firebase нужны project_id и api_key")
+	}
+	if _, err := c.logging(logging.Settings()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// LineSettings возвращает форматы линий портов для sender.SetLineSettings:
+// общий формат под пустым именем и форматы отдельных портов
+func (c Config) LineSettings() (map[string]comport.Settings, error) {
+	settings := make(map[string]comport.Settings)
+	if c.Line != "" {
+		line, err := comport.ParseSettings(c.BaudRate, c.Line)
+		if err != nil {
+			return nil, fmt.Errorf("line: %v", err)
+		}
+		settings[""] = line
+	}
+	for port, text := range c.PortLines {
+		if port == "" {
+			return nil, fmt.Errorf("port_lines: не задано имя порта")
+		}
+		line, err := comport.ParseSettings(c.BaudRate, text)
+		if err != nil {
+			return nil, fmt.Errorf("port_lines %s: %v", port, err)
+		}
+		settings[port] = line
+	}
+	return settings, nil
+}
+
+// DrainTimeout время на выполнение очереди при остановке и перезагрузке
+func (c Config) DrainTimeout() time.Duration {
+	return time.Duration(c.DrainSeconds) * time.Second
+}
+
+// logging возвращает настройки журнала: заданные поля поверх base
+func (c Config) logging(base logging.Config) (logging.Config, error) {
+	config := base
+	if c.Log.Level != "" {
+		level, levels, err := logging.ParseLevels(c.Log.Level)
+		if err != nil {
+			return config, err
+		}
+		config.Level, config.Levels = level, levels
+	}
+	if c.Log.Format != "" {
+		config.Format = c.Log.Format
+	}
+	if c.Log.File != "" {
+		config.File = c.Log.File
+	}
+	if config.Format != logging.FormatConsole && config.Format != logging.FormatJSON {
+		return config, fmt.Errorf("неизвестный формат журнала '%s'", config.Format)
+	}
+	return config, nil
+}
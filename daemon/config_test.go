@@ -0,0 +1,168 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tir/interlock"
+	"tir/sender"
+)
+
+// validConfig настройки, проходящие проверку: только локальный API
+func validConfig() Config {
+	config := DefaultConfig()
+	config.Firebase.Enabled = false
+	config.Serve = ServeConfig{Enabled: true, Addr: "127.0.0.1:0", Token: "токен"}
+	return config
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string // Часть ошибки; пусто - настройки верны
+	}{
+		{"верные настройки", func(c *Config) {}, ""},
+		{"firebase с ключами", func(c *Config) {
+			c.Firebase = FirebaseConfig{Enabled: true, ProjectID: "p", APIKey: "k"}
+		}, ""},
+		{"нет порта", func(c *Config) { c.PortName = "" }, "не задан порт"},
+		{"нет скорости", func(c *Config) { c.BaudRate = 0 }, "скорость"},
+		{"линия вне 1-6", func(c *Config) { c.LinePorts = map[int]string{7: "COM5"} }, "линии 7"},
+		{"пустой порт линии", func(c *Config) { c.LinePorts = map[int]string{2: ""} }, "линии 2"},
+		{"неверный формат линии", func(c *Config) { c.Line = "9X9" }, "line"},
+		{"формат порта без имени", func(c *Config) { c.PortLines = map[string]string{"": "8N1"} }, "port_lines"},
+		{"отрицательное время завершения", func(c *Config) { c.DrainSeconds = -1 }, "отрицательное"},
+		{"нет источников", func(c *Config) { c.Serve.Enabled = false }, "ни один источник"},
+		{"firebase без ключей", func(c *Config) { c.Firebase.Enabled = true }, "project_id"},
+		{"неверный уровень журнала", func(c *Config) { c.Log.Level = "громко" }, "уровень журнала"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig()
+			tt.change(&config)
+			err := config.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("ошибка: %v", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("ожидалась ошибка '%s'", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("ошибка '%v', ожидалась '%s'", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	base := validConfig()
+	base.LinePorts = map[int]string{1: "COM4"}
+
+	tests := []struct {
+		name string
+		data string // "-" - файла нет
+		want string // Часть ошибки; пусто - настройки загружены
+		port string // Порт линии 2 после загрузки
+	}{
+		{"нет файла - базовые настройки", "-", "", ""},
+		{"файл поверх базовых", `{"lanes": {"2": "serial:A10K5QZ3"}, "baud": 9600}`, "", "serial:A10K5QZ3"},
+		{"не JSON", `{"baud":`, "tir.json", ""},
+		{"ошибка проверки", `{"port": ""}`, "не задан порт", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), DefaultConfigFile)
+			if tt.data != "-" {
+				if err := os.WriteFile(fileName, []byte(tt.data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			config, err := LoadConfig(fileName, base)
+			if tt.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("ошибка '%v', ожидалась '%s'", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.LinePorts[1] != "COM4" || config.LinePorts[2] != tt.port {
+				t.Errorf("порты линий %v", config.LinePorts)
+			}
+		})
+	}
+
+	// Порты линий из файла не попадают в базовые настройки
+	if len(base.LinePorts) != 1 {
+		t.Errorf("базовые настройки изменены: %v", base.LinePorts)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	previousEstop := sender.EmergencyFile()
+	previousInterlock := interlock.Settings()
+	defer func() {
+		sender.SetEmergencyFile(previousEstop)
+		interlock.Configure(previousInterlock)
+	}()
+	t.Setenv("TIR_ESTOP_FILE", filepath.Join(dir, "estop.lock"))
+	t.Setenv("TIR_RANGE_HOT_FILE", "")
+
+	base := validConfig()
+	base.ScenariosFile = filepath.Join(dir, "scenarios.txt")
+	fileName := filepath.Join(dir, DefaultConfigFile)
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(fileName, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"port": "COM5", "estop_file": "` + filepath.Join(dir, "своя.lock") + `", "range_hot_file": "off"}`)
+	d := New(fileName, base)
+	config, err := LoadConfig(fileName, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.start(config); err != nil {
+		t.Fatal(err)
+	}
+	defer d.stop()
+	if sender.EmergencyFile() != filepath.Join(dir, "своя.lock") || !interlock.Settings().RangeHotDisabled {
+		t.Fatalf("файлы блокировок не применены: %s, %+v", sender.EmergencyFile(), interlock.Settings())
+	}
+
+	tests := []struct {
+		name string
+		data string
+		port string // Порт после перезагрузки
+	}{
+		{"ошибка в файле - старые настройки", `{"port": ""}`, "COM5"},
+		{"настройки не запускаются - старые настройки",
+			`{"port": "COM6", "capture_file": "` + filepath.Join(dir, "нет", "capture.jsonl") + `"}`, "COM5"},
+		{"новые настройки", `{"port": "COM7"}`, "COM7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			write(tt.data)
+			d.reload()
+			if d.config.PortName != tt.port {
+				t.Errorf("порт %s, ожидался %s", d.config.PortName, tt.port)
+			}
+			if d.server == nil {
+				t.Error("API не работает после перезагрузки")
+			}
+		})
+	}
+
+	// Удаленные из настроек файлы блокировок возвращаются к файлам по умолчанию
+	if got := sender.EmergencyFile(); got != filepath.Join(dir, "estop.lock") {
+		t.Errorf("файл аварийной блокировки %s", got)
+	}
+	if settings := interlock.Settings(); settings.RangeHotDisabled || settings.RangeHotFile != interlock.DefaultConfig().RangeHotFile {
+		t.Errorf("файл признаков %+v", settings)
+	}
+}
@@ -0,0 +1,289 @@
+// Package daemon запускает программу службой без терминала: источники заданий
+// (Firebase, локальный API) и очереди отправки по портам. SIGTERM завершает
+// очереди и останавливает службу, SIGHUP перечитывает настройки
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"tir/capture"
+	"tir/firebase"
+	"tir/interlock"
+	"tir/logging"
+	"tir/metrics"
+	"tir/models"
+	"tir/protocol"
+	"tir/sender"
+	"tir/server"
+	"tir/storage"
+)
+
+var logger = logging.For("daemon")
+
+// Daemon служба с текущими настройками и запущенными источниками
+type Daemon struct {
+	PIDFile string // PID-файл; если задан, заменяет pid_file из настроек
+
+	configFile string
+	base       Config
+	logBase    logging.Config // Настройки журнала из окружения
+
+	config     Config
+	client     *firebase.RestClient
+	server     *server.Server
+	serverDone chan error
+	metrics    *http.Server
+	recorder   *capture.Recorder
+}
+
+// New создает службу. Настройки читаются из configFile поверх base
+func New(configFile string, base Config) *Daemon {
+	return &Daemon{
+		configFile: configFile,
+		base:       base,
+		logBase:    logging.Settings(),
+	}
+}
+
+// Run запускает службу и работает до SIGTERM или SIGINT
+func (d *Daemon) Run() error {
+	config, err := LoadConfig(d.configFile, d.base)
+	if err != nil {
+		return fmt.Errorf("ошибка настроек: %v", err)
+	}
+	if err := d.applyLogging(config); err != nil {
+		return err
+	}
+
+	pidFile := config.PIDFile
+	if d.PIDFile != "" {
+		pidFile = d.PIDFile
+	}
+	if pidFile != "" {
+		if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+			return fmt.Errorf("не удалось записать PID-файл: %v", err)
+		}
+		defer os.Remove(pidFile)
+	}
+
+	if err := d.start(config); err != nil {
+		return err
+	}
+	logger.Info("Служба запущена", "pid", os.Getpid(), "config", d.configFile)
+	d.notify("READY=1\nSTATUS=" + d.status())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				d.reload()
+				continue
+			}
+			logger.Info("Получен сигнал завершения", "signal", sig.String())
+			d.notify("STOPPING=1")
+			d.stop()
+			logger.Info("Служба остановлена")
+			return nil
+
+		case err := <-d.serverDone:
+			// API остановился сам (например, адрес занят) - служба завершается с ошибкой
+			d.serverDone = nil
+			d.notify("STOPPING=1")
+			d.stop()
+			return fmt.Errorf("локальный API остановлен: %v", err)
+		}
+	}
+}
+
+// reload перечитывает настройки и перезапускает источники. При ошибке
+// в новых настройках служба продолжает работать со старыми
+func (d *Daemon) reload() {
+	logger.Info("Перезагрузка настроек", "config", d.configFile)
+	d.notify("RELOADING=1")
+	defer d.notify("READY=1\nSTATUS=" + d.status())
+
+	config, err := LoadConfig(d.configFile, d.base)
+	if err != nil {
+		logger.Error("Ошибка в новых настройках, продолжаем со старыми", "error", err)
+		return
+	}
+
+	previous := d.config
+	d.stop()
+	if err := d.applyLogging(config); err != nil {
+		logger.Error("Ошибка настройки журнала", "error", err)
+	}
+	if err := d.start(config); err != nil {
+		logger.Error("Не удалось запустить службу с новыми настройками, возврат к старым", "error", err)
+		if err := d.start(previous); err != nil {
+			logger.Error("Не удалось запустить службу со старыми настройками", "error", err)
+			return
+		}
+	}
+	logger.Info("Настройки перезагружены")
+}
+
+// start загружает библиотеку сценариев и запускает включенные источники
+func (d *Daemon) start(config Config) error {
+	d.config = config
+
+	lines, err := config.LineSettings()
+	if err != nil {
+		return err
+	}
+	sender.SetLineSettings(lines)
+
+	// Пустые значения возвращают файлы по умолчанию, чтобы удаленная при
+	// перечитывании настройка не оставляла прежний файл
+	if err := sender.SetEmergencyFile(config.EstopFile); err != nil {
+		return err
+	}
+	settings := interlock.Settings()
+	if config.RangeHotFile != "" {
+		settings.SetRangeHotFile(config.RangeHotFile)
+	} else {
+		defaults := interlock.DefaultConfig()
+		settings.RangeHotFile, settings.RangeHotDisabled = defaults.RangeHotFile, defaults.RangeHotDisabled
+	}
+	interlock.Configure(settings)
+
+	if config.CaptureFile != "" {
+		recorder, err := capture.Start(config.CaptureFile)
+		if err != nil {
+			return fmt.Errorf("ошибка записи обмена: %v", err)
+		}
+		d.recorder = recorder
+	}
+
+	if config.Firebase.Enabled {
+		client := firebase.NewRestClient(config.Firebase.ProjectID, config.Firebase.APIKey,
+			loadLibrary(config.ScenariosFile))
+		client.SetPortSettings(config.PortName, config.BaudRate)
+		for lane, port := range config.LinePorts {
+			client.SetLinePort(lane, port)
+		}
+		if config.QueueSize > 0 {
+			client.QueueSize = config.QueueSize
+		}
+		if err := client.StartAutoSender(); err != nil {
+			d.stop()
+			return fmt.Errorf("ошибка запуска автоматической отправки: %v", err)
+		}
+		d.client = client
+	}
+
+	if config.MetricsAddr != "" {
+		d.metrics = metrics.NewServer(config.MetricsAddr)
+		go func(srv *http.Server) {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("Ошибка сервера метрик", "addr", srv.Addr, "error", err)
+			}
+		}(d.metrics)
+		logger.Info("Метрики Prometheus", "addr", config.MetricsAddr)
+	}
+
+	if config.Serve.Enabled {
+		// У API своя копия библиотеки: сценарии, измененные через API, записываются
+		// в файл и попадают в автоотправку после перезагрузки настроек (SIGHUP)
+		srv, err := server.New(server.Config{
+			Addr:      config.Serve.Addr,
+			Token:     config.Serve.Token,
+			FileName:  config.ScenariosFile,
+			PortName:  config.PortName,
+			BaudRate:  config.BaudRate,
+			LinePorts: config.LinePorts,
+			QueueSize: config.QueueSize,
+		}, loadLibrary(config.ScenariosFile))
+		if err != nil {
+			d.stop()
+			return fmt.Errorf("ошибка запуска API: %v", err)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			if err := srv.ListenAndServe(); err != nil {
+				done <- err
+			}
+		}()
+		d.server, d.serverDone = srv, done
+		logger.Info("Локальный API запущен", "addr", srv.Addr())
+	}
+
+	return nil
+}
+
+// stop останавливает источники и выполняет поставленные в очередь отправки,
+// но не дольше настроенного времени
+func (d *Daemon) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.DrainTimeout())
+	defer cancel()
+
+	if d.client != nil {
+		if err := d.client.Drain(ctx); err != nil {
+			logger.Warn("Очередь автоматической отправки выполнена не полностью", "error", err)
+		}
+		d.client = nil
+	}
+	if d.server != nil {
+		if err := d.server.Shutdown(ctx); err != nil {
+			logger.Warn("Очередь API выполнена не полностью", "error", err)
+		}
+		d.server, d.serverDone = nil, nil
+	}
+	if d.metrics != nil {
+		d.metrics.Shutdown(ctx)
+		d.metrics = nil
+	}
+	if d.recorder != nil {
+		if err := d.recorder.Stop(); err != nil {
+			logger.Warn("Ошибка закрытия файла записи обмена", "error", err)
+		}
+		d.recorder = nil
+	}
+}
+
+// applyLogging применяет настройки журнала службы
+func (d *Daemon) applyLogging(config Config) error {
+	logConfig, err := config.logging(d.logBase)
+	if err != nil {
+		return err
+	}
+	return logging.Configure(logConfig)
+}
+
+// status краткое описание запущенных источников для менеджера служб
+func (d *Daemon) status() string {
+	status := "источники:"
+	if d.client != nil {
+		status += " firebase"
+	}
+	if d.server != nil {
+		status += " api " + d.server.Addr()
+	}
+	return status
+}
+
+// notify сообщает состояние менеджеру служб; ошибка только записывается в журнал
+func (d *Daemon) notify(state string) {
+	if err := Notify(state); err != nil {
+		logger.Warn("Не удалось отправить уведомление systemd", "error", err)
+	}
+}
+
+// loadLibrary загружает встроенные сценарии и сценарии из файла
+func loadLibrary(fileName string) map[string]models.Scenario {
+	library := map[string]models.Scenario{}
+	protocol.ImportDefaultScenarios(library)
+	storage.LoadScenariosFrom(fileName, library)
+	return library
+}
@@ -0,0 +1,30 @@
+package daemon
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// Notify отправляет состояние менеджеру служб systemd (протокол sd_notify),
+// например "READY=1". Без переменной NOTIFY_SOCKET (служба запущена не с
+// Type=notify или не под systemd) ничего не делает
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// Абстрактный сокет Linux обозначается '@' и начинается с нулевого байта
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,313 @@
+package doctor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"tir/audit"
+	"tir/comport"
+	"tir/firebase"
+	"tir/interlock"
+	"tir/lint"
+	"tir/models"
+	"tir/protocol"
+	"tir/sender"
+	"tir/storage"
+)
+
+// checkPorts перечисляет порты системы и проверяет, что настроенные порты есть среди них
+func checkPorts(report *Report, options Options) {
+	ports, err := comport.ListPorts()
+	if err != nil {
+		report.add("порты", Fail, fmt.Sprintf("не удалось перечислить порты: %v", err))
+		return
+	}
+
+	var notes []string
+	for _, port := range ports {
+		notes = append(notes, port.String())
+	}
+	switch len(ports) {
+	case 0:
+		report.add("порты", Warn, "последовательные порты не найдены")
+	default:
+		report.add("порты", Pass, fmt.Sprintf("найдено: %d", len(ports)), notes...)
+	}
+
+	// Постоянные имена (serial:..., path:...) разрешаются в текущие имена портов
+	configured := configuredPorts(options)
+	var missing, resolved []string
+	for _, name := range sortedPorts(configured) {
+		lanes := formatLanes(configured[name])
+		device, err := comport.Resolve(name)
+		switch {
+		case err != nil:
+			missing = append(missing, fmt.Sprintf("%s (линии %s): %v", name, lanes, err))
+		case !portListed(ports, device):
+			missing = append(missing, fmt.Sprintf("%s (линии %s)", name, lanes))
+		case device != name:
+			resolved = append(resolved, fmt.Sprintf("%s -> %s (линии %s)", name, device, lanes))
+		}
+	}
+	if len(missing) > 0 {
+		report.add("порты линий", Fail, "настроенные порты не найдены в системе", append(missing, resolved...)...)
+	} else {
+		report.add("порты линий", Pass, fmt.Sprintf("все настроенные порты на месте: %s",
+			strings.Join(sortedPorts(configured), ", ")), resolved...)
+	}
+}
+
+// portListed проверяет, есть ли порт с таким именем или путем. Путь может
+// быть ссылкой на устройство (например, /dev/serial/by-id/...)
+func portListed(ports []comport.PortInfo, name string) bool {
+	path := name
+	if filepath.IsAbs(name) {
+		if resolved, err := filepath.EvalSymlinks(name); err == nil {
+			path = resolved
+		}
+	}
+	for _, port := range ports {
+		if strings.EqualFold(port.Name, name) || port.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHandshakes отправляет пакет инициализации на каждый настроенный порт
+func checkHandshakes(report *Report, options Options) {
+	configured := configuredPorts(options)
+	for _, name := range sortedPorts(configured) {
+		check := fmt.Sprintf("связь %s", name)
+		lanes := fmt.Sprintf("линии %s", formatLanes(configured[name]))
+
+		result, err := sender.Probe(name, options.BaudRate)
+		switch {
+		case err != nil:
+			report.add(check, Fail, err.Error(), lanes)
+		case len(result.Reply) == 0:
+			report.add(check, Warn, fmt.Sprintf("контроллер не ответил на инициализацию % X за %s",
+				result.Handshake, formatDuration(result.Elapsed)), lanes)
+		default:
+			report.add(check, Pass, fmt.Sprintf("ответ % X через %s", result.Reply, formatDuration(result.Latency)),
+				lanes, fmt.Sprintf("%d бод, %s, инициализация % X", result.BaudRate,
+					sender.LineSettings(name, result.BaudRate), result.Handshake))
+		}
+	}
+}
+
+// checkLibrary проверяет библиотеку сценариев: разбор кадров, контрольные
+// суммы, повторы имен и кадров, ошибки анализатора
+func checkLibrary(report *Report, fileName string) {
+	library := map[string]models.Scenario{}
+	protocol.ImportDefaultScenarios(library)
+	storage.LoadScenariosFrom(fileName, library)
+
+	names := make([]string, 0, len(library))
+	for name := range library {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Файл: строки, которые не загружаются (неверный формат, пульт вне 1-6)
+	fileNames, invalid, err := storage.ScenarioNames(fileName)
+	switch {
+	case os.IsNotExist(err):
+		report.add("файл сценариев", Warn, fmt.Sprintf("%s не найден, только встроенные сценарии", fileName))
+	case err != nil:
+		report.add("файл сценариев", Fail, fmt.Sprintf("%s не читается: %v", fileName, err))
+	case len(invalid) > 0:
+		for i, line := range invalid {
+			if len([]rune(line)) > 60 {
+				invalid[i] = string([]rune(line)[:60]) + "..."
+			}
+		}
+		report.add("файл сценариев", Warn, fmt.Sprintf("%s: строк с неверным форматом: %d из %d",
+			fileName, len(invalid), len(fileNames)+len(invalid)), invalid...)
+	default:
+		report.add("файл сценариев", Pass, fmt.Sprintf("%s: сценариев: %d", fileName, len(fileNames)))
+	}
+
+	// Разбор: кадр должен разбираться и собираться обратно без изменений
+	var decodeErrors []string
+	for _, name := range names {
+		scenario := library[name]
+		if len(scenario.RawData) == 0 {
+			continue
+		}
+		parsed, err := protocol.ParseScenarioData(scenario.RawData)
+		if err != nil {
+			decodeErrors = append(decodeErrors, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		parsed.RawData = scenario.RawData
+		if !bytes.Equal(protocol.GenerateScenarioPacket(parsed), scenario.RawData) {
+			decodeErrors = append(decodeErrors, fmt.Sprintf("%s: кадр не восстанавливается после разбора", name))
+		}
+		if parsed.PulseType != scenario.PulseType {
+			decodeErrors = append(decodeErrors, fmt.Sprintf("%s: пульт в кадре %d, в библиотеке %d",
+				name, parsed.PulseType, scenario.PulseType))
+		}
+	}
+	if len(decodeErrors) > 0 {
+		report.add("разбор кадров", Fail, fmt.Sprintf("ошибок: %d из %d сценариев", len(decodeErrors), len(library)),
+			decodeErrors...)
+	} else {
+		report.add("разбор кадров", Pass, fmt.Sprintf("сценариев: %d", len(library)))
+	}
+
+	// Контрольные суммы: CRC-8 кадра, как в кадрах с пульта
+	var checksumErrors []string
+	for _, name := range names {
+		data := library[name].RawData
+		if len(data) < 2 {
+			continue
+		}
+		if want := protocol.Checksum(data[:len(data)-1]); data[len(data)-1] != want {
+			checksumErrors = append(checksumErrors, fmt.Sprintf("%s: %02X, должна быть %02X",
+				name, data[len(data)-1], want))
+		}
+	}
+	if len(checksumErrors) > 0 {
+		report.add("контрольные суммы", Fail, fmt.Sprintf("неверных: %d", len(checksumErrors)), checksumErrors...)
+	} else {
+		report.add("контрольные суммы", Pass, "совпадают с вычисленными")
+	}
+
+	// Повторы: имя встречается в файле несколько раз (действует последняя строка)
+	// или один и тот же кадр сохранен под разными именами
+	var duplicates []string
+	seen := make(map[string]int)
+	for _, name := range fileNames {
+		seen[name]++
+	}
+	for _, name := range sortedKeys(seen) {
+		if seen[name] > 1 {
+			duplicates = append(duplicates, fmt.Sprintf("%s: строк в файле: %d", name, seen[name]))
+		}
+	}
+	frames := make(map[string][]string)
+	for _, name := range names {
+		if data := library[name].RawData; len(data) > 0 {
+			frames[string(data)] = append(frames[string(data)], name)
+		}
+	}
+	for _, key := range sortedKeys(frames) {
+		if same := frames[key]; len(same) > 1 {
+			duplicates = append(duplicates, "один кадр: "+strings.Join(same, ", "))
+		}
+	}
+	sort.Strings(duplicates)
+	if len(duplicates) > 0 {
+		report.add("повторы", Warn, fmt.Sprintf("найдено: %d", len(duplicates)), duplicates...)
+	} else {
+		report.add("повторы", Pass, "повторов нет")
+	}
+
+	// Анализатор: сценарии с ошибками не отправляются без принудительного режима
+	var lintErrors []string
+	for _, name := range names {
+		for _, finding := range lint.Filter(lint.Check(library[name]), lint.Error) {
+			lintErrors = append(lintErrors, fmt.Sprintf("%s: %s", name, finding))
+			break
+		}
+	}
+	if len(lintErrors) > 0 {
+		report.add("анализатор", Warn, fmt.Sprintf("сценариев с ошибками: %d (подробно: tir lint)", len(lintErrors)),
+			lintErrors...)
+	} else {
+		report.add("анализатор", Pass, "ошибок нет")
+	}
+}
+
+// sortedKeys возвращает ключи по порядку
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkFirebase запрашивает линии из Firestore
+func checkFirebase(report *Report, client *firebase.RestClient) {
+	lines, elapsed, err := client.Ping()
+	switch {
+	case err != nil:
+		report.add("firebase", Fail, fmt.Sprintf("источник недоступен: %v", err))
+	case lines == 0:
+		report.add("firebase", Warn, fmt.Sprintf("ответ за %s, но линий с дистанцией нет", formatDuration(elapsed)))
+	default:
+		report.add("firebase", Pass, fmt.Sprintf("линий с дистанцией: %d, ответ за %s", lines, formatDuration(elapsed)))
+	}
+}
+
+// checkRangeHot проверяет местный источник признаков "стрельбище горячее":
+// без него кадры с движением не отправляются
+func checkRangeHot(report *Report) {
+	settings := interlock.Settings()
+	if settings.RangeHotDisabled {
+		report.add("стрельбище горячее", Warn, "правило отключено настройкой")
+		return
+	}
+
+	var hot []int
+	for lane := models.PULSE_1; lane <= models.PULSE_6; lane++ {
+		isHot, _, err := interlock.RangeHot(lane)
+		if err != nil {
+			report.add("стрельбище горячее", Fail, fmt.Sprintf("кадры с движением заблокированы: %v", err))
+			return
+		}
+		if isHot {
+			hot = append(hot, lane)
+		}
+	}
+	detail := "горячих линий нет"
+	if len(hot) > 0 {
+		detail = "горячие линии " + formatLanes(hot)
+	}
+	report.add("стрельбище горячее", Pass, detail, "файл "+settings.RangeHotFile)
+}
+
+// checkState проверяет аварийную блокировку, состояние блокировок линий и журнал аудита
+func checkState(report *Report) {
+	if state := sender.Emergency(); state.Active {
+		report.add("аварийная блокировка", Warn, "действует, отправка запрещена (снять: tir estop -rearm)",
+			fmt.Sprintf("с %s: %s", state.Since.Local().Format("2006-01-02 15:04:05"), state.Reason),
+			"файл "+sender.EmergencyFile())
+	} else {
+		report.add("аварийная блокировка", Pass, "не действует, файл "+sender.EmergencyFile())
+	}
+
+	if states, err := interlock.States(); err != nil {
+		report.add("блокировки линий", Fail, fmt.Sprintf("состояние не читается: %v", err))
+	} else {
+		var armed []int
+		for lane, state := range states {
+			if state.Armed {
+				armed = append(armed, lane)
+			}
+		}
+		sort.Ints(armed)
+		detail := "взведенных линий нет"
+		if len(armed) > 0 {
+			detail = "взведены линии " + formatLanes(armed)
+		}
+		report.add("блокировки линий", Pass, detail)
+	}
+
+	checkRangeHot(report)
+
+	if audit.File == "" {
+		report.add("журнал аудита", Warn, "запись отключена")
+	} else if file, err := os.OpenFile(audit.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+		report.add("журнал аудита", Fail, fmt.Sprintf("нет доступа на запись: %v", err))
+	} else {
+		file.Close()
+		report.add("журнал аудита", Pass, audit.File)
+	}
+}
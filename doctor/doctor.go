@@ -0,0 +1,157 @@
+// Package doctor проверяет готовность к работе: последовательные порты,
+// связь с контроллерами, библиотеку сценариев, источник заданий и файлы
+// состояния. Итог - список проверок с оценкой PASS, WARN или FAIL
+package doctor
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"tir/firebase"
+)
+
+// Status оценка проверки
+type Status int
+
+const (
+	Pass Status = iota // Проверка пройдена
+	Warn               // Работать можно, но стоит разобраться
+	Fail               // Работа невозможна или небезопасна
+)
+
+// String возвращает обозначение оценки
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return "PASS"
+	case Warn:
+		return "WARN"
+	case Fail:
+		return "FAIL"
+	default:
+		return fmt.Sprintf("STATUS%d", int(s))
+	}
+}
+
+// Result итог одной проверки
+type Result struct {
+	Name   string
+	Status Status
+	Detail string   // Краткий итог
+	Notes  []string // Подробности: найденные порты, сценарии с ошибками
+}
+
+// Report итоги всех проверок по порядку
+type Report struct {
+	Results []Result
+}
+
+func (r *Report) add(name string, status Status, detail string, notes ...string) {
+	r.Results = append(r.Results, Result{Name: name, Status: status, Detail: detail, Notes: notes})
+}
+
+// Count возвращает число проверок с оценкой status
+func (r Report) Count(status Status) int {
+	count := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Failed сообщает, есть ли проваленные проверки
+func (r Report) Failed() bool {
+	return r.Count(Fail) > 0
+}
+
+// maxNotes наибольшее число подробностей, выводимых для одной проверки
+const maxNotes = 20
+
+// Print выводит итоги проверок и сводку
+func (r Report) Print(w io.Writer) {
+	width := 0
+	for _, result := range r.Results {
+		if n := len([]rune(result.Name)); n > width {
+			width = n
+		}
+	}
+
+	for _, result := range r.Results {
+		padding := strings.Repeat(" ", width-len([]rune(result.Name)))
+		fmt.Fprintf(w, "%-4s  %s%s  %s\n", result.Status, result.Name, padding, result.Detail)
+		for i, note := range result.Notes {
+			if i == maxNotes {
+				fmt.Fprintf(w, "      ... и еще %d\n", len(result.Notes)-maxNotes)
+				break
+			}
+			fmt.Fprintf(w, "      %s\n", note)
+		}
+	}
+	fmt.Fprintf(w, "\nИтог: %d PASS, %d WARN, %d FAIL\n", r.Count(Pass), r.Count(Warn), r.Count(Fail))
+}
+
+// Options что и как проверять
+type Options struct {
+	ScenariosFile string
+	PortName      string         // Порт по умолчанию
+	BaudRate      uint32         // Скорость порта
+	LinePorts     map[int]string // Порты отдельных линий
+	Firebase      *firebase.RestClient
+	SkipProbe     bool // Не обращаться к контроллерам
+}
+
+// Run выполняет все проверки
+func Run(options Options) Report {
+	var report Report
+	checkPorts(&report, options)
+	if !options.SkipProbe {
+		checkHandshakes(&report, options)
+	}
+	checkLibrary(&report, options.ScenariosFile)
+	if options.Firebase != nil {
+		checkFirebase(&report, options.Firebase)
+	}
+	checkState(&report)
+	return report
+}
+
+// configuredPorts возвращает используемые порты с линиями на каждом
+func configuredPorts(options Options) map[string][]int {
+	ports := make(map[string][]int)
+	for lane := 1; lane <= 6; lane++ {
+		port := options.PortName
+		if linePort, exists := options.LinePorts[lane]; exists && linePort != "" {
+			port = linePort
+		}
+		ports[port] = append(ports[port], lane)
+	}
+	return ports
+}
+
+// sortedPorts возвращает имена портов по порядку
+func sortedPorts(ports map[string][]int) []string {
+	names := make([]string, 0, len(ports))
+	for name := range ports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatLanes форматирует список линий: "1, 2, 3"
+func formatLanes(lanes []int) string {
+	text := make([]string, len(lanes))
+	for i, lane := range lanes {
+		text[i] = fmt.Sprint(lane)
+	}
+	return strings.Join(text, ", ")
+}
+
+// formatDuration округляет время для вывода
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,208 @@
+package drill
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"tir/models"
+	"tir/protocol"
+)
+
+// MaxMacroDepth наибольшая вложенность макросов и повторений
+const MaxMacroDepth = 16
+
+// Step шаг упражнения: команда, вызов макроса или повторение вложенных шагов
+type Step struct {
+	Command string  `json:"command,omitempty"` // Код команды из каталога, например "0x1300"
+	Value   *uint16 `json:"value,omitempty"`   // Значение параметра
+	Var     string  `json:"var,omitempty"`     // Параметр берется из переменной развертки
+	Macro   string  `json:"macro,omitempty"`   // Имя макроса
+	Repeat  int     `json:"repeat,omitempty"`  // Количество повторений вложенных шагов
+	Steps   []Step  `json:"steps,omitempty"`   // Вложенные шаги повторения
+}
+
+// Sweep развертка: упражнение разворачивается в отдельный кадр для каждого значения
+type Sweep struct {
+	Var    string   `json:"var"`
+	Values []uint16 `json:"values"`
+}
+
+// Drill описание упражнения
+type Drill struct {
+	Name      string            `json:"name"`
+	PulseType byte              `json:"remote"`
+	Macros    map[string][]Step `json:"macros,omitempty"`
+	Sweep     *Sweep            `json:"sweep,omitempty"`
+	Steps     []Step            `json:"steps"`
+}
+
+// Frame кадр, полученный развертыванием упражнения
+type Frame struct {
+	Scenario models.Scenario
+	Warnings []string
+}
+
+// Load читает описание упражнения из JSON-файла
+func Load(fileName string) (Drill, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return Drill{}, err
+	}
+
+	var drill Drill
+	if err := json.Unmarshal(data, &drill); err != nil {
+		return Drill{}, fmt.Errorf("ошибка разбора упражнения %s: %v", fileName, err)
+	}
+	return drill, nil
+}
+
+// Expand разворачивает упражнение в кадры контроллера: по одному кадру
+// на каждое значение развертки (или один кадр без развертки)
+func Expand(drill Drill) ([]Frame, error) {
+	if drill.Name == "" {
+		return nil, fmt.Errorf("не задано имя упражнения")
+	}
+	if drill.PulseType < models.PULSE_1 || drill.PulseType > models.PULSE_6 {
+		return nil, fmt.Errorf("неверный тип пульта %d", drill.PulseType)
+	}
+	if !protocol.HasVerifiedHeader(drill.PulseType) {
+		return nil, fmt.Errorf("для пульта %d нет проверенного заголовка кадра", drill.PulseType)
+	}
+	if len(drill.Steps) == 0 {
+		return nil, fmt.Errorf("упражнение '%s' не содержит шагов", drill.Name)
+	}
+
+	if drill.Sweep == nil {
+		frame, err := expandFrame(drill, drill.Name, nil)
+		if err != nil {
+			return nil, err
+		}
+		return []Frame{frame}, nil
+	}
+
+	if drill.Sweep.Var == "" || len(drill.Sweep.Values) == 0 {
+		return nil, fmt.Errorf("развертка должна задавать переменную и значения")
+	}
+
+	var frames []Frame
+	for _, value := range drill.Sweep.Values {
+		vars := map[string]uint16{drill.Sweep.Var: value}
+		name := fmt.Sprintf("%s %s=%d", drill.Name, drill.Sweep.Var, value)
+		frame, err := expandFrame(drill, name, vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s=%d: %v", drill.Sweep.Var, value, err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// expandFrame разворачивает шаги упражнения в один кадр
+func expandFrame(drill Drill, name string, vars map[string]uint16) (Frame, error) {
+	// Длина имени с нулевым байтом записывается в заголовок одним байтом
+	if len(name)+1 > 0xFF {
+		return Frame{}, fmt.Errorf("имя кадра '%s' слишком длинное", name)
+	}
+
+	commands, err := expandSteps(drill, drill.Steps, vars, nil)
+	if err != nil {
+		return Frame{}, err
+	}
+
+	scenario := models.Scenario{
+		Name:      name,
+		PulseType: drill.PulseType,
+		Commands:  commands,
+		Tags:      []string{"упражнение"},
+	}
+	scenario.RawData = protocol.GenerateScenarioPacket(scenario)
+
+	if len(scenario.RawData) > protocol.MaxFrameSize {
+		return Frame{}, fmt.Errorf("длина кадра %d байт превышает допустимую для контроллера (%d байт)",
+			len(scenario.RawData), protocol.MaxFrameSize)
+	}
+
+	frame := Frame{Scenario: scenario}
+	if err := protocol.FillMetadata(&frame.Scenario); err != nil {
+		frame.Warnings = append(frame.Warnings, err.Error())
+	}
+
+	return frame, nil
+}
+
+// expandSteps разворачивает шаги; stack содержит вызванные макросы для поиска циклов
+func expandSteps(drill Drill, steps []Step, vars map[string]uint16, stack []string) ([]models.Command, error) {
+	if len(stack) > MaxMacroDepth {
+		return nil, fmt.Errorf("превышена вложенность макросов и повторений (%d)", MaxMacroDepth)
+	}
+
+	var commands []models.Command
+	for i, step := range steps {
+		switch {
+		case step.Macro != "":
+			for _, called := range stack {
+				if called == step.Macro {
+					return nil, fmt.Errorf("макрос '%s' вызывает сам себя", step.Macro)
+				}
+			}
+			body, exists := drill.Macros[step.Macro]
+			if !exists {
+				return nil, fmt.Errorf("шаг %d: макрос '%s' не найден", i+1, step.Macro)
+			}
+			expanded, err := expandSteps(drill, body, vars, append(stack, step.Macro))
+			if err != nil {
+				return nil, fmt.Errorf("макрос '%s': %v", step.Macro, err)
+			}
+			commands = append(commands, expanded...)
+
+		case step.Repeat > 0:
+			expanded, err := expandSteps(drill, step.Steps, vars, append(stack, ""))
+			if err != nil {
+				return nil, fmt.Errorf("шаг %d: %v", i+1, err)
+			}
+			for n := 0; n < step.Repeat; n++ {
+				commands = append(commands, expanded...)
+			}
+
+		case step.Command != "":
+			command, err := stepCommand(step, vars)
+			if err != nil {
+				return nil, fmt.Errorf("шаг %d: %v", i+1, err)
+			}
+			commands = append(commands, command)
+
+		default:
+			return nil, fmt.Errorf("шаг %d: должен задавать команду, макрос или повторение", i+1)
+		}
+	}
+
+	return commands, nil
+}
+
+// stepCommand создает команду шага по реестру команд
+func stepCommand(step Step, vars map[string]uint16) (models.Command, error) {
+	code, err := strconv.ParseUint(step.Command, 0, 16)
+	if err != nil {
+		return models.Command{}, fmt.Errorf("некорректный код команды '%s'", step.Command)
+	}
+
+	spec, exists := models.LookupCommand(uint16(code))
+	if !exists {
+		return models.Command{}, fmt.Errorf("неизвестная команда 0x%04X", code)
+	}
+
+	value := spec.Default
+	switch {
+	case step.Var != "":
+		varValue, defined := vars[step.Var]
+		if !defined {
+			return models.Command{}, fmt.Errorf("переменная '%s' не определена", step.Var)
+		}
+		value = varValue
+	case step.Value != nil:
+		value = *step.Value
+	}
+
+	return models.NewCommand(uint16(code), value)
+}
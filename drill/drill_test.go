@@ -0,0 +1,36 @@
+package drill
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"tir/protocol"
+)
+
+func TestExpandFrameSize(t *testing.T) {
+	drill, err := Load("../drills/show-3s.json")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	frames, err := Expand(drill)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	for _, frame := range frames {
+		data := frame.Scenario.RawData
+		if len(data) > protocol.MaxFrameSize {
+			t.Errorf("%s: %d байт", frame.Scenario.Name, len(data))
+		}
+		header := protocol.RebuildHeader(nil, frame.Scenario.Name, drill.PulseType)
+		if !bytes.HasPrefix(data, header) {
+			t.Errorf("%s: заголовок не проверенный: % X", frame.Scenario.Name, data)
+		}
+	}
+
+	// Более длинный кадр не разворачивается
+	drill.Steps[5].Repeat = 5
+	if _, err := Expand(drill); err == nil || !strings.Contains(err.Error(), "превышает") {
+		t.Errorf("кадр длиннее %d байт: ошибка %v", protocol.MaxFrameSize, err)
+	}
+}
@@ -0,0 +1,91 @@
+package dsl
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tir/protocol"
+)
+
+// Каждый кадр библиотеки после вывода в текст и разбора собирается заново
+// байт в байт, включая заголовок и контрольную сумму
+func TestRoundTripLibrary(t *testing.T) {
+	data, err := os.ReadFile("../scenarios.txt")
+	if err != nil {
+		t.Fatalf("файл сценариев: %v", err)
+	}
+
+	frames := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		separator := strings.LastIndex(line, ":")
+		if separator < 0 {
+			continue
+		}
+		name := line[:separator]
+		frame, err := hex.DecodeString(strings.Join(strings.Fields(line[separator+1:]), ""))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		frames++
+
+		scenario, err := protocol.ParseScenarioData(frame)
+		if err != nil {
+			t.Errorf("%s: кадр не разобран: %v", name, err)
+			continue
+		}
+		text, err := Format(scenario)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		parsed, err := Parse(text)
+		if err != nil {
+			t.Errorf("%s: текст не разобран: %v\n%s", name, err, text)
+			continue
+		}
+		if !bytes.Equal(parsed.RawData, frame) {
+			t.Errorf("%s:\n% X\nожидался\n% X\nтекст:\n%s", name, parsed.RawData, frame, text)
+		}
+	}
+	if frames < 333 {
+		t.Errorf("проверено кадров: %d", frames)
+	}
+}
+
+// Имя сценария из файла попадает и в сценарий, и в поле имени кадра
+func TestParseFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		text string
+		want string
+	}{
+		{"имя задано в тексте", "файл.tir", "name \"тир\"\nremote 1\npark\n", "тир"},
+		{"имя по файлу", "вход1.tir", "remote 1\npark\n", "вход1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(fileName, []byte(tt.text), 0644); err != nil {
+				t.Fatal(err)
+			}
+			scenario, err := ParseFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if scenario.Name != tt.want {
+				t.Errorf("имя сценария '%s', ожидалось '%s'", scenario.Name, tt.want)
+			}
+			frame, err := protocol.ParseScenarioData(scenario.RawData)
+			if err != nil {
+				t.Fatalf("кадр не разбирается: %v", err)
+			}
+			if frame.Name != tt.want {
+				t.Errorf("имя в кадре '%s', ожидалось '%s'", frame.Name, tt.want)
+			}
+		})
+	}
+}
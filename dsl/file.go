@@ -0,0 +1,47 @@
+package dsl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"tir/models"
+)
+
+// FileExtension расширение файлов сценариев в текстовом формате
+const FileExtension = ".tir"
+
+// ParseFile разбирает файл сценария. Если имя в файле не задано,
+// используется имя файла без расширения
+func ParseFile(fileName string) (models.Scenario, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return models.Scenario{}, err
+	}
+
+	// Имя из файла должно попасть и в кадр, поэтому задается до его сборки
+	defaultName := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	scenario, err := parse(string(data), defaultName)
+	if err != nil {
+		return models.Scenario{}, fmt.Errorf("%s: %v", fileName, err)
+	}
+
+	return scenario, nil
+}
+
+// WriteFile записывает сценарий в файл в текстовом формате
+func WriteFile(fileName string, scenario models.Scenario) error {
+	text, err := Format(scenario)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, []byte(text), 0644)
+}
+
+// FileNameFor возвращает имя файла для сценария: символы, недопустимые
+// в именах файлов, заменяются на '_'
+func FileNameFor(name string) string {
+	replacer := strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_",
+		"?", "_", "\"", "_", "<", "_", ">", "_", "|", "_")
+	return replacer.Replace(name) + FileExtension
+}
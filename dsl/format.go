@@ -0,0 +1,123 @@
+package dsl
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"tir/models"
+	"tir/protocol"
+)
+
+// Format записывает сценарий в текстовом формате. Кадр, собранный из текста,
+// совпадает с исходным байт в байт: нестандартный заголовок, формы записи команд,
+// нераспознанные байты и контрольная сумма сохраняются
+func Format(scenario models.Scenario) (string, error) {
+	// Стандартное начало кадра для имени и пульта (заголовок и переменная часть)
+	plain := models.Scenario{Name: scenario.Name, PulseType: scenario.PulseType}
+	defaultPacket := protocol.GenerateScenarioPacket(plain)
+	defaultPrefix := defaultPacket[:len(defaultPacket)-1]
+
+	commands := scenario.Commands
+	header := scenario.Header
+	if len(scenario.RawData) > 0 {
+		if len(scenario.RawData) > len(defaultPrefix) && bytes.HasPrefix(scenario.RawData, defaultPrefix) {
+			// Заголовок стандартный - в тексте его не выводим
+			commands = protocol.DecodeCommands(scenario.RawData[len(defaultPrefix) : len(scenario.RawData)-1])
+			header = nil
+		} else {
+			parsed, err := protocol.ParseScenarioData(scenario.RawData)
+			if err != nil {
+				return "", err
+			}
+			commands = parsed.Commands
+			header = parsed.Header
+		}
+	}
+
+	// Обратные таблицы ключевых слов
+	paramNames := make(map[uint16]string)
+	for keyword, code := range paramKeywords {
+		paramNames[code] = keyword
+	}
+	simpleNames := make(map[uint16]string)
+	for keyword, code := range simpleKeywords {
+		simpleNames[code] = keyword
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "name %s\n", strconv.Quote(scenario.Name))
+	fmt.Fprintf(&b, "remote %d\n", scenario.PulseType)
+
+	if len(header) > 0 {
+		fmt.Fprintf(&b, "header %s\n", hexBytes(header))
+	}
+
+	for _, cmd := range commands {
+		if cmd.IsRaw() {
+			fmt.Fprintf(&b, "raw %s\n", hexBytes(cmd.Raw))
+			continue
+		}
+
+		// Недопустимое значение из кадра пульта сохраняется байтами:
+		// оператор с ним при разборе текста был бы отвергнут
+		if err := models.ValidateCommand(cmd); err != nil {
+			if _, known := models.LookupCommand(cmd.Code); known {
+				fmt.Fprintf(&b, "raw %s # %v\n", hexBytes(protocol.EncodeCommands([]models.Command{cmd})), err)
+				continue
+			}
+		}
+
+		var line string
+		if keyword, exists := paramNames[cmd.Code]; exists && cmd.HasParam {
+			line = keyword + " " + formatValue(cmd)
+		} else if keyword, exists := simpleNames[cmd.Code]; exists && !cmd.HasParam {
+			line = keyword
+		} else if cmd.HasParam {
+			line = fmt.Sprintf("cmd 0x%04X %d", cmd.Code, cmd.ParamValue)
+		} else {
+			line = fmt.Sprintf("cmd 0x%04X", cmd.Code)
+		}
+
+		// Форма записи указывается, если она отличается от принятой по умолчанию
+		if cmd.Encoding != models.DefaultEncoding(cmd.Code) {
+			line += " " + encodingNames[cmd.Encoding]
+		}
+		b.WriteString(line + "\n")
+	}
+
+	// Контрольная сумма выводится, если исходная не совпадает с вычисленной
+	if len(scenario.RawData) > 0 {
+		rebuilt := scenario
+		rebuilt.Commands = commands
+		rebuilt.Header = header
+		rebuilt.RawData = nil
+		packet := protocol.GenerateScenarioPacket(rebuilt)
+		original := scenario.RawData[len(scenario.RawData)-1]
+		if packet[len(packet)-1] != original {
+			fmt.Fprintf(&b, "checksum %02X\n", original)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// formatValue записывает значение параметра с единицей измерения
+func formatValue(cmd models.Command) string {
+	spec, _ := models.LookupCommand(cmd.Code)
+	switch spec.ParamType {
+	case models.ParamDistance:
+		if cmd.ParamValue%100 == 0 {
+			return fmt.Sprintf("%dm", cmd.ParamValue/100)
+		}
+		return fmt.Sprintf("%dcm", cmd.ParamValue)
+	case models.ParamDuration:
+		return fmt.Sprintf("%ds", cmd.ParamValue)
+	}
+	return strconv.Itoa(int(cmd.ParamValue))
+}
+
+// hexBytes записывает байты в HEX через пробел
+func hexBytes(data []byte) string {
+	return strings.TrimSpace(fmt.Sprintf("% X", data))
+}
@@ -0,0 +1,369 @@
+// Package dsl реализует текстовый формат сценариев для хранения в git и ревью:
+//
+//	name "рубеж 15м"
+//	remote 2
+//	range 15m; speed 50; safe-zone 3m
+//	rotate enemy
+//	move to-range
+//
+// Операторы разделяются переводом строки или точкой с запятой, # начинает комментарий
+package dsl
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"tir/models"
+	"tir/protocol"
+	"unicode/utf8"
+)
+
+// Error ошибка разбора с позицией в тексте (строка и позиция считаются с 1)
+type Error struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("строка %d, позиция %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// token слово оператора с позицией
+type token struct {
+	text   string
+	quoted bool
+	line   int
+	column int
+}
+
+// Команды с параметром: ключевое слово -> код
+var paramKeywords = map[string]uint16{
+	"range":     models.CMD_SET_RANGE,
+	"safe-zone": models.CMD_SAFE_ZONE,
+	"speed":     models.CMD_SET_SPEED,
+	"pause":     models.CMD_PAUSE,
+}
+
+// Команды без параметра: ключевые слова -> код
+var simpleKeywords = map[string]uint16{
+	"rotate edge":     models.CMD_EDGE_POSITION,
+	"rotate enemy":    models.CMD_ENEMY_POSITION,
+	"light on":        models.CMD_LIGHT_ON,
+	"light off":       models.CMD_LIGHT_OFF,
+	"oop on":          models.CMD_OOP_SIMULATION_ON,
+	"oop off":         models.CMD_OOP_SIMULATION_OFF,
+	"hit-light on":    models.CMD_HIT_LIGHT_ON,
+	"hit-light off":   models.CMD_HIT_LIGHT_OFF,
+	"move to-range":   models.CMD_MOVE_TO_RANGE,
+	"move to-shooter": models.CMD_MOVE_TO_SHOOTER,
+	"park":            models.CMD_PARKING,
+	"manual-feed off": models.CMD_MANUAL_FEED_OFF,
+	"encoder":         models.CMD_ENCODER,
+}
+
+// Формы записи команды в кадре (необязательное последнее слово оператора)
+var encodingKeywords = map[string]models.CommandEncoding{
+	"le":    models.EncodingLE,
+	"be":    models.EncodingBE,
+	"short": models.EncodingShort,
+}
+
+// Ключевые слова форм записи для вывода
+var encodingNames = map[models.CommandEncoding]string{
+	models.EncodingLE:    "le",
+	models.EncodingBE:    "be",
+	models.EncodingShort: "short",
+}
+
+// Parse разбирает текст сценария. Кадр собирается protocol.GenerateScenarioPacket
+func Parse(src string) (models.Scenario, error) {
+	return parse(src, "")
+}
+
+// parse разбирает текст сценария; defaultName используется как имя сценария
+// (и имя в кадре), если оно не задано в тексте
+func parse(src, defaultName string) (models.Scenario, error) {
+	statements, err := tokenize(src)
+	if err != nil {
+		return models.Scenario{}, err
+	}
+
+	var scenario models.Scenario
+	var checksum *byte
+	remoteSet := false
+
+	for _, stmt := range statements {
+		keyword := stmt[0]
+		args := stmt[1:]
+
+		switch keyword.text {
+		case "name":
+			if len(args) != 1 || !args[0].quoted {
+				return models.Scenario{}, errorAt(keyword, "ожидается name \"имя\"")
+			}
+			scenario.Name = args[0].text
+
+		case "remote":
+			if len(args) != 1 {
+				return models.Scenario{}, errorAt(keyword, "ожидается remote N")
+			}
+			value, err := strconv.Atoi(args[0].text)
+			if err != nil || value < models.PULSE_1 || value > models.PULSE_6 {
+				return models.Scenario{}, errorAt(args[0], "тип пульта должен быть от 1 до 6")
+			}
+			scenario.PulseType = byte(value)
+			remoteSet = true
+
+		case "header":
+			data, err := parseBytes(args)
+			if err != nil {
+				return models.Scenario{}, err
+			}
+			if len(data) < 4 || data[0] != 0x7E {
+				return models.Scenario{}, errorAt(keyword, "заголовок кадра должен начинаться с 7E")
+			}
+			scenario.Header = data
+
+		case "checksum":
+			data, err := parseBytes(args)
+			if err != nil {
+				return models.Scenario{}, err
+			}
+			if len(data) != 1 {
+				return models.Scenario{}, errorAt(keyword, "контрольная сумма - один байт")
+			}
+			checksum = &data[0]
+
+		case "raw":
+			data, err := parseBytes(args)
+			if err != nil {
+				return models.Scenario{}, err
+			}
+			if len(data) == 0 {
+				return models.Scenario{}, errorAt(keyword, "ожидаются байты в HEX")
+			}
+			scenario.Commands = append(scenario.Commands, models.NewRawCommand(data))
+
+		default:
+			command, err := parseCommand(stmt)
+			if err != nil {
+				return models.Scenario{}, err
+			}
+			scenario.Commands = append(scenario.Commands, command)
+		}
+	}
+
+	if !remoteSet {
+		return models.Scenario{}, &Error{Line: 1, Column: 1, Msg: "не задан тип пульта (remote N)"}
+	}
+
+	if scenario.Name == "" {
+		scenario.Name = defaultName
+	}
+
+	scenario.RawData = protocol.GenerateScenarioPacket(scenario)
+	if checksum != nil {
+		scenario.RawData[len(scenario.RawData)-1] = *checksum
+	}
+	protocol.FillMetadata(&scenario)
+
+	return scenario, nil
+}
+
+// parseCommand разбирает оператор-команду
+func parseCommand(stmt []token) (models.Command, error) {
+	keyword := stmt[0]
+	words := stmt
+
+	// Необязательная форма записи в конце оператора; без нее - как в кадрах с пульта
+	encoding, explicit := models.CommandEncoding(0), false
+	if len(words) > 1 {
+		if value, exists := encodingKeywords[words[len(words)-1].text]; exists {
+			encoding, explicit = value, true
+			words = words[:len(words)-1]
+		}
+	}
+
+	var command models.Command
+	var err error
+
+	if code, exists := paramKeywords[keyword.text]; exists {
+		if len(words) != 2 {
+			return models.Command{}, errorAt(keyword, fmt.Sprintf("ожидается %s ЗНАЧЕНИЕ", keyword.text))
+		}
+		value, convErr := parseValue(code, words[1])
+		if convErr != nil {
+			return models.Command{}, convErr
+		}
+		command, err = models.NewCommand(code, value)
+		if err != nil {
+			return models.Command{}, errorAt(words[1], err.Error())
+		}
+	} else if keyword.text == "cmd" {
+		// Команда каталога по коду: cmd 0x1300 300
+		if len(words) < 2 || len(words) > 3 {
+			return models.Command{}, errorAt(keyword, "ожидается cmd КОД [ЗНАЧЕНИЕ]")
+		}
+		code, convErr := strconv.ParseUint(words[1].text, 0, 16)
+		if convErr != nil {
+			return models.Command{}, errorAt(words[1], "некорректный код команды")
+		}
+		var value uint64
+		if len(words) == 3 {
+			value, convErr = strconv.ParseUint(words[2].text, 0, 16)
+			if convErr != nil {
+				return models.Command{}, errorAt(words[2], "некорректное значение параметра")
+			}
+		}
+		command, err = models.NewCommand(uint16(code), uint16(value))
+		if err != nil {
+			return models.Command{}, errorAt(words[1], err.Error())
+		}
+	} else {
+		texts := make([]string, len(words))
+		for i, word := range words {
+			texts[i] = word.text
+		}
+		code, exists := simpleKeywords[strings.Join(texts, " ")]
+		if !exists {
+			return models.Command{}, errorAt(keyword, fmt.Sprintf("неизвестная команда '%s'", strings.Join(texts, " ")))
+		}
+		command, err = models.NewCommand(code, 0)
+		if err != nil {
+			return models.Command{}, errorAt(keyword, err.Error())
+		}
+	}
+
+	if !explicit {
+		return command, nil
+	}
+	if encoding == models.EncodingShort && !command.HasParam {
+		return models.Command{}, errorAt(keyword, "короткая форма допустима только для команд с параметром")
+	}
+	command.Encoding = encoding
+
+	return command, nil
+}
+
+// parseValue разбирает значение параметра с единицей измерения:
+// дистанции в м или см (без единицы - см), паузы в с (без единицы - с)
+func parseValue(code uint16, word token) (uint16, error) {
+	text := word.text
+	multiplier := uint64(1)
+
+	spec, _ := models.LookupCommand(code)
+	switch spec.ParamType {
+	case models.ParamDistance:
+		if strings.HasSuffix(text, "cm") {
+			text = strings.TrimSuffix(text, "cm")
+		} else if strings.HasSuffix(text, "m") {
+			text = strings.TrimSuffix(text, "m")
+			multiplier = 100
+		}
+	case models.ParamDuration:
+		text = strings.TrimSuffix(text, "s")
+	}
+
+	value, err := strconv.ParseUint(text, 10, 16)
+	if err != nil || value*multiplier > 0xFFFF {
+		return 0, errorAt(word, fmt.Sprintf("некорректное значение '%s'", word.text))
+	}
+
+	return uint16(value * multiplier), nil
+}
+
+// parseBytes разбирает байты в HEX, записанные через пробел или слитно
+func parseBytes(words []token) ([]byte, error) {
+	var data []byte
+	for _, word := range words {
+		decoded, err := hex.DecodeString(word.text)
+		if err != nil {
+			return nil, errorAt(word, fmt.Sprintf("некорректные HEX-данные '%s'", word.text))
+		}
+		data = append(data, decoded...)
+	}
+	return data, nil
+}
+
+// errorAt создает ошибку в позиции слова
+func errorAt(word token, msg string) error {
+	return &Error{Line: word.line, Column: word.column, Msg: msg}
+}
+
+// tokenize разбивает текст на операторы из слов с позициями
+func tokenize(src string) ([][]token, error) {
+	var statements [][]token
+	var current []token
+
+	flush := func() {
+		if len(current) > 0 {
+			statements = append(statements, current)
+			current = nil
+		}
+	}
+
+	line, column := 1, 1
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+
+		switch {
+		case r == '\n':
+			flush()
+			line++
+			column = 1
+			i += size
+			continue
+		case r == ';':
+			flush()
+		case r == '#':
+			// Комментарий до конца строки
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case r == ' ' || r == '\t' || r == '\r':
+		case r == '"':
+			// Строка в кавычках с экранированием как в Go
+			start := i
+			end := i + 1
+			for end < len(src) && src[end] != '"' && src[end] != '\n' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) || src[end] != '"' {
+				return nil, &Error{Line: line, Column: column, Msg: "незакрытая строка"}
+			}
+			text, err := strconv.Unquote(src[start : end+1])
+			if err != nil {
+				return nil, &Error{Line: line, Column: column, Msg: "некорректная строка"}
+			}
+			current = append(current, token{text: text, quoted: true, line: line, column: column})
+			column += utf8.RuneCountInString(src[start : end+1])
+			i = end + 1
+			continue
+		default:
+			start := i
+			startColumn := column
+			for i < len(src) {
+				r, size = utf8.DecodeRuneInString(src[i:])
+				if r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == ';' || r == '#' || r == '"' {
+					break
+				}
+				i += size
+				column++
+			}
+			current = append(current, token{text: src[start:i], line: line, column: startColumn})
+			continue
+		}
+
+		i += size
+		column++
+	}
+	flush()
+
+	return statements, nil
+}
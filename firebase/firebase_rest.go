@@ -2,6 +2,7 @@
 package firebase
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -10,19 +11,44 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"tir/audit"
 	"tir/auto"
+	"tir/logging"
+	"tir/metrics"
 	"tir/models"
+	"tir/sender"
 )
 
+var logger = logging.For("firebase")
+
+// Метрики источника Firebase
+var (
+	pollErrors = metrics.NewCounter("tir_firestore_poll_errors_total",
+		"Ошибки опроса Firestore")
+	changesTotal = metrics.NewCounter("tir_firestore_changes_total",
+		"Обнаруженные изменения дистанции по линиям", "lane")
+	changeToSend = metrics.NewHistogram("tir_change_to_send_seconds",
+		"Время от изменения документа линии в Firestore (updateTime) до отправки кадра", nil, "lane")
+)
+
+// httpClient клиент HTTP с ограничением времени запроса, чтобы опрос
+// не зависал при потере связи
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
 // RestClient клиент для работы с Firebase REST API
 type RestClient struct {
 	Running    bool
 	PortName   string
 	BaudRate   uint32
+	LinePorts  map[int]string // номер линии -> порт (если не задан, используется PortName)
+	QueueSize  int            // размер очереди отправки на порт
 	Scenarios  map[string]models.Scenario
 	LastValues map[string]int // lineID -> last distance
 	ProjectID  string
 	ApiKey     string
+
+	dispatcher *sender.Dispatcher
+	links      []*sender.Link
 }
 
 // NewRestClient создает новый REST клиент
@@ -31,6 +57,8 @@ func NewRestClient(projectID, apiKey string, scenarios map[string]models.Scenari
 		Running:    false,
 		PortName:   "COM4",
 		BaudRate:   4800,
+		LinePorts:  make(map[int]string),
+		QueueSize:  sender.DefaultQueueSize,
 		Scenarios:  scenarios,
 		LastValues: make(map[string]int),
 		ProjectID:  projectID,
@@ -44,35 +72,122 @@ func (rc *RestClient) SetPortSettings(portName string, baudRate uint32) {
 	rc.BaudRate = baudRate
 }
 
+// SetLinePort назначает отдельный порт для линии
+func (rc *RestClient) SetLinePort(lineNum int, portName string) {
+	rc.LinePorts[lineNum] = portName
+}
+
+// portForLine возвращает порт, к которому подключена линия
+func (rc *RestClient) portForLine(lineNum int) string {
+	if portName, exists := rc.LinePorts[lineNum]; exists && portName != "" {
+		return portName
+	}
+	return rc.PortName
+}
+
+// ports возвращает порты всех линий без повторов
+func (rc *RestClient) ports() []string {
+	var ports []string
+	seen := make(map[string]bool)
+	for lineNum := models.PULSE_1; lineNum <= models.PULSE_6; lineNum++ {
+		if port := rc.portForLine(lineNum); !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// LinkStates возвращает состояние постоянных соединений с портами автоотправки
+func (rc *RestClient) LinkStates() []sender.LinkStatus {
+	var states []sender.LinkStatus
+	for _, link := range rc.links {
+		states = append(states, link.Status())
+	}
+	return states
+}
+
+// closeLinks закрывает постоянные соединения с портами
+func (rc *RestClient) closeLinks() {
+	for _, link := range rc.links {
+		link.Close()
+	}
+	rc.links = nil
+}
+
+// EmergencyTargets возвращает все линии с их портами для аварийной остановки
+func (rc *RestClient) EmergencyTargets() []sender.Target {
+	var targets []sender.Target
+	for lineNum := models.PULSE_1; lineNum <= models.PULSE_6; lineNum++ {
+		targets = append(targets, sender.Target{
+			Lane:     lineNum,
+			PortName: rc.portForLine(lineNum),
+			BaudRate: rc.BaudRate,
+		})
+	}
+	return targets
+}
+
+// sendRequest выполняет задание диспетчера: находит и отправляет сценарий линии
+func (rc *RestClient) sendRequest(req sender.Request) error {
+	err := auto.SendScenarioAuto(rc.Scenarios, req.PortName, req.BaudRate,
+		byte(req.Lane), req.Distance, audit.SourceFirebase)
+	if err != nil {
+		return err
+	}
+
+	// Время изменения документа по часам сервера служит только для задержки;
+	// очередь и отбрасывание после остановки идут по Created
+	changed := req.Changed
+	if changed.IsZero() {
+		changed = req.Created
+	}
+	changeToSend.Observe(time.Since(changed).Seconds(), strconv.Itoa(req.Lane))
+	logger.Info("Сценарий линии отправлен", "lane", req.Lane, "distance", req.Distance)
+	return nil
+}
+
 // StartAutoSender запускает автоматическое отслеживание и отправку
 func (rc *RestClient) StartAutoSender() error {
 	if rc.Running {
 		return fmt.Errorf("автоматическая отправка уже запущена")
 	}
 
-	fmt.Println("Запуск автоматической отправки сценариев...")
-	fmt.Printf("Порт: %s, скорость: %d бод\n", rc.PortName, rc.BaudRate)
-	fmt.Println("Подключение к Firebase Firestore...")
-	fmt.Printf("Проект: %s\n", rc.ProjectID)
-
-	// Запускаем подготовку сценариев для автоматизации
-	rc.Scenarios = auto.PrepareForAutomation(rc.Scenarios)
+	logger.Info("Запуск автоматической отправки сценариев", "port", rc.PortName, "baud", rc.BaudRate,
+		"project", rc.ProjectID)
+	for lineNum, portName := range rc.LinePorts {
+		logger.Info("Отдельный порт линии", "lane", lineNum, "port", portName)
+	}
 
 	// Считываем начальные значения
 	lines, err := rc.getFirestoreLines()
 	if err != nil {
-		fmt.Printf("Ошибка при получении начальных значений: %v\n", err)
+		logger.Error("Ошибка при получении начальных значений", "error", err)
 	} else {
-		for lineID, distance := range lines {
+		for lineID, line := range lines {
 			lineNum, err := getLineNumber(lineID)
 			if err == nil {
-				rc.LastValues[lineID] = distance
-				fmt.Printf("Начальное значение для линии %d (ID: %s): дистанция %d м\n",
-					lineNum, lineID, distance)
+				rc.LastValues[lineID] = line.Distance
+				logger.Info("Начальное значение линии", "lane", lineNum, "id", lineID, "distance", line.Distance)
 			}
 		}
 	}
 
+	// Каждый порт обслуживается своим потоком с ограниченной очередью
+	dispatcher := sender.NewDispatcher(rc.QueueSize, rc.sendRequest)
+	rc.dispatcher = dispatcher
+
+	// Порты линий держатся открытыми; после обрыва связи соединение восстанавливается,
+	// и отложенные за время обрыва задания отправляются повторно
+	for _, portName := range rc.ports() {
+		link, err := sender.OpenLink(portName, rc.BaudRate, dispatcher.Replay)
+		if err != nil {
+			logger.Warn("Порт будет открываться на каждую отправку", "port", portName, "error", err)
+			continue
+		}
+		rc.links = append(rc.links, link)
+	}
+
 	rc.Running = true
 
 	// Запускаем обработку в отдельной горутине
@@ -81,13 +196,20 @@ func (rc *RestClient) StartAutoSender() error {
 			// Получаем текущие значения из Firestore
 			currentLines, err := rc.getFirestoreLines()
 			if err != nil {
-				fmt.Printf("Ошибка при запросе к Firebase: %v\n", err)
+				pollErrors.Inc()
+				logger.Error("Ошибка при запросе к Firebase", "error", err)
 				time.Sleep(time.Second * 5)
 				continue
 			}
 
 			// Проверяем изменения по каждой линии
-			for lineID, distance := range currentLines {
+			for lineID, line := range currentLines {
+				distance := line.Distance
+				// Остановка во время опроса: новые задания не ставим
+				if !rc.Running {
+					break
+				}
+
 				lineNum, err := getLineNumber(lineID)
 				if err != nil {
 					continue // Пропускаем линии с неверным ID
@@ -97,23 +219,28 @@ func (rc *RestClient) StartAutoSender() error {
 
 				// Если дистанция изменилась или это новая линия
 				if !exists || lastDistance != distance {
-					fmt.Printf("\n[%s] Обнаружено изменение в линии %d (ID: %s): дистанция изменена с %d на %d\n",
-						time.Now().Format("2006-01-02 15:04:05"),
-						lineNum, lineID,
-						lastDistance, distance)
+					logger.Info("Обнаружено изменение дистанции", "lane", lineNum, "id", lineID,
+						"old_distance", lastDistance, "distance", distance)
+					changesTotal.Inc(strconv.Itoa(lineNum))
+
+					// Ставим отправку в очередь порта линии; более новая дистанция
+					// заменяет еще не отправленную старую
+					err := dispatcher.Submit(sender.Request{
+						Lane:     lineNum,
+						PortName: rc.portForLine(lineNum),
+						BaudRate: rc.BaudRate,
+						Distance: distance,
+						Created:  time.Now(),
+						Changed:  line.changedAt(),
+					})
+					if err != nil {
+						// Значение не запоминаем, чтобы повторить попытку при следующем опросе
+						logger.Error("Ошибка постановки в очередь", "lane", lineNum, "error", err)
+						continue
+					}
 
 					// Обновляем последнее известное значение
 					rc.LastValues[lineID] = distance
-
-					// Отправляем сценарий
-					err := auto.SendScenarioAuto(rc.Scenarios, rc.PortName, rc.BaudRate,
-						byte(lineNum), distance)
-					if err != nil {
-						fmt.Printf("Ошибка при отправке сценария: %v\n", err)
-					} else {
-						fmt.Printf("Сценарий для линии %d с дистанцией %d м успешно отправлен\n",
-							lineNum, distance)
-					}
 				}
 			}
 
@@ -124,17 +251,37 @@ func (rc *RestClient) StartAutoSender() error {
 	return nil
 }
 
+// lineValue дистанция линии и время последнего изменения документа
+type lineValue struct {
+	Distance int
+	Updated  time.Time // updateTime документа; нулевое, если не указано
+}
+
+// changedAt возвращает время изменения для задания отправки. Время из будущего
+// (часы сервера впереди) и отсутствующее заменяются текущим
+func (v lineValue) changedAt() time.Time {
+	now := time.Now()
+	if v.Updated.IsZero() || v.Updated.After(now) {
+		return now
+	}
+	return v.Updated
+}
+
 // getFirestoreLines получает информацию о линиях из Firestore
-func (rc *RestClient) getFirestoreLines() (map[string]int, error) {
-	result := make(map[string]int)
+func (rc *RestClient) getFirestoreLines() (map[string]lineValue, error) {
+	result := make(map[string]lineValue)
 
 	// Формируем URL
 	collectionUrl := fmt.Sprintf("https://firestore.googleapis.com/v1/projects/%s/databases/(default)/documents/target_lines?key=%s",
 		url.QueryEscape(rc.ProjectID), url.QueryEscape(rc.ApiKey))
 
 	// Отправляем запрос
-	resp, err := http.Get(collectionUrl)
+	resp, err := httpClient.Get(collectionUrl)
 	if err != nil {
+		// Адрес запроса содержит ключ API - в сообщение попадает только причина
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
 		return result, fmt.Errorf("ошибка отправки запроса: %v", err)
 	}
 	defer resp.Body.Close()
@@ -153,8 +300,9 @@ func (rc *RestClient) getFirestoreLines() (map[string]int, error) {
 	// Структура ответа Firestore
 	var response struct {
 		Documents []struct {
-			Name   string                            `json:"name"`
-			Fields map[string]map[string]interface{} `json:"fields"`
+			Name       string                            `json:"name"`
+			Fields     map[string]map[string]interface{} `json:"fields"`
+			UpdateTime string                            `json:"updateTime"`
 		} `json:"documents"`
 	}
 
@@ -209,13 +357,25 @@ func (rc *RestClient) getFirestoreLines() (map[string]int, error) {
 		}
 
 		if distance > 0 {
-			result[lineID] = distance
+			value := lineValue{Distance: distance}
+			if updated, err := time.Parse(time.RFC3339Nano, doc.UpdateTime); err == nil {
+				value.Updated = updated
+			}
+			result[lineID] = value
 		}
 	}
 
 	return result, nil
 }
 
+// Ping запрашивает линии из Firestore для проверки доступности источника.
+// Возвращает число линий с дистанцией и время ответа
+func (rc *RestClient) Ping() (int, time.Duration, error) {
+	started := time.Now()
+	lines, err := rc.getFirestoreLines()
+	return len(lines), time.Since(started), err
+}
+
 // getLineNumber извлекает номер линии из ID
 func getLineNumber(lineID string) (int, error) {
 	// Проверяем, соответствует ли ID формату "line_X"
@@ -252,12 +412,36 @@ func getLineNumber(lineID string) (int, error) {
 // StopAutoSender останавливает автоматическую отправку
 func (rc *RestClient) StopAutoSender() {
 	rc.Running = false
-	fmt.Println("Остановка автоматической отправки...")
+	logger.Info("Остановка автоматической отправки")
+	if rc.dispatcher != nil {
+		rc.dispatcher.Stop()
+		rc.dispatcher = nil
+	}
+	rc.closeLinks()
+}
+
+// Drain останавливает опрос Firebase и дожидается отправки уже поставленных
+// в очередь заданий (не дольше, чем позволяет ctx)
+func (rc *RestClient) Drain(ctx context.Context) error {
+	rc.Running = false
+	if rc.dispatcher == nil {
+		return nil
+	}
+	logger.Info("Завершение автоматической отправки: выполнение очереди")
+	err := rc.dispatcher.Drain(ctx)
+	rc.dispatcher = nil
+	rc.closeLinks()
+	return err
 }
 
 // Close закрывает соединение
 func (rc *RestClient) Close() {
 	rc.Running = false
+	if rc.dispatcher != nil {
+		rc.dispatcher.Stop()
+		rc.dispatcher = nil
+	}
+	rc.closeLinks()
 }
 
 // ListenToTargetLines отслеживает изменения в target_lines
@@ -267,15 +451,15 @@ func (rc *RestClient) ListenToTargetLines() {
 	for {
 		lines, err := rc.getFirestoreLines()
 		if err != nil {
-			fmt.Printf("Ошибка при запросе к Firebase: %v\n", err)
+			logger.Error("Ошибка при запросе к Firebase", "error", err)
 		} else if len(lines) > 0 {
 			fmt.Printf("[%s] Обнаружено %d линий в Firestore:\n",
 				time.Now().Format("2006-01-02 15:04:05"), len(lines))
 
-			for lineID, distance := range lines {
+			for lineID, line := range lines {
 				lineNum, _ := getLineNumber(lineID)
 				fmt.Printf("  Линия %d (ID: %s): Дистанция %d м\n",
-					lineNum, lineID, distance)
+					lineNum, lineID, line.Distance)
 			}
 		} else {
 			fmt.Println("Линии в Firestore не найдены")
@@ -0,0 +1,432 @@
+// Package interlock проверяет кадры с командами движения перед отправкой:
+// линия должна быть взведена, стрельбище "горячим", безопасная зона не меньше
+// минимальной, а с прошлого движения должна пройти пауза
+package interlock
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tir/logging"
+	"tir/models"
+	"tir/protocol"
+)
+
+// Config настройки блокировок
+type Config struct {
+	MinSafeZoneCM    uint16        // Наименьшая безопасная зона для кадров с движением (см)
+	Cooldown         time.Duration // Наименьшая пауза между кадрами с движением на линии
+	StateFile        string        // Файл состояния линий (взведение, последнее движение)
+	RangeHotFile     string        // Файл признаков "стрельбище горячее" от местного источника
+	RangeHotDisabled bool          // Местного источника нет: правило "стрельбище горячее" не применяется
+	LogFile          string        // Журнал заблокированных отправок
+}
+
+// RangeHotOff значение файла признаков, отключающее правило "стрельбище горячее"
+const RangeHotOff = "off"
+
+// rangeHotHint подсказка в ошибках источника признаков
+const rangeHotHint = `отключить правило: TIR_RANGE_HOT_FILE=off или "range_hot_file": "off" в настройках службы`
+
+// DefaultConfig настройки по умолчанию. Файл признаков задается переменной
+// окружения TIR_RANGE_HOT_FILE; значение "off" отключает правило
+func DefaultConfig() Config {
+	config := Config{
+		MinSafeZoneCM: 300,
+		Cooldown:      5 * time.Second,
+		StateFile:     "interlock.json",
+		RangeHotFile:  "range_hot.txt",
+		LogFile:       "interlock.log",
+	}
+	if fileName := os.Getenv("TIR_RANGE_HOT_FILE"); fileName != "" {
+		config.SetRangeHotFile(fileName)
+	}
+	return config
+}
+
+// SetRangeHotFile задает файл признаков "стрельбище горячее"; RangeHotOff
+// отключает правило
+func (c *Config) SetRangeHotFile(fileName string) {
+	c.RangeHotDisabled = fileName == RangeHotOff
+	if !c.RangeHotDisabled {
+		c.RangeHotFile = fileName
+	}
+}
+
+var (
+	mu       sync.Mutex
+	config   = DefaultConfig()
+	reserved = make(map[int]bool) // Линии, на которые сейчас отправляется кадр с движением
+)
+
+var logger = logging.For("interlock")
+
+// Settings возвращает текущие настройки
+func Settings() Config {
+	mu.Lock()
+	defer mu.Unlock()
+	return config
+}
+
+// Configure заменяет настройки
+func Configure(c Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	config = c
+}
+
+// LaneState состояние линии
+type LaneState struct {
+	Armed      bool      `json:"armed"`
+	ArmedAt    time.Time `json:"armed_at,omitempty"`
+	LastMotion time.Time `json:"last_motion,omitempty"`
+}
+
+// BlockedError отказ в отправке кадра
+type BlockedError struct {
+	Lane     int
+	Scenario string
+	Reason   string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("линия %d: отправка '%s' заблокирована: %s", e.Lane, e.Scenario, e.Reason)
+}
+
+// frameCommands возвращает команды кадра, который будет отправлен
+func frameCommands(scenario models.Scenario) ([]models.Command, error) {
+	if len(scenario.RawData) == 0 {
+		return scenario.Commands, nil
+	}
+	parsed, err := protocol.ParseScenarioData(scenario.RawData)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.Commands, nil
+}
+
+// HasMotion проверяет, содержит ли кадр сценария команды движения.
+// Кадр, который не удается разобрать, считается кадром с движением
+func HasMotion(scenario models.Scenario) bool {
+	commands, err := frameCommands(scenario)
+	if err != nil {
+		return true
+	}
+	return hasMotion(commands)
+}
+
+// motionCodes коды команд движения
+var motionCodes = []uint16{models.CMD_MOVE_TO_RANGE, models.CMD_MOVE_TO_SHOOTER}
+
+// hasMotion проверяет, содержит ли список команды движения
+func hasMotion(commands []models.Command) bool {
+	for _, cmd := range commands {
+		if isMotion(cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMotion проверяет, может ли команда запустить движение. Нераспознанные
+// байты считаются движением, если в них есть код команды движения в любом
+// порядке байтов: разбор мог сбиться и пропустить ее
+func isMotion(cmd models.Command) bool {
+	if !cmd.IsRaw() {
+		for _, code := range motionCodes {
+			if cmd.Code == code {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, code := range motionCodes {
+		high, low := byte(code>>8), byte(code)
+		for i := 0; i+1 < len(cmd.Raw); i++ {
+			pair := [2]byte{cmd.Raw[i], cmd.Raw[i+1]}
+			if pair == [2]byte{high, low} || pair == [2]byte{low, high} {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check проверяет, можно ли отправить сценарий на линию. Кадры без команд
+// движения не ограничиваются. Каждая заблокированная отправка записывается в журнал.
+// Check только сообщает о блокировке; перед самой отправкой нужен Reserve
+func Check(lane int, scenario models.Scenario) error {
+	_, err := reserve(lane, scenario, false)
+	return err
+}
+
+// Reservation разрешение на отправку кадра: пока оно не завершено, другой
+// кадр с движением на линию не пропускается
+type Reservation struct {
+	lane   int
+	motion bool
+	done   bool
+}
+
+// Reserve проверяет сценарий, как Check, и занимает линию до Done, чтобы
+// проверка, отправка и учет движения шли без вмешательства других отправок
+func Reserve(lane int, scenario models.Scenario) (*Reservation, error) {
+	return reserve(lane, scenario, true)
+}
+
+// Done завершает отправку и освобождает линию. sent - кадр мог уйти в порт
+// (в том числе без ответа); от него отсчитывается пауза между движениями.
+// Повторный вызов ничего не делает
+func (r *Reservation) Done(sent bool) {
+	if r == nil || r.done {
+		return
+	}
+	r.done = true
+	if !r.motion {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	delete(reserved, r.lane)
+	if sent {
+		recordMotionLocked(r.lane)
+	}
+}
+
+func reserve(lane int, scenario models.Scenario, hold bool) (*Reservation, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Кадр, который не удается разобрать, проверить нельзя - не отправляем
+	commands, err := frameCommands(scenario)
+	var reason string
+	motion := false
+	if err != nil {
+		reason = fmt.Sprintf("кадр не разобран: %v", err)
+	} else if motion = hasMotion(commands); motion {
+		reason = checkLocked(lane, commands)
+	}
+	if reason != "" {
+		blocked := &BlockedError{Lane: lane, Scenario: scenario.Name, Reason: reason}
+		logBlocked(blocked)
+		return nil, blocked
+	}
+
+	if hold && motion {
+		reserved[lane] = true
+	}
+	return &Reservation{lane: lane, motion: motion, done: !hold}, nil
+}
+
+// checkLocked возвращает причину блокировки или пустую строку
+func checkLocked(lane int, commands []models.Command) string {
+	states, err := loadStates()
+	if err != nil {
+		return fmt.Sprintf("не удалось прочитать состояние линий: %v", err)
+	}
+
+	state := states[lane]
+	if !state.Armed {
+		return "линия не взведена"
+	}
+	if reserved[lane] {
+		return "на линию уже отправляется кадр с движением"
+	}
+
+	hot, known, err := rangeHot(lane)
+	if err != nil {
+		return fmt.Sprintf("нет данных о состоянии стрельбища: %v", err)
+	}
+	if known && !hot {
+		return "стрельбище не в режиме стрельбы (range hot не установлен)"
+	}
+
+	// Безопасная зона должна быть задана до первой команды движения
+	var safeZone uint16
+	safeZoneSet := false
+	for _, cmd := range commands {
+		if isMotion(cmd) {
+			break
+		}
+		if !cmd.IsRaw() && cmd.Code == models.CMD_SAFE_ZONE {
+			safeZone = cmd.ParamValue
+			safeZoneSet = true
+		}
+	}
+	if !safeZoneSet {
+		return "безопасная зона не задана до команды движения"
+	}
+	if safeZone < config.MinSafeZoneCM {
+		return fmt.Sprintf("безопасная зона %d см меньше допустимой %d см", safeZone, config.MinSafeZoneCM)
+	}
+
+	if since := time.Since(state.LastMotion); !state.LastMotion.IsZero() && since < config.Cooldown {
+		return fmt.Sprintf("с прошлого движения прошло %.1f с, требуется %.1f с",
+			since.Seconds(), config.Cooldown.Seconds())
+	}
+
+	return ""
+}
+
+// recordMotionLocked запоминает время отправки кадра с движением для паузы
+// между движениями; вызывается под mu
+func recordMotionLocked(lane int) {
+	states, err := loadStates()
+	if err != nil {
+		logger.Error("Ошибка чтения состояния линий", "file", config.StateFile, "error", err)
+		return
+	}
+	state := states[lane]
+	state.LastMotion = time.Now()
+	states[lane] = state
+	if err := saveStates(states); err != nil {
+		logger.Error("Ошибка записи состояния линий", "file", config.StateFile, "error", err)
+	}
+}
+
+// Arm взводит линию: кадры с движением разрешены
+func Arm(lane int) error {
+	return setArmed(lane, true)
+}
+
+// Disarm снимает линию со взвода: кадры с движением запрещены
+func Disarm(lane int) error {
+	return setArmed(lane, false)
+}
+
+// DisarmAll снимает со взвода все линии (например, при аварийной остановке)
+func DisarmAll() error {
+	for lane := models.PULSE_1; lane <= models.PULSE_6; lane++ {
+		if err := Disarm(lane); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setArmed(lane int, armed bool) error {
+	if lane < models.PULSE_1 || lane > models.PULSE_6 {
+		return fmt.Errorf("неверный номер линии %d", lane)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	states, err := loadStates()
+	if err != nil {
+		return err
+	}
+	state := states[lane]
+	state.Armed = armed
+	state.ArmedAt = time.Time{}
+	if armed {
+		state.ArmedAt = time.Now()
+	}
+	states[lane] = state
+	return saveStates(states)
+}
+
+// States возвращает состояние всех линий
+func States() (map[int]LaneState, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return loadStates()
+}
+
+// RangeHot возвращает признак "стрельбище горячее" для линии;
+// known = false, если правило отключено настройкой
+func RangeHot(lane int) (hot bool, known bool, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return rangeHot(lane)
+}
+
+// loadStates читает файл состояния; отсутствующий файл - все линии не взведены
+func loadStates() (map[int]LaneState, error) {
+	states := make(map[int]LaneState)
+	data, err := os.ReadFile(config.StateFile)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("ошибка разбора %s: %v", config.StateFile, err)
+	}
+	return states, nil
+}
+
+// saveStates записывает файл состояния
+func saveStates(states map[int]LaneState) error {
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(config.StateFile, data, 0644)
+}
+
+// rangeHot читает признак линии из файла местного источника. Файл содержит строки
+// "линия=1" (горячее) или "линия=0"; линия, не указанная в файле, считается не горячей.
+// Правило не применяется только при явном отключении; незаданный или
+// отсутствующий файл - ошибка, и кадры с движением не отправляются
+func rangeHot(lane int) (bool, bool, error) {
+	if config.RangeHotDisabled {
+		return false, false, nil
+	}
+	if config.RangeHotFile == "" {
+		return false, true, fmt.Errorf("файл признаков не задан (%s)", rangeHotHint)
+	}
+
+	file, err := os.Open(config.RangeHotFile)
+	if os.IsNotExist(err) {
+		return false, true, fmt.Errorf("нет файла признаков %s (%s)", config.RangeHotFile, rangeHotHint)
+	}
+	if err != nil {
+		return false, true, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimSpace(key))
+		if err != nil || number != lane {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		return value == "1" || value == "hot", true, nil
+	}
+	return false, true, scanner.Err()
+}
+
+// logBlocked записывает заблокированную отправку в диагностический журнал
+// и в журнал блокировок
+func logBlocked(err *BlockedError) {
+	logger.Warn("Отправка заблокирована", "lane", err.Lane, "scenario", err.Scenario, "reason", err.Reason)
+
+	if config.LogFile == "" {
+		return
+	}
+	file, openErr := os.OpenFile(config.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if openErr != nil {
+		logger.Error("Ошибка записи журнала блокировок", "file", config.LogFile, "error", openErr)
+		return
+	}
+	defer file.Close()
+	fmt.Fprintf(file, "%s\tлиния %d\t%s\t%s\n", time.Now().Format(time.RFC3339), err.Lane, err.Scenario, err.Reason)
+}
@@ -0,0 +1,189 @@
+package interlock
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"tir/models"
+)
+
+// useTempConfig переключает блокировки на файлы во временном каталоге
+func useTempConfig(t *testing.T) Config {
+	t.Helper()
+	previous := Settings()
+	t.Cleanup(func() { Configure(previous) })
+
+	dir := t.TempDir()
+	c := DefaultConfig()
+	c.StateFile = filepath.Join(dir, "interlock.json")
+	c.RangeHotFile = filepath.Join(dir, "range_hot.txt")
+	c.RangeHotDisabled = false
+	c.LogFile = ""
+	Configure(c)
+	return c
+}
+
+// scenario создает сценарий линии 1 из пар код/параметр
+func scenario(t *testing.T, codes ...uint16) models.Scenario {
+	t.Helper()
+	s := models.Scenario{Name: "тест", PulseType: models.PULSE_1}
+	for i := 0; i < len(codes); i += 2 {
+		cmd, err := models.NewCommand(codes[i], codes[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Commands = append(s.Commands, cmd)
+	}
+	return s
+}
+
+func TestCheck(t *testing.T) {
+	motion := []uint16{models.CMD_SAFE_ZONE, 300, models.CMD_MOVE_TO_RANGE, 0}
+
+	tests := []struct {
+		name       string
+		armed      bool
+		rangeHot   string        // Содержимое файла признаков; "-" - файла нет, "off" - правило отключено
+		lastMotion time.Duration // Сколько прошло с прошлого движения; 0 - движений не было
+		codes      []uint16
+		want       string // Часть причины блокировки; пусто - отправка разрешена
+	}{
+		{"без движения на невзведенную линию", false, "-", 0,
+			[]uint16{models.CMD_LIGHT_ON, 0}, ""},
+		{"не взведена", false, "1=1", 0, motion, "не взведена"},
+		{"взведена, стрельбище горячее", true, "1=1", 0, motion, ""},
+		{"стрельбище не горячее", true, "1=0", 0, motion, "не в режиме стрельбы"},
+		{"линии нет в файле признаков", true, "2=1", 0, motion, "не в режиме стрельбы"},
+		{"нет файла признаков", true, "-", 0, motion, "нет файла признаков"},
+		{"правило отключено", true, "off", 0, motion, ""},
+		{"безопасная зона меньше допустимой", true, "1=1", 0,
+			[]uint16{models.CMD_SAFE_ZONE, 200, models.CMD_MOVE_TO_RANGE, 0}, "меньше допустимой"},
+		{"безопасная зона не задана", true, "1=1", 0,
+			[]uint16{models.CMD_MOVE_TO_RANGE, 0}, "не задана"},
+		{"безопасная зона после движения", true, "1=1", 0,
+			[]uint16{models.CMD_MOVE_TO_RANGE, 0, models.CMD_SAFE_ZONE, 300}, "не задана"},
+		{"пауза после движения не выдержана", true, "1=1", time.Second, motion, "с прошлого движения"},
+		{"пауза после движения выдержана", true, "1=1", time.Minute, motion, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := useTempConfig(t)
+
+			state := LaneState{Armed: tt.armed}
+			if tt.lastMotion > 0 {
+				state.LastMotion = time.Now().Add(-tt.lastMotion)
+			}
+			data, _ := json.Marshal(map[int]LaneState{models.PULSE_1: state})
+			if err := os.WriteFile(c.StateFile, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			switch tt.rangeHot {
+			case "-":
+			case RangeHotOff:
+				c.SetRangeHotFile(RangeHotOff)
+				Configure(c)
+			default:
+				if err := os.WriteFile(c.RangeHotFile, []byte(tt.rangeHot+"\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := Check(models.PULSE_1, scenario(t, tt.codes...))
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("отправка заблокирована: %v", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("отправка разрешена, ожидалась блокировка '%s'", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("причина '%v', ожидалась '%s'", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReserve(t *testing.T) {
+	c := useTempConfig(t)
+	if err := os.WriteFile(c.RangeHotFile, []byte("1=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Arm(models.PULSE_1); err != nil {
+		t.Fatal(err)
+	}
+	s := scenario(t, models.CMD_SAFE_ZONE, 300, models.CMD_MOVE_TO_RANGE, 0)
+
+	reservation, err := Reserve(models.PULSE_1, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Пока линия занята, второй кадр с движением не проходит
+	if _, err := Reserve(models.PULSE_1, s); err == nil || !strings.Contains(err.Error(), "уже отправляется") {
+		t.Errorf("вторая отправка на занятую линию: %v", err)
+	}
+
+	// Кадр не ушел: линия свободна, пауза не началась
+	reservation.Done(false)
+	reservation, err = Reserve(models.PULSE_1, s)
+	if err != nil {
+		t.Fatalf("после отмены отправки: %v", err)
+	}
+
+	// Кадр ушел: началась пауза между движениями
+	reservation.Done(true)
+	reservation.Done(true)
+	if err := Check(models.PULSE_1, s); err == nil || !strings.Contains(err.Error(), "с прошлого движения") {
+		t.Errorf("сразу после движения: %v", err)
+	}
+}
+
+func TestCheckRawMotion(t *testing.T) {
+	c := useTempConfig(t)
+	if err := os.WriteFile(c.RangeHotFile, []byte("1=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	safeZone, _ := models.NewCommand(models.CMD_SAFE_ZONE, 300)
+
+	tests := []struct {
+		name     string
+		armed    bool
+		commands []models.Command
+		want     string
+	}{
+		{"код движения внутри нераспознанных байтов", false,
+			[]models.Command{models.NewRawCommand([]byte{0x05, 0x00, 0x03, 0x0A})}, "не взведена"},
+		{"код движения в обратном порядке", false,
+			[]models.Command{models.NewRawCommand([]byte{0x13, 0x12, 0x00})}, "не взведена"},
+		{"нераспознанные байты без движения", false,
+			[]models.Command{models.NewRawCommand([]byte{0x05, 0x00, 0x09})}, ""},
+		{"безопасная зона после скрытого движения", true,
+			[]models.Command{models.NewRawCommand([]byte{0x03, 0x0A}), safeZone}, "не задана"},
+		{"безопасная зона до скрытого движения", true,
+			[]models.Command{safeZone, models.NewRawCommand([]byte{0x03, 0x0A})}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := setArmed(models.PULSE_1, tt.armed); err != nil {
+				t.Fatal(err)
+			}
+			s := models.Scenario{Name: "тест", PulseType: models.PULSE_1, Commands: tt.commands}
+			err := Check(models.PULSE_1, s)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("отправка заблокирована: %v", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("отправка разрешена, ожидалась блокировка '%s'", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("причина '%v', ожидалась '%s'", err, tt.want)
+			}
+		})
+	}
+
+	// Неразбираемый кадр не отправляется
+	if err := Check(models.PULSE_1, models.Scenario{Name: "мусор", RawData: []byte{0x01, 0x02}}); err == nil {
+		t.Error("неразобранный кадр пропущен")
+	}
+}
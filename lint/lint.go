@@ -0,0 +1,207 @@
+package lint
+
+import (
+	"fmt"
+	"tir/models"
+	"tir/protocol"
+)
+
+// Severity уровень серьезности замечания
+type Severity int
+
+const (
+	Info    Severity = iota // Информация
+	Warning                 // Предупреждение
+	Error                   // Ошибка: сценарий не отправляется без принудительного режима
+)
+
+// String возвращает название уровня
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "инфо"
+	case Warning:
+		return "предупреждение"
+	case Error:
+		return "ошибка"
+	default:
+		return fmt.Sprintf("уровень %d", int(s))
+	}
+}
+
+// MaxPauseSeconds пауза длиннее этого значения считается подозрительной
+var MaxPauseSeconds uint16 = 60
+
+// Finding замечание анализатора
+type Finding struct {
+	Severity Severity
+	Rule     string // Короткий идентификатор правила
+	Position int    // Номер команды (с 1), 0 - сценарий в целом
+	Message  string
+}
+
+// String форматирует замечание для вывода
+func (f Finding) String() string {
+	if f.Position > 0 {
+		return fmt.Sprintf("[%s] %s: команда %d: %s", f.Severity, f.Rule, f.Position, f.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", f.Severity, f.Rule, f.Message)
+}
+
+// Пары команд, отменяющих друг друга
+var opposites = map[uint16]uint16{
+	models.CMD_LIGHT_ON:           models.CMD_LIGHT_OFF,
+	models.CMD_LIGHT_OFF:          models.CMD_LIGHT_ON,
+	models.CMD_HIT_LIGHT_ON:       models.CMD_HIT_LIGHT_OFF,
+	models.CMD_HIT_LIGHT_OFF:      models.CMD_HIT_LIGHT_ON,
+	models.CMD_OOP_SIMULATION_ON:  models.CMD_OOP_SIMULATION_OFF,
+	models.CMD_OOP_SIMULATION_OFF: models.CMD_OOP_SIMULATION_ON,
+	models.CMD_EDGE_POSITION:      models.CMD_ENEMY_POSITION,
+	models.CMD_ENEMY_POSITION:     models.CMD_EDGE_POSITION,
+}
+
+// Check анализирует сценарий и возвращает замечания в порядке команд.
+// Если у сценария есть готовый кадр, проверяются команды этого кадра:
+// отправляется именно он, даже если список команд с ним разошелся
+func Check(scenario models.Scenario) []Finding {
+	var findings []Finding
+	add := func(severity Severity, rule string, position int, format string, args ...interface{}) {
+		findings = append(findings, Finding{
+			Severity: severity,
+			Rule:     rule,
+			Position: position,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	commands := scenario.Commands
+	if len(scenario.RawData) > 0 {
+		parsed, err := protocol.ParseScenarioData(scenario.RawData)
+		if err != nil {
+			add(Error, "decode", 0, "не удалось разобрать кадр: %v", err)
+			return findings
+		}
+		commands = parsed.Commands
+	}
+
+	if len(commands) == 0 {
+		add(Error, "empty", 0, "сценарий не содержит команд")
+		return findings
+	}
+
+	// Кадры длиннее проверенных на контроллере не отправляются
+	frame := scenario.RawData
+	if len(frame) == 0 {
+		frame = protocol.GenerateScenarioPacket(scenario)
+	}
+	if len(frame) > protocol.MaxFrameSize {
+		add(Error, "frame-size", 0, "длина кадра %d байт больше допустимой %d", len(frame), protocol.MaxFrameSize)
+	}
+
+	var rangeCM, safeZoneCM uint16
+	rangeSet, safeZoneSet, hasMotion := false, false, false
+	lastKnown := -1  // индекс последней распознанной команды
+	rawSeen := false // перед командой были нераспознанные байты
+
+	for i, cmd := range commands {
+		position := i + 1
+
+		if cmd.IsRaw() {
+			add(Info, "raw-bytes", position, "нераспознанные байты передаются без изменений: % X", cmd.Raw)
+			rawSeen = true
+			continue
+		}
+
+		// Параметры по реестру команд
+		if err := models.ValidateCommand(cmd); err != nil {
+			add(Error, "param-range", position, "%v", err)
+		}
+
+		// Повтор команды подряд
+		if lastKnown >= 0 {
+			prev := commands[lastKnown]
+			if prev.Code == cmd.Code && prev.ParamValue == cmd.ParamValue && lastKnown == i-1 {
+				add(Warning, "duplicate", position, "команда '%s' повторяется подряд", cmd.Name)
+			} else if opposite, exists := opposites[prev.Code]; exists && opposite == cmd.Code && lastKnown == i-1 {
+				add(Warning, "contradiction", position, "'%s' сразу отменяет '%s'", cmd.Name, prev.Name)
+			}
+		}
+
+		spec, _ := models.LookupCommand(cmd.Code)
+
+		switch cmd.Code {
+		case models.CMD_SET_RANGE:
+			rangeSet = true
+			rangeCM = cmd.ParamValue
+			if safeZoneSet && safeZoneCM > rangeCM {
+				add(Error, "safe-zone-range", position,
+					"безопасная зона %d см больше рубежа %d см", safeZoneCM, rangeCM)
+			}
+		case models.CMD_SAFE_ZONE:
+			safeZoneSet = true
+			safeZoneCM = cmd.ParamValue
+			if rangeSet && safeZoneCM > rangeCM {
+				add(Error, "safe-zone-range", position,
+					"безопасная зона %d см больше рубежа %d см", safeZoneCM, rangeCM)
+			}
+		case models.CMD_PAUSE:
+			if cmd.ParamValue > MaxPauseSeconds {
+				add(Warning, "long-pause", position,
+					"пауза %d сек длиннее %d сек", cmd.ParamValue, MaxPauseSeconds)
+			}
+		}
+
+		// Движение мишени требует заданных рубежа и безопасной зоны. Если перед
+		// командой есть нераспознанные байты, рубеж мог в них остаться, и правило
+		// только предупреждает
+		if spec.Terminal && cmd.Code != models.CMD_PARKING {
+			hasMotion = true
+			severity, note := Error, ""
+			if rawSeen {
+				severity, note = Warning, " (кадр разобран не полностью)"
+			}
+			if !rangeSet {
+				add(severity, "motion-before-range", position, "'%s' до установки рубежа%s", cmd.Name, note)
+			}
+			if !safeZoneSet {
+				add(severity, "motion-without-safe-zone", position, "'%s' без безопасной зоны%s", cmd.Name, note)
+			}
+		}
+
+		lastKnown = i
+	}
+
+	if hasMotion && (lastKnown < 0 || commands[lastKnown].Code != models.CMD_PARKING) {
+		add(Warning, "no-parking", 0, "сценарий с движением не заканчивается парковкой")
+	}
+
+	return findings
+}
+
+// HasErrors проверяет, есть ли среди замечаний ошибки
+func HasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity >= Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter оставляет замечания не ниже заданного уровня
+func Filter(findings []Finding, min Severity) []Finding {
+	var result []Finding
+	for _, f := range findings {
+		if f.Severity >= min {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// Print выводит замечания с отступом
+func Print(findings []Finding) {
+	for _, f := range findings {
+		fmt.Printf("  %s\n", f)
+	}
+}
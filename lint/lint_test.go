@@ -0,0 +1,102 @@
+package lint
+
+import (
+	"testing"
+	"tir/models"
+	"tir/protocol"
+)
+
+func command(t *testing.T, code, value uint16) models.Command {
+	t.Helper()
+	cmd, err := models.NewCommand(code, value)
+	if err != nil {
+		t.Fatalf("NewCommand(0x%04X, %d): %v", code, value, err)
+	}
+	return cmd
+}
+
+func severityOf(findings []Finding, rule string) (Severity, bool) {
+	for _, f := range findings {
+		if f.Rule == rule {
+			return f.Severity, true
+		}
+	}
+	return 0, false
+}
+
+func TestCheckBuiltinScenarios(t *testing.T) {
+	builtin := make(map[string]models.Scenario)
+	protocol.ImportDefaultScenarios(builtin)
+
+	for name, scenario := range builtin {
+		for _, f := range Check(scenario) {
+			if f.Severity >= Error || f.Rule == "long-pause" {
+				t.Errorf("%s: %s", name, f)
+			}
+		}
+	}
+}
+
+func TestCheckMotionRules(t *testing.T) {
+	move := command(t, models.CMD_MOVE_TO_RANGE, 0)
+	rangeCmd := command(t, models.CMD_SET_RANGE, 1000)
+	safeZone := command(t, models.CMD_SAFE_ZONE, 300)
+	raw := models.NewRawCommand([]byte{0x05, 0x00})
+
+	tests := []struct {
+		name     string
+		commands []models.Command
+		rule     string
+		want     Severity
+		found    bool
+	}{
+		{"рубеж задан", []models.Command{rangeCmd, safeZone, move}, "motion-before-range", 0, false},
+		{"без рубежа", []models.Command{safeZone, move}, "motion-before-range", Error, true},
+		{"без безопасной зоны", []models.Command{rangeCmd, move}, "motion-without-safe-zone", Error, true},
+		{"без рубежа после нераспознанных байтов", []models.Command{raw, safeZone, move}, "motion-before-range", Warning, true},
+		{"нераспознанные байты после движения", []models.Command{safeZone, move, raw}, "motion-before-range", Error, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			severity, found := severityOf(Check(models.Scenario{Name: tt.name, Commands: tt.commands}), tt.rule)
+			if found != tt.found || severity != tt.want {
+				t.Errorf("%s: найдено %v (%s), ожидалось %v (%s)", tt.rule, found, severity, tt.found, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckFrameSize(t *testing.T) {
+	commands := []models.Command{command(t, models.CMD_SET_RANGE, 1000), command(t, models.CMD_SAFE_ZONE, 300)}
+	for len(protocol.GenerateScenarioPacket(models.Scenario{Name: "длинный", PulseType: 1, Commands: commands})) <= protocol.MaxFrameSize {
+		commands = append(commands, command(t, models.CMD_LIGHT_ON, 0), command(t, models.CMD_LIGHT_OFF, 0))
+	}
+
+	findings := Check(models.Scenario{Name: "длинный", PulseType: 1, Commands: commands})
+	if severity, found := severityOf(findings, "frame-size"); !found || severity != Error {
+		t.Errorf("кадр длиннее %d байт: %v", protocol.MaxFrameSize, findings)
+	}
+	findings = Check(models.Scenario{Name: "короткий", PulseType: 1, Commands: commands[:2]})
+	if _, found := severityOf(findings, "frame-size"); found {
+		t.Errorf("короткий кадр: %v", findings)
+	}
+}
+
+func TestCheckSentFrame(t *testing.T) {
+	safeZone := command(t, models.CMD_SAFE_ZONE, 300)
+	move := command(t, models.CMD_MOVE_TO_RANGE, 0)
+	sent := protocol.GenerateScenarioPacket(models.Scenario{Name: "кадр", PulseType: 1,
+		Commands: []models.Command{safeZone, move}})
+
+	// Список команд исправлен, но отправляется старый кадр без рубежа
+	scenario := models.Scenario{
+		Name:      "кадр",
+		PulseType: 1,
+		Commands:  []models.Command{command(t, models.CMD_SET_RANGE, 1000), safeZone, move},
+		RawData:   sent,
+	}
+	if severity, found := severityOf(Check(scenario), "motion-before-range"); !found || severity != Error {
+		t.Errorf("проверен список команд, а не отправляемый кадр: %v", Check(scenario))
+	}
+}
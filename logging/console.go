@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SubsystemKey имя атрибута подсистемы
+const SubsystemKey = "subsystem"
+
+// consoleHandler выводит записи строками для оператора:
+// "2006-01-02 15:04:05 INFO  sender: сообщение ключ=значение"
+type consoleHandler struct {
+	mu        *sync.Mutex
+	w         io.Writer
+	subsystem string
+	attrs     string // Уже отформатированные атрибуты журнала
+	group     string // Префикс ключей текущей группы
+}
+
+func newConsoleHandler(w io.Writer) *consoleHandler {
+	return &consoleHandler{mu: &sync.Mutex{}, w: w}
+}
+
+func (h *consoleHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	var b strings.Builder
+	t := record.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	b.WriteString(t.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, " %-5s ", record.Level)
+	if h.subsystem != "" {
+		b.WriteString(h.subsystem)
+		b.WriteString(": ")
+	}
+	b.WriteString(record.Message)
+	b.WriteString(h.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		appendAttr(&b, h.group, attr)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	var b strings.Builder
+	for _, attr := range attrs {
+		// Подсистема выводится перед сообщением, а не среди атрибутов
+		if attr.Key == SubsystemKey && h.group == "" {
+			clone.subsystem = attr.Value.String()
+			continue
+		}
+		appendAttr(&b, h.group, attr)
+	}
+	clone.attrs += b.String()
+	return &clone
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.group = h.group + name + "."
+	return &clone
+}
+
+// appendAttr добавляет атрибут в виде " ключ=значение"; значения с пробелами
+// берутся в кавычки, группы разворачиваются в ключи через точку
+func appendAttr(b *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, inner := range attr.Value.Group() {
+			appendAttr(b, prefix, inner)
+		}
+		return
+	}
+
+	value := attr.Value.String()
+	if attr.Value.Kind() == slog.KindTime {
+		value = attr.Value.Time().Format(time.RFC3339)
+	}
+	if value == "" || strings.ContainsAny(value, " =\"\t\n") {
+		value = fmt.Sprintf("%q", value)
+	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, attr.Key, value)
+}
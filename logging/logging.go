@@ -0,0 +1,198 @@
+// Package logging настраивает диагностический журнал программы (log/slog):
+// уровни, журналы подсистем (comport, protocol, sender, firebase, auto ...)
+// и вывод в консольном или JSON-формате. Текст меню и ответы оператору
+// печатаются отдельно и в журнал не попадают
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Форматы вывода
+const (
+	FormatConsole = "console" // Строки для оператора: время, уровень, подсистема, сообщение
+	FormatJSON    = "json"    // Одна запись JSON на строку для сборщиков журналов
+)
+
+// Config настройки журнала
+type Config struct {
+	Level  slog.Level            // Уровень по умолчанию
+	Levels map[string]slog.Level // Уровни отдельных подсистем
+	Format string                // console или json
+	File   string                // Файл журнала; пусто - стандартный поток ошибок
+}
+
+// DefaultConfig настройки по умолчанию: уровень info, консольный вывод в stderr
+func DefaultConfig() Config {
+	return Config{Level: slog.LevelInfo, Format: FormatConsole}
+}
+
+// state текущий обработчик и уровни; журналы подсистем обращаются к нему при
+// каждой записи, поэтому перенастройка действует и на уже созданные журналы
+type state struct {
+	config  Config
+	handler slog.Handler
+	closer  io.Closer
+}
+
+var (
+	mu      sync.RWMutex
+	current = newState(DefaultConfig(), os.Stderr, nil)
+)
+
+func newState(config Config, w io.Writer, closer io.Closer) *state {
+	// Отбор по уровню выполняет журнал подсистемы, обработчику передается все
+	options := &slog.HandlerOptions{Level: slog.Level(-1 << 10)}
+	var handler slog.Handler
+	if config.Format == FormatJSON {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = newConsoleHandler(w)
+	}
+	return &state{config: config, handler: handler, closer: closer}
+}
+
+// levelFor возвращает уровень подсистемы
+func (s *state) levelFor(subsystem string) slog.Level {
+	if level, exists := s.config.Levels[subsystem]; exists {
+		return level
+	}
+	return s.config.Level
+}
+
+// Configure применяет настройки. Файл журнала открывается на дозапись;
+// предыдущий файл закрывается
+func Configure(config Config) error {
+	if config.Format == "" {
+		config.Format = FormatConsole
+	}
+	if config.Format != FormatConsole && config.Format != FormatJSON {
+		return fmt.Errorf("неизвестный формат журнала '%s' (ожидается console или json)", config.Format)
+	}
+
+	var w io.Writer = os.Stderr
+	var closer io.Closer
+	if config.File != "" {
+		file, err := os.OpenFile(config.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("не удалось открыть файл журнала: %v", err)
+		}
+		w, closer = file, file
+	}
+
+	mu.Lock()
+	previous := current
+	current = newState(config, w, closer)
+	mu.Unlock()
+
+	if previous.closer != nil {
+		previous.closer.Close()
+	}
+	return nil
+}
+
+// Settings возвращает текущие настройки
+func Settings() Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current.config
+}
+
+// ConfigureFromEnv применяет настройки из переменных окружения
+// TIR_LOG_LEVEL (например, "info" или "warn,sender=debug,comport=debug"),
+// TIR_LOG_FORMAT (console или json) и TIR_LOG_FILE
+func ConfigureFromEnv() error {
+	config := DefaultConfig()
+	if value := os.Getenv("TIR_LOG_LEVEL"); value != "" {
+		level, levels, err := ParseLevels(value)
+		if err != nil {
+			return err
+		}
+		config.Level, config.Levels = level, levels
+	}
+	if value := os.Getenv("TIR_LOG_FORMAT"); value != "" {
+		config.Format = value
+	}
+	config.File = os.Getenv("TIR_LOG_FILE")
+	return Configure(config)
+}
+
+// ParseLevels разбирает список уровней: общий уровень и уровни подсистем
+// вида "подсистема=уровень" через запятую
+func ParseLevels(value string) (slog.Level, map[string]slog.Level, error) {
+	level := slog.LevelInfo
+	levels := make(map[string]slog.Level)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		subsystem, name, isSubsystem := strings.Cut(part, "=")
+		if !isSubsystem {
+			name = part
+		}
+		var parsed slog.Level
+		if err := parsed.UnmarshalText([]byte(name)); err != nil {
+			return level, nil, fmt.Errorf("неверный уровень журнала '%s' (debug, info, warn, error)", name)
+		}
+		if isSubsystem {
+			levels[strings.TrimSpace(subsystem)] = parsed
+		} else {
+			level = parsed
+		}
+	}
+	return level, levels, nil
+}
+
+// For возвращает журнал подсистемы
+func For(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{subsystem: subsystem})
+}
+
+// subsystemHandler отбирает записи по уровню подсистемы и передает их текущему
+// обработчику. Атрибуты и группы журнала запоминаются и применяются к обработчику
+// при каждой записи
+type subsystemHandler struct {
+	subsystem string
+	wrap      []func(slog.Handler) slog.Handler
+}
+
+func (h *subsystemHandler) Enabled(_ context.Context, level slog.Level) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return level >= current.levelFor(h.subsystem)
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, record slog.Record) error {
+	mu.RLock()
+	handler := current.handler
+	mu.RUnlock()
+
+	handler = handler.WithAttrs([]slog.Attr{slog.String(SubsystemKey, h.subsystem)})
+	for _, wrap := range h.wrap {
+		handler = wrap(handler)
+	}
+	return handler.Handle(ctx, record)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *subsystemHandler) with(wrap func(slog.Handler) slog.Handler) *subsystemHandler {
+	return &subsystemHandler{
+		subsystem: h.subsystem,
+		wrap:      append(append([]func(slog.Handler) slog.Handler(nil), h.wrap...), wrap),
+	}
+}
@@ -2,14 +2,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 	"tir/auto"
+	"tir/capture"
+	"tir/comport"
 	"tir/firebase" // Импортируем новый пакет
+	"tir/logging"
 	"tir/models"
 	"tir/protocol"
+	"tir/sender"
 	"tir/storage"
 	"tir/ui"
 )
@@ -21,6 +29,29 @@ var scenarios = map[string]models.Scenario{}
 var restClient *firebase.RestClient
 
 func main() {
+	// Диагностический журнал (уровень, формат, файл) из переменных окружения
+	if err := logging.ConfigureFromEnv(); err != nil {
+		fmt.Printf("Ошибка настройки журнала: %v\n", err)
+	}
+
+	// Запись обмена с портами для отладки (просмотр: tir capture view файл)
+	if fileName := os.Getenv("TIR_CAPTURE"); fileName != "" {
+		if _, err := capture.Start(fileName); err != nil {
+			fmt.Printf("Ошибка записи обмена: %v\n", err)
+		}
+	}
+
+	// Язык названий команд и каталог команд (дополняет встроенный без пересборки)
+	if language := os.Getenv("TIR_LANG"); language != "" {
+		models.SetLanguage(language)
+	}
+	loadCommandCatalogue()
+
+	// Команды командной строки (tir lint ...) выполняются без меню
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	fmt.Println("Монорельсовая управляющая программа")
 	fmt.Println("====================================")
 
@@ -31,6 +62,13 @@ func main() {
 	storage.LoadScenariosFromFile(scenarios)
 
 	for {
+		if state := sender.Emergency(); state.Active {
+			fmt.Printf("\n!!! АВАРИЙНАЯ БЛОКИРОВКА с %s: отправка сценариев запрещена (пункт 16 - снять)\n",
+				state.Since.Format("15:04:05"))
+		}
+		if restClient != nil && restClient.Running {
+			printLinkStates(restClient.LinkStates())
+		}
 		fmt.Println("\nГлавное меню:")
 		fmt.Println("1. Подключиться к порту и отправить сценарий")
 		fmt.Println("2. Конструктор сценариев")
@@ -44,6 +82,12 @@ func main() {
 		fmt.Println("10. Автоматический режим (по типу пульта и дистанции)")
 		fmt.Println("11. Запустить отслеживание изменений в Firebase")      // Мониторинг
 		fmt.Println("12. Автоматическая отправка при изменении в Firebase") // Автоматическая отправка
+		fmt.Println("13. Симуляция сценария (длительность и положение мишени)")
+		fmt.Println("14. Развернуть упражнение (повторения, макросы, развертка)")
+		fmt.Println("15. Сценарий в текстовом формате (просмотр, выгрузка, загрузка)")
+		fmt.Println("16. Снять аварийную блокировку (повторное взведение)")
+		fmt.Println("17. Блокировки движения (взведение линий)")
+		fmt.Println("!. АВАРИЙНАЯ ОСТАНОВКА: парковка всех линий")
 		fmt.Println("0. Выход")
 
 		var choice string
@@ -77,6 +121,18 @@ func main() {
 		case "12":
 			// Запускаем автоматическую отправку при изменении
 			startAutoSender()
+		case "13":
+			ui.SimulateScenario(scenarios)
+		case "14":
+			ui.ExpandDrill(scenarios)
+		case "15":
+			ui.ScenarioText(scenarios)
+		case "!", "stop", "стоп":
+			emergencyStop()
+		case "16":
+			rearm()
+		case "17":
+			ui.InterlockMenu()
 		case "0":
 			fmt.Println("Завершение работы...")
 			// Закрываем соединение, если оно открыто
@@ -90,6 +146,110 @@ func main() {
 	}
 }
 
+// loadCommandCatalogue загружает файл каталога команд, если он есть
+func loadCommandCatalogue() {
+	count, err := models.LoadCommandCatalogue(models.CatalogueFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Ошибка загрузки каталога команд %s: %v\n", models.CatalogueFile, err)
+		}
+		return
+	}
+	fmt.Printf("Загружено %d описаний команд из %s\n", count, models.CatalogueFile)
+}
+
+// emergencyStop паркует все линии без дополнительных вопросов. Порты берутся
+// из настроек автоматической отправки, если она запускалась, иначе COM4 4800 бод
+func emergencyStop() {
+	var targets []sender.Target
+	if restClient != nil {
+		targets = restClient.EmergencyTargets()
+	} else {
+		for lane := models.PULSE_1; lane <= models.PULSE_6; lane++ {
+			targets = append(targets, sender.Target{Lane: lane, PortName: "COM4", BaudRate: 4800})
+		}
+	}
+
+	fmt.Println("\nАВАРИЙНАЯ ОСТАНОВКА: отправка парковки на все линии...")
+	results, err := sender.EmergencyStop(targets, "меню оператора")
+	sender.PrintStopResults(results)
+	if err != nil {
+		fmt.Printf("ОШИБКА БЛОКИРОВКИ: %v\n", err)
+		fmt.Println("Отправка заблокирована только в этой программе до повторного взведения (пункт 16)")
+		return
+	}
+	fmt.Println("Отправка сценариев заблокирована до повторного взведения (пункт 16)")
+}
+
+// rearm снимает аварийную блокировку после подтверждения оператора
+func rearm() {
+	if !sender.EmergencyActive() {
+		fmt.Println("Аварийная блокировка не действует")
+		return
+	}
+
+	fmt.Print("Линии проверены, люди вне зоны движения мишеней? Введите 'взвести' для подтверждения: ")
+	var confirm string
+	fmt.Scanln(&confirm)
+	if confirm != "взвести" && confirm != "rearm" {
+		fmt.Println("Блокировка не снята")
+		return
+	}
+
+	if err := sender.Rearm(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// parseLinePorts разбирает назначение портов линиям вида "1=COM4,2=COM5"
+func parseLinePorts(input string) map[int]string {
+	linePorts := make(map[int]string)
+	if input == "" {
+		return linePorts
+	}
+
+	for _, pair := range strings.Split(input, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		lineNum, err := strconv.Atoi(parts[0])
+		if err != nil || lineNum < 1 || lineNum > 6 || parts[1] == "" {
+			fmt.Printf("Пропущено неверное назначение порта: %s\n", pair)
+			continue
+		}
+		linePorts[lineNum] = parts[1]
+	}
+	return linePorts
+}
+
+// setLineFormat задает формат линии всех портов: "8N1", "8E1,rs485"
+func setLineFormat(text string) error {
+	line, err := comport.ParseSettings(0, text)
+	if err != nil {
+		return err
+	}
+	sender.SetLineSettings(map[string]comport.Settings{"": line})
+	return nil
+}
+
+// printLinkStates выводит состояние связи с портами автоматической отправки
+func printLinkStates(states []sender.LinkStatus) {
+	if len(states) == 0 {
+		return
+	}
+
+	var parts []string
+	for _, link := range states {
+		if link.State == sender.LinkUp {
+			parts = append(parts, link.Port+" - есть")
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s - НЕТ с %s (%s)", link.Port, link.Since.Format("15:04:05"), link.LastError))
+	}
+	fmt.Printf("\nАвтоотправка, связь с портами: %s\n", strings.Join(parts, "; "))
+}
+
 // getFirebaseCredentials возвращает учетные данные Firebase
 func getFirebaseCredentials() (string, string) {
 	// Правильные значения для вашего проекта
@@ -137,13 +297,8 @@ func startAutoSender() {
 	projectID, apiKey := getFirebaseCredentials()
 
 	// Настройки порта
-	portName := "COM4" // По умолчанию COM4
-	fmt.Print("Введите имя порта (по умолчанию COM4): ")
+	portName := comport.PromptPort("COM4")
 	var input string
-	fmt.Scanln(&input)
-	if input != "" {
-		portName = input
-	}
 
 	// Выбор скорости
 	baudRate := uint32(4800) // По умолчанию 4800 бод
@@ -157,6 +312,18 @@ func startAutoSender() {
 		}
 	}
 
+	// Формат линии (RS-485, четность, управление потоком)
+	for {
+		input = ""
+		fmt.Print("Формат линии, например 8E1 или 8N1,rs485 (по умолчанию 8N1): ")
+		fmt.Scanln(&input)
+		if err := setLineFormat(input); err != nil {
+			fmt.Printf("Ошибка: %v\n", err)
+			continue
+		}
+		break
+	}
+
 	fmt.Println("Инициализация клиента автоматической отправки...")
 
 	// Инициализируем клиент
@@ -165,6 +332,14 @@ func startAutoSender() {
 	// Устанавливаем настройки порта
 	restClient.SetPortSettings(portName, baudRate)
 
+	// Отдельные порты для линий (каждый порт обслуживается независимо)
+	fmt.Print("Порты для отдельных линий (например, 1=COM4,2=serial:A10K5QZ3; Enter - один порт для всех): ")
+	input = ""
+	fmt.Scanln(&input)
+	for lineNum, portName := range parseLinePorts(input) {
+		restClient.SetLinePort(lineNum, portName)
+	}
+
 	// Запускаем автоматическую отправку
 	err := restClient.StartAutoSender()
 	if err != nil {
@@ -180,19 +355,25 @@ func startAutoSender() {
 	// Настраиваем обработку сигналов для корректного завершения
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
-	// Ожидаем нажатия Enter или сигнала завершения
+	// Ожидаем нажатия Enter или сигнала завершения. Чтение Enter завершается
+	// до возврата в меню, поэтому меню не соревнуется с ним за ввод
+	entered := make(chan struct{})
 	go func() {
 		fmt.Scanln()
-		// Возврат в главное меню, но автоматическая отправка продолжается
+		close(entered)
 	}()
 
 	select {
+	case <-entered:
+		// Возврат в главное меню, но автоматическая отправка продолжается
 	case <-sigChan:
-		// Получен сигнал завершения
-		fmt.Println("\nПолучен сигнал завершения, останавливаем автоматическую отправку...")
-		restClient.StopAutoSender()
-		restClient.Close()
+		// Получен сигнал завершения: уже поставленные отправки выполняем
+		fmt.Println("\nПолучен сигнал завершения, завершаем очередь автоматической отправки...")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		restClient.Drain(ctx)
+		cancel()
 		restClient = nil
 		os.Exit(0)
 	}
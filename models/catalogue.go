@@ -0,0 +1,161 @@
+package models
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Встроенный каталог команд; файл каталога рядом с программой дополняет его
+//
+//go:embed commands.json
+var builtinCatalogue []byte
+
+// CatalogueFile имя файла каталога команд по умолчанию
+const CatalogueFile = "commands.json"
+
+// Language язык названий команд (код из поля names каталога)
+var Language = "ru"
+
+// catalogueEntry запись каталога команд в файле
+type catalogueEntry struct {
+	Code     string            `json:"code"`
+	Names    map[string]string `json:"names"`
+	Terminal bool              `json:"terminal,omitempty"`
+	Notes    string            `json:"notes,omitempty"`
+	Param    *struct {
+		Type    string            `json:"type"`
+		Names   map[string]string `json:"names"`
+		Unit    string            `json:"unit"`
+		Min     uint16            `json:"min"`
+		Max     uint16            `json:"max"`
+		Default uint16            `json:"default"`
+	} `json:"param,omitempty"`
+}
+
+// Типы параметров в файле каталога
+var paramTypeNames = map[string]ParamType{
+	"none":     ParamNone,
+	"distance": ParamDistance,
+	"speed":    ParamSpeed,
+	"duration": ParamDuration,
+}
+
+// ParseCommandCatalogue разбирает каталог команд в формате JSON
+func ParseCommandCatalogue(data []byte) ([]CommandSpec, error) {
+	var entries []catalogueEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("ошибка разбора каталога команд: %v", err)
+	}
+
+	specs := make([]CommandSpec, 0, len(entries))
+	seen := make(map[uint16]bool)
+	for i, entry := range entries {
+		code, err := strconv.ParseUint(entry.Code, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("запись %d: некорректный код '%s'", i+1, entry.Code)
+		}
+		if seen[uint16(code)] {
+			return nil, fmt.Errorf("запись %d: код 0x%04X указан повторно", i+1, code)
+		}
+		seen[uint16(code)] = true
+
+		spec := CommandSpec{
+			Code:     uint16(code),
+			Names:    entry.Names,
+			Name:     localizedName(entry.Names),
+			Terminal: entry.Terminal,
+			Notes:    entry.Notes,
+		}
+		if spec.Name == "" {
+			spec.Name = fmt.Sprintf("Команда 0x%04X", code)
+		}
+
+		if entry.Param != nil {
+			paramType, known := paramTypeNames[entry.Param.Type]
+			if !known {
+				return nil, fmt.Errorf("запись %d (0x%04X): неизвестный тип параметра '%s'",
+					i+1, code, entry.Param.Type)
+			}
+			if entry.Param.Min > entry.Param.Max {
+				return nil, fmt.Errorf("запись %d (0x%04X): минимум больше максимума", i+1, code)
+			}
+
+			spec.ParamType = paramType
+			spec.ParamNames = entry.Param.Names
+			spec.ParamName = localizedName(entry.Param.Names)
+			spec.Unit = entry.Param.Unit
+			spec.Min = entry.Param.Min
+			spec.Max = entry.Param.Max
+			spec.Default = entry.Param.Default
+			if spec.ParamName == "" {
+				spec.ParamName = "параметр"
+			}
+		}
+
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
+
+// localizedName выбирает название на текущем языке (или на русском, если перевода нет)
+func localizedName(names map[string]string) string {
+	if name, exists := names[Language]; exists && name != "" {
+		return name
+	}
+	return names["ru"]
+}
+
+// LoadCommandCatalogue загружает файл каталога и дополняет им реестр команд:
+// записи с уже известным кодом заменяют встроенные, новые добавляются в конец.
+// Возвращает количество записей в файле
+func LoadCommandCatalogue(fileName string) (int, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	specs, err := ParseCommandCatalogue(data)
+	if err != nil {
+		return 0, err
+	}
+
+	merged := CommandSpecs()
+	for _, spec := range specs {
+		replaced := false
+		for i := range merged {
+			if merged[i].Code == spec.Code {
+				merged[i] = spec
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, spec)
+		}
+	}
+
+	SetCommandSpecs(merged)
+	return len(specs), nil
+}
+
+// SetLanguage меняет язык названий команд и перестраивает карты команд
+func SetLanguage(language string) {
+	Language = language
+
+	specs := CommandSpecs()
+	for i := range specs {
+		if name := localizedName(specs[i].Names); name != "" {
+			specs[i].Name = name
+		}
+		if specs[i].HasParam() {
+			if name := localizedName(specs[i].ParamNames); name != "" {
+				specs[i].ParamName = name
+			}
+		}
+	}
+	SetCommandSpecs(specs)
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// keepRegistry восстанавливает реестр команд и язык после теста
+func keepRegistry(t *testing.T) {
+	t.Helper()
+	specs, language := CommandSpecs(), Language
+	t.Cleanup(func() {
+		Language = language
+		SetCommandSpecs(specs)
+	})
+}
+
+func TestParseCommandCatalogue(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string // Часть ошибки; пусто - каталог разбирается
+	}{
+		{"команда без параметра", `[{"code": "0x0401", "names": {"ru": "Парковка"}}]`, ""},
+		{"команда с параметром", `[{"code": "0x1300", "names": {"ru": "Рубеж"},
+			"param": {"type": "distance", "min": 100, "max": 6500}}]`, ""},
+		{"десятичный код", `[{"code": "1024"}]`, ""},
+		{"не JSON", `{`, "ошибка разбора"},
+		{"некорректный код", `[{"code": "0xZZ"}]`, "некорректный код"},
+		{"код вне 16 бит", `[{"code": "0x10000"}]`, "некорректный код"},
+		{"повтор кода", `[{"code": "0x0401"}, {"code": "0x401"}]`, "повторно"},
+		{"неизвестный тип параметра", `[{"code": "0x1300", "param": {"type": "angle"}}]`, "неизвестный тип"},
+		{"минимум больше максимума", `[{"code": "0x1300", "param": {"type": "distance", "min": 10, "max": 1}}]`, "минимум больше"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCommandCatalogue([]byte(tt.data))
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("ошибка: %v", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("ожидалась ошибка '%s'", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("ошибка '%v', ожидалась '%s'", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCommandCatalogueNames(t *testing.T) {
+	keepRegistry(t)
+	Language = "en"
+
+	specs, err := ParseCommandCatalogue([]byte(`[
+		{"code": "0x1300", "names": {"ru": "Рубеж", "en": "Range"},
+			"param": {"type": "distance", "names": {"ru": "рубеж (см)"}, "min": 1, "max": 2}},
+		{"code": "0x0401", "names": {"ru": "Парковка"}},
+		{"code": "0x7777", "param": {"type": "speed"}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		wantName  string
+		wantParam string
+	}{
+		{"перевод есть", "Range", "рубеж (см)"},
+		{"перевода нет - по-русски", "Парковка", ""},
+		{"названий нет", "Команда 0x7777", "параметр"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if specs[i].Name != tt.wantName || specs[i].ParamName != tt.wantParam {
+				t.Errorf("'%s' ('%s'), ожидалось '%s' ('%s')",
+					specs[i].Name, specs[i].ParamName, tt.wantName, tt.wantParam)
+			}
+		})
+	}
+}
+
+func TestLoadCommandCatalogue(t *testing.T) {
+	keepRegistry(t)
+	before := len(CommandSpecs())
+
+	fileName := filepath.Join(t.TempDir(), CatalogueFile)
+	data := `[
+		{"code": "0x1300", "names": {"ru": "Рубеж площадки"},
+			"param": {"type": "distance", "names": {"ru": "рубеж"}, "unit": "см", "min": 200, "max": 3000}},
+		{"code": "0x7701", "names": {"ru": "Новая команда", "en": "New command"}}
+	]`
+	if err := os.WriteFile(fileName, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	count, err := LoadCommandCatalogue(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("записей в файле %d, ожидалось 2", count)
+	}
+
+	// Известный код заменен на месте, новый добавлен в конец
+	specs := CommandSpecs()
+	if len(specs) != before+1 {
+		t.Errorf("команд %d, ожидалось %d", len(specs), before+1)
+	}
+	if last := specs[len(specs)-1]; last.Code != 0x7701 {
+		t.Errorf("последняя команда 0x%04X, ожидалась 0x7701", last.Code)
+	}
+	if _, err := NewCommand(CMD_SET_RANGE, 100); err == nil {
+		t.Error("рубеж 100 см: ожидалась ошибка по новому минимуму")
+	}
+	if cmd, err := NewCommand(CMD_SET_RANGE, 1000); err != nil || cmd.Name != "Рубеж площадки" {
+		t.Errorf("рубеж 1000 см: %s, %v", cmd.Name, err)
+	}
+
+	// Смена языка меняет названия, у команд без перевода остается русское
+	SetLanguage("en")
+	if spec, _ := LookupCommand(0x7701); spec.Name != "New command" {
+		t.Errorf("название на английском '%s'", spec.Name)
+	}
+	if spec, _ := LookupCommand(CMD_SET_RANGE); spec.Name != "Рубеж площадки" {
+		t.Errorf("название без перевода '%s'", spec.Name)
+	}
+
+	if _, err := LoadCommandCatalogue(filepath.Join(t.TempDir(), "нет.json")); err == nil {
+		t.Error("нет файла: ожидалась ошибка")
+	}
+}
@@ -31,52 +31,24 @@ const (
 	CMD_SET_SPEED          = 0x1500 // Установить скорость
 )
 
-// Карта команд для удобного поиска
-var CommandMap = map[string]uint16{
-	"Повернуть мишень в ребро":      CMD_EDGE_POSITION,
-	"Повернуть мишень в чужой":      CMD_ENEMY_POSITION,
-	"Включить подсветку мишени":     CMD_LIGHT_ON,
-	"Выключить подсветку мишени":    CMD_LIGHT_OFF,
-	"Включить имитацию ООП":         CMD_OOP_SIMULATION_ON,
-	"Выключить имитацию ООП":        CMD_OOP_SIMULATION_OFF,
-	"Включить подсветку поражений":  CMD_HIT_LIGHT_ON,
-	"Выключить подсветку поражений": CMD_HIT_LIGHT_OFF,
-	"Парковка": CMD_PARKING,
-	"Старт движения - к рубежу":  CMD_MOVE_TO_RANGE,
-	"Старт движения - к стрелку": CMD_MOVE_TO_SHOOTER,
-	"Ручная протяжка (откл)":     CMD_MANUAL_FEED_OFF,
-	"Энкодер":             CMD_ENCODER,
-	"Пауза":               CMD_PAUSE,
-	"Установить рубеж":    CMD_SET_RANGE,
-	"Безопасная зона":     CMD_SAFE_ZONE,
-	"Установить скорость": CMD_SET_SPEED,
+// ShortFormCommands команды, короткая форма которых (13 2C 01) встречается
+// в кадрах с пульта. Для остальных команд с параметром она не проверена
+var ShortFormCommands = map[uint16]bool{
+	CMD_SET_RANGE: true,
+	CMD_SAFE_ZONE: true,
+	CMD_SET_SPEED: true,
 }
 
-// Обратная карта команд для поиска по коду
-var ReverseCommandMap = map[uint16]string{
-	CMD_EDGE_POSITION:      "Повернуть мишень в ребро",
-	CMD_ENEMY_POSITION:     "Повернуть мишень в чужой",
-	CMD_LIGHT_ON:           "Включить подсветку мишени",
-	CMD_LIGHT_OFF:          "Выключить подсветку мишени",
-	CMD_OOP_SIMULATION_ON:  "Включить имитацию ООП",
-	CMD_OOP_SIMULATION_OFF: "Выключить имитацию ООП",
-	CMD_HIT_LIGHT_ON:       "Включить подсветку поражений",
-	CMD_HIT_LIGHT_OFF:      "Выключить подсветку поражений",
-	CMD_PARKING:            "Парковка",
-	CMD_MOVE_TO_RANGE:      "Старт движения - к рубежу",
-	CMD_MOVE_TO_SHOOTER:    "Старт движения - к стрелку",
-	CMD_MANUAL_FEED_OFF:    "Ручная протяжка (откл)",
-	CMD_ENCODER:            "Энкодер",
-	CMD_PAUSE:              "Пауза",
-	CMD_SET_RANGE:          "Установить рубеж",
-	CMD_SAFE_ZONE:          "Безопасная зона",
-	CMD_SET_SPEED:          "Установить скорость",
-}
-
-// Определение команд с параметрами
-var ParamCommands = map[uint16]string{
-	CMD_PAUSE:     "длительность (сек)",
-	CMD_SET_RANGE: "рубеж (см)",
-	CMD_SAFE_ZONE: "безопасное расстояние (см)",
-	CMD_SET_SPEED: "скорость",
+// DefaultEncoding форма записи новой команды, как в кадрах с пульта: короткая
+// для команд из ShortFormCommands, старший-младший байт для команд без параметра.
+// Остальные команды с параметром (пауза) с пульта не встречаются и записываются
+// младшим байтом вперед
+func DefaultEncoding(code uint16) CommandEncoding {
+	if ShortFormCommands[code] {
+		return EncodingShort
+	}
+	if spec, exists := LookupCommand(code); exists && spec.HasParam() {
+		return EncodingLE
+	}
+	return EncodingBE
 }
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ParamType тип параметра команды
+type ParamType int
+
+const (
+	ParamNone     ParamType = iota // Команда без параметра
+	ParamDistance                  // Расстояние (см), ограничено длиной трассы
+	ParamSpeed                     // Скорость (условные единицы)
+	ParamDuration                  // Длительность (сек)
+)
+
+// String возвращает название типа параметра
+func (t ParamType) String() string {
+	switch t {
+	case ParamNone:
+		return "нет"
+	case ParamDistance:
+		return "расстояние"
+	case ParamSpeed:
+		return "скорость"
+	case ParamDuration:
+		return "длительность"
+	default:
+		return fmt.Sprintf("тип %d", int(t))
+	}
+}
+
+// CommandSpec описание команды в реестре: параметр, единицы и допустимые значения
+type CommandSpec struct {
+	Code      uint16
+	Name      string
+	ParamType ParamType
+	ParamName string // Подпись параметра для пользователя
+	Unit      string // Единица измерения параметра
+	Min       uint16 // Минимальное допустимое значение параметра
+	Max       uint16 // Максимальное допустимое значение параметра
+	Default   uint16 // Значение параметра по умолчанию
+	Terminal  bool   // Команда движения, после которой мишень уходит с места
+	Notes     string // Примечания (например, что известно о неразобранном коде)
+
+	Names      map[string]string // Название команды на разных языках
+	ParamNames map[string]string // Подпись параметра на разных языках
+}
+
+// HasParam проверяет, требует ли команда параметр
+func (spec CommandSpec) HasParam() bool {
+	return spec.ParamType != ParamNone
+}
+
+// TrackLengthCM длина трассы (см); рубеж и безопасная зона не могут ее превышать
+var TrackLengthCM uint16 = 6500
+
+// Реестр команд в порядке вывода пользователю
+var (
+	registryMu    sync.RWMutex
+	commandSpecs  []CommandSpec
+	commandByCode = map[uint16]CommandSpec{}
+)
+
+func init() {
+	specs, err := ParseCommandCatalogue(builtinCatalogue)
+	if err != nil {
+		panic("встроенный каталог команд поврежден: " + err.Error())
+	}
+	SetCommandSpecs(specs)
+}
+
+// SetCommandSpecs заменяет реестр команд. Реестр читается только через
+// CommandSpecs и LookupCommand под registryMu, поэтому замена во время
+// разбора кадров в других потоках безопасна
+func SetCommandSpecs(specs []CommandSpec) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	commandSpecs = append([]CommandSpec(nil), specs...)
+	commandByCode = make(map[uint16]CommandSpec, len(specs))
+	for _, spec := range specs {
+		commandByCode[spec.Code] = spec
+	}
+}
+
+// CommandSpecs возвращает описания всех команд в порядке реестра
+func CommandSpecs() []CommandSpec {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return append([]CommandSpec(nil), commandSpecs...)
+}
+
+// LookupCommand возвращает описание команды по коду
+func LookupCommand(code uint16) (CommandSpec, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	spec, exists := commandByCode[code]
+	return spec, exists
+}
+
+// ValidateParam проверяет значение параметра команды
+func (spec CommandSpec) ValidateParam(value uint16) error {
+	if !spec.HasParam() {
+		return nil
+	}
+
+	if value < spec.Min || value > spec.Max {
+		return fmt.Errorf("%s: %s %d %s вне допустимого диапазона %d-%d",
+			spec.Name, spec.ParamName, value, spec.Unit, spec.Min, spec.Max)
+	}
+
+	if spec.ParamType == ParamDistance && value > TrackLengthCM {
+		return fmt.Errorf("%s: %d см превышает длину трассы %d см", spec.Name, value, TrackLengthCM)
+	}
+
+	return nil
+}
+
+// NewCommand создает команду по коду из реестра с проверкой параметра
+func NewCommand(code uint16, value uint16) (Command, error) {
+	spec, exists := LookupCommand(code)
+	if !exists {
+		return Command{}, fmt.Errorf("неизвестная команда 0x%04X", code)
+	}
+
+	command := Command{
+		Name:     spec.Name,
+		Code:     spec.Code,
+		HasParam: spec.HasParam(),
+		Encoding: DefaultEncoding(spec.Code),
+	}
+	if spec.HasParam() {
+		command.ParamName = spec.ParamName
+		command.ParamValue = value
+	}
+
+	return command, spec.ValidateParam(value)
+}
+
+// ValidateCommand проверяет команду по реестру
+func ValidateCommand(cmd Command) error {
+	// Нераспознанные байты передаются как есть и не проверяются
+	if cmd.IsRaw() {
+		return nil
+	}
+
+	spec, exists := LookupCommand(cmd.Code)
+	if !exists {
+		return fmt.Errorf("неизвестная команда 0x%04X", cmd.Code)
+	}
+
+	if cmd.HasParam != spec.HasParam() {
+		if spec.HasParam() {
+			return fmt.Errorf("%s: отсутствует параметр (%s)", spec.Name, spec.ParamName)
+		}
+		return fmt.Errorf("%s: команда не принимает параметр", spec.Name)
+	}
+
+	return spec.ValidateParam(cmd.ParamValue)
+}
+
+// ValidateScenario проверяет все команды сценария и возвращает найденные ошибки
+func ValidateScenario(scenario Scenario) []error {
+	var errs []error
+	for i, cmd := range scenario.Commands {
+		if err := ValidateCommand(cmd); err != nil {
+			errs = append(errs, fmt.Errorf("команда %d: %v", i+1, err))
+		}
+	}
+	return errs
+}
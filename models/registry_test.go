@@ -0,0 +1,36 @@
+package models
+
+import (
+	"sync"
+	"testing"
+)
+
+// Замена реестра (загрузка каталога) не мешает разбору команд в других
+// потоках; проверяется с -race
+func TestSetCommandSpecsConcurrent(t *testing.T) {
+	specs := CommandSpecs()
+	defer SetCommandSpecs(specs)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			SetCommandSpecs(specs)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if _, err := NewCommand(CMD_SAFE_ZONE, 300); err != nil {
+				t.Error(err)
+				return
+			}
+			if DefaultEncoding(CMD_PAUSE) != EncodingLE {
+				t.Error("пауза: ожидалась запись младшим байтом вперед")
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
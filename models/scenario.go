@@ -1,13 +1,41 @@
 package models
 
+import "fmt"
+
 // Структура сценария
 type Scenario struct {
 	Name      string
 	PulseType byte
 	Commands  []Command
 	RawData   []byte // Опционально, для хранения сырых данных при импорте
+	Header    []byte // Заголовок разобранного кадра (до команд), используется при генерации
+
+	// Метаданные для выбора сценария без разбора имени
+	Distance  int      // Дистанция в метрах (по команде установки рубежа), 0 - не задана
+	Lane      int      // Номер линии (полосы), 0 - любая
+	DrillType string   // Тип упражнения
+	Tags      []string // Произвольные метки
+}
+
+// HasTag проверяет наличие метки у сценария
+func (s Scenario) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
+// CommandEncoding форма записи команды в кадре
+type CommandEncoding byte
+
+const (
+	EncodingLE    CommandEncoding = iota // Код в порядке младший-старший байт
+	EncodingBE                           // Код в порядке старший-младший байт
+	EncodingShort                        // Только старший байт кода и параметр (13 2C 01)
+)
+
 // Структура команды
 type Command struct {
 	Name       string
@@ -15,4 +43,21 @@ type Command struct {
 	HasParam   bool
 	ParamName  string
 	ParamValue uint16
+
+	Encoding CommandEncoding // Форма записи в кадре (для новых команд - DefaultEncoding)
+	Raw      []byte          // Нераспознанные байты, передаются без изменений
+}
+
+// NewRawCommand создает команду из нераспознанных байтов кадра
+func NewRawCommand(data []byte) Command {
+	raw := append([]byte(nil), data...)
+	return Command{
+		Name: fmt.Sprintf("Нераспознанные данные (% X)", raw),
+		Raw:  raw,
+	}
+}
+
+// IsRaw проверяет, хранит ли команда нераспознанные байты
+func (c Command) IsRaw() bool {
+	return len(c.Raw) > 0
 }
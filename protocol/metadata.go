@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"fmt"
+	"tir/models"
+)
+
+// RangeDistance возвращает дистанцию в метрах по команде установки рубежа (CMD_SET_RANGE)
+func RangeDistance(commands []models.Command) (int, error) {
+	found := false
+	var rangeCM uint16
+	for _, cmd := range commands {
+		if cmd.Code != models.CMD_SET_RANGE {
+			continue
+		}
+		if found && cmd.ParamValue != rangeCM {
+			return 0, fmt.Errorf("несколько разных рубежей в одном сценарии")
+		}
+		found = true
+		rangeCM = cmd.ParamValue
+	}
+
+	if !found {
+		return 0, fmt.Errorf("нет команды установки рубежа")
+	}
+	if rangeCM == 0 || rangeCM%100 != 0 {
+		return 0, fmt.Errorf("рубеж %d см не равен целому числу метров", rangeCM)
+	}
+
+	return int(rangeCM / 100), nil
+}
+
+// FillMetadata заполняет метаданные сценария по декодированным командам.
+// Дистанция из команды установки рубежа имеет приоритет над заданной вручную;
+// если рубеж в кадре не найден, сохраняется прежнее значение
+func FillMetadata(scenario *models.Scenario) error {
+	commands := scenario.Commands
+	if len(commands) == 0 && len(scenario.RawData) > 0 {
+		parsed, err := ParseScenarioData(scenario.RawData)
+		if err != nil {
+			return fmt.Errorf("не удалось разобрать кадр: %v", err)
+		}
+		commands = parsed.Commands
+	}
+
+	distance, err := RangeDistance(commands)
+	if err != nil {
+		return err
+	}
+
+	scenario.Distance = distance
+	return nil
+}
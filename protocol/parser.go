@@ -1,10 +1,18 @@
 package protocol
 
 import (
+	"bytes"
 	"fmt"
+	"tir/logging"
 	"tir/models"
 )
 
+var logger = logging.For("protocol")
+
+// MaxFrameSize наибольшая длина кадра (байт), которую принимает контроллер:
+// самый длинный из проверенных на контроллере кадров. Длиннее кадры не проверялись
+var MaxFrameSize = 90
+
 // Разобрать сырые данные сценария в структурированный вид
 func ParseScenarioData(data []byte) (models.Scenario, error) {
 	scenario := models.Scenario{}
@@ -17,96 +25,225 @@ func ParseScenarioData(data []byte) (models.Scenario, error) {
 	// Получаем версию пульта
 	scenario.PulseType = data[2]
 
-	// Извлекаем имя сценария
-	nameLength := int(data[3])
-	if nameLength+4 > len(data) {
-		return scenario, fmt.Errorf("неверная длина имени сценария")
+	// Байт 3 не всегда равен длине имени, поэтому границы заголовка
+	// определяются по его содержимому
+	nameEnd, cmdStart, err := headerBounds(data)
+	if err != nil {
+		return scenario, err
 	}
 
-	nameBytes := data[4 : 4+nameLength-1] // Без нулевого байта
+	// Имя до нулевого байта; после него в кадре с пульта бывает заполнение
+	nameBytes, _, _ := bytes.Cut(data[4:nameEnd], []byte{0x00})
 	scenario.Name = string(nameBytes)
 
-	// Ищем начало команд
-	cmdStart := 4 + nameLength + 6 // Заголовок + имя + константные данные
-	if cmdStart >= len(data) {
-		return scenario, fmt.Errorf("в данных нет команд")
+	// Заголовок сохраняем как есть, чтобы повторная генерация дала тот же кадр
+	scenario.Header = append([]byte(nil), data[:cmdStart]...)
+
+	// Команды занимают все байты до контрольной суммы
+	scenario.Commands = DecodeCommands(data[cmdStart : len(data)-1])
+
+	return scenario, nil
+}
+
+// Байты заголовка кадра: после имени идут FD FD FD FD, переменная часть
+// (своя у каждого пульта) и маркер начала команд 00 00 00 01
+var (
+	nameTerminator = []byte{0xFD, 0xFD, 0xFD, 0xFD}
+	commandsMarker = []byte{0x00, 0x00, 0x00, 0x01}
+)
+
+// headerBounds возвращает конец имени (начало FD FD FD FD) и начало команд.
+// В немногих кадрах из библиотеки маркера нет - тогда заголовок
+// заканчивается на первых трех нулевых байтах после FD FD FD FD
+func headerBounds(data []byte) (int, int, error) {
+	body := data[:len(data)-1] // Без контрольной суммы
+
+	nameEnd := bytes.Index(body[4:], nameTerminator)
+	if nameEnd < 0 {
+		return 0, 0, fmt.Errorf("в заголовке нет байтов FD FD FD FD после имени")
 	}
+	nameEnd += 4
 
-	// Начинаем чтение команд
-	for i := cmdStart; i < len(data)-1; { // -1 чтобы не включать контрольную сумму
-		if i+1 >= len(data) {
-			break
-		}
+	variableStart := nameEnd + len(nameTerminator)
+	if marker := bytes.Index(body[variableStart:], commandsMarker); marker >= 0 {
+		return nameEnd, variableStart + marker + len(commandsMarker), nil
+	}
+	if zeros := bytes.Index(body[variableStart:], commandsMarker[:3]); zeros >= 0 {
+		return nameEnd, variableStart + zeros + 3, nil
+	}
+	return 0, 0, fmt.Errorf("в данных нет команд")
+}
 
-		// Получаем 2 байта команды
-		cmdCode := uint16(data[i]) | uint16(data[i+1])<<8
-		name, exists := models.ReverseCommandMap[cmdCode]
+// DecodeCommands распознает команды в байтах кадра между заголовком и контрольной суммой.
+// Нераспознанные байты сохраняются командами с сырыми данными
+func DecodeCommands(data []byte) []models.Command {
+	var commands []models.Command
+	var unknown []byte
+
+	for i := 0; i < len(data); {
+		command, size := decodeCommand(data[i:])
+		if size == 0 {
+			// Нераспознанный байт сохраняем, а не отбрасываем
+			unknown = append(unknown, data[i])
+			i++
+			continue
+		}
+		if command.IsRaw() {
+			unknown = append(unknown, command.Raw...)
+			i += size
+			continue
+		}
 
-		if !exists {
-			// Пробуем другой порядок байтов
-			cmdCode = uint16(data[i]<<8) | uint16(data[i+1])
-			name, exists = models.ReverseCommandMap[cmdCode]
-
-			if !exists {
-				// Если команда не найдена, пропускаем байт и продолжаем
-				i++
-				continue
-			}
+		if len(unknown) > 0 {
+			commands = append(commands, models.NewRawCommand(unknown))
+			unknown = nil
 		}
 
-		// Проверяем, имеет ли команда параметры
-		_, hasParam := models.ParamCommands[cmdCode]
+		commands = append(commands, command)
+		i += size
+	}
 
-		command := models.Command{
-			Name:     name,
-			Code:     cmdCode,
-			HasParam: hasParam,
+	if len(unknown) > 0 {
+		commands = append(commands, models.NewRawCommand(unknown))
+	}
+
+	return commands
+}
+
+// decodeCommand распознает команду в начале data и возвращает ее и занятый размер.
+// Размер 0 означает, что команда не распознана
+func decodeCommand(data []byte) (models.Command, int) {
+	if len(data) == 0 {
+		return models.Command{}, 0
+	}
+
+	// Короткая форма команды с параметром, как в кадрах с пульта:
+	// [старший байт кода] [параметр LE], например 13 2C 01 - рубеж 300 см
+	shortCode := uint16(data[0]) << 8
+	if models.ShortFormCommands[shortCode] && len(data) >= 3 {
+		spec, _ := models.LookupCommand(shortCode)
+		return models.Command{
+			Name:       spec.Name,
+			Code:       shortCode,
+			HasParam:   true,
+			ParamName:  spec.ParamName,
+			ParamValue: uint16(data[1]) | uint16(data[2])<<8,
+			Encoding:   models.EncodingShort,
+		}, 3
+	}
+
+	if len(data) < 2 {
+		return models.Command{}, 0
+	}
+
+	// Получаем 2 байта команды
+	encoding := models.EncodingLE
+	cmdCode := uint16(data[0]) | uint16(data[1])<<8
+	spec, exists := models.LookupCommand(cmdCode)
+
+	if !exists {
+		// Пробуем другой порядок байтов
+		encoding = models.EncodingBE
+		cmdCode = uint16(data[0])<<8 | uint16(data[1])
+		spec, exists = models.LookupCommand(cmdCode)
+
+		if !exists {
+			return models.Command{}, 0
 		}
 
-		// Если команда с параметром, читаем параметр
-		if hasParam && i+3 < len(data) {
-			paramValue := uint16(data[i+2]) | uint16(data[i+3])<<8
-			command.ParamValue = paramValue
-			command.ParamName = models.ParamCommands[cmdCode]
-			i += 4 // Пропускаем 2 байта команды и 2 байта параметра
-		} else {
-			i += 2 // Пропускаем только 2 байта команды
+		// Команду с параметром в порядке старший-младший байт пульт не передает:
+		// в кадрах с пульта 05 00 стоит без параметра (… 03 0A 05 00 04 01 …).
+		// Пара остается нераспознанной, а следующие байты разбираются с нее же,
+		// иначе параметр поглотил бы следующую команду
+		if spec.HasParam() {
+			return models.NewRawCommand(data[:2]), 2
 		}
+	}
 
-		scenario.Commands = append(scenario.Commands, command)
+	command := models.Command{
+		Name:     spec.Name,
+		Code:     cmdCode,
+		HasParam: spec.HasParam(),
+		Encoding: encoding,
 	}
 
-	return scenario, nil
+	// Если команда с параметром, читаем параметр
+	if spec.HasParam() {
+		if len(data) < 4 {
+			// Параметр обрезан - оставляем байты нераспознанными
+			return models.Command{}, 0
+		}
+		command.ParamValue = uint16(data[2]) | uint16(data[3])<<8
+		command.ParamName = spec.ParamName
+		return command, 4 // 2 байта команды и 2 байта параметра
+	}
+
+	return command, 2
 }
 
 // Генерировать бинарный пакет из структуры сценария
 func GenerateScenarioPacket(scenario models.Scenario) []byte {
-	// Имя с нулевым байтом
-	nameWithZero := append([]byte(scenario.Name), 0)
-
-	// Заголовок: 7E 00 [версия пульта] [длина имени с нулевым байтом]
-	header := []byte{0x7E, 0x00, scenario.PulseType, byte(len(nameWithZero))}
+	var packet []byte
+
+	switch {
+	case len(scenario.Header) == 0:
+		packet = RebuildHeader(nil, scenario.Name, scenario.PulseType)
+	case len(scenario.Header) > 2 && scenario.Header[2] != scenario.PulseType:
+		// Пульт сменился: переменная часть заголовка у каждого пульта своя
+		packet = rebuildHeader(scenario.Header, nil, scenario.PulseType)
+	default:
+		// Заголовок разобранного кадра используем без изменений
+		packet = append(packet, scenario.Header...)
+	}
 
-	// Начинаем собирать пакет
-	packet := append(header, nameWithZero...)
+	// Команды сценария в бинарном формате
+	packet = append(packet, EncodeCommands(scenario.Commands)...)
 
-	// Константные данные
-	constantData := []byte{0xFD, 0xFD, 0xFD, 0xFD, 0x00, 0x00}
-	packet = append(packet, constantData...)
+	// Добавляем контрольную сумму
+	return append(packet, Checksum(packet))
+}
 
-	// Добавляем переменную часть в зависимости от пульта
-	variablePart := getVariablePartForPulse(scenario.PulseType)
-	packet = append(packet, variablePart...)
+// Checksum вычисляет контрольную сумму кадра: CRC-8/MAXIM (отраженный полином 0x8C,
+// начальное значение 0) по всем байтам от 7E до последней команды. Так посчитаны
+// суммы всех кадров с пульта в библиотеке
+func Checksum(frame []byte) byte {
+	var crc byte
+	for _, b := range frame {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x01 != 0 {
+				crc = crc>>1 ^ 0x8C
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
 
-	// Команды сценария в бинарном формате
+// EncodeCommands кодирует команды в байты кадра, сохраняя исходную форму записи
+// каждой команды и нераспознанные байты без изменений
+func EncodeCommands(commands []models.Command) []byte {
 	commandsData := []byte{}
 
-	for _, cmd := range scenario.Commands {
+	for _, cmd := range commands {
+		if cmd.IsRaw() {
+			commandsData = append(commandsData, cmd.Raw...)
+			continue
+		}
+
 		// Преобразуем uint16 в два байта
 		highByte := byte((cmd.Code >> 8) & 0xFF)
 		lowByte := byte(cmd.Code & 0xFF)
 
-		commandsData = append(commandsData, lowByte, highByte)
+		switch {
+		case cmd.Encoding == models.EncodingShort && cmd.HasParam:
+			commandsData = append(commandsData, highByte)
+		case cmd.Encoding == models.EncodingBE:
+			commandsData = append(commandsData, highByte, lowByte)
+		default:
+			commandsData = append(commandsData, lowByte, highByte)
+		}
 
 		// Если команда с параметром, добавляем его
 		if cmd.HasParam {
@@ -116,39 +253,93 @@ func GenerateScenarioPacket(scenario models.Scenario) []byte {
 		}
 	}
 
-	// Добавляем команды к пакету
-	packet = append(packet, commandsData...)
+	return commandsData
+}
 
-	// Вычисляем контрольную сумму (XOR всех байтов команд)
-	var checksum byte
-	for _, b := range commandsData {
-		checksum ^= b
-	}
+// Переменная часть заголовка (между FD FD FD FD и маркером начала команд)
+// из кадров range_3m_pulseN, проверенных на контроллере
+var verifiedVariableParts = map[byte][]byte{
+	models.PULSE_1: {0x00, 0x00, 0x00, 0xA6, 0x40, 0xA9},
+	models.PULSE_2: {0x20, 0x00, 0x80, 0x59, 0xD4, 0xB4},
+	models.PULSE_3: {0x00, 0x00, 0x00, 0x5D, 0xC6, 0x83},
+	models.PULSE_4: {0x00, 0x00, 0x00, 0x6B, 0x47, 0x59},
+	models.PULSE_5: {0x55, 0x17, 0x0A, 0x97, 0x47, 0x9A},
+}
 
-	// Добавляем контрольную сумму
-	packet = append(packet, checksum)
+// Байт 3 заголовка в проверенных кадрах (длиной имени он не является)
+const verifiedHeaderByte3 = 0x0D
+
+// HasVerifiedHeader проверяет, есть ли для пульта заголовок из кадра,
+// проверенного на контроллере. Для пульта 6 такого кадра нет
+func HasVerifiedHeader(pulseType byte) bool {
+	_, exists := verifiedVariableParts[pulseType]
+	return exists
+}
+
+// RebuildHeader возвращает заголовок кадра с новым именем. Если пульт отличается
+// от указанного в заголовке, переменная часть заменяется проверенной для нового
+// пульта. Без заголовка (или с заголовком, который не разбирается) собирается
+// заголовок проверенного кадра
+func RebuildHeader(header []byte, name string, pulseType byte) []byte {
+	return rebuildHeader(header, append([]byte(name), 0x00), pulseType)
+}
 
-	return packet
+// rebuildHeader собирает заголовок с полем имени nameField (с нулевым байтом);
+// nil - поле имени исходного заголовка без изменений
+func rebuildHeader(header, nameField []byte, pulseType byte) []byte {
+	prefix, oldName, variable, tail, ok := splitHeader(header)
+	switch {
+	case !ok && nameField == nil && len(header) > 2:
+		// Нестандартный заголовок: меняем только номер пульта
+		result := append([]byte(nil), header...)
+		result[2] = pulseType
+		return result
+	case !ok:
+		prefix = []byte{0x7E, 0x00, pulseType, verifiedHeaderByte3}
+		variable = verifiedVariableParts[pulseType]
+		if variable == nil {
+			variable = make([]byte, 6) // Не проверено: кадров с пульта 6 нет
+		}
+		tail = commandsMarker
+	case prefix[2] != pulseType:
+		if verified, exists := verifiedVariableParts[pulseType]; exists {
+			variable = verified
+		}
+	}
+	if nameField == nil {
+		nameField = oldName
+	}
+
+	result := append([]byte(nil), prefix...)
+	result[2] = pulseType
+	result = append(result, nameField...)
+	result = append(result, nameTerminator...)
+	result = append(result, variable...)
+	return append(result, tail...)
 }
 
-// Получить переменную часть заголовка для разных типов пультов
-func getVariablePartForPulse(pulseType byte) []byte {
-	switch pulseType {
-	case models.PULSE_1:
-		return []byte{0x00, 0xA6, 0x40, 0xA9, 0x00, 0x00, 0x00}
-	case models.PULSE_2:
-		return []byte{0x20, 0x00, 0x80, 0x59, 0xD4, 0xB4, 0x00, 0x00, 0x00}
-	case models.PULSE_3:
-		return []byte{0x00, 0x00, 0x00, 0x5D, 0xC6, 0x83, 0x00, 0x00, 0x00}
-	case models.PULSE_4:
-		return []byte{0x00, 0x00, 0x00, 0x6B, 0x47, 0x59, 0x00, 0x00, 0x00}
-	case models.PULSE_5:
-		return []byte{0x55, 0x17, 0x0A, 0x97, 0x47, 0x9A, 0x00, 0x00, 0x00}
-	case models.PULSE_6:
-		return []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00} // Предполагаемые данные для пульта 6
+// splitHeader разбивает заголовок кадра на начало (7E 00 пульт байт), поле имени
+// (с нулевым байтом и заполнением), переменную часть и маркер начала команд
+func splitHeader(header []byte) (prefix, nameField, variable, tail []byte, ok bool) {
+	if len(header) < 8 || header[0] != 0x7E {
+		return nil, nil, nil, nil, false
+	}
+	nameEnd := bytes.Index(header[4:], nameTerminator)
+	if nameEnd < 0 {
+		return nil, nil, nil, nil, false
+	}
+	nameEnd += 4
+
+	rest := header[nameEnd+len(nameTerminator):]
+	switch {
+	case bytes.HasSuffix(rest, commandsMarker):
+		tail = commandsMarker
+	case bytes.HasSuffix(rest, commandsMarker[:3]):
+		tail = commandsMarker[:3]
 	default:
-		return []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+		return nil, nil, nil, nil, false
 	}
+	return header[:4], header[4:nameEnd], rest[:len(rest)-len(tail)], tail, true
 }
 
 // Импортировать сохраненные ранее сценарии в новый формат
@@ -203,11 +394,15 @@ func ImportDefaultScenarios(scenarios map[string]models.Scenario) {
 		parsedScenario, err := ParseScenarioData(data)
 		if err == nil && len(parsedScenario.Commands) > 0 {
 			scenario.Commands = parsedScenario.Commands
+			scenario.Header = parsedScenario.Header
 		}
 
+		// Заполняем метаданные (дистанцию) по декодированному рубежу
+		FillMetadata(&scenario)
+
 		// Сохраняем сценарий
 		scenarios[name] = scenario
 	}
 
-	fmt.Printf("Импортировано %d встроенных сценариев\n", len(savedScenarios))
+	logger.Info("Импортированы встроенные сценарии", "count", len(savedScenarios))
 }
@@ -0,0 +1,220 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+	"tir/models"
+)
+
+// libraryFrames читает кадры из файла сценариев в корне репозитория,
+// включая строки, которые storage пропускает из-за формата
+func libraryFrames(t *testing.T) map[string][]byte {
+	t.Helper()
+	data, err := os.ReadFile("../scenarios.txt")
+	if err != nil {
+		t.Fatalf("файл сценариев: %v", err)
+	}
+
+	frames := make(map[string][]byte)
+	for _, line := range strings.Split(string(data), "\n") {
+		separator := strings.LastIndex(line, ":")
+		if separator < 0 {
+			continue
+		}
+		frame, err := hex.DecodeString(strings.Join(strings.Fields(line[separator+1:]), ""))
+		if err != nil {
+			t.Fatalf("%s: %v", line[:separator], err)
+		}
+		frames[line[:separator]] = frame
+	}
+	return frames
+}
+
+func TestParseScenarioDataHeader(t *testing.T) {
+	builtin := make(map[string]models.Scenario)
+	ImportDefaultScenarios(builtin)
+
+	tests := []struct {
+		name      string
+		header    int      // Длина заголовка до первой команды
+		scenario  string   // Имя в кадре
+		first     uint16   // Первая команда
+		firstCM   uint16   // Ее параметр
+		wantCodes []uint16 // Распознанные команды по порядку
+	}{
+		{"test1", 27, "test1", models.CMD_SET_RANGE, 1000, []uint16{
+			models.CMD_SET_RANGE, models.CMD_SET_SPEED, models.CMD_SAFE_ZONE,
+			models.CMD_EDGE_POSITION, models.CMD_MOVE_TO_RANGE, models.CMD_PARKING}},
+		{"test1_bez_park", 27, "test1 bez park", models.CMD_SET_RANGE, 1000, []uint16{
+			models.CMD_SET_RANGE, models.CMD_SET_SPEED, models.CMD_SAFE_ZONE,
+			models.CMD_EDGE_POSITION, models.CMD_MOVE_TO_RANGE, models.CMD_PARKING,
+			models.CMD_SET_SPEED, models.CMD_SAFE_ZONE}},
+		{"range_3m_pulse1", 27, "range 3m", models.CMD_SET_RANGE, 300, []uint16{
+			models.CMD_SET_RANGE, models.CMD_SET_SPEED, models.CMD_SAFE_ZONE, models.CMD_EDGE_POSITION}},
+		{"range_3m_pulse5", 27, "range 3m", models.CMD_SET_RANGE, 300, nil},
+		{"test5_30m_park", 27, "test5 30m park", models.CMD_SET_RANGE, 3000, nil},
+		{"Сценарий 5м", 27, "\xd1\xf6\xe5\xed\xe0\xf0\xe8\xe9 5\xec", models.CMD_SET_RANGE, 500, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := builtin[tt.name].RawData
+			scenario, err := ParseScenarioData(raw)
+			if err != nil {
+				t.Fatalf("ParseScenarioData: %v", err)
+			}
+			if len(scenario.Header) != tt.header {
+				t.Errorf("заголовок %d байт, ожидалось %d: % X", len(scenario.Header), tt.header, scenario.Header)
+			}
+			if scenario.Name != tt.scenario {
+				t.Errorf("имя %q, ожидалось %q", scenario.Name, tt.scenario)
+			}
+			first := scenario.Commands[0]
+			if first.Code != tt.first || first.ParamValue != tt.firstCM {
+				t.Errorf("первая команда %s = %d, ожидалась 0x%04X = %d", first.Name, first.ParamValue, tt.first, tt.firstCM)
+			}
+
+			if tt.wantCodes != nil {
+				var codes []uint16
+				for _, cmd := range scenario.Commands {
+					if !cmd.IsRaw() {
+						codes = append(codes, cmd.Code)
+					}
+				}
+				if !equalCodes(codes, tt.wantCodes) {
+					t.Errorf("команды %04X, ожидались %04X", codes, tt.wantCodes)
+				}
+			}
+			for _, cmd := range scenario.Commands {
+				if cmd.Code == models.CMD_PAUSE {
+					t.Errorf("в кадре найдена пауза %d сек", cmd.ParamValue)
+				}
+			}
+		})
+	}
+}
+
+func equalCodes(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGenerateScenarioPacketRoundTrip(t *testing.T) {
+	for name, frame := range libraryFrames(t) {
+		scenario, err := ParseScenarioData(frame)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		// Заголовок, команды и вычисленная контрольная сумма дают исходный кадр
+		packet := GenerateScenarioPacket(scenario)
+		if !bytes.Equal(packet, frame) {
+			t.Errorf("%s: кадр после разбора отличается\n было  % X\n стало % X", name, frame, packet)
+		}
+		body := frame[len(scenario.Header) : len(frame)-1]
+		if encoded := EncodeCommands(scenario.Commands); !bytes.Equal(encoded, body) {
+			t.Errorf("%s: команды кодируются в % X, в кадре % X", name, encoded, body)
+		}
+	}
+}
+
+func TestGenerateScenarioPacketHeader(t *testing.T) {
+	frames := libraryFrames(t)
+	parse := func(name string) models.Scenario {
+		scenario, err := ParseScenarioData(frames[name])
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return scenario
+	}
+	commands := parse("range_3m_pulse1").Commands
+
+	tests := []struct {
+		name     string
+		scenario models.Scenario
+		want     string // Ожидаемый кадр из библиотеки
+		frame    string // Имя в кадре
+	}{
+		// Без заголовка кадр собирается по проверенному кадру пульта
+		{"новый, пульт 1", models.Scenario{Name: "range 3m", PulseType: 1, Commands: commands}, "range_3m_pulse1", "range 3m"},
+		{"новый, пульт 2", models.Scenario{Name: "range 3m", PulseType: 2, Commands: commands}, "range_3m_pulse2", "range 3m"},
+		{"новый, пульт 3", models.Scenario{Name: "range 3m", PulseType: 3, Commands: commands}, "range_3m_pulse3", "range 3m"},
+		{"новый, пульт 4", models.Scenario{Name: "range 3m", PulseType: 4, Commands: commands}, "range_3m_pulse4", "range 3m"},
+		{"новый, пульт 5", models.Scenario{Name: "range 3m", PulseType: 5, Commands: commands}, "range_3m_pulse5", "range 3m"},
+		// Смена пульта заменяет переменную часть заголовка
+		{"пульт 1 -> 5", func() models.Scenario {
+			scenario := parse("range_3m_pulse1")
+			scenario.PulseType = 5
+			return scenario
+		}(), "range_3m_pulse5", "range 3m"},
+		// Смена имени заменяет имя в кадре
+		{"переименование", func() models.Scenario {
+			scenario := parse("range_3m_pulse2")
+			scenario.Header = RebuildHeader(scenario.Header, "Сценарий 3м", 2)
+			return scenario
+		}(), "", "Сценарий 3м"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := GenerateScenarioPacket(tt.scenario)
+			if tt.want != "" && !bytes.Equal(packet, frames[tt.want]) {
+				t.Errorf("кадр\n % X\nожидался %s\n % X", packet, tt.want, frames[tt.want])
+			}
+
+			parsed, err := ParseScenarioData(packet)
+			if err != nil {
+				t.Fatalf("собранный кадр не разбирается: %v", err)
+			}
+			if parsed.Name != tt.frame {
+				t.Errorf("имя в кадре %q, ожидалось %q", parsed.Name, tt.frame)
+			}
+			if parsed.PulseType != tt.scenario.PulseType {
+				t.Errorf("пульт в кадре %d, ожидался %d", parsed.PulseType, tt.scenario.PulseType)
+			}
+			if packet[len(packet)-1] != Checksum(packet[:len(packet)-1]) {
+				t.Errorf("контрольная сумма %02X не совпадает с вычисленной", packet[len(packet)-1])
+			}
+		})
+	}
+}
+
+func TestNewCommandEncoding(t *testing.T) {
+	tests := []struct {
+		code  uint16
+		value uint16
+		want  []byte
+	}{
+		{models.CMD_SET_RANGE, 300, []byte{0x13, 0x2C, 0x01}},
+		{models.CMD_SET_SPEED, 50, []byte{0x15, 0x32, 0x00}},
+		{models.CMD_SAFE_ZONE, 300, []byte{0x14, 0x2C, 0x01}},
+		{models.CMD_EDGE_POSITION, 0, []byte{0x11, 0x02}},
+		{models.CMD_MOVE_TO_RANGE, 0, []byte{0x03, 0x0A}},
+		{models.CMD_PARKING, 0, []byte{0x04, 0x01}},
+	}
+
+	for _, tt := range tests {
+		cmd, err := models.NewCommand(tt.code, tt.value)
+		if err != nil {
+			t.Fatalf("NewCommand(0x%04X): %v", tt.code, err)
+		}
+		if got := EncodeCommands([]models.Command{cmd}); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: % X, ожидалось % X", cmd.Name, got, tt.want)
+		}
+		decoded := DecodeCommands(tt.want)
+		if len(decoded) != 1 || decoded[0].Code != tt.code || decoded[0].ParamValue != tt.value {
+			t.Errorf("% X разбирается как %v", tt.want, decoded)
+		}
+	}
+}
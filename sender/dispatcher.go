@@ -0,0 +1,421 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"tir/logging"
+)
+
+var logger = logging.For("sender")
+
+// DefaultQueueSize размер очереди порта по умолчанию
+const DefaultQueueSize = 8
+
+// ErrQueueFull возвращается, если очередь порта заполнена
+var ErrQueueFull = errors.New("очередь отправки порта переполнена")
+
+// ErrStopped возвращается при постановке задания в остановленный диспетчер
+var ErrStopped = errors.New("диспетчер отправки остановлен")
+
+// Request задание на отправку сценария для одной линии
+type Request struct {
+	Lane     int
+	PortName string
+	BaudRate uint32
+	Distance int
+	Scenario string    // Имя сценария; если пусто, сценарий выбирается по дистанции
+	Created  time.Time // Время появления задания по часам этой машины; по умолчанию - постановки в очередь
+	Changed  time.Time // Время изменения у источника (updateTime документа Firebase); только для метрик
+}
+
+// Handler выполняет одно задание; вызывается из потока порта
+type Handler func(req Request) error
+
+// DropHandler получает задание, отброшенное без выполнения, и причину
+type DropHandler func(req Request, reason string)
+
+// Причины отбрасывания заданий
+const (
+	DropEmergency = "аварийная остановка"
+	DropStale     = "выполнено более новое задание"
+	DropStopped   = "диспетчер остановлен"
+)
+
+// Dispatcher распределяет задания по портам: у каждого порта свой поток
+// и своя ограниченная очередь, поэтому зависший порт не задерживает остальные линии
+type Dispatcher struct {
+	handler   Handler
+	onDrop    DropHandler
+	queueSize int
+
+	mu       sync.Mutex
+	queues   map[string]*portQueue
+	deferred map[string]map[int]Request   // Порт -> линия -> задание, отложенное до восстановления связи
+	handled  map[string]map[int]time.Time // Порт -> линия -> время появления последнего выполненного задания
+	stopped  bool
+	wg       sync.WaitGroup
+}
+
+// portQueue очередь заданий одного порта
+type portQueue struct {
+	pending []Request
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+// NewDispatcher создает диспетчер с заданным размером очереди на порт
+func NewDispatcher(queueSize int, handler Handler) *Dispatcher {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	d := &Dispatcher{
+		handler:   handler,
+		queueSize: queueSize,
+		queues:    make(map[string]*portQueue),
+		deferred:  make(map[string]map[int]Request),
+		handled:   make(map[string]map[int]time.Time),
+	}
+
+	dispatchersMu.Lock()
+	dispatchers[d] = struct{}{}
+	dispatchersMu.Unlock()
+	return d
+}
+
+// Диспетчеры процесса: аварийная остановка отбрасывает их задания
+var (
+	dispatchersMu sync.Mutex
+	dispatchers   = make(map[*Dispatcher]struct{})
+)
+
+// discardAll отбрасывает ожидающие и отложенные задания всех диспетчеров процесса
+func discardAll() {
+	dispatchersMu.Lock()
+	list := make([]*Dispatcher, 0, len(dispatchers))
+	for d := range dispatchers {
+		list = append(list, d)
+	}
+	dispatchersMu.Unlock()
+
+	for _, d := range list {
+		d.mu.Lock()
+		dropped := append(d.dropPendingLocked(), d.dropDeferredLocked()...)
+		d.mu.Unlock()
+		d.dropped(dropped, DropEmergency)
+	}
+}
+
+// OnDrop задает обработчик заданий, отброшенных без выполнения (аварийная
+// остановка, устаревшее задание, остановка диспетчера). Обработчик вызывается
+// без блокировок диспетчера и может обращаться к нему
+func (d *Dispatcher) OnDrop(handler DropHandler) {
+	d.mu.Lock()
+	d.onDrop = handler
+	d.mu.Unlock()
+}
+
+// dropped сообщает обработчику об отброшенных заданиях. Вызывается без d.mu
+func (d *Dispatcher) dropped(reqs []Request, reason string) {
+	d.mu.Lock()
+	handler := d.onDrop
+	d.mu.Unlock()
+	if handler == nil {
+		return
+	}
+	for _, req := range reqs {
+		handler(req, reason)
+	}
+}
+
+// unregister исключает остановленный диспетчер из списка процесса
+func (d *Dispatcher) unregister() {
+	dispatchersMu.Lock()
+	delete(dispatchers, d)
+	dispatchersMu.Unlock()
+}
+
+// Submit ставит задание в очередь порта. Если для той же линии уже ждет
+// более старое задание, оно заменяется новым без изменения позиции в очереди
+func (d *Dispatcher) Submit(req Request) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stopped {
+		return ErrStopped
+	}
+	if req.Created.IsZero() {
+		req.Created = time.Now()
+	}
+	return d.submitLocked(req)
+}
+
+// submitLocked ставит задание в очередь; вызывается под d.mu
+func (d *Dispatcher) submitLocked(req Request) error {
+
+	queue, exists := d.queues[req.PortName]
+	if !exists {
+		queue = &portQueue{
+			wake: make(chan struct{}, 1),
+			done: make(chan struct{}),
+		}
+		d.queues[req.PortName] = queue
+		d.wg.Add(1)
+		go d.worker(req.PortName, queue)
+	}
+
+	replaced := false
+	for i, pending := range queue.pending {
+		if pending.Lane == req.Lane {
+			if req.Created.Before(pending.Created) {
+				return nil // Ожидает более новое задание линии
+			}
+			logger.Info("Устаревшее задание заменено", "lane", req.Lane,
+				"old_distance", pending.Distance, "distance", req.Distance)
+			queue.pending[i] = req
+			replaced = true
+			break
+		}
+	}
+
+	if !replaced {
+		if len(queue.pending) >= d.queueSize {
+			return fmt.Errorf("%w: %s", ErrQueueFull, req.PortName)
+		}
+		queue.pending = append(queue.pending, req)
+		queueDepth.Add(1, req.PortName)
+	}
+
+	// Будим поток порта, если он ждет
+	select {
+	case queue.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// QueueLength возвращает количество ожидающих заданий порта
+func (d *Dispatcher) QueueLength(portName string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if queue, exists := d.queues[portName]; exists {
+		return len(queue.pending)
+	}
+	return 0
+}
+
+// Pending сообщает, ждет ли в очереди порта задание линии
+func (d *Dispatcher) Pending(portName string, lane int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if queue, exists := d.queues[portName]; exists {
+		for _, req := range queue.pending {
+			if req.Lane == lane {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Replay ставит в очередь задания порта, отложенные из-за обрыва связи
+// (по последнему на линию). Вызывается после восстановления связи
+func (d *Dispatcher) Replay(portName string) {
+	var dropped []Request
+	defer func() { d.dropped(dropped, DropEmergency) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stopped {
+		return
+	}
+	lastStop := LastEmergency()
+	for lane, req := range d.deferred[portName] {
+		if req.Created.Before(lastStop) {
+			logger.Warn("Отложенное задание появилось до аварийной остановки и отброшено",
+				"port", portName, "lane", lane)
+			dropped = append(dropped, req)
+			continue
+		}
+		if err := d.submitLocked(req); err != nil {
+			logger.Error("Отложенное задание не поставлено в очередь", "port", portName, "lane", lane, "error", err)
+			continue
+		}
+		logger.Info("Повтор отложенного задания после восстановления связи", "port", portName,
+			"lane", lane, "distance", req.Distance, "scenario", req.Scenario)
+	}
+	delete(d.deferred, portName)
+}
+
+// Deferred возвращает число заданий порта, отложенных до восстановления связи
+func (d *Dispatcher) Deferred(portName string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.deferred[portName])
+}
+
+// Stop прекращает прием заданий, отбрасывает ожидающие и дожидается
+// завершения текущих отправок
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	d.stopped = true
+	dropped := d.dropPendingLocked()
+	for _, queue := range d.queues {
+		close(queue.done)
+	}
+	dropped = append(dropped, d.dropDeferredLocked()...)
+	d.mu.Unlock()
+	d.unregister()
+	d.dropped(dropped, DropStopped)
+
+	d.wg.Wait()
+}
+
+// Drain прекращает прием заданий и дожидается выполнения уже поставленных.
+// Если ctx завершится раньше, оставшиеся задания отбрасываются, а текущие
+// отправки дожидаются окончания
+func (d *Dispatcher) Drain(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.stopped {
+		d.stopped = true
+		for _, queue := range d.queues {
+			close(queue.done)
+		}
+	}
+	dropped := d.dropDeferredLocked()
+	d.mu.Unlock()
+	d.unregister()
+	d.dropped(dropped, DropStopped)
+
+	finished := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+
+	d.mu.Lock()
+	dropped = d.dropPendingLocked()
+	d.mu.Unlock()
+	d.dropped(dropped, DropStopped)
+
+	<-finished
+	return ctx.Err()
+}
+
+// dropPendingLocked отбрасывает задания, ожидающие в очередях портов,
+// и возвращает их. Вызывается под d.mu
+func (d *Dispatcher) dropPendingLocked() []Request {
+	var dropped []Request
+	for portName, queue := range d.queues {
+		if len(queue.pending) > 0 {
+			logger.Warn("Ожидающие задания отброшены", "port", portName, "count", len(queue.pending))
+			queueDepth.Add(-float64(len(queue.pending)), portName)
+			dropped = append(dropped, queue.pending...)
+			queue.pending = nil
+		}
+	}
+	return dropped
+}
+
+// dropDeferredLocked отбрасывает задания, ожидающие восстановления связи:
+// после остановки диспетчера их некому повторить, после аварийной
+// остановки их нельзя повторять. Возвращает отброшенные задания.
+// Вызывается под d.mu
+func (d *Dispatcher) dropDeferredLocked() []Request {
+	var dropped []Request
+	for portName, deferred := range d.deferred {
+		if len(deferred) > 0 {
+			logger.Warn("Отложенные задания отброшены", "port", portName, "count", len(deferred))
+		}
+		for _, req := range deferred {
+			dropped = append(dropped, req)
+		}
+	}
+	d.deferred = make(map[string]map[int]Request)
+	return dropped
+}
+
+// worker последовательно выполняет задания одного порта
+func (d *Dispatcher) worker(portName string, queue *portQueue) {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+		if len(queue.pending) == 0 {
+			d.mu.Unlock()
+			select {
+			case <-queue.wake:
+				continue
+			case <-queue.done:
+				return
+			}
+		}
+		req := queue.pending[0]
+		queue.pending = queue.pending[1:]
+		queueDepth.Add(-1, portName)
+		last := d.handled[portName][req.Lane]
+		d.mu.Unlock()
+
+		// Повтор отложенного задания не отменяет выполненное после него более новое
+		if req.Created.Before(last) {
+			logger.Debug("Устаревшее задание пропущено", "port", portName, "lane", req.Lane)
+			d.dropped([]Request{req}, DropStale)
+			continue
+		}
+		// Задание, появившееся до аварийной остановки, не выполняется и после взведения
+		if req.Created.Before(LastEmergency()) {
+			logger.Warn("Задание появилось до аварийной остановки и отброшено", "port", portName, "lane", req.Lane)
+			d.dropped([]Request{req}, DropEmergency)
+			continue
+		}
+
+		err := d.handler(req)
+		if err != nil {
+			logger.Error("Ошибка отправки", "port", portName, "lane", req.Lane, "error", err)
+		}
+
+		d.mu.Lock()
+		if errors.Is(err, ErrLinkDown) {
+			d.deferLocked(portName, req)
+		} else {
+			if d.handled[portName] == nil {
+				d.handled[portName] = make(map[int]time.Time)
+			}
+			d.handled[portName][req.Lane] = req.Created
+			if deferred, exists := d.deferred[portName][req.Lane]; exists && !deferred.Created.After(req.Created) {
+				delete(d.deferred[portName], req.Lane)
+			}
+		}
+		d.mu.Unlock()
+	}
+}
+
+// deferLocked откладывает задание до восстановления связи; для линии хранится
+// только последнее. Вызывается под d.mu
+func (d *Dispatcher) deferLocked(portName string, req Request) {
+	if d.deferred[portName] == nil {
+		d.deferred[portName] = make(map[int]Request)
+	}
+	if pending, exists := d.deferred[portName][req.Lane]; exists && pending.Created.After(req.Created) {
+		return
+	}
+	d.deferred[portName][req.Lane] = req
+	deferredRequests.Inc(portName)
+	logger.Warn("Задание отложено до восстановления связи", "port", portName, "lane", req.Lane)
+}
@@ -0,0 +1,254 @@
+package sender
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+	"tir/interlock"
+)
+
+// recorder обработчик заданий для тестов: запоминает выполненные задания,
+// первое задание держит до release
+type recorder struct {
+	started chan Request
+	release chan struct{}
+	done    chan Request
+	fail    func(req Request) error
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		started: make(chan Request, 16),
+		release: make(chan struct{}),
+		done:    make(chan Request, 16),
+	}
+}
+
+func (r *recorder) handle(req Request) error {
+	r.started <- req
+	<-r.release
+	var err error
+	if r.fail != nil {
+		err = r.fail(req)
+	}
+	r.done <- req
+	return err
+}
+
+// next ждет очередное выполненное задание
+func (r *recorder) next(t *testing.T) Request {
+	t.Helper()
+	select {
+	case req := <-r.done:
+		return req
+	case <-time.After(time.Second):
+		t.Fatal("задание не выполнено")
+		return Request{}
+	}
+}
+
+// expectIdle проверяет, что больше заданий не выполняется
+func (r *recorder) expectIdle(t *testing.T) {
+	t.Helper()
+	select {
+	case req := <-r.done:
+		t.Errorf("лишнее задание: линия %d, дистанция %d", req.Lane, req.Distance)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDispatcherReplace(t *testing.T) {
+	r := newRecorder()
+	d := NewDispatcher(2, r.handle)
+	defer d.Stop()
+
+	base := time.Now()
+	request := func(lane, distance int, created time.Duration) Request {
+		return Request{Lane: lane, PortName: "COM1", Distance: distance, Created: base.Add(created)}
+	}
+
+	// Первое задание занимает поток порта, остальные ждут в очереди
+	if err := d.Submit(request(1, 10, 0)); err != nil {
+		t.Fatal(err)
+	}
+	<-r.started
+
+	steps := []struct {
+		req     Request
+		wantErr bool
+	}{
+		{request(2, 20, 1), false},
+		{request(3, 30, 2), false},
+		{request(2, 25, 3), false},  // Заменяет ожидающее задание линии 2 на его месте
+		{request(2, 15, -1), false}, // Старше ожидающего - не принимается
+		{request(4, 40, 4), true},   // Очередь заполнена
+	}
+	for _, step := range steps {
+		err := d.Submit(step.req)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("линия %d, дистанция %d: ошибка %v", step.req.Lane, step.req.Distance, err)
+		}
+	}
+	if got := d.QueueLength("COM1"); got != 2 {
+		t.Errorf("в очереди %d заданий, ожидалось 2", got)
+	}
+
+	close(r.release)
+	var got []string
+	for i := 0; i < 3; i++ {
+		req := r.next(t)
+		got = append(got, fmt.Sprintf("%d:%d", req.Lane, req.Distance))
+	}
+	want := []string{"1:10", "2:25", "3:30"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("порядок выполнения %v, ожидался %v", got, want)
+	}
+	r.expectIdle(t)
+}
+
+func TestDispatcherDeferReplay(t *testing.T) {
+	r := newRecorder()
+	close(r.release)
+	linkDown := true
+	r.fail = func(req Request) error {
+		if linkDown {
+			return fmt.Errorf("%w COM1: нет ответа", ErrLinkDown)
+		}
+		return nil
+	}
+	d := NewDispatcher(4, r.handle)
+	defer d.Stop()
+
+	base := time.Now()
+	for _, req := range []Request{
+		{Lane: 1, PortName: "COM1", Distance: 10, Created: base},
+		{Lane: 1, PortName: "COM1", Distance: 15, Created: base.Add(1)},
+		{Lane: 2, PortName: "COM1", Distance: 20, Created: base.Add(2)},
+	} {
+		if err := d.Submit(req); err != nil {
+			t.Fatal(err)
+		}
+		r.next(t)
+	}
+
+	// Для линии хранится только последнее отложенное задание
+	if got := d.Deferred("COM1"); got != 2 {
+		t.Fatalf("отложено %d заданий, ожидалось 2", got)
+	}
+
+	// Новое задание линии 2 выполнено раньше повтора - отложенное для нее не повторяется
+	linkDown = false
+	if err := d.Submit(Request{Lane: 2, PortName: "COM1", Distance: 22, Created: base.Add(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if req := r.next(t); req.Distance != 22 {
+		t.Fatalf("выполнено задание с дистанцией %d", req.Distance)
+	}
+
+	d.Replay("COM1")
+	if req := r.next(t); req.Lane != 1 || req.Distance != 15 {
+		t.Errorf("повторено задание линии %d с дистанцией %d, ожидалось 1:15", req.Lane, req.Distance)
+	}
+	r.expectIdle(t)
+	if got := d.Deferred("COM1"); got != 0 {
+		t.Errorf("после повтора отложено %d заданий", got)
+	}
+}
+
+func TestDispatcherEmergencyStop(t *testing.T) {
+	previous := EmergencyFile()
+	defer SetEmergencyFile(previous)
+	settings := interlock.Settings()
+	defer interlock.Configure(settings)
+
+	dir := t.TempDir()
+	if err := SetEmergencyFile(filepath.Join(dir, "estop.lock")); err != nil {
+		t.Fatal(err)
+	}
+	test := settings
+	test.StateFile = filepath.Join(dir, "interlock.json")
+	test.LogFile = ""
+	interlock.Configure(test)
+
+	r := newRecorder()
+	linkDown := true
+	r.fail = func(req Request) error {
+		if req.PortName == "COM2" && linkDown {
+			return fmt.Errorf("%w COM2: нет ответа", ErrLinkDown)
+		}
+		return nil
+	}
+	d := NewDispatcher(4, r.handle)
+	defer d.Stop()
+	drops := make(chan string, 8)
+	d.OnDrop(func(req Request, reason string) {
+		drops <- fmt.Sprintf("%d: %s", req.Lane, reason)
+	})
+	expectDrops := func(want ...string) {
+		t.Helper()
+		got := make(map[string]bool)
+		for range want {
+			select {
+			case drop := <-drops:
+				got[drop] = true
+			case <-time.After(time.Second):
+				t.Fatalf("отброшено %v, ожидалось %v", got, want)
+			}
+		}
+		for _, drop := range want {
+			if !got[drop] {
+				t.Errorf("отброшено %v, ожидалось %v", got, want)
+			}
+		}
+	}
+
+	// Отложенное задание COM2 и ожидающее задание COM1 за выполняющимся
+	if err := d.Submit(Request{Lane: 2, PortName: "COM2", Distance: 20}); err != nil {
+		t.Fatal(err)
+	}
+	<-r.started
+	r.release <- struct{}{}
+	r.next(t)
+	if err := d.Submit(Request{Lane: 1, PortName: "COM1", Distance: 10}); err != nil {
+		t.Fatal(err)
+	}
+	<-r.started
+	early := time.Now()
+	if err := d.Submit(Request{Lane: 3, PortName: "COM1", Distance: 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := EmergencyStop(nil, "тест"); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.QueueLength("COM1"); got != 0 {
+		t.Errorf("после остановки в очереди %d заданий", got)
+	}
+	if got := d.Deferred("COM2"); got != 0 {
+		t.Errorf("после остановки отложено %d заданий", got)
+	}
+	// Об отброшенных заданиях сообщается, чтобы линии не оставались "в очереди"
+	expectDrops("3: "+DropEmergency, "2: "+DropEmergency)
+	close(r.release)
+	r.next(t) // Задание, которое выполнялось во время остановки
+
+	if err := Rearm(); err != nil {
+		t.Fatal(err)
+	}
+
+	// После взведения задания, появившиеся до остановки, не выполняются
+	linkDown = false
+	if err := d.Submit(Request{Lane: 1, PortName: "COM1", Distance: 11, Created: early}); err != nil {
+		t.Fatal(err)
+	}
+	r.expectIdle(t)
+	expectDrops("1: " + DropEmergency)
+
+	if err := d.Submit(Request{Lane: 1, PortName: "COM1", Distance: 12}); err != nil {
+		t.Fatal(err)
+	}
+	if req := r.next(t); req.Distance != 12 {
+		t.Errorf("выполнено задание с дистанцией %d, ожидалось 12", req.Distance)
+	}
+}
@@ -0,0 +1,303 @@
+package sender
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"tir/audit"
+	"tir/interlock"
+	"tir/models"
+	"tir/protocol"
+)
+
+// DefaultEmergencyFile файл аварийной блокировки по умолчанию
+const DefaultEmergencyFile = "estop.lock"
+
+// Аварийная блокировка. Пока файл блокировки существует, сценарии не отправляются
+// ни одним процессом программы (меню, автоотправка, API) до повторного взведения.
+// Процесс, включивший блокировку, помнит ее и без файла: если файл записать
+// не удалось, отправка из этого процесса все равно заблокирована
+var (
+	emergencyMu   sync.Mutex
+	emergencyFile = defaultEmergencyFile()
+	localStop     EmergencyState // Блокировка, включенная этим процессом
+	localStopFile bool           // Она записана в файл: удаление файла другим процессом снимает ее
+	lastStop      time.Time      // Время последней известной процессу остановки
+)
+
+// defaultEmergencyFile возвращает файл блокировки из переменной окружения
+// TIR_ESTOP_FILE или файл по умолчанию в рабочем каталоге при запуске
+func defaultEmergencyFile() string {
+	fileName := os.Getenv("TIR_ESTOP_FILE")
+	if fileName == "" {
+		fileName = DefaultEmergencyFile
+	}
+	if absolute, err := filepath.Abs(fileName); err == nil {
+		return absolute
+	}
+	return fileName
+}
+
+// SetEmergencyFile задает файл аварийной блокировки. Относительный путь
+// отсчитывается от текущего рабочего каталога и сразу становится абсолютным;
+// пустое имя возвращает файл по умолчанию (TIR_ESTOP_FILE или estop.lock)
+func SetEmergencyFile(fileName string) error {
+	if fileName == "" {
+		emergencyMu.Lock()
+		emergencyFile = defaultEmergencyFile()
+		emergencyMu.Unlock()
+		return nil
+	}
+	absolute, err := filepath.Abs(fileName)
+	if err != nil {
+		return fmt.Errorf("файл аварийной блокировки %s: %v", fileName, err)
+	}
+	emergencyMu.Lock()
+	emergencyFile = absolute
+	emergencyMu.Unlock()
+	return nil
+}
+
+// EmergencyFile возвращает абсолютный путь файла аварийной блокировки
+func EmergencyFile() string {
+	emergencyMu.Lock()
+	defer emergencyMu.Unlock()
+	return emergencyFile
+}
+
+// ErrEmergencyStop возвращается при отправке сценария во время аварийной блокировки
+var ErrEmergencyStop = errors.New("аварийная остановка: отправка заблокирована до повторного взведения")
+
+// Target линия, на которую отправляется кадр аварийной остановки
+type Target struct {
+	Lane     int
+	PortName string
+	BaudRate uint32
+}
+
+// StopResult результат отправки кадра остановки на линию
+type StopResult struct {
+	Lane     int
+	PortName string
+	Reply    []byte // Ответ контроллера; пустой, если ответа не было
+	Err      error
+}
+
+// Delivered сообщает, записан ли кадр остановки в порт
+func (r StopResult) Delivered() bool {
+	return r.Err == nil
+}
+
+// Confirmed сообщает, ответил ли контроллер на кадр остановки
+func (r StopResult) Confirmed() bool {
+	return r.Err == nil && len(r.Reply) > 0
+}
+
+// EmergencyState состояние аварийной блокировки
+type EmergencyState struct {
+	Active bool
+	Since  time.Time
+	Reason string
+}
+
+// Emergency возвращает состояние аварийной блокировки
+func Emergency() EmergencyState {
+	emergencyMu.Lock()
+	defer emergencyMu.Unlock()
+	return emergencyLocked()
+}
+
+// emergencyLocked читает состояние блокировки; вызывается под emergencyMu.
+// Файл, который существует, но не читается, считается действующей блокировкой
+func emergencyLocked() EmergencyState {
+	if localStop.Active && !localStopFile {
+		return localStop
+	}
+
+	data, err := os.ReadFile(emergencyFile)
+	switch {
+	case os.IsNotExist(err):
+		// Блокировку этого процесса снял другой процесс (tir estop -rearm)
+		localStop = EmergencyState{}
+		return EmergencyState{}
+	case err != nil:
+		return EmergencyState{Active: true, Reason: fmt.Sprintf("файл блокировки не читается: %v", err)}
+	}
+
+	state := EmergencyState{Active: true}
+	since, reason, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+	if t, err := time.Parse(time.RFC3339Nano, since); err == nil {
+		state.Since = t
+	}
+	state.Reason = reason
+	if state.Since.After(lastStop) {
+		lastStop = state.Since
+	}
+	return state
+}
+
+// lastStopFile файл времени последней снятой остановки рядом с файлом блокировки
+func lastStopFile() string {
+	return emergencyFile + ".last"
+}
+
+// LastEmergency возвращает время последней аварийной остановки, в том числе
+// уже снятой (в этом или другом процессе). Задания, появившиеся до нее,
+// выполнять нельзя: линии после остановки взводятся заново
+func LastEmergency() time.Time {
+	emergencyMu.Lock()
+	defer emergencyMu.Unlock()
+
+	if state := emergencyLocked(); state.Active && state.Since.IsZero() {
+		// Время остановки неизвестно (файл не читается) - остановка сейчас
+		return time.Now()
+	}
+	if data, err := os.ReadFile(lastStopFile()); err == nil {
+		if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data))); err == nil && t.After(lastStop) {
+			lastStop = t
+		}
+	}
+	return lastStop
+}
+
+// EmergencyActive проверяет, действует ли аварийная блокировка
+func EmergencyActive() bool {
+	return Emergency().Active
+}
+
+// Rearm снимает аварийную блокировку
+func Rearm() error {
+	emergencyMu.Lock()
+	defer emergencyMu.Unlock()
+
+	// Время снимаемой остановки остается для других процессов: их отложенные
+	// задания, появившиеся до остановки, не должны уйти после взведения
+	if state := emergencyLocked(); state.Active && !state.Since.IsZero() {
+		content := []byte(state.Since.Format(time.RFC3339Nano))
+		if err := os.WriteFile(lastStopFile(), content, 0644); err != nil {
+			logger.Error("Не удалось записать время остановки", "file", lastStopFile(), "error", err)
+		}
+	}
+
+	if err := os.Remove(emergencyFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("не удалось снять аварийную блокировку: %v", err)
+	}
+	localStop, localStopFile = EmergencyState{}, false
+	logger.Warn("Аварийная блокировка снята, отправка сценариев разрешена", "file", emergencyFile)
+	return nil
+}
+
+// engage включает блокировку в этом процессе и записывает ее в файл
+func engage(reason string) error {
+	emergencyMu.Lock()
+	defer emergencyMu.Unlock()
+
+	localStop = EmergencyState{Active: true, Since: time.Now(), Reason: reason}
+	localStopFile = false
+	lastStop = localStop.Since
+
+	content := localStop.Since.Format(time.RFC3339Nano) + " " + reason
+	if err := os.WriteFile(emergencyFile, []byte(content), 0644); err != nil {
+		return fmt.Errorf("блокировка действует только в этом процессе: не удалось записать %s: %v",
+			emergencyFile, err)
+	}
+	localStopFile = true
+	return nil
+}
+
+// ParkingFrame создает кадр остановки для пульта: заголовок проверенного
+// на контроллере кадра этого пульта и единственная команда парковки в той же
+// форме, что в кадрах с пульта (04 01). Для пульта без проверенного кадра
+// возвращается ошибка: непроверенный кадр контроллер может не принять
+func ParkingFrame(pulseType byte) ([]byte, error) {
+	if !protocol.HasVerifiedHeader(pulseType) {
+		return nil, fmt.Errorf("для пульта %d нет проверенного кадра, парковка не отправлена", pulseType)
+	}
+
+	command, err := models.NewCommand(models.CMD_PARKING, 0)
+	if err != nil {
+		return nil, err
+	}
+	command.Encoding = models.EncodingBE
+
+	scenario := models.Scenario{
+		Name:      "stop",
+		PulseType: pulseType,
+		Commands:  []models.Command{command},
+	}
+	return protocol.GenerateScenarioPacket(scenario), nil
+}
+
+// EmergencyStop включает аварийную блокировку и сразу отправляет кадр парковки
+// на все линии, минуя очереди отправки. Текущие передачи прерываются, порт
+// достается кадру парковки раньше ожидающих обычных передач. Порты
+// обслуживаются параллельно, линии одного порта - последовательно.
+// Возвращает результат по каждой линии и ошибку записи файла блокировки:
+// парковка отправляется и в этом случае, но другие процессы программы
+// блокировку не видят
+func EmergencyStop(targets []Target, reason string) ([]StopResult, error) {
+	logger.Warn("Аварийная остановка", "reason", reason, "lanes", len(targets))
+
+	// Блокировку включаем до отправки, чтобы новые задания очередей не ушли
+	engageErr := engage(reason)
+	if engageErr != nil {
+		logger.Error("Аварийная блокировка не записана в файл", "error", engageErr)
+	}
+	// Задания очередей и отложенные до восстановления связи появились
+	// до остановки и после взведения не выполняются
+	discardAll()
+	// После повторного взведения линии нужно взвести заново по одной
+	if err := interlock.DisarmAll(); err != nil {
+		logger.Error("Не удалось снять линии со взвода", "error", err)
+	}
+
+	byPort := make(map[string][]int)
+	for i, target := range targets {
+		byPort[target.PortName] = append(byPort[target.PortName], i)
+	}
+
+	results := make([]StopResult, len(targets))
+	var wg sync.WaitGroup
+	for _, indexes := range byPort {
+		wg.Add(1)
+		go func(indexes []int) {
+			defer wg.Done()
+			for _, i := range indexes {
+				target := targets[i]
+				result := StopResult{Lane: target.Lane, PortName: target.PortName}
+
+				frame, err := ParkingFrame(byte(target.Lane))
+				if err == nil {
+					result.Reply, err = sendFrame(target.PortName, target.BaudRate, frame,
+						Origin{Source: audit.SourceEstop, Lane: target.Lane, Scenario: "аварийная парковка"}, true)
+				}
+				result.Err = err
+				results[i] = result
+			}
+		}(indexes)
+	}
+	wg.Wait()
+
+	return results, engageErr
+}
+
+// PrintStopResults выводит подтверждение доставки по линиям. Ответ контроллера
+// подтверждает только прием кадра, поэтому остановку мишени нужно проверить
+// визуально на каждой линии
+func PrintStopResults(results []StopResult) {
+	for _, r := range results {
+		switch {
+		case r.Confirmed():
+			fmt.Printf("Линия %d (%s): кадр парковки принят контроллером (ответ % X)\n", r.Lane, r.PortName, r.Reply)
+		case r.Delivered():
+			fmt.Printf("Линия %d (%s): кадр парковки записан в порт, ответа нет - парковка НЕ ПОДТВЕРЖДЕНА, проверьте линию\n",
+				r.Lane, r.PortName)
+		default:
+			fmt.Printf("Линия %d (%s): НЕ ДОСТАВЛЕНО: %v\n", r.Lane, r.PortName, r.Err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package sender
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"tir/models"
+	"tir/protocol"
+)
+
+func TestParkingFrame(t *testing.T) {
+	for pulseType := byte(models.PULSE_1); pulseType <= models.PULSE_5; pulseType++ {
+		frame, err := ParkingFrame(pulseType)
+		if err != nil {
+			t.Fatalf("пульт %d: %v", pulseType, err)
+		}
+
+		// Заголовок проверенного кадра пульта, парковка 04 01 и контрольная сумма
+		header := protocol.RebuildHeader(nil, "stop", pulseType)
+		want := append(append(header, 0x04, 0x01), 0)
+		want[len(want)-1] = protocol.Checksum(want[:len(want)-1])
+		if !bytes.Equal(frame, want) {
+			t.Errorf("пульт %d: % X, ожидался % X", pulseType, frame, want)
+		}
+
+		scenario, err := protocol.ParseScenarioData(frame)
+		if err != nil {
+			t.Fatalf("пульт %d: кадр не разбирается: %v", pulseType, err)
+		}
+		if len(scenario.Commands) != 1 || scenario.Commands[0].Code != models.CMD_PARKING {
+			t.Errorf("пульт %d: команды %v", pulseType, scenario.Commands)
+		}
+	}
+
+	if _, err := ParkingFrame(models.PULSE_6); err == nil {
+		t.Error("пульт 6 без проверенного кадра: ожидалась ошибка")
+	}
+}
+
+func TestEmergencyState(t *testing.T) {
+	previous := EmergencyFile()
+	defer SetEmergencyFile(previous)
+	dir := t.TempDir()
+
+	// Файл не записан: блокировка все равно действует в этом процессе
+	if err := SetEmergencyFile(filepath.Join(dir, "нет", "estop.lock")); err != nil {
+		t.Fatal(err)
+	}
+	if err := engage("тест"); err == nil {
+		t.Error("запись в несуществующий каталог: ожидалась ошибка")
+	}
+	if !EmergencyActive() {
+		t.Error("блокировка не действует после ошибки записи файла")
+	}
+	if err := Rearm(); err != nil {
+		t.Fatal(err)
+	}
+	if EmergencyActive() {
+		t.Error("блокировка действует после взведения")
+	}
+
+	// Файл записан: удаление файла другим процессом снимает блокировку
+	fileName := filepath.Join(dir, "estop.lock")
+	if err := SetEmergencyFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if err := engage("тест"); err != nil {
+		t.Fatal(err)
+	}
+	state := Emergency()
+	if !state.Active || state.Reason != "тест" || state.Since.IsZero() {
+		t.Errorf("состояние %+v", state)
+	}
+	if err := os.Remove(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if EmergencyActive() {
+		t.Error("блокировка действует после удаления файла")
+	}
+}
+
+func TestSetEmergencyFileDefault(t *testing.T) {
+	previous := EmergencyFile()
+	defer SetEmergencyFile(previous)
+	dir := t.TempDir()
+	t.Setenv("TIR_ESTOP_FILE", filepath.Join(dir, "estop.lock"))
+
+	if err := SetEmergencyFile(filepath.Join(dir, "другой.lock")); err != nil {
+		t.Fatal(err)
+	}
+	// Пустое имя (настройка удалена при перечитывании) - снова файл по умолчанию
+	if err := SetEmergencyFile(""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := EmergencyFile(), filepath.Join(dir, "estop.lock"); got != want {
+		t.Errorf("файл блокировки %s, ожидался %s", got, want)
+	}
+}
@@ -0,0 +1,354 @@
+package sender
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"tir/comport"
+)
+
+// LinkState состояние постоянного соединения с портом
+type LinkState string
+
+const (
+	LinkUp   LinkState = "up"   // Порт открыт или откроется при следующей отправке
+	LinkDown LinkState = "down" // Порт недоступен, идут повторные подключения
+)
+
+// ErrLinkDown возвращается при отправке через соединение, которое не удалось
+// открыть или которое оборвалось во время обмена
+var ErrLinkDown = errors.New("нет связи с портом")
+
+// Интервалы повторного подключения: от минимального, удваиваясь до максимального
+var (
+	LinkRetryMin = time.Second
+	LinkRetryMax = 30 * time.Second
+)
+
+// linkCheckInterval период проверки, подключено ли устройство порта
+var linkCheckInterval = time.Second
+
+// LinkStatus состояние соединения для вывода
+type LinkStatus struct {
+	Port        string    `json:"port"`
+	Device      string    `json:"device,omitempty"` // Текущее имя порта, если задано постоянное имя
+	State       LinkState `json:"state"`
+	Since       time.Time `json:"since"`
+	LastError   string    `json:"last_error,omitempty"`
+	Reconnects  int       `json:"reconnects"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"` // Следующая попытка подключения (LinkDown)
+}
+
+// Link постоянное соединение с портом для долго работающей автоотправки:
+// порт открыт между отправками, обрыв (ошибка чтения или записи, исчезновение
+// устройства) переводит соединение в LinkDown, после чего оно переподключается
+// с нарастающей паузой. После восстановления вызывается onUp
+type Link struct {
+	portName string
+	onUp     func(portName string)
+
+	// Поля ниже защищены mu; ввод-вывод дополнительно сериализуется блокировкой порта
+	mu          sync.Mutex
+	handle      comport.Handle
+	open        bool
+	device      string
+	baudRate    uint32
+	state       LinkState
+	since       time.Time
+	lastErr     string
+	reconnects  int
+	retry       time.Duration
+	nextAttempt time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Реестр постоянных соединений по именам портов
+var (
+	linksMu sync.Mutex
+	links   = make(map[string]*Link)
+)
+
+// OpenLink открывает постоянное соединение с портом и запускает наблюдение
+// за ним. Недоступный порт не ошибка: соединение начинает переподключаться.
+// onUp (может быть nil) вызывается после каждого восстановления связи
+func OpenLink(portName string, baudRate uint32, onUp func(portName string)) (*Link, error) {
+	linksMu.Lock()
+	if _, exists := links[portName]; exists {
+		linksMu.Unlock()
+		return nil, fmt.Errorf("порт %s уже удерживается постоянным соединением", portName)
+	}
+	link := &Link{
+		portName: portName,
+		onUp:     onUp,
+		baudRate: baudRate,
+		state:    LinkUp,
+		since:    time.Now(),
+		done:     make(chan struct{}),
+	}
+	links[portName] = link
+	linksMu.Unlock()
+
+	unlock := lockPort(portName)
+	if err := link.connect(); err != nil {
+		link.fail(err)
+	} else {
+		linkUp.Set(1, portName)
+		logger.Info("Постоянное соединение с портом открыто", "port", portName, "device", link.device)
+	}
+	unlock()
+
+	link.wg.Add(1)
+	go link.supervise()
+	return link, nil
+}
+
+// Close останавливает наблюдение, закрывает порт и убирает соединение из реестра
+func (l *Link) Close() {
+	close(l.done)
+	l.wg.Wait()
+
+	unlock := lockPort(l.portName)
+	l.release()
+	unlock()
+
+	linksMu.Lock()
+	if links[l.portName] == l {
+		delete(links, l.portName)
+	}
+	linksMu.Unlock()
+	linkUp.Set(0, l.portName)
+	logger.Info("Постоянное соединение с портом закрыто", "port", l.portName)
+}
+
+// Status возвращает состояние соединения
+func (l *Link) Status() LinkStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := LinkStatus{
+		Port:       l.portName,
+		State:      l.state,
+		Since:      l.since,
+		LastError:  l.lastErr,
+		Reconnects: l.reconnects,
+	}
+	if l.device != l.portName {
+		status.Device = l.device
+	}
+	if l.state == LinkDown {
+		status.NextAttempt = l.nextAttempt
+	}
+	return status
+}
+
+// linkFor возвращает постоянное соединение порта или nil. Порт ищется по имени,
+// а затем по текущему имени устройства (serial:... и ttyUSB0 - один порт)
+func linkFor(portName string) *Link {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+
+	if link, exists := links[portName]; exists {
+		return link
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	device, err := comport.Resolve(portName)
+	if err != nil {
+		return nil
+	}
+	for _, link := range links {
+		link.mu.Lock()
+		same := link.device == device
+		link.mu.Unlock()
+		if same {
+			return link
+		}
+	}
+	return nil
+}
+
+// LinkStatusOf возвращает состояние постоянного соединения порта;
+// false, если порт не удерживается
+func LinkStatusOf(portName string) (LinkStatus, bool) {
+	if link := linkFor(portName); link != nil {
+		return link.Status(), true
+	}
+	return LinkStatus{}, false
+}
+
+// Links возвращает состояния всех постоянных соединений по именам портов
+func Links() []LinkStatus {
+	linksMu.Lock()
+	all := make([]*Link, 0, len(links))
+	for _, link := range links {
+		all = append(all, link)
+	}
+	linksMu.Unlock()
+
+	statuses := make([]LinkStatus, 0, len(all))
+	for _, link := range all {
+		statuses = append(statuses, link.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Port < statuses[j].Port })
+	return statuses
+}
+
+// exchange выполняет обмен через соединение. Закрытый порт открывается сразу,
+// не дожидаясь очередной попытки переподключения. Ошибки порта обрывают
+// соединение и возвращаются с ErrLinkDown
+func (l *Link) exchange(baudRate uint32, frame []byte, urgent bool) (handshake, reply []byte, err error) {
+	unlock := acquirePort(l.portName, urgent)
+	defer unlock()
+
+	l.mu.Lock()
+	baudChanged := l.baudRate != baudRate
+	l.baudRate = baudRate
+	open, wasDown := l.open, l.state == LinkDown
+	l.mu.Unlock()
+
+	if open && baudChanged {
+		if err := comport.Configure(l.handle, LineSettings(l.portName, baudRate)); err != nil {
+			l.fail(err)
+			return nil, nil, notSent(fmt.Errorf("%w %s: ошибка установки параметров: %v", ErrLinkDown, l.portName, err))
+		}
+	}
+	if !open {
+		if err := l.connect(); err != nil {
+			l.fail(err)
+			return nil, nil, notSent(fmt.Errorf("%w %s: %v", ErrLinkDown, l.portName, err))
+		}
+		if wasDown {
+			l.restored()
+		}
+	}
+
+	handshake, reply, err = transfer(l.handle, l.portName, frame, urgent)
+	if errors.Is(err, ErrEmergencyStop) {
+		// Передача прервана остановкой, соединение исправно
+		return handshake, nil, err
+	}
+	if err != nil {
+		l.fail(err)
+		if FrameNotSent(err) {
+			return handshake, nil, notSent(fmt.Errorf("%w %s: %v", ErrLinkDown, l.portName, err))
+		}
+		return handshake, nil, fmt.Errorf("%w %s: %v", ErrLinkDown, l.portName, err)
+	}
+	return handshake, reply, nil
+}
+
+// connect открывает порт; вызывается под блокировкой порта
+func (l *Link) connect() error {
+	l.mu.Lock()
+	baudRate := l.baudRate
+	l.mu.Unlock()
+
+	device, err := comport.Resolve(l.portName)
+	if err != nil {
+		return err
+	}
+	handle, err := openPort(l.portName, baudRate)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.handle, l.open, l.device = handle, true, device
+	l.mu.Unlock()
+	return nil
+}
+
+// release закрывает порт, не меняя состояния соединения: следующая отправка
+// откроет его снова. Вызывается под блокировкой порта
+func (l *Link) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.open {
+		comport.ClosePort(l.handle)
+		l.open = false
+	}
+}
+
+// fail закрывает порт и переводит соединение в LinkDown с паузой до повторного
+// подключения. Вызывается под блокировкой порта
+func (l *Link) fail(err error) {
+	l.release()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.state != LinkDown {
+		l.state, l.since, l.retry = LinkDown, now, LinkRetryMin
+		linkUp.Set(0, l.portName)
+		logger.Warn("Нет связи с портом", "port", l.portName, "error", err)
+	} else {
+		l.retry *= 2
+		if l.retry > LinkRetryMax {
+			l.retry = LinkRetryMax
+		}
+		logger.Debug("Порт недоступен", "port", l.portName, "retry", l.retry, "error", err)
+	}
+	l.lastErr = err.Error()
+	l.nextAttempt = now.Add(l.retry)
+}
+
+// restored переводит соединение в LinkUp после переподключения и сообщает об этом
+func (l *Link) restored() {
+	l.mu.Lock()
+	downFor := time.Since(l.since)
+	l.state, l.since, l.lastErr = LinkUp, time.Now(), ""
+	l.reconnects++
+	l.mu.Unlock()
+
+	linkUp.Set(1, l.portName)
+	linkReconnects.Inc(l.portName)
+	logger.Info("Связь с портом восстановлена", "port", l.portName, "device", l.device,
+		"down_for", downFor.Round(time.Second))
+	if l.onUp != nil {
+		l.onUp(l.portName)
+	}
+}
+
+// supervise переподключает оборванное соединение и проверяет, что устройство
+// порта не отключено
+func (l *Link) supervise() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(linkCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		l.mu.Lock()
+		state, due := l.state, !time.Now().Before(l.nextAttempt)
+		l.mu.Unlock()
+
+		switch {
+		case state == LinkDown && due:
+			unlock := lockPort(l.portName)
+			if l.Status().State == LinkDown { // Могла восстановить отправка
+				if err := l.connect(); err != nil {
+					l.fail(err)
+				} else {
+					l.restored()
+				}
+			}
+			unlock()
+
+		case state == LinkUp && !comport.Present(l.portName):
+			unlock := lockPort(l.portName)
+			l.fail(errors.New("устройство отключено"))
+			unlock()
+		}
+	}
+}
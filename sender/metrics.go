@@ -0,0 +1,35 @@
+package sender
+
+import (
+	"strconv"
+	"tir/metrics"
+)
+
+// Метрики отправки
+var (
+	sendsTotal = metrics.NewCounter("tir_sends_total",
+		"Отправки кадров по линиям и итогам (confirmed, no-reply, error, blocked)", "lane", "outcome")
+	handshakeFailures = metrics.NewCounter("tir_handshake_failures_total",
+		"Ошибки инициализации обмена с контроллером", "port")
+	portOpenFailures = metrics.NewCounter("tir_port_open_failures_total",
+		"Ошибки открытия и настройки порта", "port")
+	sendDuration = metrics.NewHistogram("tir_send_duration_seconds",
+		"Длительность обмена с контроллером: от открытия порта до ответа", nil, "port")
+	queueDepth = metrics.NewGauge("tir_queue_depth",
+		"Заданий в очереди отправки порта", "port")
+	linkUp = metrics.NewGauge("tir_link_up",
+		"Состояние постоянного соединения с портом: 1 - есть связь, 0 - нет", "port")
+	linkReconnects = metrics.NewCounter("tir_link_reconnects_total",
+		"Восстановления постоянного соединения с портом после обрыва", "port")
+	deferredRequests = metrics.NewCounter("tir_deferred_requests_total",
+		"Задания, отложенные до восстановления связи с портом", "port")
+)
+
+// OutcomeBlocked итог отправки, не дошедшей до порта: аварийная блокировка,
+// блокировка движения или ошибки проверки сценария
+const OutcomeBlocked = "blocked"
+
+// laneLabel значение метки линии
+func laneLabel(lane int) string {
+	return strconv.Itoa(lane)
+}
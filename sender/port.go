@@ -0,0 +1,355 @@
+package sender
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"tir/audit"
+	"tir/comport"
+	"tir/interlock"
+	"tir/lint"
+	"tir/models"
+)
+
+// Блокировки портов: на одном контроллере не может идти две передачи одновременно
+var (
+	portLocksMu sync.Mutex
+	portLocks   = make(map[string]*portLock)
+)
+
+// portLock блокировка порта с приоритетом: кадр аварийной остановки захватывает
+// порт сразу после текущего владельца, обычные передачи ждут, пока он не отправлен
+type portLock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	held   bool
+	urgent int // Число ожидающих срочных захватов
+}
+
+func newPortLock() *portLock {
+	lock := &portLock{}
+	lock.cond = sync.NewCond(&lock.mu)
+	return lock
+}
+
+func (p *portLock) lock(urgent bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if urgent {
+		p.urgent++
+		defer func() { p.urgent-- }()
+	}
+	for p.held || (!urgent && p.urgent > 0) {
+		p.cond.Wait()
+	}
+	p.held = true
+}
+
+func (p *portLock) unlock() {
+	p.mu.Lock()
+	p.held = false
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// Форматы линий портов по именам; запись с пустым именем действует для всех
+// остальных портов. Порты без формата работают в 8N1
+var (
+	lineSettingsMu sync.Mutex
+	lineSettings   = make(map[string]comport.Settings)
+)
+
+// SetLineSettings заменяет форматы линий портов: имя порта -> параметры
+// (скорость не используется, она задается при отправке). Пустое имя - все порты
+func SetLineSettings(settings map[string]comport.Settings) {
+	lineSettingsMu.Lock()
+	defer lineSettingsMu.Unlock()
+	lineSettings = make(map[string]comport.Settings, len(settings))
+	for portName, line := range settings {
+		lineSettings[portName] = line
+	}
+}
+
+// LineSettings возвращает параметры порта с заданной скоростью. Формат ищется
+// по имени порта, затем по текущему имени устройства (serial:... и ttyUSB0 - один порт)
+func LineSettings(portName string, baudRate uint32) comport.Settings {
+	lineSettingsMu.Lock()
+	defer lineSettingsMu.Unlock()
+
+	line, exists := lineSettings[portName]
+	if !exists {
+		device, err := comport.Resolve(portName)
+		for name, settings := range lineSettings {
+			if name == "" || err != nil {
+				continue
+			}
+			if resolved, err := comport.Resolve(name); err == nil && resolved == device {
+				line, exists = settings, true
+				break
+			}
+		}
+	}
+	if !exists {
+		line, exists = lineSettings[""]
+	}
+	if !exists {
+		return comport.DefaultSettings(baudRate)
+	}
+	line.BaudRate = baudRate
+	return line
+}
+
+// LockPort захватывает порт для монопольного доступа и возвращает функцию освобождения.
+// Постоянное соединение с портом на это время закрывается, чтобы порт можно было открыть
+func LockPort(portName string) func() {
+	unlock := lockPort(portName)
+	if link := linkFor(portName); link != nil {
+		link.release()
+	}
+	return unlock
+}
+
+// lockPort захватывает блокировку порта
+func lockPort(portName string) func() {
+	return acquirePort(portName, false)
+}
+
+// acquirePort захватывает блокировку порта; срочный захват (аварийная
+// остановка) проходит раньше всех ожидающих обычных
+func acquirePort(portName string, urgent bool) func() {
+	// Постоянное имя (serial:..., path:...) и имя устройства одного порта
+	// захватывают одну блокировку
+	if name, err := comport.Resolve(portName); err == nil {
+		portName = name
+	}
+
+	portLocksMu.Lock()
+	lock, exists := portLocks[portName]
+	if !exists {
+		lock = newPortLock()
+		portLocks[portName] = lock
+	}
+	portLocksMu.Unlock()
+
+	lock.lock(urgent)
+	return lock.unlock
+}
+
+// Origin источник и назначение кадра для журнала аудита
+type Origin struct {
+	Source   audit.Source
+	Lane     int
+	Scenario string
+}
+
+// SendFrame открывает порт, выполняет инициализацию и отправляет кадр сценария.
+// Каждая передача записывается в журнал аудита. Возвращает ответ устройства
+// (может быть пустым, если ответа не было)
+func SendFrame(portName string, baudRate uint32, frame []byte, origin Origin) ([]byte, error) {
+	return sendFrame(portName, baudRate, frame, origin, false)
+}
+
+// sendFrame отправляет кадр. Обычная передача прерывается аварийной
+// остановкой; срочная (кадр парковки) захватывает порт раньше обычных
+func sendFrame(portName string, baudRate uint32, frame []byte, origin Origin, urgent bool) ([]byte, error) {
+	started := time.Now()
+	handshake, reply, err := exchange(portName, baudRate, frame, urgent)
+	sendDuration.Observe(time.Since(started).Seconds(), portName)
+
+	entry := audit.NewEntry(origin.Source, origin.Lane, portName, baudRate, origin.Scenario,
+		frame, handshake, reply, err)
+	audit.Record(entry)
+	sendsTotal.Inc(laneLabel(origin.Lane), string(entry.Outcome))
+	return reply, err
+}
+
+// exchange выполняет обмен с контроллером и возвращает отправленные байты
+// инициализации и ответ устройства. Если порт удерживается постоянным
+// соединением (автоотправка), обмен идет через него
+func exchange(portName string, baudRate uint32, frame []byte, urgent bool) (handshake, reply []byte, err error) {
+	if len(frame) == 0 {
+		return nil, nil, notSent(fmt.Errorf("ошибка: у сценария отсутствуют данные для отправки"))
+	}
+	if link := linkFor(portName); link != nil {
+		return link.exchange(baudRate, frame, urgent)
+	}
+
+	// Порт занят другой отправкой - ждем ее завершения
+	unlock := acquirePort(portName, urgent)
+	defer unlock()
+
+	handle, err := openPort(portName, baudRate)
+	if err != nil {
+		return nil, nil, notSent(err)
+	}
+	defer comport.ClosePort(handle)
+
+	return transfer(handle, portName, frame, urgent)
+}
+
+// notSentError ошибка, после которой кадр точно не записан в порт
+type notSentError struct {
+	err error
+}
+
+func (e *notSentError) Error() string { return e.err.Error() }
+func (e *notSentError) Unwrap() error { return e.err }
+
+// notSent помечает ошибку до записи кадра в порт
+func notSent(err error) error {
+	return &notSentError{err: err}
+}
+
+// FrameNotSent сообщает, что отправка завершилась ошибкой до записи кадра
+// в порт. При остальных ошибках кадр мог дойти до контроллера
+func FrameNotSent(err error) bool {
+	var e *notSentError
+	return errors.As(err, &e)
+}
+
+// openPort открывает и настраивает порт
+func openPort(portName string, baudRate uint32) (comport.Handle, error) {
+	logger.Debug("Подключение к порту", "port", portName, "baud", baudRate)
+	handle, err := comport.OpenPort(portName)
+	if err != nil {
+		portOpenFailures.Inc(portName)
+		return handle, fmt.Errorf("ошибка открытия порта: %v", err)
+	}
+
+	// Установка параметров порта
+	if err := comport.Configure(handle, LineSettings(portName, baudRate)); err != nil {
+		comport.ClosePort(handle)
+		portOpenFailures.Inc(portName)
+		return handle, fmt.Errorf("ошибка установки параметров: %v", err)
+	}
+
+	// Установка таймаутов
+	if err := comport.SetCommTimeouts(handle); err != nil {
+		comport.ClosePort(handle)
+		portOpenFailures.Inc(portName)
+		return handle, fmt.Errorf("ошибка установки таймаутов: %v", err)
+	}
+	return handle, nil
+}
+
+// transfer отправляет в открытый порт инициализацию и кадр и ждет ответа.
+// Обычная передача проверяет аварийную блокировку на каждом шаге и
+// прерывается с ErrEmergencyStop, освобождая порт для кадра парковки
+func transfer(handle comport.Handle, portName string, frame []byte, urgent bool) (handshake, reply []byte, err error) {
+	stopped := func() bool { return !urgent && EmergencyActive() }
+
+	// Очищаем буферы
+	comport.PurgeComm(handle)
+
+	// Имитация цикла инициализации
+	buffer := make([]byte, 64)
+	for i := 0; i < 10; i++ {
+		if stopped() {
+			return nil, nil, notSent(ErrEmergencyStop)
+		}
+		if _, err := comport.ReadPort(handle, buffer); err != nil {
+			return nil, nil, notSent(fmt.Errorf("ошибка чтения порта: %v", err))
+		}
+		time.Sleep(time.Millisecond * 16)
+	}
+
+	// Отправляем инициализационный пакет
+	initPacket := []byte{0x7E, 0xAA}
+	_, err = comport.WritePort(handle, initPacket)
+	if err != nil {
+		handshakeFailures.Inc(portName)
+		return nil, nil, notSent(fmt.Errorf("ошибка отправки инициализационного пакета: %v", err))
+	}
+	handshake = initPacket
+
+	// Пауза после инициализации
+	time.Sleep(time.Millisecond * 500)
+	comport.PurgeComm(handle)
+
+	if stopped() {
+		return handshake, nil, notSent(ErrEmergencyStop)
+	}
+	n, err := comport.WritePort(handle, frame)
+	if err != nil {
+		return handshake, nil, fmt.Errorf("ошибка отправки сценария: %v", err)
+	}
+
+	logger.Info("Кадр отправлен", "port", portName, "bytes", n, "frame", fmt.Sprintf("% X", frame))
+
+	// Ожидаем ответа от устройства; кадр уже записан, но ждать ответа
+	// во время аварийной остановки не нужно
+	for i := 0; i < 10; i++ {
+		if stopped() {
+			return handshake, nil, ErrEmergencyStop
+		}
+		n, err := comport.ReadPort(handle, buffer)
+		if err != nil {
+			return handshake, nil, fmt.Errorf("ошибка чтения ответа: %v", err)
+		}
+		if n > 0 {
+			reply = make([]byte, n)
+			copy(reply, buffer[:n])
+			return handshake, reply, nil
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	return handshake, nil, nil
+}
+
+// SendScenario проверяет сценарий анализатором и отправляет его кадр.
+// Сценарий с ошибками анализа отправляется только при force = true.
+// Во время аварийной блокировки возвращается ErrEmergencyStop.
+// source указывает источник отправки для журнала аудита
+func SendScenario(portName string, baudRate uint32, scenario models.Scenario, force bool, source audit.Source) ([]byte, error) {
+	// Во время аварийной блокировки сценарии не отправляются даже принудительно
+	lane := int(scenario.PulseType)
+	if EmergencyActive() {
+		sendsTotal.Inc(laneLabel(lane), OutcomeBlocked)
+		return nil, ErrEmergencyStop
+	}
+
+	// Кадр с движением проверяется блокировками линии, на которую он адресован
+	// (номер пульта в кадре); принудительная отправка блокировки не обходит.
+	// Линия занята до конца отправки, чтобы проверка и учет движения не
+	// разошлись с другими отправками на нее
+	reservation, err := interlock.Reserve(lane, scenario)
+	if err != nil {
+		sendsTotal.Inc(laneLabel(lane), OutcomeBlocked)
+		return nil, err
+	}
+
+	findings := lint.Check(scenario)
+	if lint.HasErrors(findings) {
+		if !force {
+			reservation.Done(false)
+			sendsTotal.Inc(laneLabel(lane), OutcomeBlocked)
+			return nil, &LintError{Scenario: scenario.Name, Findings: findings}
+		}
+		logger.Warn("Принудительная отправка сценария с ошибками проверки", "scenario", scenario.Name)
+	}
+
+	// Пауза между движениями отсчитывается от кадра, который мог уйти в порт,
+	// даже если ответа нет; кадр, не дошедший до порта, ее не начинает
+	reply, err := SendFrame(portName, baudRate, scenario.RawData,
+		Origin{Source: source, Lane: lane, Scenario: scenario.Name})
+	reservation.Done(!FrameNotSent(err))
+	return reply, err
+}
+
+// LintError отказ в отправке сценария с ошибками анализа
+type LintError struct {
+	Scenario string
+	Findings []lint.Finding
+}
+
+// Error возвращает описание первой ошибки анализа
+func (e *LintError) Error() string {
+	for _, f := range e.Findings {
+		if f.Severity >= lint.Error {
+			return fmt.Sprintf("сценарий '%s' не отправлен, ошибка проверки: %s", e.Scenario, f)
+		}
+	}
+	return fmt.Sprintf("сценарий '%s' не отправлен", e.Scenario)
+}
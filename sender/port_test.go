@@ -0,0 +1,136 @@
+package sender
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"tir/audit"
+	"tir/interlock"
+	"tir/models"
+	"tir/protocol"
+)
+
+func TestPortLockUrgentFirst(t *testing.T) {
+	lock := newPortLock()
+	lock.lock(false)
+
+	order := make(chan string, 2)
+	go func() {
+		lock.lock(false)
+		order <- "обычный"
+		lock.unlock()
+	}()
+	go func() {
+		lock.lock(true)
+		order <- "срочный"
+		lock.unlock()
+	}()
+
+	// Ждем, пока срочный захват встанет в ожидание
+	for deadline := time.Now().Add(time.Second); ; {
+		lock.mu.Lock()
+		waiting := lock.urgent
+		lock.mu.Unlock()
+		if waiting == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("срочный захват не встал в ожидание")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	lock.unlock()
+
+	if first := <-order; first != "срочный" {
+		t.Errorf("первым захватил порт %s, ожидался срочный", first)
+	}
+	if second := <-order; second != "обычный" {
+		t.Errorf("вторым захватил порт %s", second)
+	}
+}
+
+func TestSendScenarioLinkDownReplay(t *testing.T) {
+	previousAudit := audit.File
+	previousInterlock := interlock.Settings()
+	defer func() {
+		audit.File = previousAudit
+		interlock.Configure(previousInterlock)
+	}()
+
+	dir := t.TempDir()
+	audit.File = filepath.Join(dir, "audit.jsonl")
+	config := interlock.DefaultConfig()
+	config.StateFile = filepath.Join(dir, "interlock.json")
+	config.RangeHotFile = filepath.Join(dir, "range_hot.txt")
+	config.RangeHotDisabled = false
+	config.LogFile = ""
+	interlock.Configure(config)
+	if err := os.WriteFile(config.RangeHotFile, []byte("1=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := interlock.Arm(models.PULSE_1); err != nil {
+		t.Fatal(err)
+	}
+
+	scenario := models.Scenario{Name: "движение", PulseType: models.PULSE_1}
+	for _, pair := range [][2]uint16{
+		{models.CMD_SET_RANGE, 1000},
+		{models.CMD_SAFE_ZONE, 300},
+		{models.CMD_MOVE_TO_RANGE, 0},
+	} {
+		cmd, err := models.NewCommand(pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		scenario.Commands = append(scenario.Commands, cmd)
+	}
+	scenario.RawData = protocol.GenerateScenarioPacket(scenario)
+
+	// Порта нет: постоянное соединение сразу в состоянии "нет связи"
+	portName := filepath.Join(dir, "ttyНЕТ")
+	link, err := OpenLink(portName, 9600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer link.Close()
+
+	results := make(chan error, 2)
+	d := NewDispatcher(4, func(req Request) error {
+		_, err := SendScenario(req.PortName, req.BaudRate, scenario, true, audit.SourceAuto)
+		results <- err
+		return err
+	})
+	defer d.Stop()
+
+	if err := d.Submit(Request{Lane: 1, PortName: portName, BaudRate: 9600}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-results; !errors.Is(err, ErrLinkDown) {
+		t.Fatalf("отправка без связи: %v, ожидалась ErrLinkDown", err)
+	}
+
+	// Кадр не ушел в порт: пауза между движениями не началась
+	states, err := interlock.States()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := states[models.PULSE_1].LastMotion; !last.IsZero() {
+		t.Errorf("после отправки без связи учтено движение в %v", last)
+	}
+
+	// Повтор после восстановления не блокируется паузой от неотправленного кадра
+	d.Replay(portName)
+	select {
+	case err := <-results:
+		var blocked *interlock.BlockedError
+		if errors.As(err, &blocked) {
+			t.Errorf("повтор заблокирован: %v", err)
+		} else if !errors.Is(err, ErrLinkDown) {
+			t.Errorf("повтор: %v, ожидалась ErrLinkDown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("отложенное задание не повторено")
+	}
+}
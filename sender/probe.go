@@ -0,0 +1,67 @@
+package sender
+
+import (
+	"fmt"
+	"time"
+	"tir/comport"
+)
+
+// ProbeResult итог проверки связи с контроллером
+type ProbeResult struct {
+	Port      string
+	BaudRate  uint32
+	Handshake []byte        // Отправленный пакет инициализации
+	Reply     []byte        // Ответ контроллера на инициализацию
+	Latency   time.Duration // Время от инициализации до первого байта ответа
+	Elapsed   time.Duration // Длительность проверки
+}
+
+// probeWait время ожидания ответа на инициализацию
+var probeWait = 1500 * time.Millisecond
+
+// Probe открывает порт и отправляет только пакет инициализации, без кадра
+// сценария, и собирает ответ контроллера. Ошибка возвращается, если порт
+// не открылся или запись не прошла; отсутствие ответа ошибкой не считается
+func Probe(portName string, baudRate uint32) (result ProbeResult, err error) {
+	result = ProbeResult{Port: portName, BaudRate: baudRate}
+	started := time.Now()
+	defer func() { result.Elapsed = time.Since(started) }()
+
+	unlock := LockPort(portName)
+	defer unlock()
+
+	handle, err := openPort(portName, baudRate)
+	if err != nil {
+		return result, err
+	}
+	defer comport.ClosePort(handle)
+
+	comport.PurgeComm(handle)
+
+	initPacket := []byte{0x7E, 0xAA}
+	sent := time.Now()
+	if _, err := comport.WritePort(handle, initPacket); err != nil {
+		return result, fmt.Errorf("ошибка отправки инициализационного пакета: %v", err)
+	}
+	result.Handshake = initPacket
+
+	buffer := make([]byte, 64)
+	for time.Since(sent) < probeWait {
+		n, _ := comport.ReadPort(handle, buffer)
+		if n > 0 {
+			if len(result.Reply) == 0 {
+				result.Latency = time.Since(sent)
+			}
+			result.Reply = append(result.Reply, buffer[:n]...)
+			continue
+		}
+		if len(result.Reply) > 0 {
+			break // Ответ закончился
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	logger.Debug("Проверка связи", "port", portName, "reply", fmt.Sprintf("% X", result.Reply),
+		"latency", result.Latency)
+	return result, nil
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Result результат отправки на линию
+type Result struct {
+	ID       int64     `json:"id"`
+	Lane     int       `json:"lane"`
+	Port     string    `json:"port"`
+	Scenario string    `json:"scenario,omitempty"`
+	Distance int       `json:"distance,omitempty"`
+	OK       bool      `json:"ok"`
+	Error    string    `json:"error,omitempty"`
+	Reply    string    `json:"reply,omitempty"` // Ответ устройства в HEX
+	Time     time.Time `json:"time"`
+}
+
+// subscriberBuffer размер буфера подписчика; медленный подписчик пропускает события
+const subscriberBuffer = 16
+
+// broker рассылает результаты отправки подписчикам потока событий
+type broker struct {
+	mu          sync.Mutex
+	nextID      int64
+	subscribers map[chan Result]bool
+	closed      bool
+	done        chan struct{}
+}
+
+func newBroker() *broker {
+	return &broker{
+		subscribers: make(map[chan Result]bool),
+		done:        make(chan struct{}),
+	}
+}
+
+// publish рассылает результат всем подписчикам
+func (b *broker) publish(result Result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	result.ID = b.nextID
+	for ch := range b.subscribers {
+		select {
+		case ch <- result:
+		default:
+		}
+	}
+}
+
+// subscribe добавляет подписчика
+func (b *broker) subscribe() chan Result {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Result, subscriberBuffer)
+	if !b.closed {
+		b.subscribers[ch] = true
+	}
+	return ch
+}
+
+// unsubscribe удаляет подписчика
+func (b *broker) unsubscribe(ch chan Result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, ch)
+}
+
+// close завершает все потоки событий
+func (b *broker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+}
+
+// handleEvents передает результаты отправки потоком Server-Sent Events
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("поток событий не поддерживается"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+
+	// Комментарий раз в 30 секунд не дает прокси закрыть соединение
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case result := <-ch:
+			data, _ := json.Marshal(result)
+			fmt.Fprintf(w, "id: %d\nevent: result\ndata: %s\n\n", result.ID, data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.events.done:
+			return
+		}
+	}
+}
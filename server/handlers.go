@@ -0,0 +1,554 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tir/dsl"
+	"tir/interlock"
+	"tir/lint"
+	"tir/models"
+	"tir/protocol"
+	"tir/sender"
+)
+
+// routes регистрирует обработчики API и пульта инструктора
+func (s *Server) routes() http.Handler {
+	api := http.NewServeMux()
+
+	api.HandleFunc("GET /api/scenarios", s.handleListScenarios)
+	api.HandleFunc("POST /api/scenarios", s.handleCreateScenario)
+	api.HandleFunc("GET /api/scenarios/{name}", s.handleGetScenario)
+	api.HandleFunc("PUT /api/scenarios/{name}", s.handleUpdateScenario)
+	api.HandleFunc("DELETE /api/scenarios/{name}", s.handleDeleteScenario)
+	api.HandleFunc("GET /api/lanes", s.handleListLanes)
+	api.HandleFunc("GET /api/lanes/{lane}", s.handleGetLane)
+	api.HandleFunc("POST /api/lanes/{lane}/send", s.handleSend)
+	api.HandleFunc("POST /api/lanes/{lane}/arm", s.handleArm)
+	api.HandleFunc("POST /api/lanes/{lane}/disarm", s.handleArm)
+	api.HandleFunc("GET /api/events", s.handleEvents)
+	api.HandleFunc("GET /api/estop", s.handleEmergencyStatus)
+	api.HandleFunc("POST /api/estop", s.handleEmergencyStop)
+	api.HandleFunc("POST /api/rearm", s.handleRearm)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.authenticate(api))
+	mux.Handle("/", webHandler())
+
+	return mux
+}
+
+// authenticate пропускает только запросы с токеном доступа: заголовок
+// Authorization: Bearer <токен> или параметр token (для EventSource в браузере)
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) != 1 {
+			logger.Warn("Запрос с неверным токеном отклонен", "remote", r.RemoteAddr, "path", r.URL.Path)
+			writeError(w, http.StatusUnauthorized, errors.New("неверный токен доступа"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// scenarioSummary краткое описание сценария в списке
+type scenarioSummary struct {
+	Name      string   `json:"name"`
+	Remote    byte     `json:"remote"`
+	Distance  int      `json:"distance,omitempty"`
+	Lane      int      `json:"lane,omitempty"`
+	DrillType string   `json:"drill_type,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Size      int      `json:"size"`
+}
+
+// commandJSON команда сценария
+type commandJSON struct {
+	Code     string  `json:"code,omitempty"`
+	Name     string  `json:"name"`
+	Param    string  `json:"param,omitempty"`
+	Value    *uint16 `json:"value,omitempty"`
+	Raw      string  `json:"raw,omitempty"`
+	Encoding string  `json:"encoding,omitempty"`
+}
+
+// scenarioJSON полное описание сценария
+type scenarioJSON struct {
+	scenarioSummary
+	Hex      string        `json:"hex"`
+	Text     string        `json:"text,omitempty"`
+	Commands []commandJSON `json:"commands"`
+	Findings []findingJSON `json:"findings,omitempty"`
+}
+
+// findingJSON замечание анализатора
+type findingJSON struct {
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Position int    `json:"position,omitempty"`
+	Message  string `json:"message"`
+}
+
+// scenarioInput тело запроса создания и изменения сценария: кадр задается
+// HEX-строкой (hex) или в текстовом формате (text)
+type scenarioInput struct {
+	Name      string   `json:"name"`
+	Remote    byte     `json:"remote"`
+	Hex       string   `json:"hex"`
+	Text      string   `json:"text"`
+	Distance  int      `json:"distance"`
+	Lane      int      `json:"lane"`
+	DrillType string   `json:"drill_type"`
+	Tags      []string `json:"tags"`
+}
+
+// sendInput тело запроса отправки: имя сценария или дистанция
+type sendInput struct {
+	Scenario string `json:"scenario"`
+	Distance int    `json:"distance"`
+}
+
+func summarize(name string, scenario models.Scenario) scenarioSummary {
+	return scenarioSummary{
+		Name:      name,
+		Remote:    scenario.PulseType,
+		Distance:  scenario.Distance,
+		Lane:      scenario.Lane,
+		DrillType: scenario.DrillType,
+		Tags:      scenario.Tags,
+		Size:      len(scenario.RawData),
+	}
+}
+
+// describe формирует полное описание сценария с разобранными командами
+func describe(name string, scenario models.Scenario) scenarioJSON {
+	scenario.Name = name
+	result := scenarioJSON{
+		scenarioSummary: summarize(name, scenario),
+		Hex:             strings.ToUpper(hex.EncodeToString(scenario.RawData)),
+		Commands:        []commandJSON{},
+	}
+
+	for _, f := range lint.Filter(lint.Check(scenario), lint.Warning) {
+		result.Findings = append(result.Findings, findingJSON{
+			Severity: f.Severity.String(),
+			Rule:     f.Rule,
+			Position: f.Position,
+			Message:  f.Message,
+		})
+	}
+
+	commands := scenario.Commands
+	if len(scenario.RawData) > 0 {
+		if parsed, err := protocol.ParseScenarioData(scenario.RawData); err == nil {
+			commands = parsed.Commands
+		}
+	}
+	for _, cmd := range commands {
+		item := commandJSON{Name: cmd.Name}
+		if cmd.IsRaw() {
+			item.Raw = strings.ToUpper(hex.EncodeToString(cmd.Raw))
+		} else {
+			item.Code = fmt.Sprintf("0x%04X", cmd.Code)
+			if cmd.HasParam {
+				value := cmd.ParamValue
+				item.Param = cmd.ParamName
+				item.Value = &value
+			}
+			switch cmd.Encoding {
+			case models.EncodingBE:
+				item.Encoding = "be"
+			case models.EncodingShort:
+				item.Encoding = "short"
+			}
+		}
+		result.Commands = append(result.Commands, item)
+	}
+
+	if text, err := dsl.Format(scenario); err == nil {
+		result.Text = text
+	}
+	return result
+}
+
+func (s *Server) handleListScenarios(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	remote, _ := strconv.Atoi(query.Get("remote"))
+	distance, _ := strconv.Atoi(query.Get("distance"))
+
+	s.mu.RLock()
+	list := make([]scenarioSummary, 0, len(s.scenarios))
+	for name, scenario := range s.scenarios {
+		if remote > 0 && int(scenario.PulseType) != remote {
+			continue
+		}
+		if distance > 0 && scenario.Distance != distance {
+			continue
+		}
+		list = append(list, summarize(name, scenario))
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleGetScenario(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	s.mu.RLock()
+	scenario, exists := s.scenarios[name]
+	s.mu.RUnlock()
+
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Errorf("сценарий '%s' не найден", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, describe(name, scenario))
+}
+
+func (s *Server) handleCreateScenario(w http.ResponseWriter, r *http.Request) {
+	s.storeScenario(w, r, "", false)
+}
+
+func (s *Server) handleUpdateScenario(w http.ResponseWriter, r *http.Request) {
+	s.storeScenario(w, r, r.PathValue("name"), true)
+}
+
+// storeScenario создает или заменяет сценарий и сохраняет библиотеку в файл
+func (s *Server) storeScenario(w http.ResponseWriter, r *http.Request, name string, replace bool) {
+	var input scenarioInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора запроса: %v", err))
+		return
+	}
+	if name == "" {
+		name = input.Name
+	}
+
+	scenario, err := buildScenario(name, input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if errs := models.ValidateScenario(scenario); len(errs) > 0 {
+		writeError(w, http.StatusUnprocessableEntity, errs[0])
+		return
+	}
+
+	s.mu.Lock()
+	_, exists := s.scenarios[scenario.Name]
+	if exists && !replace {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, fmt.Errorf("сценарий '%s' уже существует", scenario.Name))
+		return
+	}
+	s.scenarios[scenario.Name] = scenario
+	err = s.save(scenario.Name)
+	s.mu.Unlock()
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("ошибка сохранения файла: %v", err))
+		return
+	}
+
+	status := http.StatusCreated
+	if exists {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, describe(scenario.Name, scenario))
+}
+
+// buildScenario собирает сценарий из тела запроса
+func buildScenario(name string, input scenarioInput) (models.Scenario, error) {
+	var scenario models.Scenario
+	var err error
+
+	switch {
+	case input.Text != "":
+		scenario, err = dsl.Parse(input.Text)
+		if err != nil {
+			return models.Scenario{}, err
+		}
+	case input.Hex != "":
+		data, err := hex.DecodeString(strings.ReplaceAll(input.Hex, " ", ""))
+		if err != nil {
+			return models.Scenario{}, fmt.Errorf("некорректная HEX-строка: %v", err)
+		}
+		scenario, err = protocol.ParseScenarioData(data)
+		if err != nil {
+			return models.Scenario{}, err
+		}
+		scenario.RawData = data
+		protocol.FillMetadata(&scenario)
+	default:
+		return models.Scenario{}, errors.New("кадр не задан: укажите hex или text")
+	}
+
+	if name == "" {
+		name = scenario.Name
+	}
+	if name == "" || strings.ContainsAny(name, ":\n") {
+		return models.Scenario{}, errors.New("некорректное имя сценария")
+	}
+	scenario.Name = name
+
+	// Тип пульта из запроса заменяет тип из кадра
+	if input.Remote != 0 && input.Remote != scenario.PulseType {
+		if input.Remote < models.PULSE_1 || input.Remote > models.PULSE_6 {
+			return models.Scenario{}, fmt.Errorf("неверный тип пульта %d", input.Remote)
+		}
+		scenario.PulseType = input.Remote
+		scenario.RawData = protocol.GenerateScenarioPacket(scenario)
+	}
+
+	if input.Distance > 0 {
+		scenario.Distance = input.Distance
+	}
+	scenario.Lane = input.Lane
+	scenario.DrillType = input.DrillType
+	scenario.Tags = input.Tags
+
+	return scenario, nil
+}
+
+func (s *Server) handleDeleteScenario(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	s.mu.Lock()
+	_, exists := s.scenarios[name]
+	var err error
+	if exists {
+		delete(s.scenarios, name)
+		err = s.save(name)
+	}
+	s.mu.Unlock()
+
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Errorf("сценарий '%s' не найден", name))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("ошибка сохранения файла: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// laneStatus возвращает копию состояния линии с признаком взведения
+func (s *Server) laneStatus(lane int) LaneStatus {
+	s.mu.RLock()
+	status := *s.lanes[lane]
+	s.mu.RUnlock()
+
+	if states, err := interlock.States(); err == nil {
+		status.Armed = states[lane].Armed
+	}
+	if link, exists := sender.LinkStatusOf(status.Port); exists {
+		status.Link = link.State
+	}
+	return status
+}
+
+func (s *Server) handleListLanes(w http.ResponseWriter, r *http.Request) {
+	lanes := make([]LaneStatus, 0, len(s.lanes))
+	for lane := range s.lanes {
+		lanes = append(lanes, s.laneStatus(lane))
+	}
+
+	sort.Slice(lanes, func(i, j int) bool { return lanes[i].Lane < lanes[j].Lane })
+	writeJSON(w, http.StatusOK, lanes)
+}
+
+func (s *Server) handleGetLane(w http.ResponseWriter, r *http.Request) {
+	lane, err := s.laneFromPath(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.laneStatus(lane))
+}
+
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
+	lane, err := s.laneFromPath(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var input sendInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора запроса: %v", err))
+		return
+	}
+	if (input.Scenario == "") == (input.Distance <= 0) {
+		writeError(w, http.StatusBadRequest, errors.New("укажите либо scenario, либо distance"))
+		return
+	}
+
+	if input.Scenario != "" {
+		s.mu.RLock()
+		_, exists := s.scenarios[input.Scenario]
+		s.mu.RUnlock()
+		if !exists {
+			writeError(w, http.StatusNotFound, fmt.Errorf("сценарий '%s' не найден", input.Scenario))
+			return
+		}
+	}
+
+	if err := s.submit(lane, input.Scenario, input.Distance); err != nil {
+		status := http.StatusServiceUnavailable
+		switch {
+		case errors.Is(err, sender.ErrQueueFull):
+			status = http.StatusTooManyRequests
+		case errors.Is(err, sender.ErrEmergencyStop):
+			status = http.StatusLocked
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, s.laneStatus(lane))
+}
+
+// handleArm взводит линию или снимает ее со взвода
+func (s *Server) handleArm(w http.ResponseWriter, r *http.Request) {
+	lane, err := s.laneFromPath(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/arm") {
+		err = interlock.Arm(lane)
+	} else {
+		err = interlock.Disarm(lane)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Info("Взведение линии изменено", "lane", lane, "path", r.URL.Path, "remote", r.RemoteAddr)
+
+	writeJSON(w, http.StatusOK, s.laneStatus(lane))
+}
+
+// emergencyJSON состояние аварийной блокировки
+type emergencyJSON struct {
+	Active bool             `json:"active"`
+	Since  string           `json:"since,omitempty"`
+	Reason string           `json:"reason,omitempty"`
+	Error  string           `json:"error,omitempty"` // Блокировка не записана в файл
+	Lanes  []stopResultJSON `json:"lanes,omitempty"`
+}
+
+// stopResultJSON результат отправки парковки на линию
+type stopResultJSON struct {
+	Lane      int    `json:"lane"`
+	Port      string `json:"port"`
+	Delivered bool   `json:"delivered"`
+	Confirmed bool   `json:"confirmed"`
+	Reply     string `json:"reply,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func emergencyStatus() emergencyJSON {
+	state := sender.Emergency()
+	status := emergencyJSON{Active: state.Active, Reason: state.Reason}
+	if !state.Since.IsZero() {
+		status.Since = state.Since.Format(time.RFC3339)
+	}
+	return status
+}
+
+func (s *Server) handleEmergencyStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, emergencyStatus())
+}
+
+// handleEmergencyStop паркует все линии, минуя очереди, и блокирует отправку
+func (s *Server) handleEmergencyStop(w http.ResponseWriter, r *http.Request) {
+	results, engageErr := sender.EmergencyStop(s.targets(), "API "+r.RemoteAddr)
+	sender.PrintStopResults(results)
+
+	status := emergencyStatus()
+	if engageErr != nil {
+		status.Error = engageErr.Error()
+	}
+	s.mu.Lock()
+	for _, result := range results {
+		item := stopResultJSON{
+			Lane:      result.Lane,
+			Port:      result.PortName,
+			Delivered: result.Delivered(),
+			Confirmed: result.Confirmed(),
+			Reply:     hex.EncodeToString(result.Reply),
+		}
+		lane := s.lanes[result.Lane]
+		lane.State = StateStopped
+		now := time.Now()
+		lane.LastSend = &now
+		lane.LastError = ""
+		switch {
+		case result.Err != nil:
+			item.Error = result.Err.Error()
+			lane.LastError = "парковка не доставлена: " + item.Error
+		case !result.Confirmed():
+			lane.LastError = "парковка не подтверждена: контроллер не ответил"
+		}
+		status.Lanes = append(status.Lanes, item)
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleRearm снимает аварийную блокировку
+func (s *Server) handleRearm(w http.ResponseWriter, r *http.Request) {
+	if err := sender.Rearm(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.mu.Lock()
+	for _, lane := range s.lanes {
+		if lane.State == StateStopped {
+			lane.State = StateIdle
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, emergencyStatus())
+}
+
+// laneFromPath возвращает номер линии из пути запроса
+func (s *Server) laneFromPath(r *http.Request) (int, error) {
+	lane, err := strconv.Atoi(r.PathValue("lane"))
+	if err != nil || s.lanes[lane] == nil {
+		return 0, fmt.Errorf("линия '%s' не найдена", r.PathValue("lane"))
+	}
+	return lane, nil
+}
+
+// writeJSON записывает ответ в формате JSON
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError записывает ошибку в формате {"error": "..."}
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,307 @@
+// Package server реализует локальный HTTP/JSON API для работы со сценариями
+// и отправки их на линии
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+	"tir/audit"
+	"tir/auto"
+	"tir/logging"
+	"tir/models"
+	"tir/sender"
+	"tir/storage"
+)
+
+// DefaultAddr адрес по умолчанию: только локальные подключения
+const DefaultAddr = "127.0.0.1:8080"
+
+// Config настройки сервера
+type Config struct {
+	Addr      string         // Адрес прослушивания
+	Token     string         // Токен доступа; если пуст, генерируется при запуске
+	FileName  string         // Файл сценариев, в который сохраняются изменения
+	PortName  string         // Порт по умолчанию
+	BaudRate  uint32         // Скорость порта
+	LinePorts map[int]string // Номер линии -> порт
+	QueueSize int            // Размер очереди отправки на порт
+}
+
+// LaneStatus состояние линии
+type LaneStatus struct {
+	Lane      int        `json:"lane"`
+	Port      string     `json:"port"`
+	State     string     `json:"state"` // idle, queued, sending, ok, error, stopped
+	Distance  int        `json:"distance,omitempty"`
+	Scenario  string     `json:"scenario,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	LastSend  *time.Time `json:"last_send,omitempty"` // Нет, пока на линию ничего не отправлялось
+	Queue     int        `json:"queue"`
+	Armed     bool       `json:"armed"` // Линия взведена: кадры с движением разрешены
+
+	// Состояние постоянного соединения с портом (up, down), если порт удерживается автоотправкой
+	Link sender.LinkState `json:"link,omitempty"`
+}
+
+var logger = logging.For("server")
+
+// Состояния линии
+const (
+	StateIdle    = "idle"
+	StateQueued  = "queued"
+	StateSending = "sending"
+	StateOK      = "ok"
+	StateError   = "error"
+	StateStopped = "stopped" // Аварийная остановка
+)
+
+// Server локальный API
+type Server struct {
+	config Config
+
+	mu        sync.RWMutex
+	scenarios map[string]models.Scenario
+	lanes     map[int]*LaneStatus
+
+	dispatcher *sender.Dispatcher
+	events     *broker
+	http       *http.Server
+}
+
+// New создает сервер над общей библиотекой сценариев
+func New(config Config, scenarios map[string]models.Scenario) (*Server, error) {
+	if config.Addr == "" {
+		config.Addr = DefaultAddr
+	}
+	if config.FileName == "" {
+		config.FileName = storage.DefaultFileName
+	}
+	if config.PortName == "" {
+		config.PortName = "COM4"
+	}
+	if config.BaudRate == 0 {
+		config.BaudRate = 4800
+	}
+	if config.Token == "" {
+		token, err := generateToken()
+		if err != nil {
+			return nil, err
+		}
+		config.Token = token
+	}
+
+	s := &Server{
+		config:    config,
+		scenarios: scenarios,
+		lanes:     make(map[int]*LaneStatus),
+		events:    newBroker(),
+	}
+	for lane := models.PULSE_1; lane <= models.PULSE_6; lane++ {
+		s.lanes[lane] = &LaneStatus{Lane: lane, Port: s.portForLane(lane), State: StateIdle}
+	}
+	s.dispatcher = sender.NewDispatcher(config.QueueSize, s.sendRequest)
+	s.dispatcher.OnDrop(s.dropRequest)
+
+	s.http = &http.Server{
+		Addr:              config.Addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s, nil
+}
+
+// Token возвращает токен доступа
+func (s *Server) Token() string {
+	return s.config.Token
+}
+
+// Addr возвращает адрес прослушивания
+func (s *Server) Addr() string {
+	return s.config.Addr
+}
+
+// ListenAndServe принимает подключения до вызова Shutdown
+func (s *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+
+	err = s.http.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown останавливает прием запросов, закрывает потоки событий
+// и выполняет уже поставленные в очередь отправки, пока не истечет ctx
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.events.close()
+	err := s.http.Shutdown(ctx)
+	if drainErr := s.dispatcher.Drain(ctx); err == nil {
+		err = drainErr
+	}
+	return err
+}
+
+// portForLane возвращает порт, к которому подключена линия
+func (s *Server) portForLane(lane int) string {
+	if portName, exists := s.config.LinePorts[lane]; exists && portName != "" {
+		return portName
+	}
+	return s.config.PortName
+}
+
+// targets возвращает все линии с их портами для аварийной остановки
+func (s *Server) targets() []sender.Target {
+	var targets []sender.Target
+	for lane := models.PULSE_1; lane <= models.PULSE_6; lane++ {
+		targets = append(targets, sender.Target{
+			Lane:     lane,
+			PortName: s.portForLane(lane),
+			BaudRate: s.config.BaudRate,
+		})
+	}
+	return targets
+}
+
+// submit ставит отправку на линию в очередь порта
+func (s *Server) submit(lane int, scenarioName string, distance int) error {
+	if sender.EmergencyActive() {
+		return sender.ErrEmergencyStop
+	}
+
+	req := sender.Request{
+		Lane:     lane,
+		PortName: s.portForLane(lane),
+		BaudRate: s.config.BaudRate,
+		Distance: distance,
+		Scenario: scenarioName,
+	}
+
+	// Состояние "в очереди" ставится до постановки: поток порта может взять
+	// задание сразу, и его "отправка" не должна затираться. Submit не ждет
+	// и не берет s.mu, поэтому выполняется под блокировкой
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.lanes[lane]
+	previous := status.State
+	status.State = StateQueued
+	if err := s.dispatcher.Submit(req); err != nil {
+		status.State = previous
+		return err
+	}
+	status.Queue = s.dispatcher.QueueLength(req.PortName)
+	return nil
+}
+
+// sendRequest выполняет задание диспетчера и публикует результат
+func (s *Server) sendRequest(req sender.Request) error {
+	s.mu.Lock()
+	s.lanes[req.Lane].State = StateSending
+	s.mu.Unlock()
+
+	result := Result{
+		Lane:     req.Lane,
+		Port:     req.PortName,
+		Distance: req.Distance,
+		Time:     time.Now(),
+	}
+
+	scenario, err := s.scenarioForRequest(req)
+	var reply []byte
+	if err == nil {
+		result.Scenario = scenario.Name
+		reply, err = sender.SendScenario(req.PortName, req.BaudRate, scenario, false, audit.SourceAPI)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.OK = true
+		result.Reply = hex.EncodeToString(reply)
+	}
+
+	s.mu.Lock()
+	status := s.lanes[req.Lane]
+	status.LastSend = &result.Time
+	status.Queue = s.dispatcher.QueueLength(req.PortName)
+	if result.Scenario != "" {
+		status.Scenario = result.Scenario
+	}
+	if err != nil {
+		status.State = StateError
+		status.LastError = result.Error
+	} else {
+		status.State = StateOK
+		status.LastError = ""
+		if scenario.Distance > 0 {
+			status.Distance = scenario.Distance
+		}
+	}
+	s.mu.Unlock()
+
+	s.events.publish(result)
+	return err
+}
+
+// dropRequest снимает состояние "в очереди" с линии, задание которой
+// диспетчер отбросил без выполнения
+func (s *Server) dropRequest(req sender.Request, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.lanes[req.Lane]
+	if status == nil || status.State != StateQueued || s.dispatcher.Pending(req.PortName, req.Lane) {
+		return
+	}
+	status.State = StateIdle
+	if sender.EmergencyActive() {
+		status.State = StateStopped
+	}
+	status.LastError = "задание отброшено: " + reason
+	status.Queue = s.dispatcher.QueueLength(req.PortName)
+}
+
+// scenarioForRequest находит сценарий задания: по имени или по дистанции
+func (s *Server) scenarioForRequest(req sender.Request) (models.Scenario, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if req.Scenario != "" {
+		scenario, exists := s.scenarios[req.Scenario]
+		if !exists {
+			return models.Scenario{}, fmt.Errorf("сценарий '%s' не найден", req.Scenario)
+		}
+		scenario.Name = req.Scenario
+		return scenario, nil
+	}
+
+	return auto.ResolveScenarioAuto(s.scenarios, byte(req.Lane), req.Distance)
+}
+
+// save записывает в файл библиотеки изменение сценария name: измененный
+// сценарий заменяет свою строку, удаленный - удаляется. Вызывается под блокировкой
+func (s *Server) save(name string) error {
+	if scenario, exists := s.scenarios[name]; exists {
+		return storage.UpdateScenariosFile(s.config.FileName, map[string]models.Scenario{name: scenario}, nil)
+	}
+	return storage.UpdateScenariosFile(s.config.FileName, nil, []string{name})
+}
+
+// generateToken создает случайный токен доступа
+func generateToken() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", fmt.Errorf("не удалось создать токен: %v", err)
+	}
+	return hex.EncodeToString(buffer), nil
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"tir/audit"
+	"tir/interlock"
+	"tir/models"
+	"tir/sender"
+)
+
+const testToken = "секрет"
+
+// newTestServer создает сервер над файлами во временном каталоге: файл
+// сценариев, блокировки и журналы. Порт не существует, отправки завершаются ошибкой
+func newTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	previousEstop := sender.EmergencyFile()
+	previousAudit := audit.File
+	previousInterlock := interlock.Settings()
+	t.Cleanup(func() {
+		sender.SetEmergencyFile(previousEstop)
+		audit.File = previousAudit
+		interlock.Configure(previousInterlock)
+	})
+	if err := sender.SetEmergencyFile(filepath.Join(dir, "estop.lock")); err != nil {
+		t.Fatal(err)
+	}
+	audit.File = filepath.Join(dir, "audit.jsonl")
+	config := interlock.DefaultConfig()
+	config.StateFile = filepath.Join(dir, "interlock.json")
+	config.RangeHotFile = filepath.Join(dir, "range_hot.txt")
+	config.LogFile = ""
+	interlock.Configure(config)
+
+	s, err := New(Config{
+		Token:    testToken,
+		FileName: filepath.Join(dir, "scenarios.txt"),
+		PortName: filepath.Join(dir, "ttyНЕТ"),
+	}, make(map[string]models.Scenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.dispatcher.Stop)
+	return s, dir
+}
+
+// request выполняет запрос к API с токеном и возвращает код и тело ответа
+func request(t *testing.T, s *Server, method, path, body string) (int, string) {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	s.routes().ServeHTTP(w, r)
+	data, _ := io.ReadAll(w.Result().Body)
+	return w.Code, string(data)
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"без токена", "/api/lanes", "", http.StatusUnauthorized},
+		{"неверный токен", "/api/lanes", "Bearer чужой", http.StatusUnauthorized},
+		{"токен без Bearer", "/api/lanes", testToken, http.StatusOK},
+		{"токен в заголовке", "/api/lanes", "Bearer " + testToken, http.StatusOK},
+		{"токен в параметре", "/api/lanes?token=" + testToken, "", http.StatusOK},
+		{"пульт инструктора без токена", "/", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.routes().ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("код %d, ожидался %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestScenarioHandlers(t *testing.T) {
+	s, dir := newTestServer(t)
+	text := "name \"тир\"\nremote 2\nrange 1000\npark\n"
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+		inBody string // Часть тела ответа
+		inFile bool   // Сценарий есть в файле после запроса
+	}{
+		{"создание из текста", "POST", "/api/scenarios", `{"text": ` + quote(text) + `, "drill_type": "зачет"}`,
+			http.StatusCreated, `"drill_type":"зачет"`, true},
+		{"повторное создание", "POST", "/api/scenarios", `{"text": ` + quote(text) + `}`,
+			http.StatusConflict, "уже существует", true},
+		{"получение", "GET", "/api/scenarios/тир", "", http.StatusOK, `"distance":10`, true},
+		{"список с фильтром пульта", "GET", "/api/scenarios?remote=2", "", http.StatusOK, `"name":"тир"`, true},
+		{"список другого пульта", "GET", "/api/scenarios?remote=1", "", http.StatusOK, "[]", true},
+		{"замена со сменой пульта", "PUT", "/api/scenarios/тир", `{"text": ` + quote(text) + `, "remote": 3}`,
+			http.StatusOK, `"remote":3`, true},
+		{"некорректный HEX", "POST", "/api/scenarios", `{"name": "х", "hex": "7G"}`,
+			http.StatusBadRequest, "HEX", true},
+		{"кадр не задан", "POST", "/api/scenarios", `{"name": "х"}`, http.StatusBadRequest, "кадр не задан", true},
+		{"не JSON", "POST", "/api/scenarios", `{`, http.StatusBadRequest, "ошибка разбора", true},
+		{"нет сценария", "GET", "/api/scenarios/нет", "", http.StatusNotFound, "не найден", true},
+		{"удаление", "DELETE", "/api/scenarios/тир", "", http.StatusNoContent, "", false},
+		{"повторное удаление", "DELETE", "/api/scenarios/тир", "", http.StatusNotFound, "не найден", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := request(t, s, tt.method, tt.path, tt.body)
+			if code != tt.want {
+				t.Fatalf("код %d, ожидался %d: %s", code, tt.want, body)
+			}
+			if !strings.Contains(body, tt.inBody) {
+				t.Errorf("в ответе нет '%s': %s", tt.inBody, body)
+			}
+			data, _ := os.ReadFile(filepath.Join(dir, "scenarios.txt"))
+			if inFile := strings.HasPrefix(string(data), "тир:"); inFile != tt.inFile {
+				t.Errorf("сценарий в файле: %v, ожидалось %v", inFile, tt.inFile)
+			}
+		})
+	}
+}
+
+// quote записывает строку в JSON
+func quote(text string) string {
+	data, _ := json.Marshal(text)
+	return string(data)
+}
+
+func TestSendHandler(t *testing.T) {
+	s, _ := newTestServer(t)
+	if code, body := request(t, s, "POST", "/api/scenarios",
+		`{"text": "name \"тир\"\nremote 1\nlight on\n"}`); code != http.StatusCreated {
+		t.Fatalf("создание сценария: %d %s", code, body)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"нет линии", "/api/lanes/9/send", `{"distance": 10}`, http.StatusNotFound},
+		{"сценарий и дистанция", "/api/lanes/1/send", `{"scenario": "тир", "distance": 10}`, http.StatusBadRequest},
+		{"ни сценария, ни дистанции", "/api/lanes/1/send", `{}`, http.StatusBadRequest},
+		{"нет сценария", "/api/lanes/1/send", `{"scenario": "нет"}`, http.StatusNotFound},
+		{"постановка в очередь", "/api/lanes/1/send", `{"scenario": "тир"}`, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := request(t, s, "POST", tt.path, tt.body); code != tt.want {
+				t.Errorf("код %d, ожидался %d: %s", code, tt.want, body)
+			}
+		})
+	}
+
+	// Порта нет: отправка завершается ошибкой, линия не остается в очереди
+	var lane LaneStatus
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		_, body := request(t, s, "GET", "/api/lanes/1", "")
+		if err := json.Unmarshal([]byte(body), &lane); err != nil {
+			t.Fatal(err)
+		}
+		if lane.State != StateQueued && lane.State != StateSending {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("линия в состоянии %s", lane.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lane.State != StateError || lane.LastError == "" || lane.LastSend == nil {
+		t.Errorf("состояние линии %+v", lane)
+	}
+
+	// Во время аварийной блокировки задания не принимаются
+	if _, err := sender.EmergencyStop(nil, "тест"); err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Rearm()
+	if code, body := request(t, s, "POST", "/api/lanes/1/send", `{"scenario": "тир"}`); code != http.StatusLocked {
+		t.Errorf("отправка при блокировке: код %d: %s", code, body)
+	}
+}
+
+func TestLaneStatusJSON(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	// Пока на линию ничего не отправлялось, last_send в ответе нет
+	_, body := request(t, s, "GET", "/api/lanes/2", "")
+	if strings.Contains(body, "last_send") {
+		t.Errorf("last_send у линии без отправок: %s", body)
+	}
+}
+
+func TestDropRequest(t *testing.T) {
+	s, _ := newTestServer(t)
+	req := sender.Request{Lane: 1, PortName: s.portForLane(1)}
+
+	tests := []struct {
+		name      string
+		state     string
+		emergency bool
+		want      string
+	}{
+		{"в очереди", StateQueued, false, StateIdle},
+		{"в очереди при блокировке", StateQueued, true, StateStopped},
+		{"выполняется", StateSending, false, StateSending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.emergency {
+				if _, err := sender.EmergencyStop(nil, "тест"); err != nil {
+					t.Fatal(err)
+				}
+				defer sender.Rearm()
+			}
+			s.lanes[1].State = tt.state
+			s.dropRequest(req, sender.DropStale)
+			if got := s.lanes[1].State; got != tt.want {
+				t.Errorf("состояние %s, ожидалось %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// Файлы пульта инструктора встроены в программу и работают без доступа в интернет
+//
+//go:embed web
+var webFiles embed.FS
+
+// webHandler раздает файлы пульта инструктора; доступ к данным проверяет API
+func webHandler() http.Handler {
+	root, _ := fs.Sub(webFiles, "web")
+	return http.FileServerFS(root)
+}
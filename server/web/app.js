@@ -0,0 +1,348 @@
+// Пульт инструктора: линии, отправка и просмотр сценариев через локальный API
+"use strict";
+
+const state = {
+  token: new URLSearchParams(location.search).get("token") || localStorage.getItem("tir-token") || "",
+  lanes: [],
+  scenarios: [],
+  selected: "",
+  events: null,
+};
+
+// api выполняет запрос к API с токеном доступа
+async function api(method, path, body) {
+  const options = { method, headers: { Authorization: "Bearer " + state.token } };
+  if (body !== undefined) {
+    options.headers["Content-Type"] = "application/json";
+    options.body = JSON.stringify(body);
+  }
+  const response = await fetch("/api" + path, options);
+  if (response.status === 401) {
+    showLogin("Неверный токен доступа");
+    throw new Error("неверный токен доступа");
+  }
+  if (response.status === 204) {
+    return null;
+  }
+  const data = await response.json();
+  if (!response.ok) {
+    throw new Error(data.error || response.statusText);
+  }
+  return data;
+}
+
+function toast(message) {
+  const element = document.getElementById("toast");
+  element.textContent = message;
+  element.hidden = false;
+  clearTimeout(toast.timer);
+  toast.timer = setTimeout(() => { element.hidden = true; }, 4000);
+}
+
+function showLogin(message) {
+  document.getElementById("login").hidden = false;
+  document.querySelector("main").hidden = true;
+  document.getElementById("login-error").textContent = message || "";
+}
+
+function formatTime(value) {
+  if (!value) {
+    return "-";
+  }
+  return new Date(value).toLocaleTimeString("ru-RU");
+}
+
+const stateNames = {
+  idle: "ожидание",
+  queued: "в очереди",
+  sending: "отправка",
+  ok: "отправлено",
+  error: "ошибка",
+  stopped: "остановлена",
+};
+
+// renderLanes перерисовывает карточки линий, сохраняя введенные значения
+function renderLanes() {
+  const container = document.getElementById("lanes");
+  const template = document.getElementById("lane-template");
+
+  for (const lane of state.lanes) {
+    let card = container.querySelector(`[data-lane="${lane.lane}"]`);
+    if (!card) {
+      card = template.content.firstElementChild.cloneNode(true);
+      card.dataset.lane = lane.lane;
+      card.querySelector(".lane-number").textContent = lane.lane;
+      card.querySelector(".send-distance").addEventListener("submit", (event) => {
+        event.preventDefault();
+        const distance = parseInt(event.target.querySelector("input").value, 10);
+        send(lane.lane, { distance });
+      });
+      card.querySelector(".send-scenario").addEventListener("submit", (event) => {
+        event.preventDefault();
+        send(lane.lane, { scenario: event.target.querySelector("select").value });
+      });
+      card.querySelector(".arm").addEventListener("click", async () => {
+        const current = state.lanes.find((l) => l.lane === lane.lane);
+        try {
+          await api("POST", `/lanes/${lane.lane}/${current.armed ? "disarm" : "arm"}`);
+          await loadLanes();
+        } catch (error) {
+          toast(`Линия ${lane.lane}: ${error.message}`);
+        }
+      });
+      container.appendChild(card);
+    }
+
+    card.className = "lane " + lane.state;
+    card.querySelector(".state").textContent = stateNames[lane.state] || lane.state;
+    card.querySelector(".distance").textContent = lane.distance ? lane.distance + " м" : "-";
+    card.querySelector(".scenario").textContent = lane.scenario || "-";
+    card.querySelector(".port").textContent = lane.port + (lane.queue ? ` (очередь ${lane.queue})` : "") +
+      (lane.link === "down" ? " - нет связи" : "");
+    card.querySelector(".last-send").textContent = formatTime(lane.last_send);
+    card.querySelector(".last-error").textContent = lane.last_error || "";
+    const arm = card.querySelector(".arm");
+    arm.textContent = lane.armed ? "Взведена - снять" : "Не взведена - взвести";
+    arm.classList.toggle("armed", lane.armed);
+
+    // Сценарии для пульта линии
+    const select = card.querySelector("select");
+    const options = state.scenarios.filter((s) => s.remote === lane.lane);
+    if (select.dataset.count !== String(options.length)) {
+      const current = select.value;
+      select.replaceChildren(...options.map((s) => {
+        const option = document.createElement("option");
+        option.value = s.name;
+        option.textContent = s.distance ? `${s.name} (${s.distance} м)` : s.name;
+        return option;
+      }));
+      select.value = current;
+      select.dataset.count = String(options.length);
+    }
+  }
+}
+
+async function send(lane, body) {
+  try {
+    await api("POST", `/lanes/${lane}/send`, body);
+    toast(`Линия ${lane}: отправка поставлена в очередь`);
+    await loadLanes();
+  } catch (error) {
+    toast(`Линия ${lane}: ${error.message}`);
+  }
+}
+
+async function loadLanes() {
+  state.lanes = await api("GET", "/lanes");
+  renderLanes();
+}
+
+async function loadScenarios() {
+  state.scenarios = await api("GET", "/scenarios");
+  renderScenarioList();
+  renderLanes();
+}
+
+// renderScenarioList выводит список сценариев с фильтром
+function renderScenarioList() {
+  const filter = document.getElementById("filter").value.trim().toLowerCase();
+  const list = document.getElementById("scenario-list");
+  const items = state.scenarios.filter((s) => {
+    if (!filter) {
+      return true;
+    }
+    const text = `${s.name} пульт ${s.remote} ${s.distance || ""}м ${(s.tags || []).join(" ")}`.toLowerCase();
+    return text.includes(filter);
+  });
+
+  list.replaceChildren(...items.map((s) => {
+    const item = document.createElement("li");
+    item.textContent = s.name;
+    const details = document.createElement("small");
+    details.textContent = `пульт ${s.remote}` + (s.distance ? `, ${s.distance} м` : "") + `, ${s.size} байт`;
+    item.appendChild(details);
+    if (s.name === state.selected) {
+      item.className = "selected";
+    }
+    item.addEventListener("click", () => showScenario(s.name));
+    return item;
+  }));
+}
+
+// showScenario показывает разобранные команды сценария
+async function showScenario(name) {
+  state.selected = name;
+  renderScenarioList();
+  const container = document.getElementById("scenario-details");
+
+  let scenario;
+  try {
+    scenario = await api("GET", "/scenarios/" + encodeURIComponent(name));
+  } catch (error) {
+    container.textContent = error.message;
+    return;
+  }
+
+  const title = document.createElement("h2");
+  title.textContent = scenario.name;
+
+  const info = document.createElement("p");
+  info.className = "muted";
+  info.textContent = `Пульт ${scenario.remote}` +
+    (scenario.distance ? `, дистанция ${scenario.distance} м` : "") +
+    (scenario.drill_type ? `, ${scenario.drill_type}` : "") +
+    (scenario.tags ? `, метки: ${scenario.tags.join(", ")}` : "");
+
+  const table = document.createElement("table");
+  const head = table.createTHead().insertRow();
+  for (const text of ["№", "Команда", "Параметр"]) {
+    const cell = document.createElement("th");
+    cell.textContent = text;
+    head.appendChild(cell);
+  }
+  const body = table.createTBody();
+  scenario.commands.forEach((command, index) => {
+    const row = body.insertRow();
+    row.insertCell().textContent = index + 1;
+    row.insertCell().textContent = command.code ? `${command.name} (${command.code})` : command.name;
+    row.insertCell().textContent = command.value !== undefined ? `${command.param}: ${command.value}` : "";
+  });
+
+  const findings = document.createElement("div");
+  for (const finding of scenario.findings || []) {
+    const line = document.createElement("p");
+    line.className = finding.severity === "ошибка" ? "error" : "muted";
+    line.textContent = `[${finding.severity}] ${finding.message}`;
+    findings.appendChild(line);
+  }
+
+  const text = document.createElement("pre");
+  text.textContent = scenario.text;
+  const hex = document.createElement("pre");
+  hex.textContent = scenario.hex.match(/.{1,2}/g).join(" ");
+
+  container.replaceChildren(title, info, table, findings, text, hex);
+}
+
+// renderEmergency показывает состояние аварийной блокировки и подтверждения по линиям
+function renderEmergency(status) {
+  document.getElementById("emergency").hidden = !status.active;
+  document.getElementById("emergency-since").textContent =
+    status.since ? "с " + new Date(status.since).toLocaleTimeString("ru-RU") : "";
+
+  if (status.lanes) {
+    document.getElementById("emergency-lanes").replaceChildren(...status.lanes.map((lane) => {
+      const item = document.createElement("li");
+      if (lane.confirmed) {
+        item.textContent = `Линия ${lane.lane}: парковка доставлена, контроллер ответил`;
+      } else if (lane.delivered) {
+        item.textContent = `Линия ${lane.lane}: парковка отправлена, ответа нет - проверьте визуально`;
+      } else {
+        item.textContent = `Линия ${lane.lane}: НЕ ДОСТАВЛЕНО - ${lane.error}`;
+        item.className = "error";
+      }
+      return item;
+    }));
+  }
+}
+
+async function loadEmergency() {
+  renderEmergency(await api("GET", "/estop"));
+}
+
+document.getElementById("estop").addEventListener("click", async () => {
+  try {
+    renderEmergency(await api("POST", "/estop"));
+    await loadLanes();
+  } catch (error) {
+    toast("Аварийная остановка: " + error.message);
+  }
+});
+
+document.getElementById("rearm").addEventListener("click", async () => {
+  if (!confirm("Линии проверены, люди вне зоны движения мишеней?")) {
+    return;
+  }
+  try {
+    document.getElementById("emergency-lanes").replaceChildren();
+    renderEmergency(await api("POST", "/rearm"));
+    await loadLanes();
+  } catch (error) {
+    toast(error.message);
+  }
+});
+
+// connectEvents подписывается на результаты отправки
+function connectEvents() {
+  if (state.events) {
+    state.events.close();
+  }
+  const badge = document.getElementById("connection");
+  const events = new EventSource("/api/events?token=" + encodeURIComponent(state.token));
+
+  events.onopen = () => {
+    badge.textContent = "на связи";
+    badge.classList.add("online");
+    loadLanes().catch(() => {});
+    loadEmergency().catch(() => {});
+  };
+  events.onerror = () => {
+    badge.textContent = "нет связи";
+    badge.classList.remove("online");
+  };
+  events.addEventListener("result", (event) => {
+    const result = JSON.parse(event.data);
+    toast(result.ok
+      ? `Линия ${result.lane}: отправлен «${result.scenario}»`
+      : `Линия ${result.lane}: ошибка - ${result.error}`);
+    loadLanes().catch(() => {});
+  });
+  state.events = events;
+}
+
+async function start() {
+  try {
+    await loadScenarios();
+    await loadLanes();
+    await loadEmergency();
+  } catch (error) {
+    if (!document.getElementById("login").hidden) {
+      return;
+    }
+    toast(error.message);
+    return;
+  }
+  localStorage.setItem("tir-token", state.token);
+  document.getElementById("login").hidden = true;
+  document.querySelector("main").hidden = false;
+  connectEvents();
+}
+
+document.getElementById("login-form").addEventListener("submit", (event) => {
+  event.preventDefault();
+  state.token = document.getElementById("token").value.trim();
+  start();
+});
+
+document.getElementById("filter").addEventListener("input", renderScenarioList);
+
+for (const button of document.querySelectorAll("nav button")) {
+  button.addEventListener("click", () => {
+    for (const other of document.querySelectorAll("nav button")) {
+      other.classList.toggle("active", other === button);
+    }
+    document.getElementById("lanes-view").hidden = button.dataset.view !== "lanes";
+    document.getElementById("scenarios-view").hidden = button.dataset.view !== "scenarios";
+  });
+}
+
+// Токен из адреса не оставляем в истории браузера
+if (location.search.includes("token=")) {
+  history.replaceState(null, "", location.pathname);
+}
+
+if (state.token) {
+  start();
+} else {
+  showLogin();
+}
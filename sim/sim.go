@@ -0,0 +1,225 @@
+package sim
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"tir/models"
+	"tir/protocol"
+)
+
+// Calibration калибровка скорости движения мишени
+type Calibration struct {
+	CMPerSecondPerUnit float64 // Скорость (см/с) на одну единицу параметра CMD_SET_SPEED
+	TurnSeconds        float64 // Время поворота мишени (сек)
+	ParkingCM          float64 // Положение парковки (см от линии огня)
+	SampleSeconds      float64 // Шаг точек временной шкалы при движении (сек)
+}
+
+// DefaultCalibration калибровка по умолчанию: скорость 50 - 1 м/с
+var DefaultCalibration = Calibration{
+	CMPerSecondPerUnit: 2,
+	TurnSeconds:        0.5,
+	ParkingCM:          0,
+	SampleSeconds:      1,
+}
+
+// Facing положение мишени
+type Facing string
+
+const (
+	FacingEdge  Facing = "ребро"
+	FacingEnemy Facing = "чужой"
+)
+
+// Point состояние мишени в момент времени
+type Point struct {
+	Time       float64 // Время от начала сценария (сек)
+	PositionCM float64 // Положение мишени (см от линии огня)
+	Facing     Facing
+	Light      bool
+	Event      string // Команда, начавшаяся в этот момент (пусто для промежуточных точек)
+}
+
+// Timeline результат симуляции
+type Timeline struct {
+	Points   []Point
+	Duration float64  // Общая длительность (сек)
+	Warnings []string // Что не удалось смоделировать
+}
+
+// Simulate строит временную шкалу положения, поворота и подсветки мишени
+func Simulate(scenario models.Scenario, cal Calibration) (Timeline, error) {
+	if cal.CMPerSecondPerUnit <= 0 {
+		return Timeline{}, fmt.Errorf("калибровка скорости должна быть больше нуля")
+	}
+	if cal.SampleSeconds <= 0 {
+		cal.SampleSeconds = DefaultCalibration.SampleSeconds
+	}
+
+	commands := scenario.Commands
+	if len(commands) == 0 && len(scenario.RawData) > 0 {
+		parsed, err := protocol.ParseScenarioData(scenario.RawData)
+		if err != nil {
+			return Timeline{}, fmt.Errorf("не удалось разобрать кадр: %v", err)
+		}
+		commands = parsed.Commands
+	}
+
+	var timeline Timeline
+	state := Point{PositionCM: cal.ParkingCM, Facing: FacingEdge}
+	var rangeCM, safeZoneCM float64
+	var speed float64
+
+	emit := func(event string) {
+		point := state
+		point.Event = event
+		timeline.Points = append(timeline.Points, point)
+	}
+
+	// Движение к цели с промежуточными точками
+	move := func(event string, target float64) {
+		if speed <= 0 {
+			timeline.Warnings = append(timeline.Warnings,
+				fmt.Sprintf("%s: скорость не задана, движение не смоделировано", event))
+			emit(event)
+			return
+		}
+
+		velocity := speed * cal.CMPerSecondPerUnit
+		start := state.PositionCM
+		duration := math.Abs(target-start) / velocity
+		startTime := state.Time
+
+		emit(event)
+		for t := cal.SampleSeconds; t < duration; t += cal.SampleSeconds {
+			state.Time = startTime + t
+			state.PositionCM = start + (target-start)*t/duration
+			emit("")
+		}
+		state.Time = startTime + duration
+		state.PositionCM = target
+		emit("")
+	}
+
+	emit("начало")
+	for _, cmd := range commands {
+		if cmd.IsRaw() {
+			continue
+		}
+
+		switch cmd.Code {
+		case models.CMD_SET_RANGE:
+			rangeCM = float64(cmd.ParamValue)
+		case models.CMD_SAFE_ZONE:
+			safeZoneCM = float64(cmd.ParamValue)
+		case models.CMD_SET_SPEED:
+			speed = float64(cmd.ParamValue)
+		case models.CMD_PAUSE:
+			emit(cmd.Name)
+			state.Time += float64(cmd.ParamValue)
+		case models.CMD_EDGE_POSITION, models.CMD_ENEMY_POSITION:
+			emit(cmd.Name)
+			state.Time += cal.TurnSeconds
+			if cmd.Code == models.CMD_EDGE_POSITION {
+				state.Facing = FacingEdge
+			} else {
+				state.Facing = FacingEnemy
+			}
+		case models.CMD_LIGHT_ON:
+			state.Light = true
+			emit(cmd.Name)
+		case models.CMD_LIGHT_OFF:
+			state.Light = false
+			emit(cmd.Name)
+		case models.CMD_MOVE_TO_RANGE:
+			move(cmd.Name, rangeCM)
+		case models.CMD_MOVE_TO_SHOOTER:
+			// К стрелку мишень подходит не ближе безопасной зоны
+			move(cmd.Name, safeZoneCM)
+		case models.CMD_PARKING:
+			move(cmd.Name, cal.ParkingCM)
+		}
+	}
+	emit("конец")
+
+	timeline.Duration = state.Time
+	return timeline, nil
+}
+
+// FormatDuration форматирует длительность в виде мм:сс.д
+func FormatDuration(seconds float64) string {
+	minutes := int(seconds) / 60
+	return fmt.Sprintf("%02d:%04.1f", minutes, seconds-float64(minutes*60))
+}
+
+// PrintTable выводит временную шкалу таблицей
+func PrintTable(w io.Writer, timeline Timeline) {
+	fmt.Fprintf(w, "%-9s %9s  %-6s %-5s %s\n", "Время", "Позиция", "Мишень", "Свет", "Событие")
+	for _, p := range timeline.Points {
+		light := "выкл"
+		if p.Light {
+			light = "вкл"
+		}
+		fmt.Fprintf(w, "%-9s %7.2f м  %-6s %-5s %s\n",
+			FormatDuration(p.Time), p.PositionCM/100, p.Facing, light, p.Event)
+	}
+	fmt.Fprintf(w, "Общая длительность: %s\n", FormatDuration(timeline.Duration))
+}
+
+// PrintChart выводит положение мишени во времени в виде ASCII-графика.
+// Символ мишени: '|' - в ребро, 'O' - в чужой; '*' после символа - подсветка включена
+func PrintChart(w io.Writer, timeline Timeline, width int) {
+	if width < 10 {
+		width = 10
+	}
+
+	maxPosition := 0.0
+	for _, p := range timeline.Points {
+		maxPosition = math.Max(maxPosition, p.PositionCM)
+	}
+	if maxPosition == 0 {
+		maxPosition = 100
+	}
+
+	fmt.Fprintf(w, "%-9s 0%s%.0f м\n", "Время", strings.Repeat(" ", width-1), maxPosition/100)
+	for _, p := range timeline.Points {
+		column := int(math.Round(p.PositionCM / maxPosition * float64(width)))
+		marker := "|"
+		if p.Facing == FacingEnemy {
+			marker = "O"
+		}
+		if p.Light {
+			marker += "*"
+		}
+		fmt.Fprintf(w, "%-9s %s%s %s\n", FormatDuration(p.Time), strings.Repeat(".", column), marker, p.Event)
+	}
+}
+
+// WriteCSV выгружает временную шкалу в CSV
+func WriteCSV(w io.Writer, timeline Timeline) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"time_s", "position_m", "facing", "light", "event"}); err != nil {
+		return err
+	}
+	for _, p := range timeline.Points {
+		light := "0"
+		if p.Light {
+			light = "1"
+		}
+		record := []string{
+			fmt.Sprintf("%.2f", p.Time),
+			fmt.Sprintf("%.2f", p.PositionCM/100),
+			string(p.Facing),
+			light,
+			p.Event,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
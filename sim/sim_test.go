@@ -0,0 +1,135 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+	"tir/models"
+	"tir/protocol"
+)
+
+// commands создает команды из пар код/параметр
+func commands(t *testing.T, codes ...uint16) []models.Command {
+	t.Helper()
+	var result []models.Command
+	for i := 0; i < len(codes); i += 2 {
+		cmd, err := models.NewCommand(codes[i], codes[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, cmd)
+	}
+	return result
+}
+
+func TestSimulate(t *testing.T) {
+	// Скорость 50 при калибровке по умолчанию - 1 м/с
+	tests := []struct {
+		name     string
+		codes    []uint16
+		duration float64
+		position float64 // Положение в конце (см)
+		facing   Facing
+		light    bool
+		warnings int
+	}{
+		{"выход на рубеж", []uint16{
+			models.CMD_SET_RANGE, 1000, models.CMD_SET_SPEED, 50, models.CMD_MOVE_TO_RANGE, 0},
+			10, 1000, FacingEdge, false, 0},
+		{"поворот", []uint16{
+			models.CMD_ENEMY_POSITION, 0},
+			0.5, 0, FacingEnemy, false, 0},
+		{"к стрелку до безопасной зоны", []uint16{
+			models.CMD_SET_RANGE, 1000, models.CMD_SAFE_ZONE, 300, models.CMD_SET_SPEED, 50,
+			models.CMD_MOVE_TO_RANGE, 0, models.CMD_MOVE_TO_SHOOTER, 0},
+			17, 300, FacingEdge, false, 0},
+		{"парковка", []uint16{
+			models.CMD_SET_RANGE, 500, models.CMD_SET_SPEED, 100,
+			models.CMD_MOVE_TO_RANGE, 0, models.CMD_PARKING, 0},
+			5, 0, FacingEdge, false, 0},
+		{"пауза и подсветка", []uint16{
+			models.CMD_LIGHT_ON, 0, models.CMD_PAUSE, 3},
+			3, 0, FacingEdge, true, 0},
+		{"скорость не задана", []uint16{
+			models.CMD_SET_RANGE, 1000, models.CMD_MOVE_TO_RANGE, 0},
+			0, 0, FacingEdge, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scenario := models.Scenario{PulseType: models.PULSE_1, Commands: commands(t, tt.codes...)}
+			timeline, err := Simulate(scenario, DefaultCalibration)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if timeline.Duration != tt.duration {
+				t.Errorf("длительность %.2f с, ожидалось %.2f", timeline.Duration, tt.duration)
+			}
+			last := timeline.Points[len(timeline.Points)-1]
+			if last.Event != "конец" || last.PositionCM != tt.position || last.Facing != tt.facing || last.Light != tt.light {
+				t.Errorf("в конце %+v, ожидалось %.0f см, %s, свет %v", last, tt.position, tt.facing, tt.light)
+			}
+			if len(timeline.Warnings) != tt.warnings {
+				t.Errorf("предупреждения %v, ожидалось %d", timeline.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestSimulateRawData(t *testing.T) {
+	scenario := models.Scenario{PulseType: models.PULSE_1, Commands: commands(t,
+		models.CMD_SET_RANGE, 1000, models.CMD_SET_SPEED, 50, models.CMD_MOVE_TO_RANGE, 0)}
+	scenario.RawData = protocol.GenerateScenarioPacket(scenario)
+	scenario.Commands = nil
+
+	// Без команд шкала строится по кадру; промежуточные точки - с шагом калибровки
+	timeline, err := Simulate(scenario, DefaultCalibration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeline.Duration != 10 {
+		t.Errorf("длительность %.2f с, ожидалось 10", timeline.Duration)
+	}
+	if len(timeline.Points) != 13 { // начало, выход, 9 промежуточных, прибытие, конец
+		t.Errorf("точек %d, ожидалось 13", len(timeline.Points))
+	}
+
+	if _, err := Simulate(scenario, Calibration{}); err == nil {
+		t.Error("нулевая калибровка скорости: ожидалась ошибка")
+	}
+	scenario.RawData = []byte{0x01, 0x02}
+	if _, err := Simulate(scenario, DefaultCalibration); err == nil {
+		t.Error("кадр не разбирается: ожидалась ошибка")
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		seconds float64
+		want    string
+	}{
+		{0, "00:00.0"},
+		{9.3, "00:09.3"},
+		{75.5, "01:15.5"},
+	}
+	for _, tt := range tests {
+		if got := FormatDuration(tt.seconds); got != tt.want {
+			t.Errorf("%.2f с: '%s', ожидалось '%s'", tt.seconds, got, tt.want)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	timeline := Timeline{Points: []Point{
+		{Time: 0, PositionCM: 0, Facing: FacingEdge, Event: "начало"},
+		{Time: 1.5, PositionCM: 150, Facing: FacingEnemy, Light: true},
+	}}
+	var buffer bytes.Buffer
+	if err := WriteCSV(&buffer, timeline); err != nil {
+		t.Fatal(err)
+	}
+	want := "time_s,position_m,facing,light,event\n" +
+		"0.00,0.00,ребро,0,начало\n" +
+		"1.50,1.50,чужой,1,\n"
+	if got := buffer.String(); got != want {
+		t.Errorf("CSV:\n%s\nожидалось:\n%s", got, want)
+	}
+}
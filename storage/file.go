@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"tir/logging"
 	"tir/models"
 	"tir/protocol"
 )
 
+var logger = logging.For("storage")
+
 // Сохранить сценарии в файл
 func SaveScenariosToFile(scenarios map[string]models.Scenario) {
 	fileName := "scenarios.txt"
@@ -29,49 +33,144 @@ func SaveScenariosToFile(scenarios map[string]models.Scenario) {
 
 	fmt.Printf("Сохранение сценариев в файл %s...\n", fileName)
 
+	if err := WriteScenariosTo(fileName, scenarios); err != nil {
+		fmt.Printf("Ошибка сохранения файла: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Сценарии успешно сохранены в файл %s\n", fileName)
+}
+
+// WriteScenariosTo записывает сценарии в указанный файл в порядке имен
+func WriteScenariosTo(fileName string, scenarios map[string]models.Scenario) error {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	var content strings.Builder
+	for _, name := range names {
+		content.WriteString(formatLine(name, scenarios[name]))
+		content.WriteString("\n")
+	}
 
-	// Сохраняем каждый сценарий в формате:
-	// [имя]:[тип пульта]:[HEX-данные]
-	for name, scenario := range scenarios {
-		content.WriteString(name)
-		content.WriteString(":")
-		content.WriteString(fmt.Sprintf("%d", scenario.PulseType))
-		content.WriteString(":")
+	return ioutil.WriteFile(fileName, []byte(content.String()), 0644)
+}
 
-		// Получаем данные сценария
-		var data []byte
-		if len(scenario.RawData) > 0 {
-			data = scenario.RawData
-		} else {
-			data = protocol.GenerateScenarioPacket(scenario)
+// UpdateScenariosFile вносит изменения в файл сценариев: строки сценариев из
+// changed заменяются на месте (новые добавляются в конец в порядке имен),
+// строки сценариев из removed удаляются. Остальные строки, в том числе
+// неразобранные, остаются как были; встроенные сценарии в файл не попадают
+func UpdateScenariosFile(fileName string, changed map[string]models.Scenario, removed []string) error {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	drop := make(map[string]bool, len(removed))
+	for _, name := range removed {
+		drop[name] = true
+	}
+	written := make(map[string]bool, len(changed))
+
+	var content strings.Builder
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, isScenario := lineScenarioName(line)
+		switch {
+		case !isScenario:
+		case drop[name]:
+			continue
+		case written[name]:
+			continue // Повтор заменяемого сценария
+		default:
+			if scenario, exists := changed[name]; exists {
+				line = formatLine(name, scenario)
+				written[name] = true
+			}
 		}
+		content.WriteString(line)
+		content.WriteString("\n")
+	}
 
-		// Сохраняем данные в HEX-формате
-		for _, b := range data {
-			content.WriteString(fmt.Sprintf(" %02X", b))
+	var added []string
+	for name := range changed {
+		if !written[name] {
+			added = append(added, name)
 		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		content.WriteString(formatLine(name, changed[name]))
 		content.WriteString("\n")
 	}
 
-	err := ioutil.WriteFile(fileName, []byte(content.String()), 0644)
-	if err != nil {
-		fmt.Printf("Ошибка сохранения файла: %v\n", err)
-		return
+	return ioutil.WriteFile(fileName, []byte(content.String()), 0644)
+}
+
+// formatLine записывает сценарий строкой файла в формате:
+// [имя]:[тип пульта]:[HEX-данные]
+// или, если у сценария есть метаданные:
+// [имя]:[тип пульта]:[метаданные]:[HEX-данные]
+func formatLine(name string, scenario models.Scenario) string {
+	var content strings.Builder
+	content.WriteString(name)
+	content.WriteString(":")
+	content.WriteString(fmt.Sprintf("%d", scenario.PulseType))
+	content.WriteString(":")
+	if metadata := formatMetadata(scenario); metadata != "" {
+		content.WriteString(metadata)
+		content.WriteString(":")
 	}
 
-	fmt.Printf("Сценарии успешно сохранены в файл %s\n", fileName)
+	// Получаем данные сценария
+	var data []byte
+	if len(scenario.RawData) > 0 {
+		data = scenario.RawData
+	} else {
+		data = protocol.GenerateScenarioPacket(scenario)
+	}
+
+	// Сохраняем данные в HEX-формате
+	for _, b := range data {
+		content.WriteString(fmt.Sprintf(" %02X", b))
+	}
+	return content.String()
+}
+
+// lineScenarioName возвращает имя сценария строки файла; false - строка
+// при загрузке пропускается из-за неверного формата
+func lineScenarioName(line string) (string, bool) {
+	parts := strings.SplitN(strings.TrimSpace(line), ":", 4)
+	var pulseType byte
+	if len(parts) >= 3 {
+		fmt.Sscanf(parts[1], "%d", &pulseType)
+	}
+	if pulseType < 1 || pulseType > 6 {
+		return "", false
+	}
+	return parts[0], true
 }
 
+// DefaultFileName файл сценариев по умолчанию
+const DefaultFileName = "scenarios.txt"
+
 // Загрузить сценарии из файла
 func LoadScenariosFromFile(scenarios map[string]models.Scenario) {
-	fileName := "scenarios.txt"
+	LoadScenariosFrom(DefaultFileName, scenarios)
+}
+
+// LoadScenariosFrom загружает сценарии из указанного файла
+func LoadScenariosFrom(fileName string, scenarios map[string]models.Scenario) {
 	data, err := ioutil.ReadFile(fileName)
 	if err != nil {
 		if os.IsNotExist(err) {
-			fmt.Printf("Файл %s не найден, будут использоваться только встроенные сценарии\n", fileName)
+			logger.Info("Файл сценариев не найден, используются только встроенные сценарии", "file", fileName)
 		} else {
-			fmt.Printf("Ошибка чтения файла %s: %v\n", fileName, err)
+			logger.Error("Ошибка чтения файла сценариев", "file", fileName, "error", err)
 		}
 		return
 	}
@@ -85,20 +184,26 @@ func LoadScenariosFromFile(scenarios map[string]models.Scenario) {
 			continue
 		}
 
-		// Разбираем строку формата: [имя]:[тип пульта]:[HEX-данные]
-		parts := strings.SplitN(line, ":", 3)
-		if len(parts) != 3 {
-			fmt.Printf("Некорректный формат строки: %s\n", line)
+		// Разбираем строку формата: [имя]:[тип пульта]:[метаданные (необязательно)]:[HEX-данные]
+		parts := strings.SplitN(line, ":", 4)
+		if len(parts) < 3 {
+			logger.Warn("Некорректный формат строки", "file", fileName, "line", line)
 			continue
 		}
 
+		var metadata string
+		if len(parts) == 4 {
+			metadata = parts[2]
+			parts = []string{parts[0], parts[1], parts[3]}
+		}
+
 		name := parts[0]
 
 		// Извлекаем тип пульта
 		var pulseType byte
 		fmt.Sscanf(parts[1], "%d", &pulseType)
 		if pulseType < 1 || pulseType > 6 {
-			fmt.Printf("Некорректный тип пульта в сценарии %s: %s\n", name, parts[1])
+			logger.Warn("Некорректный тип пульта", "scenario", name, "pulse", parts[1])
 			continue
 		}
 
@@ -110,7 +215,7 @@ func LoadScenariosFromFile(scenarios map[string]models.Scenario) {
 		for _, h := range hexBytes {
 			b, err := hex.DecodeString(h)
 			if err != nil {
-				fmt.Printf("Ошибка декодирования байта %s в сценарии %s: %v\n", h, name, err)
+				logger.Warn("Ошибка декодирования байта", "scenario", name, "byte", h, "error", err)
 				continue
 			}
 			scenarioData = append(scenarioData, b[0])
@@ -127,6 +232,18 @@ func LoadScenariosFromFile(scenarios map[string]models.Scenario) {
 		parsedScenario, err := protocol.ParseScenarioData(scenarioData)
 		if err == nil && len(parsedScenario.Commands) > 0 {
 			scenario.Commands = parsedScenario.Commands
+			scenario.Header = parsedScenario.Header
+		}
+
+		// Метаданные: сохраненные в файле, затем дистанция по декодированному рубежу
+		if err := parseMetadata(&scenario, metadata); err != nil {
+			logger.Warn("Ошибка в метаданных сценария", "scenario", name, "error", err)
+		}
+		protocol.FillMetadata(&scenario)
+
+		// Сценарии с недопустимыми параметрами загружаем, но предупреждаем о них
+		for _, err := range models.ValidateScenario(scenario) {
+			logger.Warn("Недопустимый параметр в сценарии", "scenario", name, "error", err)
 		}
 
 		// Сохраняем сценарий
@@ -134,5 +251,88 @@ func LoadScenariosFromFile(scenarios map[string]models.Scenario) {
 		loadedCount++
 	}
 
-	fmt.Printf("Загружено %d сценариев из файла %s\n", loadedCount, fileName)
+	logger.Info("Загружены сценарии из файла", "count", loadedCount, "file", fileName)
+}
+
+// formatMetadata записывает метаданные сценария в виде "ключ=значение;..."
+func formatMetadata(scenario models.Scenario) string {
+	var fields []string
+
+	// Дистанцию записываем только если ее нельзя получить из рубежа в кадре
+	if _, err := protocol.RangeDistance(scenario.Commands); err != nil && scenario.Distance > 0 {
+		fields = append(fields, fmt.Sprintf("distance=%d", scenario.Distance))
+	}
+	if scenario.Lane > 0 {
+		fields = append(fields, fmt.Sprintf("lane=%d", scenario.Lane))
+	}
+	if scenario.DrillType != "" {
+		fields = append(fields, "drill="+scenario.DrillType)
+	}
+	if len(scenario.Tags) > 0 {
+		fields = append(fields, "tags="+strings.Join(scenario.Tags, ","))
+	}
+	return strings.Join(fields, ";")
+}
+
+// parseMetadata разбирает метаданные, записанные formatMetadata
+func parseMetadata(scenario *models.Scenario, metadata string) error {
+	for _, field := range strings.Split(metadata, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("некорректное поле: %s", field)
+		}
+
+		switch kv[0] {
+		case "distance":
+			if _, err := fmt.Sscanf(kv[1], "%d", &scenario.Distance); err != nil {
+				return fmt.Errorf("некорректная дистанция: %s", kv[1])
+			}
+		case "lane":
+			if _, err := fmt.Sscanf(kv[1], "%d", &scenario.Lane); err != nil {
+				return fmt.Errorf("некорректный номер линии: %s", kv[1])
+			}
+		case "drill":
+			scenario.DrillType = kv[1]
+		case "tags":
+			scenario.Tags = nil
+			for _, tag := range strings.Split(kv[1], ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					scenario.Tags = append(scenario.Tags, tag)
+				}
+			}
+		default:
+			return fmt.Errorf("неизвестное поле: %s", kv[0])
+		}
+	}
+	return nil
+}
+
+// ScenarioNames возвращает имена сценариев из файла в порядке строк, включая
+// повторы (при загрузке сценарий из более поздней строки заменяет ранний),
+// и строки, которые при загрузке пропускаются из-за неверного формата
+func ScenarioNames(fileName string) (names []string, invalid []string, err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, isScenario := lineScenarioName(line)
+		if !isScenario {
+			invalid = append(invalid, line)
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, invalid, nil
 }
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"tir/models"
+)
+
+func TestUpdateScenariosFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "scenarios.txt")
+	original := "б:1: 7E 01\n" +
+		"неразобранная: 7E 00\n" +
+		"а:2: 7E 02\n" +
+		"б:1: 7E 03\n" +
+		"в:3: 7E 04\n"
+	if err := os.WriteFile(fileName, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := map[string]models.Scenario{
+		"б": {PulseType: 1, RawData: []byte{0x7E, 0x11}},
+		"д": {PulseType: 5, RawData: []byte{0x7E, 0x55}},
+		"г": {PulseType: 4, RawData: []byte{0x7E, 0x44}},
+	}
+	if err := UpdateScenariosFile(fileName, changed, []string{"в", "нет такого"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Измененный сценарий заменяет первую строку, повтор удаляется; неразобранная
+	// строка и нетронутый сценарий остаются; новые - в конце по именам
+	want := "б:1: 7E 11\n" +
+		"неразобранная: 7E 00\n" +
+		"а:2: 7E 02\n" +
+		"г:4: 7E 44\n" +
+		"д:5: 7E 55\n"
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("файл:\n%s\nожидался:\n%s", data, want)
+	}
+
+	// Файла нет - создается из новых сценариев
+	missing := filepath.Join(t.TempDir(), "new.txt")
+	if err := UpdateScenariosFile(missing, changed, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(missing); string(data) != "б:1: 7E 11\nг:4: 7E 44\nд:5: 7E 55\n" {
+		t.Errorf("новый файл:\n%s", data)
+	}
+}
@@ -0,0 +1,514 @@
+// Package tui реализует полноэкранный редактор сценариев для терминала
+package tui
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"tir/models"
+	"tir/protocol"
+	"unicode/utf8"
+)
+
+// MaxUndo наибольшая глубина истории отмены
+const MaxUndo = 100
+
+// mode режим редактора
+type mode int
+
+const (
+	modeList mode = iota // Перемещение по списку команд
+	modePick             // Выбор команды для добавления
+	modeEdit             // Ввод параметра команды
+)
+
+// Editor состояние полноэкранного редактора
+type Editor struct {
+	scenario models.Scenario
+	commands []models.Command
+	specs    []models.CommandSpec
+
+	cursor int // Текущая команда
+	offset int // Первая видимая команда
+	pick   int // Текущая команда в списке добавления
+	mode   mode
+	input  string // Вводимое значение параметра
+	fresh  bool   // Первая введенная цифра заменяет текущее значение
+	adding bool   // Параметр вводится для новой команды
+
+	undo [][]models.Command
+	redo [][]models.Command
+
+	dirty   bool
+	confirm bool // Повторное q выходит без сохранения
+	status  string
+
+	width, height int
+}
+
+// Run открывает редактор для сценария. Возвращает измененный сценарий
+// и true, если изменения сохранены клавишей s
+func Run(scenario models.Scenario) (models.Scenario, bool, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := makeRaw(fd)
+	if err != nil {
+		return scenario, false, err
+	}
+	defer restore(fd, state)
+
+	editor := &Editor{
+		scenario: scenario,
+		commands: append([]models.Command(nil), scenario.Commands...),
+		specs:    models.CommandSpecs(),
+	}
+
+	// Альтернативный экран, курсор скрыт
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	buffer := make([]byte, 64)
+	for {
+		editor.width, editor.height, err = terminalSize(fd)
+		if err != nil || editor.width <= 0 || editor.height <= 0 {
+			editor.width, editor.height = 80, 24
+		}
+		fmt.Print(editor.render())
+
+		n, err := os.Stdin.Read(buffer)
+		if err != nil {
+			return scenario, false, err
+		}
+
+		for _, event := range parseKeys(buffer[:n]) {
+			done, saved := editor.handle(event)
+			if done {
+				if saved {
+					edited := editor.scenario
+					edited.Commands = editor.commands
+					return edited, true, nil
+				}
+				return scenario, false, nil
+			}
+		}
+	}
+}
+
+// handle обрабатывает нажатие; возвращает done при выходе и saved при сохранении
+func (e *Editor) handle(event Event) (done bool, saved bool) {
+	if event.Key != KeyRune || event.Rune != 'q' {
+		e.confirm = false
+	}
+
+	switch e.mode {
+	case modePick:
+		e.handlePick(event)
+		return false, false
+	case modeEdit:
+		e.handleEdit(event)
+		return false, false
+	}
+
+	e.status = ""
+	switch event.Key {
+	case KeyUp:
+		e.moveCursor(-1)
+	case KeyDown:
+		e.moveCursor(1)
+	case KeyPageUp:
+		e.moveCursor(-e.listHeight())
+	case KeyPageDown:
+		e.moveCursor(e.listHeight())
+	case KeyHome:
+		e.moveCursor(-len(e.commands))
+	case KeyEnd:
+		e.moveCursor(len(e.commands))
+	case KeyEnter:
+		e.startEdit()
+	case KeyDelete:
+		e.deleteCommand()
+	case KeyCtrlZ:
+		e.undoChange()
+	case KeyCtrlY:
+		e.redoChange()
+	case KeyCtrlC, KeyEscape:
+		return e.quit()
+	case KeyRune:
+		switch event.Rune {
+		case 'a', '+', 'ф':
+			e.mode = modePick
+		case 'd', 'в':
+			e.deleteCommand()
+		case 'e', 'у':
+			e.startEdit()
+		case 'K', 'Л':
+			e.moveCommand(-1)
+		case 'J', 'О':
+			e.moveCommand(1)
+		case 'u', 'г':
+			e.undoChange()
+		case 'r', 'к':
+			e.redoChange()
+		case 's', 'ы':
+			if errs := e.validate(); len(errs) > 0 {
+				e.status = fmt.Sprintf("Сценарий не сохранен: %v", errs[0])
+				return false, false
+			}
+			return true, true
+		case 'q', 'й':
+			return e.quit()
+		}
+	}
+
+	return false, false
+}
+
+// quit выходит из редактора; при несохраненных изменениях требует подтверждения
+func (e *Editor) quit() (bool, bool) {
+	if e.dirty && !e.confirm {
+		e.confirm = true
+		e.status = "Есть несохраненные изменения: q - выйти без сохранения, s - сохранить"
+		return false, false
+	}
+	return true, false
+}
+
+// handlePick обрабатывает выбор команды для добавления
+func (e *Editor) handlePick(event Event) {
+	switch event.Key {
+	case KeyUp:
+		if e.pick > 0 {
+			e.pick--
+		}
+	case KeyDown:
+		if e.pick < len(e.specs)-1 {
+			e.pick++
+		}
+	case KeyEscape:
+		e.mode = modeList
+	case KeyEnter:
+		spec := e.specs[e.pick]
+		command, err := models.NewCommand(spec.Code, spec.Default)
+		if err != nil {
+			e.status = err.Error()
+			e.mode = modeList
+			return
+		}
+
+		// Новая команда вставляется после текущей
+		e.snapshot()
+		position := e.cursor + 1
+		if len(e.commands) == 0 {
+			position = 0
+		}
+		e.commands = append(e.commands, models.Command{})
+		copy(e.commands[position+1:], e.commands[position:])
+		e.commands[position] = command
+		e.cursor = position
+		e.mode = modeList
+
+		// Для команды с параметром сразу предлагаем ввести значение
+		if spec.HasParam() {
+			e.adding = true
+			e.startEdit()
+		}
+	}
+}
+
+// startEdit начинает ввод параметра текущей команды
+func (e *Editor) startEdit() {
+	if len(e.commands) == 0 {
+		return
+	}
+	cmd := e.commands[e.cursor]
+	if cmd.IsRaw() || !cmd.HasParam {
+		e.status = "У команды нет параметра"
+		return
+	}
+	e.input = strconv.Itoa(int(cmd.ParamValue))
+	e.fresh = true
+	e.mode = modeEdit
+}
+
+// handleEdit обрабатывает ввод параметра
+func (e *Editor) handleEdit(event Event) {
+	switch event.Key {
+	case KeyRune:
+		if e.fresh {
+			e.input = ""
+			e.fresh = false
+		}
+		if event.Rune >= '0' && event.Rune <= '9' && len(e.input) < 5 {
+			e.input += string(event.Rune)
+		}
+	case KeyBackspace:
+		e.fresh = false
+		if len(e.input) > 0 {
+			e.input = e.input[:len(e.input)-1]
+		}
+	case KeyEscape:
+		e.mode = modeList
+		e.adding = false
+	case KeyEnter:
+		value, err := strconv.ParseUint(e.input, 10, 16)
+		if err != nil {
+			e.status = "Введите число от 0 до 65535"
+			return
+		}
+
+		cmd := e.commands[e.cursor]
+		if spec, exists := models.LookupCommand(cmd.Code); exists {
+			if err := spec.ValidateParam(uint16(value)); err != nil {
+				e.status = err.Error()
+				return
+			}
+		}
+
+		if uint16(value) != cmd.ParamValue {
+			// Новая команда уже попала в историю при добавлении
+			if !e.adding {
+				e.snapshot()
+			}
+			e.commands[e.cursor].ParamValue = uint16(value)
+			e.dirty = true
+		}
+		e.mode = modeList
+		e.adding = false
+		e.status = ""
+	}
+}
+
+// moveCursor перемещает курсор по списку команд
+func (e *Editor) moveCursor(delta int) {
+	e.cursor += delta
+	if e.cursor >= len(e.commands) {
+		e.cursor = len(e.commands) - 1
+	}
+	if e.cursor < 0 {
+		e.cursor = 0
+	}
+}
+
+// moveCommand перемещает текущую команду вверх или вниз
+func (e *Editor) moveCommand(delta int) {
+	target := e.cursor + delta
+	if len(e.commands) == 0 || target < 0 || target >= len(e.commands) {
+		return
+	}
+	e.snapshot()
+	e.commands[e.cursor], e.commands[target] = e.commands[target], e.commands[e.cursor]
+	e.cursor = target
+}
+
+// deleteCommand удаляет текущую команду
+func (e *Editor) deleteCommand() {
+	if len(e.commands) == 0 {
+		return
+	}
+	e.snapshot()
+	e.commands = append(e.commands[:e.cursor], e.commands[e.cursor+1:]...)
+	e.moveCursor(0)
+}
+
+// snapshot сохраняет список команд перед изменением для отмены
+func (e *Editor) snapshot() {
+	e.undo = append(e.undo, append([]models.Command(nil), e.commands...))
+	if len(e.undo) > MaxUndo {
+		e.undo = e.undo[1:]
+	}
+	e.redo = nil
+	e.dirty = true
+}
+
+// undoChange отменяет последнее изменение
+func (e *Editor) undoChange() {
+	if len(e.undo) == 0 {
+		e.status = "Нечего отменять"
+		return
+	}
+	e.redo = append(e.redo, e.commands)
+	e.commands = e.undo[len(e.undo)-1]
+	e.undo = e.undo[:len(e.undo)-1]
+	e.dirty = true
+	e.moveCursor(0)
+}
+
+// redoChange повторяет отмененное изменение
+func (e *Editor) redoChange() {
+	if len(e.redo) == 0 {
+		e.status = "Нечего повторять"
+		return
+	}
+	e.undo = append(e.undo, e.commands)
+	e.commands = e.redo[len(e.redo)-1]
+	e.redo = e.redo[:len(e.redo)-1]
+	e.dirty = true
+	e.moveCursor(0)
+}
+
+// current возвращает сценарий с текущим списком команд
+func (e *Editor) current() models.Scenario {
+	scenario := e.scenario
+	scenario.Commands = e.commands
+	return scenario
+}
+
+// validate проверяет текущий список команд по реестру
+func (e *Editor) validate() []error {
+	return models.ValidateScenario(e.current())
+}
+
+// listHeight возвращает количество строк под список команд
+func (e *Editor) listHeight() int {
+	// Заголовок 2 строки, кадр, контрольная сумма, ошибки, статус и подсказка
+	frameLines := (len(protocol.GenerateScenarioPacket(e.current()))+15)/16 + 1
+	height := e.height - 2 - frameLines - 1 - 2 - 1 - 2
+	if height < 3 {
+		height = 3
+	}
+	return height
+}
+
+// render формирует содержимое экрана
+func (e *Editor) render() string {
+	var lines []string
+
+	title := fmt.Sprintf("Сценарий: %s   Пульт: %d   Команд: %d", e.scenario.Name, e.scenario.PulseType, len(e.commands))
+	if e.dirty {
+		title += "   [изменен]"
+	}
+	lines = append(lines, title, strings.Repeat("─", e.width))
+
+	if e.mode == modePick {
+		lines = append(lines, e.renderPick()...)
+	} else {
+		lines = append(lines, e.renderList()...)
+	}
+
+	// Кадр и контрольная сумма пересчитываются при каждом изменении
+	packet := protocol.GenerateScenarioPacket(e.current())
+	lines = append(lines, fmt.Sprintf("Кадр (%d байт):", len(packet)))
+	for i := 0; i < len(packet); i += 16 {
+		end := i + 16
+		if end > len(packet) {
+			end = len(packet)
+		}
+		lines = append(lines, fmt.Sprintf("  % X", packet[i:end]))
+	}
+	lines = append(lines, fmt.Sprintf("Контрольная сумма: %02X", packet[len(packet)-1]))
+
+	errs := e.validate()
+	switch {
+	case len(errs) == 1:
+		lines = append(lines, fmt.Sprintf("Ошибка: %v", errs[0]))
+	case len(errs) > 1:
+		lines = append(lines, fmt.Sprintf("Ошибок: %d, первая: %v", len(errs), errs[0]))
+	default:
+		lines = append(lines, "Ошибок нет")
+	}
+
+	switch e.mode {
+	case modeEdit:
+		lines = append(lines, fmt.Sprintf("Значение параметра: %s_   (Enter - принять, Esc - отмена)", e.input))
+	default:
+		lines = append(lines, e.status)
+	}
+
+	switch e.mode {
+	case modePick:
+		lines = append(lines, "↑↓ выбор, Enter - добавить после текущей, Esc - отмена")
+	case modeList:
+		lines = append(lines,
+			"↑↓ PgUp PgDn - выбор  a - добавить  d/Del - удалить  e/Enter - параметр  K/J - переместить",
+			"u/Ctrl+Z - отменить  r/Ctrl+Y - повторить  s - сохранить  q/Esc - выйти")
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	for i, line := range lines {
+		if i >= e.height {
+			break
+		}
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		// Выделенные строки уже обрезаны без учета управляющих последовательностей
+		if !strings.HasPrefix(line, "\x1b[") {
+			line = truncate(line, e.width)
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// renderList формирует строки списка команд с прокруткой к курсору
+func (e *Editor) renderList() []string {
+	height := e.listHeight()
+	if e.cursor < e.offset {
+		e.offset = e.cursor
+	}
+	if e.cursor >= e.offset+height {
+		e.offset = e.cursor - height + 1
+	}
+
+	lines := make([]string, 0, height)
+	if len(e.commands) == 0 {
+		lines = append(lines, "  (нет команд, a - добавить)")
+	}
+	for i := e.offset; i < len(e.commands) && i < e.offset+height; i++ {
+		cmd := e.commands[i]
+		text := fmt.Sprintf("%3d. %s", i+1, cmd.Name)
+		if cmd.HasParam && !cmd.IsRaw() {
+			text += fmt.Sprintf(" (%s: %d)", cmd.ParamName, cmd.ParamValue)
+		}
+		if err := models.ValidateCommand(cmd); err != nil {
+			text += "  !"
+		}
+
+		if i == e.cursor {
+			lines = append(lines, "\x1b[7m"+truncate("> "+text, e.width)+"\x1b[0m")
+		} else {
+			lines = append(lines, "  "+text)
+		}
+	}
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+// renderPick формирует строки списка команд для добавления
+func (e *Editor) renderPick() []string {
+	height := e.listHeight()
+	start := 0
+	if e.pick >= height {
+		start = e.pick - height + 1
+	}
+
+	lines := make([]string, 0, height)
+	for i := start; i < len(e.specs) && i < start+height; i++ {
+		spec := e.specs[i]
+		text := fmt.Sprintf("0x%04X %s", spec.Code, spec.Name)
+		if spec.HasParam() {
+			text += fmt.Sprintf(" (%s %d-%d %s)", spec.ParamName, spec.Min, spec.Max, spec.Unit)
+		}
+		if i == e.pick {
+			lines = append(lines, "\x1b[7m"+truncate("> "+text, e.width)+"\x1b[0m")
+		} else {
+			lines = append(lines, "  "+text)
+		}
+	}
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+// truncate обрезает строку до ширины экрана в символах
+func truncate(line string, width int) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	runes := []rune(line)
+	return string(runes[:width])
+}
@@ -0,0 +1,106 @@
+package tui
+
+import "unicode/utf8"
+
+// Key клавиша
+type Key int
+
+const (
+	KeyRune Key = iota // Печатный символ
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyHome
+	KeyEnd
+	KeyPageUp
+	KeyPageDown
+	KeyEnter
+	KeyBackspace
+	KeyDelete
+	KeyEscape
+	KeyTab
+	KeyCtrlC
+	KeyCtrlY
+	KeyCtrlZ
+	KeyUnknown
+)
+
+// Event нажатие клавиши
+type Event struct {
+	Key  Key
+	Rune rune
+}
+
+// Управляющие последовательности клавиш после ESC
+var escapeSequences = map[string]Key{
+	"[A": KeyUp, "[B": KeyDown, "[C": KeyRight, "[D": KeyLeft,
+	"OA": KeyUp, "OB": KeyDown, "OC": KeyRight, "OD": KeyLeft,
+	"[H": KeyHome, "[F": KeyEnd, "OH": KeyHome, "OF": KeyEnd,
+	"[1~": KeyHome, "[4~": KeyEnd, "[7~": KeyHome, "[8~": KeyEnd,
+	"[3~": KeyDelete, "[5~": KeyPageUp, "[6~": KeyPageDown,
+}
+
+// parseKeys разбирает прочитанные из терминала байты в нажатия клавиш.
+// Терминал передает последовательность клавиши одной записью, поэтому
+// одиночный ESC в конце буфера считается клавишей Esc
+func parseKeys(data []byte) []Event {
+	var events []Event
+
+	for i := 0; i < len(data); {
+		b := data[i]
+		switch {
+		case b == 0x1B:
+			if i+1 >= len(data) {
+				events = append(events, Event{Key: KeyEscape})
+				i++
+				continue
+			}
+			// Последовательность ESC [ ... или ESC O ... заканчивается буквой или ~
+			end := i + 2
+			if data[i+1] == '[' || data[i+1] == 'O' {
+				end++
+			}
+			if end > len(data) {
+				end = len(data)
+			}
+			for end < len(data) && !isFinalByte(data[end-1]) {
+				end++
+			}
+			if key, known := escapeSequences[string(data[i+1:end])]; known {
+				events = append(events, Event{Key: key})
+			} else {
+				events = append(events, Event{Key: KeyUnknown})
+			}
+			i = end
+			continue
+		case b == '\r' || b == '\n':
+			events = append(events, Event{Key: KeyEnter})
+		case b == 0x7F || b == 0x08:
+			events = append(events, Event{Key: KeyBackspace})
+		case b == '\t':
+			events = append(events, Event{Key: KeyTab})
+		case b == 0x03:
+			events = append(events, Event{Key: KeyCtrlC})
+		case b == 0x19:
+			events = append(events, Event{Key: KeyCtrlY})
+		case b == 0x1A:
+			events = append(events, Event{Key: KeyCtrlZ})
+		case b < 0x20:
+			events = append(events, Event{Key: KeyUnknown})
+		default:
+			r, size := utf8.DecodeRune(data[i:])
+			events = append(events, Event{Key: KeyRune, Rune: r})
+			i += size
+			continue
+		}
+		i++
+	}
+
+	return events
+}
+
+// isFinalByte проверяет, завершает ли байт управляющую последовательность
+func isFinalByte(b byte) bool {
+	return (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || b == '~'
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !windows
+
+package tui
+
+import "errors"
+
+// termState не используется на платформах без поддержки
+type termState struct{}
+
+var errUnsupported = errors.New("полноэкранный редактор не поддерживается на этой платформе")
+
+func makeRaw(fd int) (*termState, error) {
+	return nil, errUnsupported
+}
+
+func restore(fd int, state *termState) error {
+	return errUnsupported
+}
+
+func terminalSize(fd int) (int, int, error) {
+	return 0, 0, errUnsupported
+}
@@ -0,0 +1,78 @@
+//go:build windows
+
+package tui
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procGetConsoleMode             = kernel32.NewProc("GetConsoleMode")
+	procSetConsoleMode             = kernel32.NewProc("SetConsoleMode")
+	procGetConsoleScreenBufferInfo = kernel32.NewProc("GetConsoleScreenBufferInfo")
+)
+
+const (
+	ENABLE_PROCESSED_INPUT             = 0x0001
+	ENABLE_LINE_INPUT                  = 0x0002
+	ENABLE_ECHO_INPUT                  = 0x0004
+	ENABLE_VIRTUAL_TERMINAL_INPUT      = 0x0200
+	ENABLE_VIRTUAL_TERMINAL_PROCESSING = 0x0004
+)
+
+// termState исходные режимы консоли
+type termState struct {
+	inMode, outMode uint32
+}
+
+type consoleScreenBufferInfo struct {
+	SizeX, SizeY               int16
+	CursorX, CursorY           int16
+	Attributes                 uint16
+	Left, Top, Right, Bottom   int16
+	MaximumSizeX, MaximumSizeY int16
+}
+
+// makeRaw переводит консоль в посимвольный режим с управляющими последовательностями
+func makeRaw(fd int) (*termState, error) {
+	var state termState
+	out := os.Stdout.Fd()
+
+	if r, _, err := procGetConsoleMode.Call(uintptr(fd), uintptr(unsafe.Pointer(&state.inMode))); r == 0 {
+		return nil, os.NewSyscallError("GetConsoleMode", err)
+	}
+	if r, _, err := procGetConsoleMode.Call(out, uintptr(unsafe.Pointer(&state.outMode))); r == 0 {
+		return nil, os.NewSyscallError("GetConsoleMode", err)
+	}
+
+	inMode := state.inMode&^(ENABLE_PROCESSED_INPUT|ENABLE_LINE_INPUT|ENABLE_ECHO_INPUT) |
+		ENABLE_VIRTUAL_TERMINAL_INPUT
+	if r, _, err := procSetConsoleMode.Call(uintptr(fd), uintptr(inMode)); r == 0 {
+		return nil, os.NewSyscallError("SetConsoleMode", err)
+	}
+	procSetConsoleMode.Call(out, uintptr(state.outMode|ENABLE_VIRTUAL_TERMINAL_PROCESSING))
+
+	return &state, nil
+}
+
+// restore возвращает исходные режимы консоли
+func restore(fd int, state *termState) error {
+	procSetConsoleMode.Call(os.Stdout.Fd(), uintptr(state.outMode))
+	if r, _, err := procSetConsoleMode.Call(uintptr(fd), uintptr(state.inMode)); r == 0 {
+		return os.NewSyscallError("SetConsoleMode", err)
+	}
+	return nil
+}
+
+// terminalSize возвращает ширину и высоту окна консоли
+func terminalSize(fd int) (int, int, error) {
+	var info consoleScreenBufferInfo
+	if r, _, err := procGetConsoleScreenBufferInfo.Call(os.Stdout.Fd(), uintptr(unsafe.Pointer(&info))); r == 0 {
+		return 0, 0, os.NewSyscallError("GetConsoleScreenBufferInfo", err)
+	}
+	return int(info.Right-info.Left) + 1, int(info.Bottom-info.Top) + 1, nil
+}
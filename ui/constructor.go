@@ -71,6 +71,9 @@ func ScenarioConstructor(scenarios map[string]models.Scenario) {
 		Name:      scenarioName,
 		PulseType: originalScenario.PulseType,
 		RawData:   make([]byte, len(originalScenario.RawData)),
+		Distance:  originalScenario.Distance,
+		DrillType: originalScenario.DrillType,
+		Tags:      append([]string(nil), originalScenario.Tags...),
 	}
 
 	// Копируем данные
@@ -154,6 +157,9 @@ func GenerateRangeScenarios(scenarios map[string]models.Scenario) {
 			Name:      name,
 			PulseType: originalScenario.PulseType,
 			RawData:   make([]byte, len(originalScenario.RawData)),
+			Distance:  originalScenario.Distance,
+			DrillType: originalScenario.DrillType,
+			Tags:      append([]string(nil), originalScenario.Tags...),
 		}
 
 		// Копируем данные
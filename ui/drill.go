@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"tir/drill"
+	"tir/models"
+)
+
+// ExpandDrill разворачивает упражнение из файла в кадры и добавляет их в список сценариев
+func ExpandDrill(scenarios map[string]models.Scenario) {
+	fmt.Println("\nРазвертывание упражнения")
+	fmt.Println("========================")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	fmt.Print("Введите имя файла упражнения (JSON): ")
+	scanner.Scan()
+	fileName := strings.TrimSpace(scanner.Text())
+
+	d, err := drill.Load(fileName)
+	if err != nil {
+		fmt.Printf("Ошибка загрузки упражнения: %v\n", err)
+		return
+	}
+
+	frames, err := drill.Expand(d)
+	if err != nil {
+		fmt.Printf("Ошибка развертывания: %v\n", err)
+		return
+	}
+
+	PrintDrillFrames(frames)
+
+	fmt.Print("Добавить кадры в список сценариев? (да/нет): ")
+	scanner.Scan()
+	answer := strings.TrimSpace(scanner.Text())
+	if answer != "да" && answer != "д" && answer != "yes" && answer != "y" {
+		return
+	}
+
+	for _, frame := range frames {
+		if _, exists := scenarios[frame.Scenario.Name]; exists {
+			fmt.Printf("Сценарий '%s' заменен\n", frame.Scenario.Name)
+		}
+		scenarios[frame.Scenario.Name] = frame.Scenario
+	}
+	fmt.Printf("Добавлено кадров: %d. Для записи в файл используйте сохранение сценариев\n", len(frames))
+}
+
+// PrintDrillFrames выводит развернутые кадры упражнения с предупреждениями
+func PrintDrillFrames(frames []drill.Frame) {
+	for _, frame := range frames {
+		fmt.Printf("\n%s: %d команд, %d байт\n",
+			frame.Scenario.Name, len(frame.Scenario.Commands), len(frame.Scenario.RawData))
+		fmt.Printf("  % X\n", frame.Scenario.RawData)
+		for _, warning := range frame.Warnings {
+			fmt.Printf("  Предупреждение: %s\n", warning)
+		}
+	}
+}
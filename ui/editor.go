@@ -4,8 +4,11 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"tir/models"
 	"tir/protocol"
+	"tir/tui"
 )
 
 // EditScenario позволяет редактировать существующий сценарий
@@ -55,6 +58,13 @@ func EditScenario(scenarios map[string]models.Scenario) {
 				RawData:   scenario.RawData, // Сохраняем оригинальные данные
 			}
 		} else {
+			// Сохраняем исходные данные: без правок кадр будет сгенерирован байт в байт
+			parsedScenario.Name = selectedName
+			parsedScenario.RawData = scenario.RawData
+			parsedScenario.Distance = scenario.Distance
+			parsedScenario.Lane = scenario.Lane
+			parsedScenario.DrillType = scenario.DrillType
+			parsedScenario.Tags = scenario.Tags
 			scenario = parsedScenario
 		}
 	}
@@ -79,6 +89,8 @@ func EditScenario(scenarios map[string]models.Scenario) {
 		fmt.Println("5. Изменить тип пульта")
 		fmt.Println("6. Сохранить и выйти")
 		fmt.Println("7. Выйти без сохранения")
+		fmt.Println("8. Изменить метаданные (дистанция, линия, тип упражнения, метки)")
+		fmt.Println("9. Полноэкранный редактор команд")
 
 		var editChoice string
 		fmt.Print("Выберите действие: ")
@@ -118,6 +130,10 @@ func EditScenario(scenarios map[string]models.Scenario) {
 				delete(scenarios, selectedName)
 				selectedName = newName
 				scenario.Name = newName
+				if len(scenario.Header) > 0 {
+					// Имя в кадре тоже меняется
+					scenario.Header = protocol.RebuildHeader(scenario.Header, newName, scenario.PulseType)
+				}
 				scenarios[newName] = scenario
 				fmt.Printf("Имя сценария изменено на '%s'\n", newName)
 			} else {
@@ -137,32 +153,132 @@ func EditScenario(scenarios map[string]models.Scenario) {
 			}
 		case "6":
 			// Сохранить и выйти
-			// Генерируем бинарный пакет
-			scenario.RawData = protocol.GenerateScenarioPacket(scenario)
-			scenarios[selectedName] = scenario
-			fmt.Printf("Сценарий '%s' успешно сохранен\n", selectedName)
-			return
+			if saveEditedScenario(scenarios, selectedName, &scenario) {
+				return
+			}
 		case "7":
 			// Выйти без сохранения
 			fmt.Println("Изменения отменены")
 			return
+		case "8":
+			// Изменить метаданные
+			editScenarioMetadata(&scenario)
+		case "9":
+			// Полноэкранный редактор: сохранение в нем сохраняет сценарий
+			edited, saved, err := tui.Run(scenario)
+			if err != nil {
+				fmt.Printf("Полноэкранный редактор недоступен: %v\n", err)
+				continue
+			}
+			if !saved {
+				fmt.Println("Изменения в полноэкранном редакторе отменены")
+				continue
+			}
+			scenario = edited
+			if saveEditedScenario(scenarios, selectedName, &scenario) {
+				return
+			}
 		default:
 			fmt.Println("Неверный выбор, попробуйте снова")
 		}
 	}
 }
 
+// saveEditedScenario проверяет сценарий по реестру, генерирует кадр и сохраняет его.
+// Возвращает false, если сценарий содержит ошибки
+func saveEditedScenario(scenarios map[string]models.Scenario, name string, scenario *models.Scenario) bool {
+	// Проверяем команды по реестру перед генерацией пакета
+	if errs := models.ValidateScenario(*scenario); len(errs) > 0 {
+		fmt.Println("Сценарий не сохранен, исправьте ошибки:")
+		for _, err := range errs {
+			fmt.Printf("  %v\n", err)
+		}
+		return false
+	}
+
+	// Генерируем бинарный пакет
+	scenario.RawData = protocol.GenerateScenarioPacket(*scenario)
+	protocol.FillMetadata(scenario)
+	scenarios[name] = *scenario
+	fmt.Printf("Сценарий '%s' успешно сохранен\n", name)
+	return true
+}
+
+// Изменить метаданные сценария
+func editScenarioMetadata(scenario *models.Scenario) {
+	scanner := bufio.NewScanner(os.Stdin)
+
+	// Дистанция задается вручную только если в сценарии нет команды установки рубежа
+	if _, err := protocol.RangeDistance(scenario.Commands); err == nil {
+		fmt.Printf("Дистанция определяется рубежом: %d м\n", scenario.Distance)
+	} else {
+		fmt.Printf("Дистанция, м (сейчас %d; Enter - без изменений): ", scenario.Distance)
+		scanner.Scan()
+		if input := strings.TrimSpace(scanner.Text()); input != "" {
+			var distance int
+			if _, err := fmt.Sscanf(input, "%d", &distance); err == nil && distance >= 0 {
+				scenario.Distance = distance
+			} else {
+				fmt.Println("Некорректная дистанция, значение не изменено")
+			}
+		}
+	}
+
+	fmt.Printf("Номер линии (сейчас %d, 0 - любая; Enter - без изменений): ", scenario.Lane)
+	scanner.Scan()
+	if input := strings.TrimSpace(scanner.Text()); input != "" {
+		var lane int
+		if _, err := fmt.Sscanf(input, "%d", &lane); err == nil && lane >= 0 && lane <= 6 {
+			scenario.Lane = lane
+		} else {
+			fmt.Println("Некорректный номер линии, значение не изменено")
+		}
+	}
+
+	fmt.Printf("Тип упражнения (сейчас '%s'; Enter - без изменений, '-' - очистить): ", scenario.DrillType)
+	scanner.Scan()
+	if input := cleanMetadataValue(scanner.Text()); input == "-" {
+		scenario.DrillType = ""
+	} else if input != "" {
+		scenario.DrillType = input
+	}
+
+	fmt.Printf("Метки через запятую (сейчас '%s'; Enter - без изменений, '-' - очистить): ",
+		strings.Join(scenario.Tags, ","))
+	scanner.Scan()
+	if input := cleanMetadataValue(scanner.Text()); input == "-" {
+		scenario.Tags = nil
+	} else if input != "" {
+		scenario.Tags = nil
+		for _, tag := range strings.Split(input, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				scenario.Tags = append(scenario.Tags, tag)
+			}
+		}
+	}
+
+	fmt.Println("Метаданные обновлены")
+}
+
+// cleanMetadataValue убирает символы-разделители формата файла сценариев
+func cleanMetadataValue(value string) string {
+	value = strings.ReplaceAll(value, ":", " ")
+	value = strings.ReplaceAll(value, ";", " ")
+	return strings.TrimSpace(value)
+}
+
 // Добавить команду в сценарий
 func addCommandToScenario(scenario *models.Scenario) {
 	fmt.Println("\nДоступные команды:")
 
-	// Вывод списка простых команд
-	i := 1
-	var commandNames []string
-	for name := range models.CommandMap {
-		fmt.Printf("%d. %s\n", i, name)
-		commandNames = append(commandNames, name)
-		i++
+	// Вывод списка команд из реестра (в постоянном порядке)
+	specs := models.CommandSpecs()
+	for i, spec := range specs {
+		if spec.HasParam() {
+			fmt.Printf("%d. %s (%s, %d-%d %s)\n", i+1, spec.Name, spec.ParamName, spec.Min, spec.Max, spec.Unit)
+		} else {
+			fmt.Printf("%d. %s\n", i+1, spec.Name)
+		}
 	}
 
 	// Выбор команды
@@ -170,32 +286,38 @@ func addCommandToScenario(scenario *models.Scenario) {
 	fmt.Print("Выберите команду (номер): ")
 	fmt.Scanln(&cmdChoice)
 
-	if cmdChoice < 1 || cmdChoice > len(commandNames) {
+	if cmdChoice < 1 || cmdChoice > len(specs) {
 		fmt.Println("Неверный выбор, команда не добавлена")
 		return
 	}
 
 	// Получаем выбранную команду
-	selectedCmd := commandNames[cmdChoice-1]
-	cmdCode := models.CommandMap[selectedCmd]
+	spec := specs[cmdChoice-1]
+	if spec.Notes != "" {
+		fmt.Printf("Примечание: %s\n", spec.Notes)
+	}
 
-	// Создаем объект команды
-	command := models.Command{
-		Name: selectedCmd,
-		Code: cmdCode,
+	// Запрашиваем значение параметра, если команда его требует
+	paramValue := spec.Default
+	if spec.HasParam() {
+		fmt.Printf("Введите %s (%d-%d %s, по умолчанию %d): ", spec.ParamName, spec.Min, spec.Max, spec.Unit, spec.Default)
+		var input string
+		fmt.Scanln(&input)
+		if input != "" {
+			value, err := strconv.ParseUint(input, 10, 16)
+			if err != nil {
+				fmt.Printf("Некорректное значение '%s', команда не добавлена\n", input)
+				return
+			}
+			paramValue = uint16(value)
+		}
 	}
 
-	// Проверяем, требует ли команда параметр
-	_, hasParam := models.ParamCommands[cmdCode]
-	if hasParam {
-		command.HasParam = true
-		command.ParamName = models.ParamCommands[cmdCode]
-
-		// Запрашиваем значение параметра
-		fmt.Printf("Введите %s: ", command.ParamName)
-		var paramValue uint16
-		fmt.Scanln(&paramValue)
-		command.ParamValue = paramValue
+	// Создаем объект команды с проверкой параметра по реестру
+	command, err := models.NewCommand(spec.Code, paramValue)
+	if err != nil {
+		fmt.Printf("Ошибка: %v. Команда не добавлена\n", err)
+		return
 	}
 
 	// Выбираем позицию для вставки
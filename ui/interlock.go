@@ -0,0 +1,81 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"tir/interlock"
+	"tir/models"
+)
+
+// InterlockMenu показывает блокировки линий и позволяет взвести или снять линии
+func InterlockMenu() {
+	for {
+		fmt.Println("\nБлокировки движения мишеней")
+		fmt.Println("===========================")
+		PrintInterlockStatus()
+
+		fmt.Print("Введите +N - взвести линию, -N - снять со взвода (Enter - назад): ")
+		var input string
+		fmt.Scanln(&input)
+		input = strings.TrimSpace(input)
+		if input == "" {
+			return
+		}
+
+		lane, err := strconv.Atoi(input[1:])
+		if err != nil {
+			fmt.Println("Неверный номер линии")
+			continue
+		}
+
+		switch input[0] {
+		case '+':
+			err = interlock.Arm(lane)
+		case '-':
+			err = interlock.Disarm(lane)
+		default:
+			fmt.Println("Укажите + или - перед номером линии")
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Ошибка: %v\n", err)
+		}
+	}
+}
+
+// PrintInterlockStatus выводит состояние блокировок по линиям
+func PrintInterlockStatus() {
+	settings := interlock.Settings()
+	fmt.Printf("Безопасная зона не менее %d см, пауза между движениями %.0f с\n",
+		settings.MinSafeZoneCM, settings.Cooldown.Seconds())
+
+	states, err := interlock.States()
+	if err != nil {
+		fmt.Printf("Ошибка чтения состояния линий: %v\n", err)
+		return
+	}
+
+	for lane := models.PULSE_1; lane <= models.PULSE_6; lane++ {
+		state := states[lane]
+		armed := "не взведена"
+		if state.Armed {
+			armed = "взведена с " + state.ArmedAt.Format("15:04:05")
+		}
+
+		hot := "правило отключено"
+		if isHot, known, err := interlock.RangeHot(lane); err != nil {
+			hot = "ошибка: " + err.Error()
+		} else if known && isHot {
+			hot = "стрельба"
+		} else if known {
+			hot = "не горячее"
+		}
+
+		lastMotion := "-"
+		if !state.LastMotion.IsZero() {
+			lastMotion = state.LastMotion.Format("15:04:05")
+		}
+		fmt.Printf("Линия %d: %s; стрельбище: %s; последнее движение: %s\n", lane, armed, hot, lastMotion)
+	}
+}
@@ -39,8 +39,25 @@ func ShowScenarios(scenarios map[string]models.Scenario) {
 		return
 	}
 
+	// Фильтр по метаданным сценария
+	fmt.Print("Фильтр (например, пульт=2 дистанция=15 линия=1 тип=... метка=...; Enter - все): ")
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	filter, err := parseScenarioFilter(scanner.Text())
+	if err != nil {
+		fmt.Printf("Ошибка в фильтре: %v\n", err)
+		return
+	}
+
+	shown := 0
 	for name, scenario := range scenarios {
+		if !filter.matches(scenario) {
+			continue
+		}
+		shown++
+
 		fmt.Printf("\nСценарий: %s (Пульт: %d)\n", name, scenario.PulseType)
+		printScenarioMetadata(scenario)
 
 		// Показываем команды, если они есть
 		if len(scenario.Commands) > 0 {
@@ -76,6 +93,92 @@ func ShowScenarios(scenarios map[string]models.Scenario) {
 			fmt.Println()
 		}
 	}
+
+	if shown == 0 {
+		fmt.Println("Нет сценариев, подходящих под фильтр")
+	}
+}
+
+// scenarioFilter условия отбора сценариев по метаданным (нулевые значения - любое)
+type scenarioFilter struct {
+	pulseType byte
+	distance  int
+	lane      int
+	drillType string
+	tag       string
+}
+
+// parseScenarioFilter разбирает фильтр вида "пульт=2 дистанция=15 метка=ночь"
+func parseScenarioFilter(input string) (scenarioFilter, error) {
+	var filter scenarioFilter
+	for _, field := range strings.Fields(input) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return filter, fmt.Errorf("ожидается ключ=значение: %s", field)
+		}
+
+		var err error
+		switch kv[0] {
+		case "пульт":
+			var pulseType int
+			_, err = fmt.Sscanf(kv[1], "%d", &pulseType)
+			filter.pulseType = byte(pulseType)
+		case "дистанция":
+			_, err = fmt.Sscanf(kv[1], "%d", &filter.distance)
+		case "линия":
+			_, err = fmt.Sscanf(kv[1], "%d", &filter.lane)
+		case "тип":
+			filter.drillType = kv[1]
+		case "метка":
+			filter.tag = kv[1]
+		default:
+			return filter, fmt.Errorf("неизвестный ключ: %s", kv[0])
+		}
+		if err != nil {
+			return filter, fmt.Errorf("некорректное значение: %s", field)
+		}
+	}
+	return filter, nil
+}
+
+// matches проверяет, подходит ли сценарий под фильтр
+func (f scenarioFilter) matches(scenario models.Scenario) bool {
+	if f.pulseType != 0 && scenario.PulseType != f.pulseType {
+		return false
+	}
+	if f.distance != 0 && scenario.Distance != f.distance {
+		return false
+	}
+	if f.lane != 0 && scenario.Lane != f.lane {
+		return false
+	}
+	if f.drillType != "" && scenario.DrillType != f.drillType {
+		return false
+	}
+	if f.tag != "" && !scenario.HasTag(f.tag) {
+		return false
+	}
+	return true
+}
+
+// printScenarioMetadata выводит заданные метаданные сценария
+func printScenarioMetadata(scenario models.Scenario) {
+	var fields []string
+	if scenario.Distance > 0 {
+		fields = append(fields, fmt.Sprintf("дистанция %d м", scenario.Distance))
+	}
+	if scenario.Lane > 0 {
+		fields = append(fields, fmt.Sprintf("линия %d", scenario.Lane))
+	}
+	if scenario.DrillType != "" {
+		fields = append(fields, "тип: "+scenario.DrillType)
+	}
+	if len(scenario.Tags) > 0 {
+		fields = append(fields, "метки: "+strings.Join(scenario.Tags, ", "))
+	}
+	if len(fields) > 0 {
+		fmt.Printf("Метаданные: %s\n", strings.Join(fields, "; "))
+	}
 }
 
 // ImportScenarioFromHex импортирует сценарий из HEX-строки
@@ -187,7 +290,19 @@ func ImportScenarioFromHex(scenarios map[string]models.Scenario) {
 				fmt.Printf("%d. %s\n", i+1, cmd.Name)
 			}
 		}
+
+		// Проверяем параметры команд по реестру
+		for _, err := range models.ValidateScenario(parsedScenario) {
+			fmt.Printf("Предупреждение: %v\n", err)
+		}
+	}
+
+	// Заполняем метаданные по декодированному рубежу
+	scenario := scenarios[name]
+	if err := protocol.FillMetadata(&scenario); err == nil {
+		fmt.Printf("Дистанция по рубежу: %d м\n", scenario.Distance)
 	}
+	scenarios[name] = scenario
 
 	fmt.Printf("Сценарий '%s' успешно импортирован (%d байт)\n", name, len(data))
 }
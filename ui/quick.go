@@ -63,6 +63,9 @@ func QuickCreateScenario(scenarios map[string]models.Scenario) {
 				Name:      copyName,
 				PulseType: originalScenario.PulseType,
 				RawData:   make([]byte, len(originalScenario.RawData)),
+				Distance:  originalScenario.Distance,
+				DrillType: originalScenario.DrillType,
+				Tags:      append([]string(nil), originalScenario.Tags...),
 			}
 
 			// Копируем данные
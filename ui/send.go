@@ -3,20 +3,24 @@ package ui
 import (
 	"fmt"
 	"time"
+	"tir/audit"
 	"tir/comport"
+	"tir/interlock"
+	"tir/lint"
 	"tir/models"
+	"tir/sender"
 )
 
 // SendScenario подключается к COM-порту и отправляет выбранный сценарий
 func SendScenario(scenarios map[string]models.Scenario) {
+	if sender.EmergencyActive() {
+		fmt.Println(sender.ErrEmergencyStop)
+		return
+	}
+
 	// Выбор порта
-	portName := "COM4" // По умолчанию COM4
-	fmt.Print("Введите имя порта (по умолчанию COM4): ")
+	portName := comport.PromptPort("COM4")
 	var input string
-	fmt.Scanln(&input)
-	if input != "" {
-		portName = input
-	}
 
 	// Выбор скорости
 	baudRate := uint32(4800) // По умолчанию 4800 бод
@@ -30,8 +34,70 @@ func SendScenario(scenarios map[string]models.Scenario) {
 		}
 	}
 
+	// Выбор сценария для отправки
+	fmt.Println("Доступные сценарии:")
+	var scenarioNames []string
+	i := 1
+	for name := range scenarios {
+		fmt.Printf("%d. %s\n", i, name)
+		scenarioNames = append(scenarioNames, name)
+		i++
+	}
+
+	if len(scenarioNames) == 0 {
+		fmt.Println("Нет доступных сценариев для отправки")
+		return
+	}
+
+	fmt.Print("Выберите номер сценария для отправки: ")
+	var scenarioChoice int
+	fmt.Scanln(&scenarioChoice)
+
+	if scenarioChoice < 1 || scenarioChoice > len(scenarioNames) {
+		fmt.Println("Неверный выбор сценария")
+		return
+	}
+
+	selectedScenario := scenarioNames[scenarioChoice-1]
+	scenarioObj := scenarios[selectedScenario]
+
+	// Кадр с движением проверяется блокировками линии; сценарий с ошибками
+	// анализа отправляем только после подтверждения
+	if !confirmSend(scenarioObj) {
+		return
+	}
+
+	// Проверяем, есть ли у сценария сырые данные
+	var scenarioData []byte
+	if len(scenarioObj.RawData) > 0 {
+		scenarioData = scenarioObj.RawData
+	} else {
+		fmt.Println("Ошибка: у сценария отсутствуют данные для отправки")
+		return
+	}
+
+	// Пока оператор отвечал на вопросы, могла сработать аварийная остановка
+	if sender.EmergencyActive() {
+		fmt.Println(sender.ErrEmergencyStop)
+		return
+	}
+
+	// Блокировки проверяются еще раз и линия занимается до конца отправки
+	reservation, err := interlock.Reserve(int(scenarioObj.PulseType), scenarioObj)
+	if err != nil {
+		fmt.Printf("БЛОКИРОВКА: %v\n", err)
+		return
+	}
+	sent := false
+	defer func() { reservation.Done(sent) }()
+
 	fmt.Printf("Попытка подключения к %s со скоростью %d бод...\n", portName, baudRate)
 
+	// Не допускаем параллельной отправки на тот же контроллер (например, из автоотправки).
+	// Порт занимается только на время обмена, не на время вопросов оператору
+	unlock := sender.LockPort(portName)
+	defer unlock()
+
 	// Открываем COM порт
 	handle, err := comport.OpenPort(portName)
 	if err != nil {
@@ -41,7 +107,7 @@ func SendScenario(scenarios map[string]models.Scenario) {
 	defer comport.ClosePort(handle)
 
 	// Установка параметров порта
-	err = comport.SetCommParams(handle, baudRate)
+	err = comport.Configure(handle, sender.LineSettings(portName, baudRate))
 	if err != nil {
 		fmt.Printf("Ошибка установки параметров: %v\n", err)
 		return
@@ -80,46 +146,18 @@ func SendScenario(scenarios map[string]models.Scenario) {
 	time.Sleep(time.Millisecond * 500)
 	comport.PurgeComm(handle)
 
-	// Выбор сценария для отправки
-	fmt.Println("Доступные сценарии:")
-	var scenarioNames []string
-	i := 1
-	for name := range scenarios {
-		fmt.Printf("%d. %s\n", i, name)
-		scenarioNames = append(scenarioNames, name)
-		i++
-	}
-
-	if len(scenarioNames) == 0 {
-		fmt.Println("Нет доступных сценариев для отправки")
-		return
-	}
-
-	fmt.Print("Выберите номер сценария для отправки: ")
-	var scenarioChoice int
-	fmt.Scanln(&scenarioChoice)
-
-	if scenarioChoice < 1 || scenarioChoice > len(scenarioNames) {
-		fmt.Println("Неверный выбор сценария")
-		return
-	}
-
-	selectedScenario := scenarioNames[scenarioChoice-1]
-	scenarioObj := scenarios[selectedScenario]
-
-	// Проверяем, есть ли у сценария сырые данные
-	var scenarioData []byte
-	if len(scenarioObj.RawData) > 0 {
-		scenarioData = scenarioObj.RawData
-	} else {
-		fmt.Println("Ошибка: у сценария отсутствуют данные для отправки")
+	// Остановка во время инициализации: кадр не отправляем
+	if sender.EmergencyActive() {
+		fmt.Println(sender.ErrEmergencyStop)
 		return
 	}
 
+	lane := int(scenarioObj.PulseType)
 	fmt.Printf("Отправка сценария '%s'...\n", selectedScenario)
-	n, err := comport.WritePort(handle, scenarioData)
-	if err != nil {
-		fmt.Printf("Ошибка отправки сценария: %v\n", err)
+	sent = true
+	n, sendErr := comport.WritePort(handle, scenarioData)
+	if sendErr != nil {
+		fmt.Printf("Ошибка отправки сценария: %v\n", sendErr)
 	} else {
 		fmt.Printf("Отправлено %d байт\n", n)
 		fmt.Println("Сценарий успешно отправлен")
@@ -134,22 +172,31 @@ func SendScenario(scenarios map[string]models.Scenario) {
 
 	// Ожидаем ответа от устройства
 	fmt.Println("Ожидание ответа...")
+	var reply []byte
 	for i := 0; i < 10; i++ {
 		n, err := comport.ReadPort(handle, buffer)
 		if err != nil {
 			// Игнорируем ошибки чтения
 		} else if n > 0 {
 			fmt.Printf("Получен ответ (%d байт): % X\n", n, buffer[:n])
+			reply = append(reply, buffer[:n]...)
 			break
 		}
 		time.Sleep(time.Millisecond * 100)
 	}
+	audit.Record(audit.NewEntry(audit.SourceMenu, lane, portName, baudRate, selectedScenario,
+		scenarioData, initPacket, reply, sendErr))
 
 	fmt.Println("Закрытие порта...")
 }
 
 // DebugSendScenario отправляет сценарий с расширенной отладкой
 func DebugSendScenario(scenarios map[string]models.Scenario) {
+	if sender.EmergencyActive() {
+		fmt.Println(sender.ErrEmergencyStop)
+		return
+	}
+
 	fmt.Println("\nОтладочная отправка сценария")
 	fmt.Println("==========================")
 
@@ -186,15 +233,13 @@ func DebugSendScenario(scenarios map[string]models.Scenario) {
 	}
 
 	selectedScenario := workingScenarioNames[choice-1]
+	if !confirmSend(scenarios[selectedScenario]) {
+		return
+	}
 
 	// Выбор порта
-	portName := "COM4" // По умолчанию COM4
-	fmt.Print("Введите имя порта (по умолчанию COM4): ")
+	portName := comport.PromptPort("COM4")
 	var input string
-	fmt.Scanln(&input)
-	if input != "" {
-		portName = input
-	}
 
 	// Выбор скорости
 	baudRate := uint32(4800) // По умолчанию 4800 бод
@@ -208,8 +253,26 @@ func DebugSendScenario(scenarios map[string]models.Scenario) {
 		}
 	}
 
+	// Пока оператор отвечал на вопросы, могла сработать аварийная остановка
+	if sender.EmergencyActive() {
+		fmt.Println(sender.ErrEmergencyStop)
+		return
+	}
+
+	// Блокировки проверяются еще раз и линия занимается до конца отправки
+	reservation, err := interlock.Reserve(int(scenarios[selectedScenario].PulseType), scenarios[selectedScenario])
+	if err != nil {
+		fmt.Printf("БЛОКИРОВКА: %v\n", err)
+		return
+	}
+	sent := false
+	defer func() { reservation.Done(sent) }()
+
 	// Открываем COM порт
 	fmt.Printf("Попытка подключения к %s со скоростью %d бод...\n", portName, baudRate)
+	unlock := sender.LockPort(portName)
+	defer unlock()
+
 	handle, err := comport.OpenPort(portName)
 	if err != nil {
 		fmt.Printf("Ошибка открытия порта: %v\n", err)
@@ -218,7 +281,7 @@ func DebugSendScenario(scenarios map[string]models.Scenario) {
 	defer comport.ClosePort(handle)
 
 	// Установка параметров порта
-	err = comport.SetCommParams(handle, baudRate)
+	err = comport.Configure(handle, sender.LineSettings(portName, baudRate))
 	if err != nil {
 		fmt.Printf("Ошибка установки параметров: %v\n", err)
 		return
@@ -260,6 +323,7 @@ func DebugSendScenario(scenarios map[string]models.Scenario) {
 		{0x7E, 0xAA},
 	}
 
+	var handshake []byte
 	for i, packet := range initPackets {
 		fmt.Printf("Отправка инициализационного пакета %d: % X\n", i+1, packet)
 		_, err = comport.WritePort(handle, packet)
@@ -267,6 +331,7 @@ func DebugSendScenario(scenarios map[string]models.Scenario) {
 			fmt.Printf("Ошибка отправки инициализационного пакета: %v\n", err)
 			continue
 		}
+		handshake = append(handshake, packet...)
 
 		// Ожидаем ответа
 		fmt.Println("Ожидание ответа...")
@@ -283,16 +348,25 @@ func DebugSendScenario(scenarios map[string]models.Scenario) {
 		time.Sleep(time.Millisecond * 500)
 	}
 
+	// Остановка во время инициализации: кадр не отправляем
+	if sender.EmergencyActive() {
+		fmt.Println(sender.ErrEmergencyStop)
+		return
+	}
+
 	// Получаем данные сценария
-	scenarioData := scenarios[selectedScenario].RawData
+	scenarioObj := scenarios[selectedScenario]
+	scenarioData := scenarioObj.RawData
+	lane := int(scenarioObj.PulseType)
 
 	fmt.Printf("Отправка оригинального сценария '%s'...\n", selectedScenario)
 	fmt.Printf("Данные сценария (%d байт): % X\n", len(scenarioData), scenarioData)
 
 	// Отправляем сценарий
-	n, err := comport.WritePort(handle, scenarioData)
-	if err != nil {
-		fmt.Printf("Ошибка отправки сценария: %v\n", err)
+	sent = true
+	n, sendErr := comport.WritePort(handle, scenarioData)
+	if sendErr != nil {
+		fmt.Printf("Ошибка отправки сценария: %v\n", sendErr)
 	} else {
 		fmt.Printf("Отправлено %d байт\n", n)
 		fmt.Println("Сценарий успешно отправлен")
@@ -300,13 +374,52 @@ func DebugSendScenario(scenarios map[string]models.Scenario) {
 
 	// Ожидаем ответа от устройства
 	fmt.Println("Ожидание ответа (увеличенное время)...")
+	var reply []byte
 	for i := 0; i < 30; i++ { // 3 секунды ожидания
 		n, _ := comport.ReadPort(handle, buffer)
 		if n > 0 {
 			fmt.Printf("Получен ответ (%d байт): % X\n", n, buffer[:n])
+			reply = append(reply, buffer[:n]...)
 		}
 		time.Sleep(time.Millisecond * 100)
 	}
+	audit.Record(audit.NewEntry(audit.SourceDebug, lane, portName, baudRate, selectedScenario,
+		scenarioData, handshake, reply, sendErr))
 
 	fmt.Println("Закрытие порта...")
 }
+
+// confirmSend проверяет блокировки линии (линия определяется типом пульта кадра)
+// и результаты анализа сценария
+func confirmSend(scenario models.Scenario) bool {
+	if err := interlock.Check(int(scenario.PulseType), scenario); err != nil {
+		fmt.Printf("БЛОКИРОВКА: %v\n", err)
+		return false
+	}
+	return confirmLint(scenario)
+}
+
+// confirmLint проверяет сценарий анализатором. При ошибках отправка возможна
+// только после явного подтверждения оператора
+func confirmLint(scenario models.Scenario) bool {
+	findings := lint.Filter(lint.Check(scenario), lint.Warning)
+	if len(findings) == 0 {
+		return true
+	}
+
+	fmt.Printf("Результаты проверки сценария '%s':\n", scenario.Name)
+	lint.Print(findings)
+
+	if !lint.HasErrors(findings) {
+		return true
+	}
+
+	fmt.Print("Сценарий содержит ошибки. Отправить принудительно? (да/нет): ")
+	var confirm string
+	fmt.Scanln(&confirm)
+	if confirm != "да" && confirm != "д" && confirm != "yes" && confirm != "y" {
+		fmt.Println("Отправка отменена")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"tir/models"
+	"tir/sim"
+)
+
+// SimulateScenario показывает временную шкалу сценария: положение, поворот
+// и подсветку мишени, общую длительность; по запросу выгружает шкалу в CSV
+func SimulateScenario(scenarios map[string]models.Scenario) {
+	fmt.Println("\nСимуляция сценария")
+	fmt.Println("==================")
+
+	scanner := bufio.NewScanner(os.Stdin)
+
+	fmt.Print("Введите имя сценария: ")
+	scanner.Scan()
+	name := strings.TrimSpace(scanner.Text())
+	scenario, exists := scenarios[name]
+	if !exists {
+		fmt.Printf("Сценарий '%s' не найден\n", name)
+		return
+	}
+
+	// Калибровка сохраняется до конца работы программы
+	fmt.Printf("Скорость на единицу параметра скорости, см/с (сейчас %.2f; Enter - без изменений): ",
+		sim.DefaultCalibration.CMPerSecondPerUnit)
+	scanner.Scan()
+	if input := strings.TrimSpace(scanner.Text()); input != "" {
+		value, err := strconv.ParseFloat(strings.Replace(input, ",", ".", 1), 64)
+		if err != nil || value <= 0 {
+			fmt.Println("Неверное значение, калибровка не изменена")
+		} else {
+			sim.DefaultCalibration.CMPerSecondPerUnit = value
+		}
+	}
+
+	timeline, err := sim.Simulate(scenario, sim.DefaultCalibration)
+	if err != nil {
+		fmt.Printf("Ошибка симуляции: %v\n", err)
+		return
+	}
+
+	fmt.Print("Вид: 1 - таблица, 2 - график (по умолчанию 1): ")
+	scanner.Scan()
+	fmt.Println()
+	if strings.TrimSpace(scanner.Text()) == "2" {
+		sim.PrintChart(os.Stdout, timeline, 50)
+		fmt.Printf("Общая длительность: %s\n", sim.FormatDuration(timeline.Duration))
+	} else {
+		sim.PrintTable(os.Stdout, timeline)
+	}
+	for _, warning := range timeline.Warnings {
+		fmt.Printf("Предупреждение: %s\n", warning)
+	}
+
+	fmt.Print("Файл для выгрузки в CSV (Enter - не выгружать): ")
+	scanner.Scan()
+	fileName := strings.TrimSpace(scanner.Text())
+	if fileName == "" {
+		return
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		fmt.Printf("Ошибка создания файла: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	if err := sim.WriteCSV(file, timeline); err != nil {
+		fmt.Printf("Ошибка записи CSV: %v\n", err)
+		return
+	}
+	fmt.Printf("Временная шкала сохранена в %s\n", fileName)
+}
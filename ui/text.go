@@ -0,0 +1,80 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"tir/dsl"
+	"tir/models"
+)
+
+// ScenarioText показывает сценарий в текстовом формате, выгружает его в файл
+// или загружает сценарий из текстового файла
+func ScenarioText(scenarios map[string]models.Scenario) {
+	fmt.Println("\nСценарий в текстовом формате")
+	fmt.Println("============================")
+	fmt.Println("1. Показать сценарий")
+	fmt.Println("2. Выгрузить сценарий в файл")
+	fmt.Println("3. Загрузить сценарий из файла")
+	fmt.Println("0. Назад")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	fmt.Print("Выберите действие: ")
+	scanner.Scan()
+	choice := strings.TrimSpace(scanner.Text())
+
+	switch choice {
+	case "1", "2":
+		fmt.Print("Введите имя сценария: ")
+		scanner.Scan()
+		name := strings.TrimSpace(scanner.Text())
+		scenario, exists := scenarios[name]
+		if !exists {
+			fmt.Printf("Сценарий '%s' не найден\n", name)
+			return
+		}
+		scenario.Name = name
+
+		if choice == "1" {
+			text, err := dsl.Format(scenario)
+			if err != nil {
+				fmt.Printf("Ошибка: %v\n", err)
+				return
+			}
+			fmt.Println()
+			fmt.Print(text)
+			return
+		}
+
+		fileName := dsl.FileNameFor(name)
+		fmt.Printf("Введите имя файла (по умолчанию '%s'): ", fileName)
+		scanner.Scan()
+		if input := strings.TrimSpace(scanner.Text()); input != "" {
+			fileName = input
+		}
+		if err := dsl.WriteFile(fileName, scenario); err != nil {
+			fmt.Printf("Ошибка записи файла: %v\n", err)
+			return
+		}
+		fmt.Printf("Сценарий записан в %s\n", fileName)
+
+	case "3":
+		fmt.Print("Введите имя файла: ")
+		scanner.Scan()
+		scenario, err := dsl.ParseFile(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			fmt.Printf("Ошибка: %v\n", err)
+			return
+		}
+		if errs := models.ValidateScenario(scenario); len(errs) > 0 {
+			fmt.Printf("Предупреждение: %v\n", errs[0])
+		}
+		if _, exists := scenarios[scenario.Name]; exists {
+			fmt.Printf("Сценарий '%s' заменен\n", scenario.Name)
+		}
+		scenarios[scenario.Name] = scenario
+		fmt.Printf("Сценарий '%s' загружен (%d команд, %d байт)\n",
+			scenario.Name, len(scenario.Commands), len(scenario.RawData))
+	}
+}